@@ -53,7 +53,7 @@ func TestCmdOutput(t *testing.T) {
 
 // TestEnvironmentExists executes the command "cloud-platform environment create" with an answers file and asserts an outcome.
 func TestEnvironmentCreateE2E(t *testing.T) {
-	_, err := cmd.ExecuteCommand(t, "environment", "create", "--skip-env-check", "--answers-file", "testdata/environments-answers.yaml", "--skip-version-check")
+	_, err := cmd.ExecuteCommand(t, "environment", "create", "--skip-env-check", "--answers-file", "testdata/environments-answers-valid.yaml", "--skip-version-check")
 	if err != nil {
 		t.Errorf("error executing command: %s", err)
 	}
@@ -71,7 +71,7 @@ func testEnvironmentExists(t *testing.T) error {
 	t.Helper()
 
 	// Check file path exists
-	if err := checkFilePath(t, "namespaces/live.cloud-platform.service.justice.gov.uk/testNamespace/00-namespace.yaml"); err != nil {
+	if err := checkFilePath(t, "namespaces/live.cloud-platform.service.justice.gov.uk/test-namespace/00-namespace.yaml"); err != nil {
 		return err
 	}
 
@@ -2,8 +2,11 @@ package commands
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	environment "github.com/ministryofjustice/cloud-platform-cli/pkg/environment"
 	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
@@ -20,20 +23,78 @@ var (
 	optFlags              environment.Options
 )
 
-// skipEnvCheck is a flag to skip the environments repository check.
-// This is useful for testing.
-var skipEnvCheck bool
+// createNamespaceOpts are the flags of environment create, SkipEnvCheck skips the environments
+// repository check, which is useful for testing.
+var createNamespaceOpts environment.CreateNamespaceOptions
 
-// answersFile is a flag to specify the path to the answers file.
-var answersFile string
+// prototypeCheckOpts are the flags of environment prototype create.
+var prototypeCheckOpts environment.NamespaceCheckOptions
+
+// addResourceOpts are the flags of environment add.
+var addResourceOpts environment.AddResourceOptions
+
+// namespaceValidateOpts are the flags of environment validate.
+var namespaceValidateOpts environment.NamespaceValidateOptions
+
+// expiredOpts and expiredOutput are the flags of environment expired.
+var (
+	expiredOpts   environment.ExpiredNamespacesOptions
+	expiredOutput string
+)
+
+// migrateOpts, migrateDNSWeight and migrateKubeconfig are the flags of environment migrate.
+var (
+	migrateOpts       environment.MigrateOptions
+	migrateDNSWeight  int
+	migrateKubeconfig string
+)
+
+// describeOpts are the flags of environment describe.
+var describeOpts environment.NamespaceDescribeOptions
+
+// rdsCreateOpts are the flags of environment rds create.
+var rdsCreateOpts environment.RdsOptions
+
+// printAnswersSchema is a flag to print the JSON schema of the answers file instead of
+// creating a namespace.
+var printAnswersSchema bool
+
+// rdsDriftFromAws is a flag to make the rds-drift-checker compare the environments repository
+// against the versions running in AWS instead of reading a CSV of apply errors.
+var rdsDriftFromAws bool
+
+var rdsDriftOpts environment.RdsDriftCheckerOptions
+
+// templateOpts are the flags choosing where the commands generating environment files read
+// their templates from, instead of the templates embedded in the cli.
+var templateOpts environment.TemplateOptions
 
 var clusterName, githubToken string
 
+// variables used to store the values of the changelog sub command flags
+var (
+	changelogFrom, changelogTo, changelogOutput string
+	changelogGithubToken                        string
+	changelogSince                              time.Duration
+	changelogMaxPRs                             int
+)
+
+// variables used to store the values of the modules sub command flags
+var (
+	modulesOpts                          environment.ModuleInventoryOptions
+	modulesOutput, modulesLatestVersions string
+	modulesGithubReleases                bool
+	modulesGithubToken                   string
+	moduleUpgradeOpts                    environment.ModuleUpgradeOptions
+)
+
 func addEnvironmentCmd(topLevel *cobra.Command) {
 	topLevel.AddCommand(environmentCmd)
 	envSubCommands := []*cobra.Command{
+		environmentAddCmd,
 		environmentApplyCmd,
 		environmentBumpModuleCmd,
+		environmentChangelogCmd,
 		environmentCreateCmd,
 		environmentDestroyCmd,
 		environmentDivergenceCmd,
@@ -45,6 +106,11 @@ func addEnvironmentCmd(topLevel *cobra.Command) {
 		environmentSvcCmd,
 		environmentRdsDriftCheckerCmd,
 		environmentNamespaceTagsCmd,
+		environmentModulesCmd,
+		environmentValidateCmd,
+		environmentExpiredCmd,
+		environmentMigrateCmd,
+		environmentDescribeCmd,
 	}
 
 	for _, cmd := range envSubCommands {
@@ -56,6 +122,7 @@ func addEnvironmentCmd(topLevel *cobra.Command) {
 	environmentS3Cmd.AddCommand(environmentS3CreateCmd)
 	environmentSvcCmd.AddCommand(environmentSvcCreateCmd)
 	environmentPrototypeCmd.AddCommand(environmentPrototypeCreateCmd)
+	environmentModulesCmd.AddCommand(environmentModulesUpgradeCmd)
 
 	// flags
 	environmentApplyCmd.Flags().BoolVar(&optFlags.AllNamespaces, "all-namespaces", false, "Apply all namespaces with -all-namespaces")
@@ -72,12 +139,64 @@ func addEnvironmentCmd(topLevel *cobra.Command) {
 	environmentApplyCmd.PersistentFlags().BoolVar(&optFlags.RedactedEnv, "redact", true, "Redact the terraform output before printing")
 	environmentApplyCmd.Flags().StringVar(&optFlags.BuildUrl, "build-url", "", "The concourse apply build url")
 	environmentApplyCmd.Flags().BoolVar(&optFlags.IsApplyPipeline, "is-apply-pipeline", false, "is this running in the apply pipelines")
+	environmentApplyCmd.Flags().StringVar(&optFlags.FailureCatalogue, "failure-catalogue", "", "YAML file of known apply failures to classify a failed apply with, instead of the built in catalogue")
 
 	environmentBumpModuleCmd.Flags().StringVarP(&module, "module", "m", "", "Module to upgrade the version")
 	environmentBumpModuleCmd.Flags().StringVarP(&moduleVersion, "module-version", "v", "", "Semantic version to bump a module to")
+	environmentBumpModuleCmd.Flags().StringVar(&bumpModuleOpts.From, "from", "", "Only bump modules whose current version meets this semver constraint e.g. \">=7.0 <8\"")
+	environmentBumpModuleCmd.Flags().BoolVar(&bumpModuleOpts.AllowMajor, "allow-major", false, "Allow bumping modules to a different major version")
+	environmentBumpModuleCmd.Flags().BoolVar(&bumpModuleOpts.DryRun, "dry-run", false, "Print a diff of each file that would change without writing it")
+
+	environmentChangelogCmd.Flags().StringVar(&changelogFrom, "from", "", "Start of the time window in RFC3339 format e.g. 2024-01-02T15:04:05Z")
+	environmentChangelogCmd.Flags().StringVar(&changelogTo, "to", "", "End of the time window in RFC3339 format, defaults to now")
+	environmentChangelogCmd.Flags().DurationVar(&changelogSince, "since", time.Hour, "Length of the time window ending at --to, used when --from is not set e.g. 2h")
+	environmentChangelogCmd.Flags().StringVarP(&changelogOutput, "output", "o", "table", "Output format: table or json")
+	environmentChangelogCmd.Flags().IntVar(&changelogMaxPRs, "max-prs", 100, "Maximum number of merged PRs to fetch in one search, up to 100. Windows with more are searched in smaller windows")
+	environmentChangelogCmd.Flags().StringVar(&changelogGithubToken, "github-token", os.Getenv("TF_VAR_github_token"), "Personal access Token from Github ")
+
+	environmentModulesCmd.Flags().StringVarP(&modulesOutput, "output", "o", "table", "Output format: table or json")
+	environmentModulesCmd.Flags().StringVarP(&modulesOpts.Module, "module", "m", "", "Only list this module e.g. serviceaccount or github.com/ministryofjustice/cloud-platform-terraform-serviceaccount")
+	environmentModulesCmd.Flags().StringVar(&modulesOpts.Constraint, "version", "", "Only list modules pinned to a version meeting this semver constraint e.g. \"<2\"")
+	environmentModulesCmd.Flags().StringVar(&modulesLatestVersions, "latest-versions", "", "YAML or JSON file of module: latest version pairs to compare the pinned versions with")
+	environmentModulesCmd.Flags().BoolVar(&modulesGithubReleases, "github-releases", false, "Compare the pinned versions with the latest Github release of each module")
+	environmentModulesCmd.Flags().BoolVar(&modulesOpts.Outdated, "outdated", false, "Only list modules behind the latest version, requires --latest-versions or --github-releases")
+	environmentModulesCmd.Flags().IntVar(&modulesOpts.MinorsBehind, "behind", 2, "With --outdated, only list modules at least this many minor versions behind, or a major version behind, 0 lists any module behind the latest version")
+	environmentModulesCmd.Flags().StringVar(&modulesGithubToken, "github-token", os.Getenv("TF_VAR_github_token"), "Personal access Token from Github ")
+
+	environmentModulesUpgradeCmd.Flags().StringVarP(&moduleUpgradeOpts.Module, "module", "m", "", "Module to upgrade e.g. serviceaccount or github.com/ministryofjustice/cloud-platform-terraform-serviceaccount")
+	environmentModulesUpgradeCmd.Flags().StringVar(&moduleUpgradeOpts.Version, "module-version", "", "Semantic version to upgrade the module to")
+	environmentModulesUpgradeCmd.Flags().StringVar(&moduleUpgradeOpts.From, "from", "", "Only upgrade modules whose current version meets this semver constraint e.g. \">=7.0 <8\"")
+	environmentModulesUpgradeCmd.Flags().BoolVar(&moduleUpgradeOpts.AllowMajor, "allow-major", false, "Allow upgrading modules to a different major version")
+	environmentModulesUpgradeCmd.Flags().BoolVar(&moduleUpgradeOpts.DryRun, "dry-run", false, "Print the PR each namespace would get without changing any files or raising PRs")
+	environmentModulesUpgradeCmd.Flags().StringVarP(&moduleUpgradeOpts.Namespace, "namespace", "n", "", "Only upgrade this namespace")
+	environmentModulesUpgradeCmd.Flags().StringVar(&moduleUpgradeOpts.Team, "team", "", "Only upgrade the namespaces this Github team has access to")
+	environmentModulesUpgradeCmd.Flags().IntVar(&moduleUpgradeOpts.Limit, "limit", 0, "Maximum number of PRs to raise, 0 for no limit")
+	environmentModulesUpgradeCmd.Flags().StringVar(&moduleUpgradeOpts.GithubToken, "github-token", os.Getenv("TF_VAR_github_token"), "Personal access Token from Github ")
+
+	environmentCreateCmd.Flags().BoolVarP(&createNamespaceOpts.SkipEnvCheck, "skip-env-check", "s", false, "Skip the environment check")
+	environmentCreateCmd.Flags().StringVarP(&createNamespaceOpts.AnswersFile, "answers-file", "a", "", "Path to the answers file")
+	environmentCreateCmd.Flags().StringArrayVar(&createNamespaceOpts.Set, "set", []string{}, "Set an answer as key=value, can be repeated and overrides the answers file")
+	environmentCreateCmd.Flags().BoolVar(&printAnswersSchema, "print-answers-schema", false, "Print the JSON schema of the answers file and exit")
+	addNamespaceCheckFlags(environmentCreateCmd, &createNamespaceOpts.NamespaceCheckOptions)
+	addNamespaceCheckFlags(environmentPrototypeCreateCmd, &prototypeCheckOpts)
+	environmentCreateCmd.Flags().StringVar(&createNamespaceOpts.GithubToken, "github-token", os.Getenv("TF_VAR_github_token"), "Personal access Token from Github, used to check the github team and source code repository exist")
+	environmentCreateCmd.Flags().BoolVar(&createNamespaceOpts.OpenPR, "open-pr", false, "Commit the namespace and its .checksum to a branch named after it, push it and raise a PR")
 
-	environmentCreateCmd.Flags().BoolVarP(&skipEnvCheck, "skip-env-check", "s", false, "Skip the environment check")
-	environmentCreateCmd.Flags().StringVarP(&answersFile, "answers-file", "a", "", "Path to the answers file")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.Engine, "engine", "", "Engine of the database: postgresql, mysql or mssql, the other values aren't asked for when set")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.ModuleName, "module-name", "", "Name of the terraform module, by default rds_<engine> numbered to be unique")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.EngineVersion, "engine-version", "", "Engine version, by default the example's")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.InstanceClass, "instance-class", "", "Instance class, e.g. db.t4g.small, by default the example's")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.Storage, "storage", "", "Allocated storage in GiB, by default the example's")
+	environmentRdsCreateCmd.Flags().StringVar(&rdsCreateOpts.DBName, "db-name", "", "Name of the database, by default the module picks one")
+	environmentRdsCreateCmd.Flags().BoolVar(&rdsCreateOpts.ReadReplica, "read-replica", false, "Add a read replica of the instance")
+
+	environmentAddCmd.Flags().StringVar(&addResourceOpts.Name, "name", "", "Name of the terraform module, by default the example's numbered to be unique")
+	environmentAddCmd.Flags().StringArrayVar(&addResourceOpts.Set, "set", []string{}, "Set a variable as variable=value, can be repeated, the other variables aren't asked for when set")
+	environmentAddCmd.Flags().BoolVar(&addResourceOpts.Defaults, "defaults", false, "Use the example's values without asking for them")
+
+	for _, cmd := range []*cobra.Command{environmentAddCmd, environmentCreateCmd, environmentEcrCreateCmd, environmentRdsCreateCmd, environmentS3CreateCmd, environmentSvcCreateCmd, environmentPrototypeCreateCmd} {
+		addTemplateFlags(cmd)
+	}
 
 	// e.g. if this is the Pull request to perform the apply: https://github.com/ministryofjustice/cloud-platform-environments/pull/8370, the pr ID is 8370.
 	environmentDestroyCmd.Flags().IntVar(&optFlags.PRNumber, "pr-number", 0, "Pull request ID or number to which you want to perform the destroy")
@@ -109,8 +228,78 @@ func addEnvironmentCmd(topLevel *cobra.Command) {
 	environmentPlanCmd.Flags().StringVar(&optFlags.ClusterDir, "clusterdir", "", "folder name under namespaces/ inside cloud-platform-environments repo referring to full cluster name")
 	environmentPlanCmd.PersistentFlags().BoolVar(&optFlags.RedactedEnv, "redact", true, "Redact the terraform output before printing")
 
-	environmentNamespaceTagsCmd.Flags().StringSliceVarP(&optFlags.Namespaces, "namespaces", "n", []string{}, "Comma separated list of namespaces to add default tags to")
-	environmentNamespaceTagsCmd.Flags().StringVarP(&optFlags.RepoPath, "repo-path", "r", "", "Local Path to the cloud-platform-environments repository")
+	environmentRdsDriftCheckerCmd.Flags().BoolVar(&rdsDriftFromAws, "from-aws", false, "Compare every rds module in the environments repository with the engine version running in AWS instead of reading a CSV")
+	environmentRdsDriftCheckerCmd.Flags().BoolVar(&rdsDriftOpts.DryRun, "dry-run", false, "Print the planned version changes per namespace and module without changing any files")
+	environmentRdsDriftCheckerCmd.Flags().StringVar(&rdsDriftOpts.PatchDir, "output-patch", "", "Write a unified diff per namespace to this directory instead of pushing branches and raising PRs")
+
+	environmentNamespaceTagsCmd.Flags().StringSliceVarP(&namespaceTagsOpts.Namespaces, "namespaces", "n", []string{}, "Comma separated list of namespaces to add default tags to")
+	environmentNamespaceTagsCmd.Flags().StringVarP(&namespaceTagsOpts.RepoPath, "repo-path", "r", "", "Local Path to the cloud-platform-environments repository")
+	environmentNamespaceTagsCmd.Flags().StringVar(&namespaceTagsOpts.ClusterDir, "clusterdir", "", "folder name under namespaces/ inside cloud-platform-environments repo referring to full cluster name")
+	environmentNamespaceTagsCmd.Flags().BoolVar(&namespaceTagsOpts.All, "all", false, "Check every namespace with terraform in the --clusterdir folder, or in the whole repository without --clusterdir")
+	environmentNamespaceTagsCmd.Flags().BoolVar(&namespaceTagsOpts.Check, "check", false, "Report the missing tags without changing any files, exiting non-zero if any are missing")
+	environmentNamespaceTagsCmd.Flags().BoolVarP(&namespaceTagsOpts.Yes, "yes", "y", false, "Add the missing tags without asking for confirmation")
+	environmentNamespaceTagsCmd.Flags().BoolVar(&namespaceTagsOpts.FixMetadata, "fix-metadata", false, "Also change the variables the tags are set from to match the namespace's 00-namespace.yaml")
+	environmentNamespaceTagsCmd.Flags().StringVarP(&namespaceTagsOpts.Output, "output", "o", "text", "Output format: text or json")
+
+	environmentValidateCmd.Flags().BoolVar(&namespaceValidateOpts.SkipTerraform, "skip-terraform", false, "Don't run terraform validate, which needs terraform and downloads the namespace's providers and modules")
+	environmentValidateCmd.Flags().StringVarP(&namespaceValidateOpts.Output, "output", "o", "text", "Output format: text or json")
+
+	environmentExpiredCmd.Flags().StringVarP(&expiredOpts.RepoPath, "repo-path", "r", ".", "Local Path to the cloud-platform-environments repository")
+	environmentExpiredCmd.Flags().StringVar(&expiredOpts.ClusterDir, "clusterdir", "", "folder name under namespaces/ inside cloud-platform-environments repo referring to full cluster name")
+	environmentExpiredCmd.Flags().StringVarP(&expiredOutput, "output", "o", "table", "Output format of the list of expired namespaces: table or json")
+	environmentExpiredCmd.Flags().BoolVar(&expiredOpts.RaisePRs, "raise-prs", false, "Raise a PR deleting each expired namespace whose is-production label is false, and tell its team on slack")
+	environmentExpiredCmd.Flags().BoolVar(&expiredOpts.DryRun, "dry-run", false, "With --raise-prs, print the PR each namespace would get without changing any files or raising PRs")
+	environmentExpiredCmd.Flags().IntVar(&expiredOpts.Limit, "limit", 0, "Maximum number of PRs to raise, 0 for no limit")
+	environmentExpiredCmd.Flags().StringVar(&expiredOpts.GithubToken, "github-token", os.Getenv("TF_VAR_github_token"), "Personal access Token from Github ")
+	environmentExpiredCmd.Flags().StringVar(&expiredOpts.SlackWebhookUrl, "slack-webhook-url", os.Getenv("SLACK_WEBHOOK_URL"), "Slack webhook to post to the teams' channels with, they aren't told if it isn't set")
+
+	environmentMigrateCmd.Flags().StringVar(&migrateOpts.To, "to", "", "Cluster to move the namespace to: live or live-2")
+	environmentMigrateCmd.Flags().StringVarP(&migrateOpts.RepoPath, "repo-path", "r", ".", "Local Path to the cloud-platform-environments repository")
+	environmentMigrateCmd.Flags().BoolVar(&migrateOpts.DryRun, "dry-run", false, "Print the files which would be rewritten and the migration steps without changing any files")
+	environmentMigrateCmd.Flags().BoolVar(&migrateOpts.MoveState, "move-state", false, "Copy the namespace's terraform state to the new cluster's key, which needs terraform and access to the state bucket")
+	environmentMigrateCmd.Flags().StringVar(&migrateOpts.Backend.Bucket, "state-bucket", getenvDefault("PIPELINE_STATE_BUCKET", "cloud-platform-terraform-state"), "State bucket where the environments state is stored")
+	environmentMigrateCmd.Flags().StringVar(&migrateOpts.Backend.KeyPrefix, "state-key-prefix", getenvDefault("PIPELINE_STATE_KEY_PREFIX", "cloud-platform-environments/"), "State key/ folder where the environments terraform state is stored")
+	environmentMigrateCmd.Flags().StringVar(&migrateOpts.Backend.Region, "state-region", getenvDefault("PIPELINE_STATE_REGION", "eu-west-1"), "State region of the bucket")
+	environmentMigrateCmd.Flags().IntVar(&migrateDNSWeight, "dns-weight", -1, "Only set the aws-weight of the namespace's ingresses in the current cluster of --kubecfg, from 0 to 255")
+	environmentMigrateCmd.Flags().StringVar(&migrateKubeconfig, "kubecfg", filepath.Join(homedir.HomeDir(), ".kube", "config"), "path to kubeconfig file, used with --dns-weight")
+
+	environmentDescribeCmd.Flags().StringVarP(&describeOpts.RepoPath, "repo-path", "r", ".", "Local Path to the cloud-platform-environments repository")
+	environmentDescribeCmd.Flags().StringVar(&describeOpts.ClusterDir, "clusterdir", "", "folder name under namespaces/ to find the namespace in, if it's in more than one")
+	environmentDescribeCmd.Flags().StringVar(&describeOpts.Kubeconfig, "kubecfg", filepath.Join(homedir.HomeDir(), ".kube", "config"), "path to kubeconfig file")
+	environmentDescribeCmd.Flags().BoolVar(&describeOpts.SkipCluster, "skip-cluster", false, "Only describe the namespace's folder, without asking the cluster")
+	environmentDescribeCmd.Flags().StringVarP(&describeOpts.Output, "output", "o", "table", "Output format: table or json")
+}
+
+// getenvDefault returns the value of an environment variable, or def if it isn't set.
+func getenvDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// addNamespaceCheckFlags adds the flags of the check that a new namespace's name isn't taken.
+func addNamespaceCheckFlags(cmd *cobra.Command, opt *environment.NamespaceCheckOptions) {
+	cmd.Flags().BoolVar(&opt.Force, "force", false, "Create the namespace even if its name clashes with an existing namespace")
+	cmd.Flags().StringVar(&opt.Kubeconfig, "kubecfg", "", "Path to a kubeconfig file, to also check the namespaces of its current cluster")
+}
+
+// addTemplateFlags adds the flags choosing where a command reads its templates from.
+func addTemplateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&templateOpts.Dir, "template-dir", "", "Read the templates from this folder, laid out as <repository>/<path>, instead of the templates embedded in the cli")
+	cmd.Flags().StringVar(&templateOpts.Ref, "template-ref", "", "Download the templates from this branch, tag or commit of their repository instead of using the templates embedded in the cli, which are still used if Github can't be reached")
+	cmd.MarkFlagsMutuallyExclusive("template-dir", "template-ref")
+}
+
+// withTemplates sets where the templates are read from, from the template flags, before running
+// the command.
+func withTemplates(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := environment.UseTemplates(templateOpts); err != nil {
+			return err
+		}
+		return run(cmd, args)
+	}
 }
 
 var environmentCmd = &cobra.Command{
@@ -122,13 +311,55 @@ var environmentCmd = &cobra.Command{
 var environmentCreateCmd = &cobra.Command{
 	Use:   "create",
 	Short: `Create an environment`,
+	Long: heredoc.Doc(`
+	Create the files of a new namespace in the cloud-platform-environments repository.
+
+	You are asked for each of the namespace's values, unless they are given with --answers-file
+	and/or --set, in which case every required value must be given. Both ways are validated the
+	same way, and every missing or invalid value is reported.
+
+	The name is refused if a namespace of the same name exists in any cluster folder, or the
+	cluster of --kubecfg, or if it's a prototype's name followed by a dash, as a prototype serves
+	each branch at <namespace>-<branch>.apps.<domain>, unless --force is given.
+
+	With a github token the github team and source code repository are checked to exist, with
+	close matches suggested when they don't. Without one, or when github can't be reached, only
+	their format is checked.
+
+	With --open-pr the namespace folder and the .checksum file are committed to a new branch from
+	main, named after the namespace, which is pushed to origin and raised as a PR describing the
+	namespace, its owning team and business unit. This needs a github token.
+
+	The keys of the answers file, and of --set, are described by its JSON schema, see
+	--print-answers-schema. It is published at:
+
+	  ` + environment.AnswersSchemaUrl + `
+	`),
 	Example: heredoc.Doc(`
 	> cloud-platform environment create
+
+	# create a namespace without prompts, from an answers file with one value changed
+	> cloud-platform environment create --answers-file answers.yaml --set namespace=myapp-staging
+
+	# create a namespace and raise its PR in one step
+	> cloud-platform environment create --answers-file answers.yaml --open-pr
+
+	# generate the files from a branch of cloud-platform-environments instead of the embedded templates
+	> cloud-platform environment create --template-ref my-template-change
 	`),
 	PreRun: upgradeIfNotLatest,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		return environment.CreateTemplateNamespace(skipEnvCheck, answersFile)
-	},
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
+		if printAnswersSchema {
+			schema, err := environment.AnswersSchema()
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(schema)
+			return err
+		}
+
+		return environment.CreateTemplateNamespace(createNamespaceOpts)
+	}),
 }
 
 var environmentEcrCmd = &cobra.Command{
@@ -303,7 +534,7 @@ var environmentEcrCreateCmd = &cobra.Command{
 	Use:    "create",
 	Short:  `Create "resources/ecr.tf" terraform file for an ECR`,
 	PreRun: upgradeIfNotLatest,
-	RunE:   environment.CreateTemplateEcr,
+	RunE:   withTemplates(environment.CreateTemplateEcr),
 }
 
 var environmentRdsCmd = &cobra.Command{
@@ -316,10 +547,28 @@ var environmentRdsCmd = &cobra.Command{
 }
 
 var environmentRdsCreateCmd = &cobra.Command{
-	Use:    "create",
-	Short:  `Create "resources/rds.tf" terraform file for an RDS instance`,
+	Use:   "create",
+	Short: `Create a terraform file in "resources/" for an RDS instance`,
+	Long: heredoc.Doc(`
+	Create a terraform file in "resources/" for an RDS instance, from the rds-instance module's
+	example for the engine.
+
+	Without --engine you are asked for each value, otherwise the values not given as flags are
+	the example's. The module is named rds_<engine>, or rds_<engine>_2 and so on if that's taken,
+	unless --module-name is given, and its secret and file are named after it. Every value, and
+	that the names aren't already used in the namespace's .tf files, is checked before the file
+	is written.
+	`),
+	Example: heredoc.Doc(`
+	> cloud-platform environment rds create
+
+	# a postgres 16 database with a read replica, without prompts
+	> cloud-platform environment rds create --engine postgresql --engine-version 16 --instance-class db.t4g.small --storage 50 --db-name app --read-replica
+	`),
 	PreRun: upgradeIfNotLatest,
-	RunE:   environment.CreateTemplateRds,
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
+		return environment.CreateTemplateRds(rdsCreateOpts)
+	}),
 }
 
 var environmentS3Cmd = &cobra.Command{
@@ -335,7 +584,7 @@ var environmentS3CreateCmd = &cobra.Command{
 	Use:    "create",
 	Short:  `Create "resources/s3.tf" terraform file for a S3 bucket`,
 	PreRun: upgradeIfNotLatest,
-	RunE:   environment.CreateTemplateS3,
+	RunE:   withTemplates(environment.CreateTemplateS3),
 }
 
 var environmentSvcCmd = &cobra.Command{
@@ -354,15 +603,206 @@ var environmentSvcCreateCmd = &cobra.Command{
 	> cloud-platform environment serviceaccount create
 	`),
 	PreRun: upgradeIfNotLatest,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
 		if err := environment.CreateTemplateServiceAccount(); err != nil {
 			return err
 		}
 
 		return nil
+	}),
+}
+
+var environmentAddCmd = &cobra.Command{
+	Use:   "add <kind>",
+	Short: `Add a resource from the Cloud Platform module catalogue to a namespace`,
+	Long: heredoc.Doc(`
+	Add a resource to a namespace, generating its terraform file in "resources/" from the example
+	of its Cloud Platform terraform module.
+
+	You are asked for the values of the kind's variables, defaulting to the example's, unless
+	--set or --defaults are given. The module is named as in the example, with a number appended
+	if that's taken, unless --name is given, and its secret and file are named after it. Every
+	value, and that none of the names are already used in the namespace, is checked before the
+	file is written.
+
+	Kinds:
+	`) + resourceKindsHelp(),
+	Example: heredoc.Doc(`
+	> cloud-platform environment add elasticache
+
+	# an SQS queue, without prompts
+	> cloud-platform environment add sqs --name orders_queue --set sqs_name=orders
+	`),
+	Args:   cobra.ExactArgs(1),
+	PreRun: upgradeIfNotLatest,
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
+		return environment.AddResource(args[0], addResourceOpts)
+	}),
+}
+
+var environmentValidateCmd = &cobra.Command{
+	Use:   "validate [namespace folder...]",
+	Short: `Check a namespace folder for problems before raising a PR`,
+	Long: heredoc.Doc(`
+	Checks namespace folders, the current folder if none are given, for the problems the pipeline
+	would otherwise find when it plans them:
+
+	  - the labels and annotations 00-namespace.yaml needs, and that its name matches the folder
+	  - the rbac, limitrange, resourcequota and networkpolicy files exist
+	  - the terraform in resources/ is formatted, as terraform fmt would, and passes terraform validate
+	  - the .checksum environment create writes still matches the namespace, if it's for this namespace
+
+	terraform validate runs on a copy of resources/, so nothing is added to the namespace, but it
+	needs terraform and has to download the providers and modules. If it can't be run that's a
+	warning, and --skip-terraform skips it.
+
+	It exits non-zero if any namespace has errors, so it can be run in a pre-commit hook.
+	`),
+	Example: heredoc.Doc(`
+	> cloud-platform environment validate namespaces/live.cloud-platform.service.justice.gov.uk/myapp-dev
+
+	# from the namespace folder, without terraform validate, with a json report
+	> cloud-platform environment validate --skip-terraform -o json
+	`),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespaceValidateOpts.Dirs = args
+		return environment.ValidateNamespaces(namespaceValidateOpts)
+	},
+}
+
+var environmentExpiredCmd = &cobra.Command{
+	Use:   "expired",
+	Short: `List the namespaces whose review-after date has passed, and raise PRs deleting them`,
+	Long: heredoc.Doc(`
+	Lists the namespaces whose cloud-platform.justice.gov.uk/review-after annotation is before today,
+	with their owner, slack channel and whether they're production. Sandbox namespaces get a review-after
+	date three months after they're created.
+
+	With --raise-prs a PR deleting each expired namespace is raised, its Github teams are asked to review it
+	and its team is told in its slack channel. A namespace with terraform resources first gets a PR deleting
+	them, leaving the files which configure its providers, so the pipeline can destroy them. Run it again
+	once that's merged to raise the PR deleting the namespace. Only namespaces whose is-production label is
+	"false" are deleted, production namespaces and those with a missing or mistyped label are skipped, as
+	are namespaces which already have an open deletion PR.
+	`),
+	Example: heredoc.Doc(`
+	> cloud-platform environment expired --clusterdir live.cloud-platform.service.justice.gov.uk
+
+	Print the PRs which would be raised:
+	> cloud-platform environment expired --raise-prs --dry-run
+
+	Raise up to 10 deletion PRs:
+	> cloud-platform environment expired --raise-prs --limit 10
+	`),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !expiredOpts.RaisePRs {
+			if expiredOpts.DryRun {
+				return errors.New("--dry-run needs --raise-prs")
+			}
+			expired, err := environment.ExpiredNamespaces(expiredOpts)
+			if err != nil {
+				return err
+			}
+			return environment.PrintExpiredNamespaces(os.Stdout, expired, expiredOutput)
+		}
+
+		if expiredOpts.GithubToken == "" && !expiredOpts.DryRun {
+			return errors.New("a github token is needed to raise PRs, set --github-token or TF_VAR_github_token")
+		}
+		ghConfig := &github.GithubClientConfig{
+			Repository: "cloud-platform-environments",
+			Owner:      "ministryofjustice",
+		}
+
+		return environment.DeleteExpiredNamespaces(github.NewGithubClient(ghConfig, expiredOpts.GithubToken), expiredOpts)
 	},
 }
 
+var environmentMigrateCmd = &cobra.Command{
+	Use:   "migrate <namespace>",
+	Short: `Move a namespace to another cluster`,
+	Long: heredoc.Doc(`
+	Moves a namespace's folder to the folder of another cluster, rewriting the references to the old
+	cluster's domain in its files, e.g. the ingress hosts under apps.live.cloud-platform.service.justice.gov.uk.
+
+	The namespace's terraform state is kept under a key for each cluster, so it has to be copied to the
+	new cluster's key before the pipeline applies the moved folder. The terraform commands which do that
+	are printed, and --move-state runs them. A checklist of the rest of the migration is printed last.
+
+	Traffic is moved between the clusters with weighted DNS records: each ingress needs an
+	external-dns.alpha.kubernetes.io/set-identifier annotation unique to its cluster, and --dns-weight
+	sets the external-dns.alpha.kubernetes.io/aws-weight of the namespace's ingresses in the current
+	cluster of --kubecfg, without moving anything.
+	`),
+	Example: heredoc.Doc(`
+	Print what would change:
+	> cloud-platform environment migrate my-namespace --to live-2 --dry-run
+
+	Move the namespace and its terraform state:
+	> cloud-platform environment migrate my-namespace --to live-2 --move-state
+
+	Send all the traffic to the cluster of the kubeconfig:
+	> cloud-platform environment migrate my-namespace --to live-2 --dns-weight 100
+	`),
+	Args:   cobra.ExactArgs(1),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("dns-weight") {
+			return environment.SetNamespaceDNSWeight(args[0], migrateDNSWeight, migrateKubeconfig)
+		}
+		if migrateOpts.To == "" {
+			return errors.New("--to is required, the cluster to move the namespace to")
+		}
+		migrateOpts.Namespace = args[0]
+		return environment.MigrateNamespace(migrateOpts)
+	},
+}
+
+var environmentDescribeCmd = &cobra.Command{
+	Use:   "describe <namespace>",
+	Short: `Describe a namespace's configuration and its status in the cluster`,
+	Long: heredoc.Doc(`
+	Describes a namespace from its folder in the environments repository: its owner, team, business unit,
+	whether it's production and its review-after date, the terraform modules it uses with their versions,
+	and any APPLY_PIPELINE_SKIP_THIS_NAMESPACE or SECRET_ROTATE_BLOCK file stopping the pipeline applying it.
+
+	It also asks the current cluster of --kubecfg whether the namespace exists, how much of its resource
+	quotas it's using and which of its pods aren't ready. If the cluster can't be reached that's reported
+	with the rest of the description.
+	`),
+	Example: heredoc.Doc(`
+	> cloud-platform environment describe my-namespace
+
+	> cloud-platform environment describe my-namespace --skip-cluster -o json
+	`),
+	Args:   cobra.ExactArgs(1),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		describeOpts.Namespace = args[0]
+		d, err := environment.DescribeNamespace(describeOpts)
+		if err != nil {
+			return err
+		}
+		return environment.PrintNamespaceDescription(os.Stdout, d, describeOpts.Output)
+	},
+}
+
+// resourceKindsHelp lists the kinds of the module catalogue for environment add's help.
+func resourceKindsHelp() string {
+	kinds, err := environment.ResourceKinds()
+	if err != nil {
+		return "  " + err.Error() + "\n"
+	}
+
+	var b strings.Builder
+	for _, k := range kinds {
+		fmt.Fprintf(&b, "  %-15s %s\n", k.Kind, k.Description)
+	}
+	return b.String()
+}
+
 var environmentPrototypeCmd = &cobra.Command{
 	Use:   "prototype",
 	Short: `Create a gov.uk prototype kit site on the cloud platform`,
@@ -387,15 +827,17 @@ The namespace name should be your prototype github repository name:
 	> cloud-platform environment prototype create
 	`),
 	PreRun: upgradeIfNotLatest,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := environment.CreateTemplatePrototype(); err != nil {
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
+		if err := environment.CreateTemplatePrototype(prototypeCheckOpts); err != nil {
 			return err
 		}
 
 		return nil
-	},
+	}),
 }
 
+var bumpModuleOpts environment.BumpModuleOptions
+
 var environmentBumpModuleCmd = &cobra.Command{
 	Use:   "bump-module",
 	Short: `Bump all specified module versions`,
@@ -403,6 +845,11 @@ var environmentBumpModuleCmd = &cobra.Command{
 cloud-platform environments bump-module --module serviceaccount --module-version 1.1.1
 
 Would bump all users serviceaccount modules in the environments repository to the specified version.
+The module is matched exactly on its source repository, so --module rds-instance doesn't bump rds-aurora.
+
+cloud-platform environments bump-module --module rds-instance --module-version 8.1.0 --from ">=7.0 <8" --allow-major --dry-run
+
+Would print a diff of every rds-instance module on a 7.x version being bumped to 8.1.0, without changing any files.
 	`),
 	PreRun: upgradeIfNotLatest,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -410,13 +857,137 @@ Would bump all users serviceaccount modules in the environments repository to th
 			return errors.New("--module and --module-version are required")
 		}
 
-		if err := environment.BumpModule(module, moduleVersion); err != nil {
+		bumpModuleOpts.Module = module
+		bumpModuleOpts.Version = moduleVersion
+		if err := environment.BumpModule(bumpModuleOpts); err != nil {
 			return err
 		}
 		return nil
 	},
 }
 
+var environmentModulesCmd = &cobra.Command{
+	Use:   "modules",
+	Short: `List the source and pinned version of every module used by the namespaces in the environments repository`,
+	Example: heredoc.Doc(`
+	List the namespaces still using version 1 of the serviceaccount module:
+	> cloud-platform environment modules --module serviceaccount --version "<2"
+
+	List every module at least 2 minor versions, or a major version, behind its latest Github release as json:
+	> cloud-platform environment modules --github-releases --outdated -o json
+
+	List every module behind its latest Github release, even by a patch:
+	> cloud-platform environment modules --github-releases --outdated --behind 0
+
+	Compare against a file of latest versions, e.g. rds-instance: 8.0.1
+	> cloud-platform environment modules --latest-versions latest.yaml --outdated
+	`),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if modulesOpts.Outdated && modulesLatestVersions == "" && !modulesGithubReleases {
+			return errors.New("--outdated needs --latest-versions or --github-releases")
+		}
+
+		usages, err := environment.ModuleInventory(".")
+		if err != nil {
+			return err
+		}
+
+		if modulesLatestVersions != "" {
+			latest, err := environment.LoadLatestModuleVersions(modulesLatestVersions)
+			if err != nil {
+				return err
+			}
+			environment.CompareModuleVersions(usages, latest)
+		} else if modulesGithubReleases {
+			gh := github.NewGithubClient(&github.GithubClientConfig{Owner: "ministryofjustice"}, modulesGithubToken)
+			environment.CompareModuleVersions(usages, environment.LatestModuleVersionsFromGithub(gh, usages))
+		}
+
+		usages, err = environment.FilterModuleUsages(usages, modulesOpts)
+		if err != nil {
+			return err
+		}
+
+		return environment.PrintModuleInventory(os.Stdout, usages, modulesOutput)
+	},
+}
+
+var environmentModulesUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: `Upgrade a module in each namespace using it, raising a PR per namespace`,
+	Example: heredoc.Doc(`
+	Raise a PR upgrading serviceaccount to 1.1.0 in each namespace of the webops team, with the
+	module's release notes in the description and the team asked to review it:
+	> cloud-platform environment modules upgrade --module serviceaccount --module-version 1.1.0 --team webops
+
+	Print the first 5 PRs an upgrade of rds-instance 7.x to 8.1.0 would raise:
+	> cloud-platform environment modules upgrade -m rds-instance --module-version 8.1.0 --from "<8" --allow-major --limit 5 --dry-run
+
+	Namespaces which already have an open module upgrade PR are skipped.
+	`),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if moduleUpgradeOpts.Module == "" || moduleUpgradeOpts.Version == "" {
+			return errors.New("--module and --module-version are required")
+		}
+
+		ghConfig := &github.GithubClientConfig{
+			Repository: "cloud-platform-environments",
+			Owner:      "ministryofjustice",
+		}
+
+		return environment.UpgradeModules(github.NewGithubClient(ghConfig, moduleUpgradeOpts.GithubToken), moduleUpgradeOpts)
+	},
+}
+
+var environmentChangelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: `List the PRs merged into the environments repository in a time window and the namespaces they changed`,
+	Example: heredoc.Doc(`
+	List everything merged in the last 2 hours:
+	> cloud-platform environment changelog --since 2h
+
+	List everything merged between two timestamps as json:
+	> cloud-platform environment changelog --from 2024-01-02T13:00:00Z --to 2024-01-02T15:00:00Z -o json
+	`),
+	PreRun: upgradeIfNotLatest,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to := time.Now().UTC()
+		if changelogTo != "" {
+			t, err := time.Parse(time.RFC3339, changelogTo)
+			if err != nil {
+				return fmt.Errorf("invalid --to timestamp: %w", err)
+			}
+			to = t
+		}
+
+		from := to.Add(-changelogSince)
+		if changelogFrom != "" {
+			t, err := time.Parse(time.RFC3339, changelogFrom)
+			if err != nil {
+				return fmt.Errorf("invalid --from timestamp: %w", err)
+			}
+			from = t
+		}
+
+		ghConfig := &github.GithubClientConfig{
+			Repository: "cloud-platform-environments",
+			Owner:      "ministryofjustice",
+		}
+
+		changelog := environment.NewChangelog(github.NewGithubClient(ghConfig, changelogGithubToken), from, to)
+		changelog.MaxPRs = changelogMaxPRs
+
+		entries, err := changelog.Entries()
+		if err != nil {
+			return err
+		}
+
+		return environment.PrintChangelog(os.Stdout, entries, changelogOutput)
+	},
+}
+
 var environmentDivergenceCmd = &cobra.Command{
 	Use:   "divergence",
 	Short: `Check for divergence between the environments repository and the cluster`,
@@ -454,32 +1025,91 @@ var environmentDivergenceCmd = &cobra.Command{
 }
 
 var environmentRdsDriftCheckerCmd = &cobra.Command{
-	Use:   "rds-drift-checker <file-location>",
-	Short: "Detect and correct RDS engine version drift from a CSV file in S3 or locally",
+	Use:   "rds-drift-checker [<file-location>]",
+	Short: "Detect and correct RDS, Aurora and ElastiCache engine version drift from a CSV file in S3, locally, on stdin or directly from AWS",
 	Example: heredoc.Doc(`
 		Run with a file from S3:
 		  cloud-platform environment rds-drift-checker s3://your-bucket/path/to/merged-rds-errored-namespaces.csv
 
 		Run with a local CSV file:
 		  cloud-platform environment rds-drift-checker file://path/to/merged-rds-errored-namespaces.csv
+
+		Run with the CSV on stdin:
+		  cat merged-rds-errored-namespaces.csv | cloud-platform environment rds-drift-checker -
+
+		Compare the environments repository with the versions running in AWS:
+		  cloud-platform environment rds-drift-checker --from-aws
+
+		Preview the changes without touching git, Github or Slack:
+		  cloud-platform environment rds-drift-checker --from-aws --dry-run
+		  cloud-platform environment rds-drift-checker file://errors.csv --output-patch ./patches
 	`),
-	Args:   cobra.ExactArgs(1),
+	Args:   cobra.MaximumNArgs(1),
 	PreRun: upgradeIfNotLatest,
-	RunE:   environment.RdsDriftChecker,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if rdsDriftOpts.DryRun && rdsDriftOpts.PatchDir != "" {
+			return errors.New("--dry-run and --output-patch can't be used together")
+		}
+
+		if rdsDriftFromAws {
+			if len(args) > 0 {
+				return errors.New("a file location can't be used with --from-aws")
+			}
+			return environment.RdsDriftCheckerFromAws(rdsDriftOpts)
+		}
+
+		if len(args) != 1 {
+			return errors.New("a file location is required unless --from-aws is set")
+		}
+		return environment.RdsDriftChecker(rdsDriftOpts, args[0])
+	},
 }
 
+var namespaceTagsOpts environment.NamespaceTagsOptions
+
 var environmentNamespaceTagsCmd = &cobra.Command{
 	Use:   "namespace-tags",
 	Short: `Manage mandatory tags in cloud-platform-environments namespace resource files for aws providers`,
+	Long: heredoc.Doc(`
+	Checks the aws providers of each namespace set the mandatory default tags, and adds the missing ones.
+
+	The tags are set from terraform variables such as var.business_unit, so the values of those variables are
+	also checked against the labels and annotations in the namespace's 00-namespace.yaml. Mismatched values are
+	only reported, unless --fix-metadata is given to correct them to match 00-namespace.yaml.
+	`),
 	Example: heredoc.Doc(`
 	> cloud-platform environment namespace-tags --namespaces namespace1,namespace2 --repo-path /path/to/cloud-platform-environments
+
+	Check every namespace in a cluster without changing anything, e.g. in CI, with a json report:
+	> cloud-platform environment namespace-tags --all --clusterdir live.cloud-platform.service.justice.gov.uk --check -o json -r .
+
+	Check every namespace in the repository:
+	> cloud-platform environment namespace-tags --all --check -r .
+
+	Add the missing tags without being asked to confirm:
+	> cloud-platform environment namespace-tags -n namespace1 -r . --yes
+
+	Add the missing tags and correct the tag values to match 00-namespace.yaml:
+	> cloud-platform environment namespace-tags -n namespace1 -r . --yes --fix-metadata
 	`),
 	PreRun: upgradeIfNotLatest,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(optFlags.Namespaces) == 0 || optFlags.RepoPath == "" {
-			return errors.New("at least one namespace must be provided using the [--namespaces/-n] flag and a valid [--repo-path/-r] to the cloud-platform-environments repository")
+		if namespaceTagsOpts.RepoPath == "" {
+			return errors.New("a valid [--repo-path/-r] to the cloud-platform-environments repository is required")
+		}
+		if namespaceTagsOpts.All == (len(namespaceTagsOpts.Namespaces) > 0) {
+			return errors.New("either provide namespaces using the [--namespaces/-n] flag or check every namespace with [--all]")
+		}
+		if namespaceTagsOpts.Check && namespaceTagsOpts.Yes {
+			return errors.New("--check and --yes can't be used together")
+		}
+		if namespaceTagsOpts.Check && namespaceTagsOpts.FixMetadata {
+			return errors.New("--check and --fix-metadata can't be used together")
+		}
+		if namespaceTagsOpts.Output == "json" && !namespaceTagsOpts.Check && !namespaceTagsOpts.Yes {
+			return errors.New("-o json needs --check or --yes, as the confirmation prompt would be mixed in with the report")
 		}
-		if err := environment.NamespaceTagging(optFlags); err != nil {
+		if err := environment.NamespaceTagging(namespaceTagsOpts); err != nil {
 			return err
 		}
 
@@ -13,6 +13,7 @@ func addPrototypeCmd(topLevel *cobra.Command) {
 	prototypeCmd.AddCommand(prototypeDeployCmd)
 	prototypeDeployCmd.AddCommand(prototypeDeployCreateCmd)
 	prototypeDeployCreateCmd.Flags().BoolVarP(&SkipDockerFiles, "skip-docker-files", "s", false, "Whether to skip the files required to build the docker image i.e Dockerfile, .dockerignore, start.sh")
+	addTemplateFlags(prototypeDeployCreateCmd)
 }
 
 var prototypeCmd = &cobra.Command{
@@ -44,11 +45,11 @@ that any changes to the branch are deployed to the cloud platform.
 	> cloud-platform prototype deploy
 	`),
 	PreRun: upgradeIfNotLatest,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withTemplates(func(cmd *cobra.Command, args []string) error {
 		if err := prototype.CreateDeploymentPrototype(SkipDockerFiles); err != nil {
 			return err
 		}
 
 		return nil
-	},
+	}),
 }
@@ -0,0 +1,283 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AnswersSchemaUrl is where the JSON schema of the answers file is published, for editors to
+// validate answers files against.
+const AnswersSchemaUrl = "https://raw.githubusercontent.com/ministryofjustice/cloud-platform-cli/main/schemas/environment-answers.schema.json"
+
+// answerRule validates an answer, the rules of the prompts' validators implement it.
+type answerRule interface {
+	validate(string) error
+}
+
+// namespaceAnswer is a value needed to create a namespace, by its key in an answers file or
+// --set. The rules are the ones the interactive prompts use, so every way of creating a
+// namespace is validated the same way.
+type namespaceAnswer struct {
+	key         string
+	description string
+	optional    bool
+	rule        answerRule
+	field       func(ns *Namespace) *string
+}
+
+var isProductionRule = &inListValidator{list: []string{"true", "false"}}
+
+var reviewAfterRule = &regexValidator{regex: `^\d{4}-\d{2}-\d{2}$`}
+
+var namespaceAnswers = []namespaceAnswer{
+	{
+		key:         "namespace",
+		description: "Name of the namespace, of the form <application>-<environment> e.g. myapp-dev",
+		rule:        namespaceNameRule,
+		field:       func(ns *Namespace) *string { return &ns.Namespace },
+	},
+	{
+		key:         "environment",
+		description: "Type of application environment the namespace is for e.g. development, staging, production",
+		rule:        lowercaseStringRule,
+		field:       func(ns *Namespace) *string { return &ns.Environment },
+	},
+	{
+		key:         "isProduction",
+		description: "Whether this is a production namespace",
+		rule:        isProductionRule,
+		field:       func(ns *Namespace) *string { return &ns.IsProduction },
+	},
+	{
+		key:         "reviewAfter",
+		description: "Date a sandbox namespace should be reviewed for deletion, YYYY-MM-DD",
+		optional:    true,
+		rule:        reviewAfterRule,
+		field:       func(ns *Namespace) *string { return &ns.ReviewAfter },
+	},
+	{
+		key:         "application",
+		description: "Name of the application or service e.g. Send money to a prisoner",
+		rule:        new(notEmptyValidator),
+		field:       func(ns *Namespace) *string { return &ns.Application },
+	},
+	{
+		key:         "githubTeam",
+		description: "Github team given admin access to the namespace, in lower-case with hyphens instead of spaces",
+		rule:        githubTeamNameRule,
+		field:       func(ns *Namespace) *string { return &ns.GithubTeam },
+	},
+	{
+		key:         "businessUnit",
+		description: "Part of the MoJ responsible for the service",
+		rule:        businessUnitRule,
+		field:       func(ns *Namespace) *string { return &ns.BusinessUnit },
+	},
+	{
+		key:         "slackChannel",
+		description: "Slack channel, without the '#', to contact the team on",
+		rule:        slackChannelRule,
+		field:       func(ns *Namespace) *string { return &ns.SlackChannel },
+	},
+	{
+		key:         "serviceArea",
+		description: "Full name of the service area the team is based in e.g. Hosting",
+		rule:        new(notEmptyValidator),
+		field:       func(ns *Namespace) *string { return &ns.ServiceArea },
+	},
+	{
+		key:         "infrastructureSupport",
+		description: "Email address of the team which owns the application, not a named individual's",
+		rule:        teamEmailRule,
+		field:       func(ns *Namespace) *string { return &ns.InfrastructureSupport },
+	},
+	{
+		key:         "sourceCode",
+		description: "Github repository URL of the application's source code",
+		rule:        githubUrlRule,
+		field:       func(ns *Namespace) *string { return &ns.SourceCode },
+	},
+	{
+		key:         "owner",
+		description: "Team in the organisation responsible for the application e.g. Sentence Planning",
+		rule:        new(notEmptyValidator),
+		field:       func(ns *Namespace) *string { return &ns.Owner },
+	},
+}
+
+// deprecatedAnswers are keys answers files used to have, which are still accepted so existing
+// files keep working, but ignored. The value is why they're no longer needed.
+var deprecatedAnswers = map[string]string{
+	"ownerEmail": "it's the same as infrastructureSupport",
+}
+
+// isDeprecatedAnswer warns when a deprecated answer is given, and reports whether it was one.
+func isDeprecatedAnswer(key string) bool {
+	reason, ok := deprecatedAnswers[key]
+	if ok {
+		log.Printf("Warning: the %s answer is deprecated and ignored, as %s", key, reason)
+	}
+	return ok
+}
+
+func findNamespaceAnswer(key string) (*namespaceAnswer, error) {
+	keys := make([]string, 0, len(namespaceAnswers))
+	for i, a := range namespaceAnswers {
+		if a.key == key {
+			return &namespaceAnswers[i], nil
+		}
+		keys = append(keys, a.key)
+	}
+
+	return nil, fmt.Errorf("unknown answer %q, expected one of: %s", key, strings.Join(keys, ", "))
+}
+
+// setAnswers sets answers given as key=value, e.g. from --set.
+func (ns *Namespace) setAnswers(set []string) error {
+	var errs []error
+	for _, s := range set {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("%q should be of the form key=value", s))
+			continue
+		}
+		if isDeprecatedAnswer(strings.TrimSpace(key)) {
+			continue
+		}
+		a, err := findNamespaceAnswer(strings.TrimSpace(key))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		*a.field(ns) = strings.TrimSpace(value)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (ns *Namespace) readAnswersFile(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	// values are read as any type, so e.g. isProduction: false doesn't need quoting
+	answers := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &answers); err != nil {
+		return fmt.Errorf("error parsing %s: %w", fileName, err)
+	}
+
+	var errs []error
+	for _, key := range sortedKeys(answers) {
+		if isDeprecatedAnswer(key) {
+			continue
+		}
+		a, err := findNamespaceAnswer(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if answers[key] != nil {
+			*a.field(ns) = strings.TrimSpace(fmt.Sprint(answers[key]))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error reading %s:\n%w", fileName, err)
+	}
+
+	return nil
+}
+
+// validate checks every answer, reporting all the missing and invalid ones by their key.
+func (ns *Namespace) validate() error {
+	var errs []error
+	for _, a := range namespaceAnswers {
+		value := *a.field(ns)
+		switch {
+		case value == "" && a.optional:
+			continue
+		case value == "":
+			errs = append(errs, fmt.Errorf("%s: a value is required", a.key))
+		default:
+			if err := a.rule.validate(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q %w", a.key, value, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid namespace values:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkGithub confirms the namespace's github team and source repository exist, reporting
+// them as validate does.
+func (ns *Namespace) checkGithub(lookup *githubLookup) error {
+	var errs []error
+	if err := lookup.checkTeam(ns.GithubTeam); err != nil {
+		errs = append(errs, fmt.Errorf("githubTeam: %w", err))
+	}
+	if err := lookup.checkRepository(ns.SourceCode); err != nil {
+		errs = append(errs, fmt.Errorf("sourceCode: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid namespace values:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// AnswersSchema returns the JSON schema of the answers file read by environment create.
+func AnswersSchema() ([]byte, error) {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, a := range namespaceAnswers {
+		p := map[string]interface{}{
+			"type":        "string",
+			"description": a.description,
+		}
+		switch r := a.rule.(type) {
+		case *regexValidator:
+			p["pattern"] = r.regex
+		case *inListValidator:
+			p["enum"] = r.list
+		case *notEmptyValidator:
+			p["minLength"] = 1
+		}
+		properties[a.key] = p
+
+		if !a.optional {
+			required = append(required, a.key)
+		}
+	}
+	for key, reason := range deprecatedAnswers {
+		properties[key] = map[string]interface{}{
+			"type":        "string",
+			"description": "Deprecated and ignored, as " + reason,
+			"deprecated":  true,
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  AnswersSchemaUrl,
+		"title":                "cloud-platform environment create answers file",
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,100 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validAnswers() []string {
+	return []string{
+		"namespace=myapp-dev",
+		"environment=development",
+		"isProduction=false",
+		"application=My App",
+		"githubTeam=webops",
+		"businessUnit=Platforms",
+		"slackChannel=cloud-platform",
+		"serviceArea=Hosting",
+		"infrastructureSupport=platforms@digital.justice.gov.uk",
+		"sourceCode=https://github.com/ministryofjustice/myapp",
+		"owner=Cloud Platform",
+	}
+}
+
+func TestValidateReportsEveryAnswer(t *testing.T) {
+	ns := &Namespace{}
+	assert.NoError(t, ns.setAnswers(validAnswers()))
+	assert.NoError(t, ns.validate())
+
+	ns.Namespace = "MyApp"
+	ns.ServiceArea = ""
+	ns.InfrastructureSupport = "someone"
+	ns.ReviewAfter = "next year"
+	err := ns.validate()
+	assert.ErrorContains(t, err, `namespace: "MyApp" must match: ^[a-z0-9\-]+$`)
+	assert.ErrorContains(t, err, "serviceArea: a value is required")
+	assert.ErrorContains(t, err, `infrastructureSupport: "someone" must match`)
+	assert.ErrorContains(t, err, `reviewAfter: "next year" must match`)
+	assert.NotContains(t, err.Error(), "githubTeam")
+}
+
+func TestSetAnswers(t *testing.T) {
+	ns := &Namespace{Namespace: "from-file"}
+	assert.NoError(t, ns.setAnswers([]string{"namespace=myapp-dev", "application = My=App "}))
+	assert.Equal(t, "myapp-dev", ns.Namespace)
+	assert.Equal(t, "My=App", ns.Application)
+
+	assert.NoError(t, ns.setAnswers([]string{"ownerEmail=someone@digital.justice.gov.uk"}), "deprecated answers are ignored")
+
+	err := ns.setAnswers([]string{"namespace", "team=webops"})
+	assert.ErrorContains(t, err, `"namespace" should be of the form key=value`)
+	assert.ErrorContains(t, err, `unknown answer "team", expected one of: namespace, environment`)
+}
+
+func TestReadAnswersFileErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "answers.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("isProduction: false\ngithubteam: webops\nteam: webops\n"), 0o644))
+
+	ns := &Namespace{}
+	err := ns.readAnswersFile(file)
+	assert.ErrorContains(t, err, `unknown answer "githubteam"`)
+	assert.ErrorContains(t, err, `unknown answer "team"`)
+	assert.Equal(t, "false", ns.IsProduction)
+}
+
+func TestCreateNamespaceWithInvalidAnswers(t *testing.T) {
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(t.TempDir(), "namespaces")
+
+	set := append(validAnswers(), "businessUnit=Somewhere", "sourceCode=")
+	err := CreateTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, Set: set})
+	assert.ErrorContains(t, err, "businessUnit: \"Somewhere\" must be in the list: HQ, HMPPS")
+	assert.ErrorContains(t, err, "sourceCode: a value is required")
+	assert.NoDirExists(t, namespaceBaseFolder)
+}
+
+func TestCreateNamespaceRejectsInvalidAnswersFile(t *testing.T) {
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(t.TempDir(), "namespaces")
+
+	// the answers file from before answers were validated, with ownerEmail which is deprecated
+	err := CreateTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, AnswersFile: "../../testdata/environments-answers.yaml"})
+	assert.ErrorContains(t, err, `namespace: "testNamespace" must match`)
+	assert.ErrorContains(t, err, `businessUnit: "testBusinessApp" must be in the list`)
+	assert.ErrorContains(t, err, `infrastructureSupport: "testSupport" must match`)
+	assert.ErrorContains(t, err, `reviewAfter: "testReview" must match`)
+	assert.NotContains(t, err.Error(), "ownerEmail")
+	assert.NoDirExists(t, namespaceBaseFolder)
+}
+
+func TestAnswersSchemaIsUpToDate(t *testing.T) {
+	schema, err := AnswersSchema()
+	assert.NoError(t, err)
+
+	published, err := os.ReadFile("../../schemas/environment-answers.schema.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(schema), string(published), "run: cloud-platform environment create --print-answers-schema > schemas/environment-answers.schema.json")
+}
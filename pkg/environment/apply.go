@@ -17,12 +17,13 @@ import (
 type Options struct {
 	Namespace, KubecfgPath, ClusterCtx, ClusterDir, GithubToken string
 	PRNumber                                                    int
-	BuildUrl, RepoPath                                          string
+	BuildUrl                                                    string
 	AllNamespaces                                               bool
 	EnableApplySkip, RedactedEnv, SkipProdDestroy               bool
 	BatchApplyIndex, BatchApplySize                             int
 	OnlySkipFileChanged, IsApplyPipeline                        bool
-	Namespaces                                                  []string
+	// FailureCatalogue is a file of known apply failures, used instead of the built in one.
+	FailureCatalogue string
 }
 
 // RequiredEnvVars is used to store values such as TF_VAR_ , github and pingdom tokens
@@ -47,11 +48,11 @@ type Apply struct {
 	GithubClient    github.GithubIface
 }
 
-func notifyUserApplyFailed(prNumberInt int, slackToken, webhookUrl, buildUrl string) {
+func notifyUserApplyFailed(prNumberInt int, slackToken, webhookUrl, buildUrl, cataloguePath string, applyErr error) {
 	if prNumberInt > 0 && strings.Contains(buildUrl, "http") {
 		prNumber := fmt.Sprintf("%d", prNumberInt)
 
-		slackErr := slack.Notify(prNumber, slackToken, webhookUrl, buildUrl)
+		slackErr := slack.Notify(prNumber, slackToken, webhookUrl, buildUrl, failureHint(cataloguePath, applyErr))
 
 		if slackErr != nil {
 			fmt.Printf("Warning: Error notifying user of build error %v\n", slackErr)
@@ -59,6 +60,24 @@ func notifyUserApplyFailed(prNumberInt int, slackToken, webhookUrl, buildUrl str
 	}
 }
 
+// failureHint classifies the apply error against the catalogue of known failures and describes
+// it for the user, or returns an empty string if it isn't a known failure.
+func failureHint(cataloguePath string, applyErr error) string {
+	catalogue, err := loadFailureCatalogue(cataloguePath)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return ""
+	}
+
+	classification := catalogue.classify(applyErr.Error())
+	if classification == nil {
+		return ""
+	}
+
+	log.Printf("Apply failure classified as %s, failing resource: %q", classification.Category, classification.Resource)
+	return classification.slackText()
+}
+
 // NewApply creates a new Apply object and populates its fields with values from options(which are flags),
 // instantiate Applier object which also checks and sets the Backend config variables to do terraform init,
 // RequiredEnvVars object which stores the values required for plan/apply of namespace
@@ -101,7 +120,7 @@ func (a *Apply) Apply() error {
 			a.Options.OnlySkipFileChanged = false
 
 			if len(repos) == 1 {
-				a.Options.OnlySkipFileChanged = strings.Contains(*repos[0].Filename, "APPLY_PIPELINE_SKIP_THIS_NAMESPACE")
+				a.Options.OnlySkipFileChanged = strings.Contains(*repos[0].Filename, applySkipFile)
 			}
 
 			if err != nil {
@@ -294,13 +313,20 @@ func (a *Apply) applyTerraform() (string, error) {
 	return outputTerraform, nil
 }
 
+const (
+	// secretBlockerFile in a namespace folder stops the pipeline applying it while its secrets
+	// are rotated.
+	secretBlockerFile = "SECRET_ROTATE_BLOCK"
+	// applySkipFile in a namespace folder stops the apply pipeline applying it.
+	applySkipFile = "APPLY_PIPELINE_SKIP_THIS_NAMESPACE"
+)
+
 // secretBlockerExists takes a filepath (usually a namespace name i.e. namespaces/live.../mynamespace)
 // and checks if the file SECRET_ROTATE_BLOCK exists.
 func secretBlockerExists(filePath string) bool {
 	// Check if the file contains a secret blocker
 	// If it doesn't, we do want to apply it
-	secretBlocker := "SECRET_ROTATE_BLOCK"
-	if _, err := os.Stat(filePath + "/" + secretBlocker); err == nil {
+	if _, err := os.Stat(filePath + "/" + secretBlockerFile); err == nil {
 		return true
 	}
 
@@ -311,8 +337,7 @@ func secretBlockerExists(filePath string) bool {
 // and checks if the file applySkipExists exists.
 func applySkipExists(filePath string) bool {
 	// Check if the file contains a apply skip, skip applying this namespace
-	applySkip := "APPLY_PIPELINE_SKIP_THIS_NAMESPACE"
-	if _, err := os.Stat(filePath + "/" + applySkip); err == nil {
+	if _, err := os.Stat(filePath + "/" + applySkipFile); err == nil {
 		return true
 	}
 
@@ -351,7 +376,7 @@ func (a *Apply) applyNamespace(namespace string) error {
 		outputKubectl, err := applier.applyKubectl()
 		if err != nil {
 			if !a.Options.OnlySkipFileChanged && !a.Options.IsApplyPipeline {
-				notifyUserApplyFailed(a.Options.PRNumber, applier.RequiredEnvVars.SlackBotToken, applier.RequiredEnvVars.SlackWebhookUrl, a.Options.BuildUrl)
+				notifyUserApplyFailed(a.Options.PRNumber, applier.RequiredEnvVars.SlackBotToken, applier.RequiredEnvVars.SlackWebhookUrl, a.Options.BuildUrl, a.Options.FailureCatalogue, err)
 			}
 			return err
 		}
@@ -372,7 +397,7 @@ func (a *Apply) applyNamespace(namespace string) error {
 		outputTerraform, err := applier.applyTerraform()
 		if err != nil {
 			if !a.Options.OnlySkipFileChanged && !a.Options.IsApplyPipeline {
-				notifyUserApplyFailed(a.Options.PRNumber, applier.RequiredEnvVars.SlackBotToken, applier.RequiredEnvVars.SlackWebhookUrl, a.Options.BuildUrl)
+				notifyUserApplyFailed(a.Options.PRNumber, applier.RequiredEnvVars.SlackBotToken, applier.RequiredEnvVars.SlackWebhookUrl, a.Options.BuildUrl, a.Options.FailureCatalogue, err)
 			}
 			return err
 		}
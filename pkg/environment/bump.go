@@ -2,76 +2,237 @@ package environment
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 )
 
+// BumpModuleOptions configures which modules BumpModule changes and how.
+type BumpModuleOptions struct {
+	// Module is the module repository, e.g. github.com/ministryofjustice/cloud-platform-terraform-rds-instance,
+	// its name, cloud-platform-terraform-rds-instance, or its name without the prefix, rds-instance.
+	Module string
+	// Version is the version to set in the ?ref= of the module source.
+	Version string
+	// From is a semver constraint, e.g. ">=7.0 <8", the current version has to meet to be bumped.
+	From string
+	// AllowMajor allows bumping to a different major version.
+	AllowMajor bool
+	// DryRun prints a diff of each file that would change instead of writing it.
+	DryRun bool
+}
+
+// moduleBump is a module source rewritten to a new version.
+type moduleBump struct {
+	File, Module, From, To string
+}
+
+// bumpedFile is a terraform file with the contents before and after its modules were bumped.
+type bumpedFile struct {
+	path          string
+	before, after []byte
+	bumps         []moduleBump
+	majorUpgrades []moduleBump
+}
+
 // BumpModule takes a module name, walks the environments repository and
-// changes the version of all modules with that name.
-func BumpModule(m, v string) error {
-	err := filepath.Walk("./", func(path string, info os.FileInfo, err error) error {
+// changes the version of all modules with that name. The modules terraform init downloaded into
+// .terraform folders are left alone.
+func BumpModule(opt BumpModuleOptions) error {
+	return bumpModules("./", opt, os.Stdout)
+}
+
+func bumpModules(root string, opt BumpModuleOptions, out io.Writer) error {
+	target, from, err := parseBumpVersions(opt)
+	if err != nil {
+		return err
+	}
+
+	var files []bumpedFile
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		// the modules terraform init downloaded aren't the repository's to change
+		if info.IsDir() && info.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) != ".tf" {
 			return nil
 		}
 
-		if filepath.Ext(path) == ".tf" {
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error reading file %s", err)
-			}
+		f, err := bumpFile(path, opt, target, from)
+		if err != nil {
+			return err
+		}
+		if len(f.bumps) > 0 {
+			files = append(files, *f)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// check every module before writing anything, so a refused major upgrade doesn't leave
+	// the repository half bumped
+	var majorUpgrades []string
+	for _, f := range files {
+		for _, b := range f.majorUpgrades {
+			majorUpgrades = append(majorUpgrades, fmt.Sprintf("%s: module.%s %s -> %s", b.File, b.Module, b.From, b.To))
+		}
+	}
+	if len(majorUpgrades) > 0 && !opt.AllowMajor {
+		return fmt.Errorf("refusing to change the major version of %d modules without --allow-major:\n  %s", len(majorUpgrades), strings.Join(majorUpgrades, "\n  "))
+	}
 
-			f, diags := hclwrite.ParseConfig(data, path, hcl.Pos{
-				Line:   1,
-				Column: 1,
-			})
+	for _, f := range files {
+		for _, b := range f.bumps {
+			fmt.Fprintf(out, "%s: module.%s %s -> %s\n", b.File, b.Module, b.From, b.To)
+		}
 
-			if diags.HasErrors() {
-				return fmt.Errorf("error getting TF resource: %s", diags)
+		if opt.DryRun {
+			if err := writeUnifiedDiff(out, f.path, f.before, f.after); err != nil {
+				return err
 			}
+			continue
+		}
+
+		if err := os.WriteFile(f.path, f.after, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintf(out, "No %s modules needed bumping to %s\n", opt.Module, opt.Version)
+	}
+
+	return nil
+}
+
+// bumpFile changes the ?ref= of every matching module in the file at path to target, in memory.
+func bumpFile(path string, opt BumpModuleOptions, target *version.Version, from version.Constraints) (*bumpedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s", err)
+	}
 
-			// Grab slice of blocks in HCL file.
-			blocks := f.Body().Blocks()
+	f, diags := hclwrite.ParseConfig(data, path, hcl.Pos{
+		Line:   1,
+		Column: 1,
+	})
 
-			for _, block := range blocks {
-				blockBody := block.Body()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("error getting TF resource: %s", diags)
+	}
 
-				if blockBody.Attributes()["source"] == nil {
-					continue
-				}
-				expr := blockBody.Attributes()["source"].Expr()
-				exprTokens := expr.BuildTokens(nil)
+	bumped := &bumpedFile{path: path, before: data}
+	for _, block := range f.Body().Blocks() {
+		blockSource := moduleSource(block)
+		if blockSource == "" || !isModuleRepository(moduleRepository(blockSource), opt.Module) {
+			continue
+		}
 
-				var valueTokens hclwrite.Tokens
-				valueTokens = append(valueTokens, exprTokens...)
+		name := block.Labels()[0]
+		ref := moduleSourceRef(blockSource)
+		current, err := version.NewVersion(ref)
+		if err != nil {
+			log.Printf("Skipping module.%s in %s: ref %q isn't a semantic version", name, path, ref)
+			continue
+		}
 
-				blockSource := strings.TrimSpace(string(valueTokens.Bytes()))
+		if from != nil && !from.Check(current) {
+			continue
+		}
+		if current.Equal(target) {
+			continue
+		}
 
-				if strings.Contains(blockSource, m) {
-					src := strings.SplitAfter(blockSource, "=")
-					s := strings.Split(src[0], "\"")
-					val := s[1] + v
+		newRef := target.Original()
+		if strings.HasPrefix(ref, "v") && !strings.HasPrefix(newRef, "v") {
+			newRef = "v" + newRef
+		}
 
-					blockBody.SetAttributeValue("source", cty.StringVal(val))
-				}
-				err = os.WriteFile(path, f.Bytes(), 0o644)
-				if err != nil {
-					return err
-				}
-			}
+		b := moduleBump{File: path, Module: name, From: ref, To: newRef}
+		if current.Segments()[0] != target.Segments()[0] {
+			bumped.majorUpgrades = append(bumped.majorUpgrades, b)
 		}
-		return nil
-	})
-	if err != nil {
-		return err
+
+		block.Body().SetAttributeValue("source", cty.StringVal(setModuleSourceRef(blockSource, newRef)))
+		bumped.bumps = append(bumped.bumps, b)
 	}
 
-	return nil
+	bumped.after = f.Bytes()
+	return bumped, nil
+}
+
+// moduleSource returns the source of a module block, or an empty string if the block isn't a module.
+func moduleSource(block *hclwrite.Block) string {
+	source := block.Body().GetAttribute("source")
+	if block.Type() != "module" || source == nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(string(source.Expr().BuildTokens(nil).Bytes())), `"`)
+}
+
+// isModuleRepository reports whether repo, as returned by moduleRepository, is the module
+// the user asked for. The name has to match exactly, so rds doesn't match rds-aurora.
+func isModuleRepository(repo, module string) bool {
+	module = strings.TrimSuffix(module, ".git")
+	name := path.Base(repo)
+	return repo == moduleRepository(module) || name == module || name == "cloud-platform-terraform-"+module
+}
+
+// moduleSourceRef returns the value of the ref query parameter of a module source.
+func moduleSourceRef(source string) string {
+	_, query, _ := strings.Cut(source, "?")
+	for _, param := range strings.Split(query, "&") {
+		if ref, ok := strings.CutPrefix(param, "ref="); ok {
+			return ref
+		}
+	}
+	return ""
+}
+
+// setModuleSourceRef replaces the ref query parameter of a module source, keeping any other parameters.
+func setModuleSourceRef(source, ref string) string {
+	base, query, _ := strings.Cut(source, "?")
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if strings.HasPrefix(param, "ref=") {
+			params[i] = "ref=" + ref
+		}
+	}
+
+	return base + "?" + strings.Join(params, "&")
+}
+
+// parseVersionConstraint parses a constraint such as ">=7.0 <8" or ">= 7.0, < 8".
+// go-version needs the constraints separated by commas, so space separated ones are joined.
+func parseVersionConstraint(constraint string) (version.Constraints, error) {
+	var parts []string
+	operator := ""
+	for _, field := range strings.Fields(strings.ReplaceAll(constraint, ",", " ")) {
+		if strings.Trim(field, "<>=!~") == "" {
+			operator += field
+			continue
+		}
+		parts = append(parts, operator+field)
+		operator = ""
+	}
+
+	c, err := version.NewConstraint(strings.Join(parts, ","))
+	if err != nil || operator != "" {
+		return nil, fmt.Errorf("invalid version constraint %q", constraint)
+	}
+	return c, nil
 }
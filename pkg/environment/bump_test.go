@@ -2,69 +2,158 @@ package environment
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
-func TestBumpModule(t *testing.T) {
-	type args struct {
-		moduleName   string
-		newVersion   string
-		checkVersion string
-		file         os.File
-	}
+const bumpTestModules = `module "rds" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=7.2.0"
+}
+
+module "aurora" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-aurora?ref=7.2.0"
+}
+
+module "old_rds" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=6.0.1"
+}
 
+module "branch_rds" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=my-branch"
+}
+`
+
+func TestBumpModule(t *testing.T) {
 	tests := []struct {
 		name        string
-		args        args
-		wantErr     bool
-		wantSuccess bool
+		opt         BumpModuleOptions
+		wantErr     string
+		wantSources []string
 	}{
 		{
-			name: "Correctly bump a module version",
-			args: args{
-				moduleName:   "test",
-				newVersion:   "0.1.2",
-				checkVersion: "0.1.2",
-				file:         createTestFile(),
+			name: "bump only the exact module repository within the constraint",
+			opt:  BumpModuleOptions{Module: "rds-instance", Version: "7.3.0", From: ">=7.0 <8"},
+			wantSources: []string{
+				"cloud-platform-terraform-rds-instance?ref=7.3.0",
+				"cloud-platform-terraform-rds-aurora?ref=7.2.0",
+				"cloud-platform-terraform-rds-instance?ref=6.0.1",
+				"cloud-platform-terraform-rds-instance?ref=my-branch",
+			},
+		},
+		{
+			name: "match the full repository url",
+			opt:  BumpModuleOptions{Module: "github.com/ministryofjustice/cloud-platform-terraform-rds-aurora", Version: "7.3.0"},
+			wantSources: []string{
+				"cloud-platform-terraform-rds-instance?ref=7.2.0",
+				"cloud-platform-terraform-rds-aurora?ref=7.3.0",
+			},
+		},
+		{
+			name:    "refuse a major version change",
+			opt:     BumpModuleOptions{Module: "rds-instance", Version: "7.3.0"},
+			wantErr: "refusing to change the major version of 1 modules without --allow-major",
+			wantSources: []string{
+				"cloud-platform-terraform-rds-instance?ref=7.2.0",
+				"cloud-platform-terraform-rds-instance?ref=6.0.1",
 			},
-			wantErr:     false,
-			wantSuccess: true,
 		},
 		{
-			name: "Incorrectly bump a module version",
-			args: args{
-				moduleName:   "test",
-				newVersion:   "0.1.2",
-				checkVersion: "NOTHING",
-				file:         createTestFile(),
+			name: "allow a major version change",
+			opt:  BumpModuleOptions{Module: "rds-instance", Version: "7.3.0", AllowMajor: true},
+			wantSources: []string{
+				"cloud-platform-terraform-rds-instance?ref=7.3.0",
+				"cloud-platform-terraform-rds-instance?ref=my-branch",
 			},
-			wantErr:     false,
-			wantSuccess: false,
+		},
+		{
+			name:    "invalid constraint",
+			opt:     BumpModuleOptions{Module: "rds-instance", Version: "7.3.0", From: ">="},
+			wantErr: "invalid version constraint",
+		},
+		{
+			name:    "invalid version",
+			opt:     BumpModuleOptions{Module: "rds-instance", Version: "latest"},
+			wantErr: "invalid module version",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := BumpModule(tt.args.moduleName, tt.args.newVersion); (err != nil) != tt.wantErr {
-				t.Errorf("BumpModule() error = %v, wantErr %v", err, tt.wantErr)
+			dir := t.TempDir()
+			file := filepath.Join(dir, "main.tf")
+			assert.NoError(t, os.WriteFile(file, []byte(bumpTestModules), 0o644))
+
+			var out strings.Builder
+			err := bumpModules(dir, tt.opt, &out)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
 			}
 
-			if checkModuleChange(tt.args.checkVersion, tt.args.file.Name()) != tt.wantSuccess {
-				t.Errorf("BumpModule() checkSourceChange = %v, want %v", checkModuleChange(tt.args.checkVersion, tt.args.file.Name()), tt.wantSuccess)
+			for _, source := range tt.wantSources {
+				assert.True(t, checkModuleChange(source, file), "expected %s in %s", source, file)
 			}
-			defer os.Remove(tt.args.file.Name())
 		})
 	}
 }
 
-// createTestFile creates a test file with the given version.
-func createTestFile() os.File {
-	f, _ := os.Create("test.tf")
+func TestBumpModuleOnlyWritesChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "rds.tf")
+	unchanged := filepath.Join(dir, "other.tf")
+	assert.NoError(t, os.WriteFile(changed, []byte(bumpTestModules), 0o644))
+	// unusual formatting would be normalised if the file was rewritten
+	assert.NoError(t, os.WriteFile(unchanged, []byte("module   \"s3\"   {\n  source = \"github.com/ministryofjustice/cloud-platform-terraform-s3-bucket?ref=5.0.0\"\n}\n"), 0o644))
+	before, err := os.Stat(unchanged)
+	assert.NoError(t, err)
+
+	var out strings.Builder
+	assert.NoError(t, bumpModules(dir, BumpModuleOptions{Module: "rds-aurora", Version: "7.3.0"}, &out))
+
+	after, err := os.Stat(unchanged)
+	assert.NoError(t, err)
+	assert.Equal(t, before.ModTime(), after.ModTime())
+	assert.True(t, checkModuleChange("cloud-platform-terraform-rds-aurora?ref=7.3.0", changed))
+}
+
+func TestBumpModuleSkipsDotTerraform(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.tf")
+	downloaded := filepath.Join(dir, ".terraform", "modules", "aurora", "main.tf")
+	assert.NoError(t, os.WriteFile(file, []byte(bumpTestModules), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(downloaded), 0o755))
+	assert.NoError(t, os.WriteFile(downloaded, []byte(bumpTestModules), 0o644))
+
+	var out strings.Builder
+	assert.NoError(t, bumpModules(dir, BumpModuleOptions{Module: "rds-aurora", Version: "7.3.0"}, &out))
+
+	assert.True(t, checkModuleChange("cloud-platform-terraform-rds-aurora?ref=7.3.0", file))
+	assert.True(t, checkModuleChange("cloud-platform-terraform-rds-aurora?ref=7.2.0", downloaded))
+	assert.NotContains(t, out.String(), ".terraform")
+}
+
+func TestBumpModuleDryRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.tf")
+	assert.NoError(t, os.WriteFile(file, []byte(bumpTestModules), 0o644))
 
-	defer f.Close()
-	_, _ = f.WriteString("module test { source = \"test=1.0.0\" }")
+	var out strings.Builder
+	assert.NoError(t, bumpModules(dir, BumpModuleOptions{Module: "rds-aurora", Version: "7.3.0", DryRun: true}, &out))
+
+	assert.Contains(t, out.String(), file+": module.aurora 7.2.0 -> 7.3.0")
+	assert.Contains(t, out.String(), "--- a/"+filepath.ToSlash(file))
+	assert.Contains(t, out.String(), `-  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-aurora?ref=7.2.0"`)
+	assert.Contains(t, out.String(), `+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-aurora?ref=7.3.0"`)
+	assert.True(t, checkModuleChange("cloud-platform-terraform-rds-aurora?ref=7.2.0", file))
+}
 
-	return *f
+func TestSetModuleSourceRef(t *testing.T) {
+	assert.Equal(t, "git::https://github.com/org/repo.git//sub?depth=1&ref=v2.0.0", setModuleSourceRef("git::https://github.com/org/repo.git//sub?depth=1&ref=v1.0.0", "v2.0.0"))
+	assert.Equal(t, "v1.0.0", moduleSourceRef("git::https://github.com/org/repo.git//sub?depth=1&ref=v1.0.0"))
+	assert.Equal(t, "", moduleSourceRef("github.com/org/repo"))
 }
 
 // checkModuleChange checks if the file has been changed and contains
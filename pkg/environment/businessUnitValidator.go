@@ -1,20 +1,21 @@
 package environment
 
+var businessUnitRule = &inListValidator{
+	list: []string{
+		"HQ",
+		"HMPPS",
+		"OPG",
+		"LAA",
+		"Central Digital",
+		"Technology Services",
+		"HMCTS",
+		"CICA",
+		"Platforms",
+	},
+}
+
 type businessUnitValidator struct{}
 
 func (v *businessUnitValidator) isValid(s string) bool {
-	l := inListValidator{
-		list: []string{
-			"HQ",
-			"HMPPS",
-			"OPG",
-			"LAA",
-			"Central Digital",
-			"Technology Services",
-			"HMCTS",
-			"CICA",
-			"Platforms",
-		},
-	}
-	return l.isValid(s)
+	return businessUnitRule.isValid(s)
 }
@@ -0,0 +1,569 @@
+package environment
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v2"
+)
+
+// catalogueYaml describes the modules environment add can generate, see the comment at its top.
+//
+//go:embed catalogue.yaml
+var catalogueYaml []byte
+
+const resourcesDir = "resources/"
+
+var moduleNameRule = &regexValidator{regex: `^[a-z][a-z0-9_]*$`}
+
+// maxModuleNameAttempts is how many numbered names are tried for a resource before giving up, as
+// a template may generate something numbering doesn't rename, e.g. a resource with another label.
+const maxModuleNameAttempts = 100
+
+// varReference matches the variables referenced in a terraform file.
+var varReference = regexp.MustCompile(`\bvar\.([A-Za-z_][A-Za-z0-9_-]*)`)
+
+type catalogueKind struct {
+	Kind        string            `yaml:"kind"`
+	Description string            `yaml:"description"`
+	Module      string            `yaml:"module"`
+	Example     string            `yaml:"example"`
+	File        string            `yaml:"file"`
+	Generator   string            `yaml:"generator"`
+	Required    []string          `yaml:"required"`
+	Prompts     []cataloguePrompt `yaml:"prompts"`
+}
+
+type cataloguePrompt struct {
+	Variable    string `yaml:"variable"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Pattern     string `yaml:"pattern"`
+}
+
+// ResourceKind is a kind of resource environment add can generate.
+type ResourceKind struct {
+	Kind        string
+	Description string
+}
+
+// AddResourceOptions are the options of generating a resource from the catalogue.
+type AddResourceOptions struct {
+	// Name is the name of the module, by default the example's, with a number appended if
+	// that's taken. The module's secret and file are named after it.
+	Name string
+	// Set are variable=value answers to the kind's prompts. With any set, or Defaults, the user
+	// isn't prompted, and the example's values are used for the rest.
+	Set []string
+	// Defaults uses the example's values without prompting.
+	Defaults bool
+}
+
+func readCatalogue() ([]catalogueKind, error) {
+	var c struct {
+		Kinds []catalogueKind `yaml:"kinds"`
+	}
+	if err := yaml.UnmarshalStrict(catalogueYaml, &c); err != nil {
+		return nil, fmt.Errorf("error reading the module catalogue: %w", err)
+	}
+	return c.Kinds, nil
+}
+
+// ResourceKinds returns the kinds of resource in the catalogue.
+func ResourceKinds() ([]ResourceKind, error) {
+	kinds, err := readCatalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	var r []ResourceKind
+	for _, k := range kinds {
+		r = append(r, ResourceKind{Kind: k.Kind, Description: k.Description})
+	}
+	return r, nil
+}
+
+func findCatalogueKind(kind string) (*catalogueKind, error) {
+	kinds, err := readCatalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i, k := range kinds {
+		if k.Kind == kind {
+			return &kinds[i], nil
+		}
+		names = append(names, k.Kind)
+	}
+	return nil, fmt.Errorf("unknown kind %q, expected one of: %s", kind, strings.Join(names, ", "))
+}
+
+func (k *catalogueKind) template() string {
+	return k.Module + "/" + k.Example
+}
+
+func (k *catalogueKind) prompt(variable string) *cataloguePrompt {
+	for i, p := range k.Prompts {
+		if p.Variable == variable {
+			return &k.Prompts[i]
+		}
+	}
+	return nil
+}
+
+// AddResource generates the terraform file of a kind of resource in the catalogue, in the
+// resources folder of the current namespace.
+func AddResource(kind string, opt AddResourceOptions) error {
+	re := RepoEnvironment{}
+	err := re.mustBeInANamespaceFolder()
+	if err != nil {
+		return err
+	}
+
+	k, err := findCatalogueKind(kind)
+	if err != nil {
+		return err
+	}
+
+	if k.Generator == "rds" {
+		if opt.Name != "" || len(opt.Set) > 0 {
+			return errors.New("rds has its own options, use: cloud-platform environment rds create")
+		}
+		rdsOpt := RdsOptions{}
+		if opt.Defaults {
+			rdsOpt.Engine = "postgresql"
+		}
+		return CreateTemplateRds(rdsOpt)
+	}
+
+	file, err := addResource(resourcesDir, k, opt, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s generated in %s from %s\n", k.Description, file, templates.version(k.template()))
+	color.Info.Tips("This template is using default values provided by your namespace information. Please review before raising PR")
+
+	return nil
+}
+
+// addResource renders the kind's example with the answers into dir, returning the generated
+// file's path. Everything is checked before the file is written.
+func addResource(dir string, k *catalogueKind, opt AddResourceOptions, out io.Writer) (string, error) {
+	example, err := templates.read(k.template())
+	if err != nil {
+		return "", fmt.Errorf("error reading %s from %s: %w", k.template(), templates.version(k.template()), err)
+	}
+	defaults, err := k.exampleValues(example)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := loadExistingResources(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var answers map[string]string
+	if len(opt.Set) > 0 || opt.Defaults {
+		answers, err = k.setAnswers(opt.Set)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		answers = k.promptAnswers(defaults)
+	}
+
+	if opt.Name != "" {
+		if err := moduleNameRule.validate(opt.Name); err != nil {
+			return "", fmt.Errorf("name %q %w", opt.Name, err)
+		}
+	}
+
+	// without a name, the example's is numbered until nothing it generates is taken
+	var content []byte
+	var file string
+	for i := 1; i <= maxModuleNameAttempts; i++ {
+		name := opt.Name
+		if name == "" && i > 1 {
+			name = fmt.Sprintf("%s_%d", defaults.module, i)
+		}
+
+		content, file, err = k.render(example, name, answers)
+		if err != nil {
+			return "", err
+		}
+		generated := newExistingResources()
+		if err := generated.addFile(file, content); err != nil {
+			return "", err
+		}
+
+		err = existing.clashes(generated)
+		if err == nil {
+			break
+		}
+		if opt.Name != "" {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("no free name found for the %s after %d attempts, set one with --name:\n%w", k.Kind, maxModuleNameAttempts, err)
+	}
+
+	path := dir + file
+	if err := validateTemplateOutput(path, content); err != nil {
+		return "", err
+	}
+	if len(existing.variables) > 0 {
+		for _, v := range undeclaredVariables(content, existing.variables) {
+			fmt.Fprintf(out, "Warning: %s uses var.%s, which isn't declared in %s, add it to variables.tf\n", path, v, dir)
+		}
+	}
+
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// exampleModule is the module of an example, and the values of its attributes.
+type exampleModule struct {
+	module string
+	// values are the attributes' literal values, or their expression if they aren't literals.
+	values map[string]string
+}
+
+// findModule returns the block of the kind's module in a parsed example.
+func (k *catalogueKind) findModule(f *hclwrite.File) (*hclwrite.Block, error) {
+	for _, b := range f.Body().Blocks() {
+		if source := moduleSource(b); source != "" && isModuleRepository(moduleRepository(source), k.Module) {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%s from %s has no %s module", k.template(), templates.version(k.template()), k.Module)
+}
+
+// exampleValues returns the example's module, and checks it sets the kind's required variables.
+func (k *catalogueKind) exampleValues(example []byte) (*exampleModule, error) {
+	f, diags := hclwrite.ParseConfig(example, k.template(), hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s is not valid terraform: %s", k.template(), diags.Error())
+	}
+	b, err := k.findModule(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &exampleModule{module: b.Labels()[0], values: map[string]string{}}
+	for name, attr := range b.Body().Attributes() {
+		m.values[name] = expressionValue(attr.Expr().BuildTokens(nil).Bytes())
+	}
+
+	var missing []string
+	for _, v := range k.Required {
+		if _, ok := m.values[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s from %s doesn't set the required variables: %s", k.template(), templates.version(k.template()), strings.Join(missing, ", "))
+	}
+
+	return m, nil
+}
+
+// expressionValue returns the value of a literal string, number or bool expression, and any
+// other expression as it's written.
+func expressionValue(src []byte) string {
+	src = bytes.TrimSpace(src)
+	expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
+	if diags.HasErrors() || len(expr.Variables()) > 0 {
+		return string(src)
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || v.IsNull() || !v.IsKnown() {
+		return string(src)
+	}
+
+	switch v.Type() {
+	case cty.String:
+		return v.AsString()
+	case cty.Number:
+		return v.AsBigFloat().Text('f', -1)
+	case cty.Bool:
+		return strconv.FormatBool(v.True())
+	}
+	return string(src)
+}
+
+// validateAnswer checks an answer to a prompt matches its pattern and type.
+func (p *cataloguePrompt) validateAnswer(s string) error {
+	if p.Pattern != "" {
+		if err := (&regexValidator{regex: p.Pattern}).validate(s); err != nil {
+			return fmt.Errorf("%s: %q %w", p.Variable, s, err)
+		}
+	}
+	if _, err := p.value(s); err != nil {
+		return fmt.Errorf("%s: %q %w", p.Variable, s, err)
+	}
+	return nil
+}
+
+func (p *cataloguePrompt) value(s string) (cty.Value, error) {
+	switch p.Type {
+	case "number":
+		v, err := cty.ParseNumberVal(s)
+		if err != nil {
+			return cty.NilVal, errors.New("must be a number")
+		}
+		return v, nil
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return cty.NilVal, errors.New("must be true or false")
+		}
+		return cty.BoolVal(b), nil
+	default:
+		return cty.StringVal(s), nil
+	}
+}
+
+// setAnswers parses key=value answers, and checks each is valid for its prompt.
+func (k *catalogueKind) setAnswers(set []string) (map[string]string, error) {
+	answers := map[string]string{}
+	var errs []error
+	for _, s := range set {
+		key, value, ok := strings.Cut(s, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		p := k.prompt(key)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%q should be of the form variable=value", s))
+		case p == nil:
+			var variables []string
+			for _, p := range k.Prompts {
+				variables = append(variables, p.Variable)
+			}
+			if len(variables) == 0 {
+				errs = append(errs, fmt.Errorf("%s has no variables to set", k.Kind))
+			} else {
+				errs = append(errs, fmt.Errorf("unknown variable %q, expected one of: %s", key, strings.Join(variables, ", ")))
+			}
+		default:
+			if err := p.validateAnswer(value); err != nil {
+				errs = append(errs, err)
+			}
+			answers[key] = value
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid %s values:\n%w", k.Kind, errors.Join(errs...))
+	}
+	return answers, nil
+}
+
+// promptAnswers asks for each of the kind's prompts, defaulting to the example's value.
+func (k *catalogueKind) promptAnswers(defaults *exampleModule) map[string]string {
+	answers := map[string]string{}
+	for i := range k.Prompts {
+		p := &k.Prompts[i]
+		q := userQuestion{
+			description:  p.Description,
+			prompt:       p.Variable,
+			validator:    &cataloguePromptValidator{prompt: p, keep: defaults.values[p.Variable]},
+			defaultValue: defaults.values[p.Variable],
+		}
+		_ = q.getAnswer()
+		if q.value != defaults.values[p.Variable] {
+			answers[p.Variable] = q.value
+		}
+	}
+	return answers
+}
+
+// cataloguePromptValidator accepts valid answers to a prompt, and keep, the example's value,
+// which may be an expression rather than a valid answer.
+type cataloguePromptValidator struct {
+	prompt *cataloguePrompt
+	keep   string
+}
+
+func (v *cataloguePromptValidator) isValid(s string) bool {
+	if s != "" && s == v.keep {
+		return true
+	}
+	if err := v.prompt.validateAnswer(s); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
+
+// render returns the example with the answers set and, when name is set, its module renamed to
+// name along with the resources and secret named after it. The file is named after the module,
+// unless it keeps the example's name.
+func (k *catalogueKind) render(example []byte, name string, answers map[string]string) ([]byte, string, error) {
+	f, diags := hclwrite.ParseConfig(example, k.template(), hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, "", fmt.Errorf("%s is not valid terraform: %s", k.template(), diags.Error())
+	}
+	module, err := k.findModule(f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, variable := range sortedKeys(answers) {
+		v, err := k.prompt(variable).value(answers[variable])
+		if err != nil {
+			return nil, "", err
+		}
+		module.Body().SetAttributeValue(variable, v)
+	}
+
+	old := module.Labels()[0]
+	if name == "" || name == old {
+		return hclwrite.Format(f.Bytes()), k.File, nil
+	}
+
+	oldDashed, dashed := strings.ReplaceAll(old, "_", "-"), strings.ReplaceAll(name, "_", "-")
+	module.SetLabels([]string{name})
+	for _, b := range f.Body().Blocks() {
+		if b.Type() != "resource" || len(b.Labels()) != 2 || b.Labels()[1] != old {
+			continue
+		}
+		b.SetLabels([]string{b.Labels()[0], name})
+
+		metadata := b.Body().FirstMatchingBlock("metadata", nil)
+		if b.Labels()[0] != "kubernetes_secret" || metadata == nil || metadata.Body().GetAttribute("name") == nil {
+			continue
+		}
+		secretName := expressionValue(metadata.Body().GetAttribute("name").Expr().BuildTokens(nil).Bytes())
+		if strings.HasPrefix(secretName, oldDashed) {
+			metadata.Body().SetAttributeValue("name", cty.StringVal(dashed+strings.TrimPrefix(secretName, oldDashed)))
+		}
+	}
+
+	content := bytes.ReplaceAll(f.Bytes(), []byte("module."+old+"."), []byte("module."+name+"."))
+	return hclwrite.Format(content), dashed + ".tf", nil
+}
+
+// existingResources are the names defined in the .tf files of a namespace's resources folder,
+// which generated files mustn't reuse.
+type existingResources struct {
+	// each maps a name to the file it's defined in, resources are named <type>.<name>
+	modules, resources, secretNames map[string]string
+	files                           map[string]bool
+	variables                       map[string]bool
+}
+
+func newExistingResources() *existingResources {
+	return &existingResources{
+		modules:     map[string]string{},
+		resources:   map[string]string{},
+		secretNames: map[string]string{},
+		files:       map[string]bool{},
+		variables:   map[string]bool{},
+	}
+}
+
+func loadExistingResources(dir string) (*existingResources, error) {
+	existing := newExistingResources()
+
+	files, err := loadTfFiles(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files.names {
+		existing.add(name, files.parsed[name])
+	}
+	return existing, nil
+}
+
+// addFile parses content and adds its names.
+func (e *existingResources) addFile(name string, content []byte) error {
+	f, diags := hclwrite.ParseConfig(content, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("%s is not valid terraform: %s", name, diags.Error())
+	}
+	e.add(name, f)
+	return nil
+}
+
+func (e *existingResources) add(name string, f *hclwrite.File) {
+	e.files[name] = true
+	for _, b := range f.Body().Blocks() {
+		switch {
+		case b.Type() == "module" && len(b.Labels()) == 1:
+			e.modules[b.Labels()[0]] = name
+		case b.Type() == "variable" && len(b.Labels()) == 1:
+			e.variables[b.Labels()[0]] = true
+		case b.Type() == "resource" && len(b.Labels()) == 2:
+			e.resources[b.Labels()[0]+"."+b.Labels()[1]] = name
+			if b.Labels()[0] != "kubernetes_secret" {
+				continue
+			}
+			if metadata := b.Body().FirstMatchingBlock("metadata", nil); metadata != nil {
+				if attr := metadata.Body().GetAttribute("name"); attr != nil {
+					e.secretNames[expressionValue(attr.Expr().BuildTokens(nil).Bytes())] = name
+				}
+			}
+		}
+	}
+}
+
+// clashes returns an error for every name in generated which already exists.
+func (e *existingResources) clashes(generated *existingResources) error {
+	var errs []error
+	for _, m := range sortedKeys(generated.modules) {
+		if file, ok := e.modules[m]; ok {
+			errs = append(errs, fmt.Errorf("module %s already exists in %s", m, file))
+		}
+	}
+	for _, r := range sortedKeys(generated.resources) {
+		if file, ok := e.resources[r]; ok {
+			errs = append(errs, fmt.Errorf("resource %s already exists in %s", r, file))
+		}
+	}
+	for _, s := range sortedKeys(generated.secretNames) {
+		if file, ok := e.secretNames[s]; ok {
+			errs = append(errs, fmt.Errorf("a secret named %s already exists in %s", s, file))
+		}
+	}
+	for _, f := range sortedKeys(generated.files) {
+		if e.files[f] {
+			errs = append(errs, fmt.Errorf("%s%s already exists", resourcesDir, f))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// undeclaredVariables returns the variables content references which aren't declared.
+func undeclaredVariables(content []byte, declared map[string]bool) []string {
+	seen := map[string]bool{}
+	for _, m := range varReference.FindAllSubmatch(content, -1) {
+		if v := string(m[1]); !declared[v] {
+			seen[v] = true
+		}
+	}
+	return sortedKeys(seen)
+}
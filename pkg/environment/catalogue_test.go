@@ -0,0 +1,190 @@
+package environment
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// addDefaultResource generates a kind of the catalogue, with the example's values, in resources/.
+func addDefaultResource(kind string) error {
+	k, err := findCatalogueKind(kind)
+	if err != nil {
+		return err
+	}
+	_, err = addResource(resourcesDir, k, AddResourceOptions{Defaults: true}, io.Discard)
+	return err
+}
+
+func catalogueTestDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir + "/"
+}
+
+func TestCatalogueMatchesBundle(t *testing.T) {
+	kinds, err := readCatalogue()
+	assert.NoError(t, err)
+
+	data, err := templateBundle.ReadFile("templates/" + templateBundleManifest)
+	assert.NoError(t, err)
+	var manifest templateManifest
+	assert.NoError(t, yaml.Unmarshal(data, &manifest))
+
+	seen := map[string]bool{}
+	for i := range kinds {
+		k := &kinds[i]
+		t.Run(k.Kind, func(t *testing.T) {
+			assert.False(t, seen[k.Kind], "duplicate kind")
+			seen[k.Kind] = true
+			assert.Contains(t, manifest.Repositories, k.Module)
+			assert.Equal(t, ".tf", filepath.Ext(k.File))
+
+			example, err := templates.read(k.template())
+			assert.NoError(t, err)
+			defaults, err := k.exampleValues(example)
+			assert.NoError(t, err)
+			assert.True(t, strings.Contains(moduleSourceRef(defaults.values["source"]), manifest.Repositories[k.Module]), "the example's ref should match the bundle")
+
+			for _, p := range k.Prompts {
+				assert.Contains(t, []string{"", "string", "number", "bool"}, p.Type)
+				_, err := regexp.Compile(p.Pattern)
+				assert.NoError(t, err)
+				if value, ok := defaults.values[p.Variable]; ok && !strings.Contains(value, "var.") {
+					assert.NoError(t, p.validateAnswer(value), "the example's value should be a valid answer")
+				}
+			}
+
+			if k.Generator == "" {
+				content, file, err := k.render(example, "", nil)
+				assert.NoError(t, err)
+				assert.Equal(t, k.File, file)
+				assert.NoError(t, validateTemplateOutput(file, content))
+			}
+		})
+	}
+}
+
+func TestAddResourceNumbersTakenNames(t *testing.T) {
+	dir := catalogueTestDir(t, nil)
+	k, err := findCatalogueKind("sqs")
+	assert.NoError(t, err)
+
+	file, err := addResource(dir, k, AddResourceOptions{Defaults: true}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, dir+"sqs.tf", file)
+
+	file, err = addResource(dir, k, AddResourceOptions{Defaults: true}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, dir+"sqs-2.tf", file)
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `module "sqs_2"`)
+	assert.Contains(t, string(data), `resource "kubernetes_secret" "sqs_2"`)
+	assert.Contains(t, string(data), `name      = "sqs-2-output"`)
+	assert.Contains(t, string(data), "sqs_arn  = module.sqs_2.sqs_arn")
+}
+
+func TestAddResourceGivesUpNumbering(t *testing.T) {
+	templateDir := t.TempDir()
+	example := filepath.Join(templateDir, "cloud-platform-terraform-sqs", "examples", "sqs.tf")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(example), 0o755))
+	content, err := embeddedTemplates{}.read("cloud-platform-terraform-sqs/examples/sqs.tf")
+	assert.NoError(t, err)
+	// the secret's label isn't the module's name, so numbering the module never renames it
+	content = []byte(strings.Replace(string(content), `resource "kubernetes_secret" "sqs"`, `resource "kubernetes_secret" "queue"`, 1))
+	assert.NoError(t, os.WriteFile(example, content, 0o644))
+	useTemplates(t, TemplateOptions{Dir: templateDir})
+
+	dir := catalogueTestDir(t, map[string]string{
+		"queue.tf": "resource \"kubernetes_secret\" \"queue\" {}\n",
+	})
+	k, err := findCatalogueKind("sqs")
+	assert.NoError(t, err)
+
+	_, err = addResource(dir, k, AddResourceOptions{Defaults: true}, io.Discard)
+	assert.ErrorContains(t, err, "no free name found for the sqs after 100 attempts, set one with --name")
+	assert.ErrorContains(t, err, "resource kubernetes_secret.queue already exists in queue.tf")
+}
+
+func TestAddResourceWithAnswers(t *testing.T) {
+	dir := catalogueTestDir(t, nil)
+	k, err := findCatalogueKind("sqs")
+	assert.NoError(t, err)
+
+	file, err := addResource(dir, k, AddResourceOptions{Name: "orders_queue", Set: []string{"sqs_name=orders", "message_retention_seconds = 3600"}}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, dir+"orders-queue.tf", file)
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `module "orders_queue"`)
+	assert.Contains(t, string(data), `sqs_name                  = "orders"`)
+	assert.Contains(t, string(data), "message_retention_seconds = 3600\n")
+	assert.Contains(t, string(data), `name      = "orders-queue-output"`)
+
+	_, err = addResource(dir, k, AddResourceOptions{Name: "orders_queue"}, io.Discard)
+	assert.ErrorContains(t, err, "module orders_queue already exists in orders-queue.tf")
+	assert.ErrorContains(t, err, "resource kubernetes_secret.orders_queue already exists in orders-queue.tf")
+	assert.ErrorContains(t, err, "a secret named orders-queue-output already exists in orders-queue.tf")
+}
+
+func TestAddResourceInvalidAnswers(t *testing.T) {
+	dir := catalogueTestDir(t, nil)
+	k, err := findCatalogueKind("sqs")
+	assert.NoError(t, err)
+
+	_, err = addResource(dir, k, AddResourceOptions{Set: []string{"sqs_name=bad name!", "message_retention_seconds=abc", "queue=x", "fifo"}}, io.Discard)
+	assert.ErrorContains(t, err, `sqs_name: "bad name!" must match`)
+	assert.ErrorContains(t, err, `message_retention_seconds: "abc" must match`)
+	assert.ErrorContains(t, err, `unknown variable "queue", expected one of: sqs_name, message_retention_seconds`)
+	assert.ErrorContains(t, err, `"fifo" should be of the form variable=value`)
+
+	_, err = addResource(dir, k, AddResourceOptions{Name: "Orders", Defaults: true}, io.Discard)
+	assert.ErrorContains(t, err, `name "Orders" must match`)
+
+	s3, err := findCatalogueKind("s3")
+	assert.NoError(t, err)
+	_, err = addResource(dir, s3, AddResourceOptions{Set: []string{"bucket=x"}}, io.Discard)
+	assert.ErrorContains(t, err, "s3 has no variables to set")
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = findCatalogueKind("redis")
+	assert.ErrorContains(t, err, `unknown kind "redis", expected one of: dynamodb, ecr, elasticache`)
+}
+
+func TestAddResourceWarnsOfUndeclaredVariables(t *testing.T) {
+	dir := catalogueTestDir(t, map[string]string{
+		"variables.tf": "variable \"namespace\" {}\nvariable \"team_name\" {}\nvariable \"environment\" {}\n",
+	})
+	k, err := findCatalogueKind("irsa")
+	assert.NoError(t, err)
+
+	var out strings.Builder
+	_, err = addResource(dir, k, AddResourceOptions{Defaults: true}, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "uses var.eks_cluster_name, which isn't declared in "+dir)
+	assert.Contains(t, out.String(), "uses var.business_unit, which isn't declared")
+	assert.NotContains(t, out.String(), "var.namespace")
+}
+
+func TestExpressionValue(t *testing.T) {
+	assert.Equal(t, "example-queue", expressionValue([]byte(` "example-queue"`)))
+	assert.Equal(t, "1209600", expressionValue([]byte("1209600")))
+	assert.Equal(t, "true", expressionValue([]byte("true")))
+	assert.Equal(t, "var.namespace", expressionValue([]byte("var.namespace")))
+	assert.Equal(t, `"${var.team_name}-${var.environment}"`, expressionValue([]byte(`"${var.team_name}-${var.environment}"`)))
+}
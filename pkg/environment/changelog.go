@@ -0,0 +1,188 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+)
+
+// Changelog is used to build a report of the PRs merged into the environments
+// repository in a given time window, and the namespaces each of them touched.
+type Changelog struct {
+	GithubClient github.GithubIface
+	// Clusters is the list of cluster folders under namespaces/ to map changed files to.
+	Clusters []string
+	From, To time.Time
+	// MaxPRs is the maximum number of merged PRs to fetch from the Github search api in one
+	// search, from 1 to maxSearchResults. Windows with more are split into smaller windows.
+	MaxPRs int
+}
+
+// maxSearchResults is the most results a page of the Github search api returns.
+const maxSearchResults = 100
+
+// ChangelogEntry is a merged PR and the namespaces it changed, keyed by cluster folder.
+type ChangelogEntry struct {
+	Number     int                 `json:"number"`
+	Title      string              `json:"title"`
+	Url        string              `json:"url"`
+	MergedAt   time.Time           `json:"mergedAt"`
+	Namespaces map[string][]string `json:"namespaces"`
+}
+
+// NewChangelog returns a Changelog for the window between from and to, which maps
+// changes to the live and live-2 cluster folders.
+func NewChangelog(gh github.GithubIface, from, to time.Time) *Changelog {
+	return &Changelog{
+		GithubClient: gh,
+		Clusters:     []string{filepath.Base(liveBaseDir), filepath.Base(betaBaseDir)},
+		From:         from,
+		To:           to,
+		MaxPRs:       maxSearchResults,
+	}
+}
+
+// Entries lists the PRs merged in the changelog window, newest first, and maps each one
+// to the namespaces it changed using the list of changed files in the PR.
+func (c *Changelog) Entries() ([]ChangelogEntry, error) {
+	if !c.From.Before(c.To) {
+		return nil, fmt.Errorf("the start of the window %s must be before the end %s", c.From.Format(time.RFC3339), c.To.Format(time.RFC3339))
+	}
+	// a full search is how a window with more PRs is spotted, so it has to be possible
+	if c.MaxPRs < 1 || c.MaxPRs > maxSearchResults {
+		return nil, fmt.Errorf("the maximum number of PRs to fetch in one search must be from 1 to %d, not %d", maxSearchResults, c.MaxPRs)
+	}
+
+	nodes, err := c.mergedPRs(c.From, c.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ChangelogEntry
+	seen := map[int]bool{}
+	for _, node := range nodes {
+		pr := node.PullRequest
+		mergedAt := pr.MergedAt.Time
+		// the search api works to the minute, so drop anything outside the exact window, and
+		// the windows of a split search overlap, so drop the PRs found twice
+		if mergedAt.Before(c.From) || mergedAt.After(c.To) || seen[int(pr.Number)] {
+			continue
+		}
+		seen[int(pr.Number)] = true
+
+		files, err := c.GithubClient.GetChangedFiles(int(pr.Number))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch list of changed files in PR %d: %w", pr.Number, err)
+		}
+
+		namespaces := make(map[string][]string)
+		for _, cluster := range c.Clusters {
+			changed, err := nsChangedInPR(files, cluster, false)
+			if err != nil {
+				return nil, err
+			}
+			if len(changed) > 0 {
+				namespaces[cluster] = changed
+			}
+		}
+
+		entries = append(entries, ChangelogEntry{
+			Number:     int(pr.Number),
+			Title:      string(pr.Title),
+			Url:        string(pr.Url),
+			MergedAt:   mergedAt,
+			Namespaces: namespaces,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].MergedAt.After(entries[j].MergedAt)
+	})
+
+	return entries, nil
+}
+
+// mergedPRs searches for the PRs merged between from and to. The search returns at most MaxPRs,
+// so if it's full the window is split in half and each half searched.
+func (c *Changelog) mergedPRs(from, to time.Time) ([]github.Nodes, error) {
+	// round up, so the search starts at or before from
+	minutes := int(math.Ceil(to.Sub(from).Minutes()))
+	date, err := util.GetDatePastMinute(to.UTC().Format(time.RFC3339), minutes)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := c.GithubClient.ListMergedPRs(*date, c.MaxPRs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merged PRs: %w", err)
+	}
+	if len(nodes) < c.MaxPRs {
+		return nodes, nil
+	}
+	if to.Sub(from) <= time.Minute {
+		log.Printf("Warning: more than %d PRs were merged between %s and %s, only %d are listed", c.MaxPRs, from.Format(time.RFC3339), to.Format(time.RFC3339), len(nodes))
+		return nodes, nil
+	}
+
+	mid := from.Add(to.Sub(from) / 2)
+	older, err := c.mergedPRs(from, mid)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := c.mergedPRs(mid, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(newer, older...), nil
+}
+
+// PrintChangelog writes the changelog entries to w either as a table or as json.
+func PrintChangelog(w io.Writer, entries []ChangelogEntry, output string) error {
+	switch output {
+	case "json":
+		if entries == nil {
+			entries = []ChangelogEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table", "":
+		t := table.NewWriter()
+		t.SetOutputMirror(w)
+		t.AppendHeader(table.Row{"PR", "Merged At", "Title", "Cluster", "Namespaces"})
+		for _, e := range entries {
+			if len(e.Namespaces) == 0 {
+				t.AppendRow(table.Row{e.Number, e.MergedAt.UTC().Format(time.RFC3339), e.Title, "-", "-"})
+				continue
+			}
+
+			clusters := make([]string, 0, len(e.Namespaces))
+			for cluster := range e.Namespaces {
+				clusters = append(clusters, cluster)
+			}
+			sort.Strings(clusters)
+
+			for _, cluster := range clusters {
+				t.AppendRow(table.Row{e.Number, e.MergedAt.UTC().Format(time.RFC3339), e.Title, cluster, strings.Join(e.Namespaces[cluster], ", ")})
+			}
+		}
+		t.SetStyle(table.StyleLight)
+		t.Render()
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: table, json", output)
+	}
+}
@@ -0,0 +1,153 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	pkggithub "github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+	"github.com/shurcooL/githubv4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func mergedPR(number int, title string, mergedAt time.Time) pkggithub.Nodes {
+	n := pkggithub.Nodes{}
+	n.PullRequest.Number = githubv4.Int(number)
+	n.PullRequest.Title = githubv4.String(title)
+	n.PullRequest.Url = githubv4.String("https://github.com/ministryofjustice/cloud-platform-environments/pull/" + title)
+	n.PullRequest.MergedAt = githubv4.DateTime{Time: mergedAt}
+	return n
+}
+
+func TestChangelog_Entries(t *testing.T) {
+	to := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	from := to.Add(-2 * time.Hour)
+
+	gh := mocks.NewGithubIface(t)
+	gh.On("ListMergedPRs", mock.Anything, 100).Return([]pkggithub.Nodes{
+		mergedPR(1, "older", from.Add(10*time.Minute)),
+		mergedPR(2, "newer", to.Add(-5*time.Minute)),
+		mergedPR(3, "outside", to.Add(30*time.Second)),
+	}, nil)
+	gh.On("GetChangedFiles", 1).Return([]*github.CommitFile{
+		{Filename: github.String("namespaces/live.cloud-platform.service.justice.gov.uk/foo/resources/main.tf")},
+		{Filename: github.String("namespaces/live-2.cloud-platform.service.justice.gov.uk/bar/00-namespace.yaml")},
+	}, nil)
+	gh.On("GetChangedFiles", 2).Return([]*github.CommitFile{
+		{Filename: github.String("README.md")},
+	}, nil)
+
+	entries, err := NewChangelog(gh, from, to).Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, 2, entries[0].Number)
+	assert.Empty(t, entries[0].Namespaces)
+
+	assert.Equal(t, 1, entries[1].Number)
+	assert.Equal(t, map[string][]string{
+		"live.cloud-platform.service.justice.gov.uk":   {"foo"},
+		"live-2.cloud-platform.service.justice.gov.uk": {"bar"},
+	}, entries[1].Namespaces)
+
+	gh.AssertNotCalled(t, "GetChangedFiles", 3)
+}
+
+func TestChangelog_EntriesRoundsTheWindowUp(t *testing.T) {
+	to := time.Date(2024, 1, 2, 15, 0, 30, 0, time.UTC)
+	from := to.Add(-75 * time.Second)
+
+	gh := mocks.NewGithubIface(t)
+	gh.On("ListMergedPRs", mock.MatchedBy(func(d util.Date) bool {
+		return d.Last == "2024-01-02T14:58:30"
+	}), 100).Return([]pkggithub.Nodes{mergedPR(1, "first second", from)}, nil)
+	gh.On("GetChangedFiles", 1).Return([]*github.CommitFile{}, nil)
+
+	entries, err := NewChangelog(gh, from, to).Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "the PR merged in the seconds before the first whole minute is kept")
+}
+
+func TestChangelog_EntriesSplitsFullSearch(t *testing.T) {
+	to := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	from := to.Add(-2 * time.Hour)
+	var merged []pkggithub.Nodes
+	// the PR merged at 14:00 is in both halves of the window
+	for i, m := range []time.Duration{time.Minute, 10 * time.Minute, 59 * time.Minute, time.Hour, 90 * time.Minute, 119 * time.Minute} {
+		merged = append(merged, mergedPR(i+1, "pr", from.Add(m)))
+	}
+
+	// search returns the PRs merged in the date's window, newest first, up to count
+	search := func(d util.Date, count int) []pkggithub.Nodes {
+		var found []pkggithub.Nodes
+		for i := len(merged) - 1; i >= 0 && len(found) < count; i-- {
+			at := merged[i].PullRequest.MergedAt.Format("2006-01-02T15:04:05")
+			if at >= d.Last && at <= d.First {
+				found = append(found, merged[i])
+			}
+		}
+		return found
+	}
+	gh := mocks.NewGithubIface(t)
+	gh.On("ListMergedPRs", mock.Anything, 2).Return(search, nil)
+	for i := range merged {
+		gh.On("GetChangedFiles", i+1).Return([]*github.CommitFile{}, nil).Once()
+	}
+
+	changelog := NewChangelog(gh, from, to)
+	changelog.MaxPRs = 2
+	entries, err := changelog.Entries()
+	assert.NoError(t, err)
+
+	var numbers []int
+	for _, e := range entries {
+		numbers = append(numbers, e.Number)
+	}
+	assert.Equal(t, []int{6, 5, 4, 3, 2, 1}, numbers)
+}
+
+func TestChangelog_EntriesInvalidWindow(t *testing.T) {
+	now := time.Now()
+	_, err := NewChangelog(mocks.NewGithubIface(t), now, now.Add(-time.Hour)).Entries()
+	assert.Error(t, err)
+}
+
+func TestChangelog_EntriesInvalidMaxPRs(t *testing.T) {
+	now := time.Now()
+	for _, max := range []int{0, -1, 101} {
+		changelog := NewChangelog(mocks.NewGithubIface(t), now.Add(-2*time.Hour), now)
+		changelog.MaxPRs = max
+		_, err := changelog.Entries()
+		assert.EqualError(t, err, fmt.Sprintf("the maximum number of PRs to fetch in one search must be from 1 to 100, not %d", max))
+	}
+}
+
+func TestPrintChangelog(t *testing.T) {
+	entries := []ChangelogEntry{
+		{
+			Number:     42,
+			Title:      "Add foo",
+			MergedAt:   time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC),
+			Namespaces: map[string][]string{"live.cloud-platform.service.justice.gov.uk": {"foo", "bar"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintChangelog(&buf, entries, "table"))
+	assert.True(t, strings.Contains(buf.String(), "foo, bar"))
+
+	buf.Reset()
+	assert.NoError(t, PrintChangelog(&buf, entries, "json"))
+	var got []ChangelogEntry
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, entries, got)
+
+	assert.Error(t, PrintChangelog(&buf, entries, "yaml"))
+}
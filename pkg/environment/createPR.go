@@ -3,7 +3,6 @@ package environment
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"log"
 	"os/exec"
@@ -13,7 +12,26 @@ import (
 	"github.com/ministryofjustice/cloud-platform-cli/pkg/slack"
 )
 
-func createPR(description, namespace, ghToken, repo string) func(github.GithubIface, []string) (string, error) {
+// pullRequest is a change to files in the environments repository, to be committed to its own
+// branch and raised as a PR.
+type pullRequest struct {
+	Branch        string
+	Title         string
+	Description   string
+	CommitMessage string
+	// RepoPath is the directory Files are relative to.
+	RepoPath string
+	Files    []string
+	// TeamReviewers are the Github teams asked to review the PR.
+	TeamReviewers []string
+	// Local is raised from a user's own checkout, so it's committed as them and pushed to their
+	// origin, rather than as cloud-platform-moj to an origin using the github token.
+	Local bool
+}
+
+// createPR returns a function raising the PR for the version drift fixes of a namespace. resources
+// names what was fixed, e.g. "RDS and ElastiCache", and is used in the branch, title and commit.
+func createPR(description, namespace, resources, ghToken, repo string) func(github.GithubIface, []string) (string, error) {
 	b := make([]byte, 2)
 	if _, err := rand.Read(b); err != nil {
 		return func(gh github.GithubIface, files []string) (string, error) {
@@ -21,74 +39,135 @@ func createPR(description, namespace, ghToken, repo string) func(github.GithubIf
 		}
 	}
 	fourCharUid := hex.EncodeToString(b)
-	branchName := namespace + "-rds-minor-version-bump-" + fourCharUid
+	branchName := namespace + "-" + strings.ToLower(strings.ReplaceAll(resources, " and ", "-")) + "-version-bump-" + fourCharUid
 
 	return func(gh github.GithubIface, filenames []string) (string, error) {
-		repoPath := "namespaces/live.cloud-platform.service.justice.gov.uk/" + namespace + "/resources"
+		return raisePR(gh, ghToken, repo, pullRequest{
+			Branch:        branchName,
+			Title:         "Fix: " + resources + " version mismatch in " + namespace,
+			Description:   description,
+			CommitMessage: "concourse: correcting " + resources + " version drift",
+			RepoPath:      "namespaces/live.cloud-platform.service.justice.gov.uk/" + namespace + "/resources",
+			Files:         filenames,
+		})
+	}
+}
 
-		removeRemoteCmd := exec.Command("/bin/sh", "-c", "git remote remove origin")
-		if err := removeRemoteCmd.Run(); err != nil {
+// raisePR commits the files of the pull request to a new branch from main, pushes it and raises
+// a PR, unless a PR with the same title is already open. Git is run in pr.RepoPath, with its
+// arguments passed as they are rather than through a shell, as they include names and messages
+// which come from the user.
+func raisePR(gh github.GithubIface, ghToken, repo string, pr pullRequest) (string, error) {
+	if !pr.Local {
+		if err := runGit(pr.RepoPath, "remote", "remove", "origin"); err != nil {
 			return "", fmt.Errorf("failed to remove remote origin: %w", err)
 		}
 
-		useGhTokenCmd := exec.Command("/bin/sh", "-c", "git remote add origin https://"+ghToken+"@github.com/ministryofjustice/"+repo)
-		if err := useGhTokenCmd.Run(); err != nil {
+		if err := runGit(pr.RepoPath, "remote", "add", "origin", "https://"+ghToken+"@github.com/ministryofjustice/"+repo); err != nil {
 			return "", fmt.Errorf("failed to remote add origin: %w", err)
 		}
+	}
+
+	open, err := openPR(gh, pr.Title)
+	if err != nil {
+		log.Printf("Warning: error listing open PRs: %v", err)
+	}
+	if open != "" {
+		return "", fmt.Errorf("a PR is already open for this namespace, skipping: %s", open)
+	}
 
-		pulls, err := gh.ListOpenPRs(namespace)
-		if err != nil {
-			log.Printf("Warning: error listing open PRs: %v", err)
+	if err := runGit(pr.RepoPath, "checkout", "main"); err != nil {
+		return "", fmt.Errorf("failed to checkout main: %w", err)
+	}
+
+	if err := runGit(pr.RepoPath, "checkout", "-b", pr.Branch); err != nil {
+		return "", fmt.Errorf("failed to create new branch: %w", err)
+	}
+
+	// once on the new branch, a failure goes back to main with the files unstaged, as a success
+	// does, so the next PR doesn't start from this branch or commit these files
+	failed := func(err error) (string, error) {
+		if resetErr := runGit(pr.RepoPath, append([]string{"reset", "-q", "--"}, pr.Files...)...); resetErr != nil {
+			log.Printf("Warning: failed to unstage the files: %v", resetErr)
 		}
-		if len(pulls) > 0 {
-			return "", errors.New("a PR is already open for this namespace, skipping")
+		if checkoutErr := runGit(pr.RepoPath, "checkout", "main"); checkoutErr != nil {
+			log.Printf("Warning: failed to checkout main: %v", checkoutErr)
 		}
+		return "", err
+	}
 
-		checkMainCmd := exec.Command("/bin/sh", "-c", "git checkout main")
-		if err := checkMainCmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to checkout main: %w", err)
-		}
+	if err := runGit(pr.RepoPath, append([]string{"add", "--"}, pr.Files...)...); err != nil {
+		log.Printf("[ERROR] Failed to git add: %v", err)
+		return failed(fmt.Errorf("failed to git add: %w", err))
+	}
 
-		checkBranchCmd := exec.Command("/bin/sh", "-c", "git checkout -b "+branchName)
-		if err := checkBranchCmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to create new branch: %w", err)
-		}
+	commit := []string{"-c", "user.name=cloud-platform-moj", "-c", "user.email=cloudplatform@justiceuk.onmicrosoft.com", "commit", "-m", pr.CommitMessage}
+	if pr.Local {
+		commit = commit[4:]
+	}
+	if err := runGit(pr.RepoPath, commit...); err != nil {
+		log.Printf("[ERROR] Failed to git commit: %v", err)
+		return failed(fmt.Errorf("failed to git commit: %w", err))
+	}
 
-		addCmd := exec.Command("/bin/sh", "-c", "git add "+strings.Join(filenames, " "))
-		addCmd.Dir = repoPath
-		if err := addCmd.Run(); err != nil {
-			log.Printf("[ERROR] Failed to git add: %v", err)
-			return "", fmt.Errorf("failed to git add: %w", err)
-		}
+	if err := runGit(pr.RepoPath, "push", "--set-upstream", "origin", pr.Branch); err != nil {
+		log.Printf("[ERROR] Failed to push branch: %v", err)
+		return failed(fmt.Errorf("failed to push branch: %w", err))
+	}
 
-		commitCmd := exec.Command("/bin/sh", "-c",
-			"git -c user.name='cloud-platform-moj' -c user.email='cloudplatform@justiceuk.onmicrosoft.com' commit -m 'concourse: correcting rds version drift'",
-		)
-		commitCmd.Dir = repoPath
-		if err := commitCmd.Run(); err != nil {
-			log.Printf("[ERROR] Failed to git commit: %v", err)
-			return "", fmt.Errorf("failed to git commit: %w", err)
-		}
+	prUrl, err := gh.CreatePR(pr.Branch, pr.Title, pr.Description, pr.TeamReviewers)
+	if err != nil {
+		log.Printf("[ERROR] Failed to create GitHub PR: %v", err)
+		return failed(fmt.Errorf("failed to create PR: %w", err))
+	}
 
-		pushCmd := exec.Command("/bin/sh", "-c", "git push --set-upstream origin "+branchName)
-		pushCmd.Dir = repoPath
-		if err := pushCmd.Run(); err != nil {
-			log.Printf("[ERROR] Failed to push branch: %v", err)
-			return "", fmt.Errorf("failed to push branch: %w", err)
-		}
+	// go back to main, so changes made for the next PR don't start from this branch
+	if err := runGit(pr.RepoPath, "checkout", "main"); err != nil {
+		log.Printf("Warning: failed to checkout main: %v", err)
+	}
 
-		prUrl, err := gh.CreatePR(branchName, namespace, description)
-		if err != nil {
-			log.Printf("[ERROR] Failed to create GitHub PR: %v", err)
-			return "", fmt.Errorf("failed to create PR: %w", err)
+	return prUrl, nil
+}
+
+// openPR returns the URL of an open PR whose title is title, ignoring case, or "" if there isn't
+// one. A title ending in ":" is a prefix, e.g. "Module upgrade in myapp:" finds every module
+// upgrade PR of myapp. The titles are compared in full, as Github's match is a substring, which
+// would confuse the PRs of myapp with those of myapp-dev.
+func openPR(gh github.GithubIface, title string) (string, error) {
+	pulls, err := gh.ListOpenPRs(title)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range pulls {
+		t := p.GetTitle()
+		if strings.EqualFold(t, title) || strings.HasSuffix(title, ":") && len(t) >= len(title) && strings.EqualFold(t[:len(title)], title) {
+			return p.GetHTMLURL(), nil
 		}
+	}
+	return "", nil
+}
 
-		return prUrl, nil
+// branchExists reports whether the checkout in dir already has a branch called branch, either
+// locally or fetched from origin.
+func branchExists(dir, branch string) bool {
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		if runGit(dir, "rev-parse", "--verify", "--quiet", ref) == nil {
+			return true
+		}
 	}
+	return false
+}
+
+// runGit runs git with the arguments in dir. Its output isn't returned, as the remote's URL can
+// have the github token in it.
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	return cmd.Run()
 }
 
-func postPR(prUrl, slackWebhookUrl string) {
-	if err := slack.PostToAsk(prUrl, slackWebhookUrl); err != nil {
+func postPR(prUrl, resources, slackWebhookUrl string) {
+	if err := slack.PostToAsk(prUrl, resources, slackWebhookUrl); err != nil {
 		fmt.Printf("Warning: Error posting to #ask-cloud-platform: %v\n", err)
 	}
 }
@@ -0,0 +1,134 @@
+package environment
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gogithub "github.com/google/go-github/github"
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// gitTestRepo creates a git repository with a main branch, whose origin is a bare repository
+// next to it, and returns its path.
+func gitTestRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	root := t.TempDir()
+	repo, origin := filepath.Join(root, "repo"), filepath.Join(root, "origin.git")
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git(root, "init", "--bare", "-b", "main", origin)
+	git(root, "init", "-b", "main", repo)
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "README.md"), []byte("environments\n"), 0o644))
+	git(repo, "add", "README.md")
+	git(repo, "commit", "-m", "initial")
+	git(repo, "remote", "add", "origin", origin)
+	git(repo, "push", "origin", "main")
+	return repo
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	assert.NoError(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+func TestRaisePRDoesntUseAShell(t *testing.T) {
+	repo := gitTestRepo(t)
+	nsDir := filepath.Join(repo, "namespaces", "live", "my-ns")
+	assert.NoError(t, os.MkdirAll(nsDir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(nsDir, "it's $(touch pwned).yaml"), []byte("x\n"), 0o644))
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListOpenPRs", "Add my-ns's file").Return([]*gogithub.PullRequest{}, nil)
+	gh.On("CreatePR", "add-my-ns", "Add my-ns's file", "", mock.Anything).Return("https://github.com/pr/1", nil)
+
+	message := "Add my-ns's file; $(touch pwned) `touch pwned`"
+	url, err := raisePR(gh, "", "cloud-platform-environments", pullRequest{
+		Branch:        "add-my-ns",
+		Title:         "Add my-ns's file",
+		CommitMessage: message,
+		RepoPath:      nsDir,
+		Files:         []string{"it's $(touch pwned).yaml"},
+		Local:         true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/pr/1", url)
+
+	assert.Equal(t, message, gitOutput(t, repo, "log", "-1", "--format=%s", "add-my-ns"))
+	assert.Equal(t, "namespaces/live/my-ns/it's $(touch pwned).yaml", gitOutput(t, repo, "show", "--format=", "--name-only", "add-my-ns"))
+	assert.Contains(t, gitOutput(t, repo, "ls-remote", "--heads", "origin", "add-my-ns"), "refs/heads/add-my-ns", "the branch is pushed")
+	assert.Equal(t, "main", gitOutput(t, repo, "branch", "--show-current"))
+	assert.NoFileExists(t, filepath.Join(nsDir, "pwned"))
+	assert.NoFileExists(t, filepath.Join(repo, "pwned"))
+}
+
+func TestRaisePRGoesBackToMainOnFailure(t *testing.T) {
+	repo := gitTestRepo(t)
+	nsDir := filepath.Join(repo, "namespaces", "live", "my-ns")
+	assert.NoError(t, os.MkdirAll(nsDir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(nsDir, "main.tf"), []byte("x\n"), 0o644))
+
+	gh := mocks.NewGithubIface(t)
+	gh.On("ListOpenPRs", "Add my-ns").Return([]*gogithub.PullRequest{}, nil)
+	gh.On("CreatePR", "add-my-ns", "Add my-ns", "", mock.Anything).Return("", errors.New("rate limited"))
+
+	_, err := raisePR(gh, "", "cloud-platform-environments", pullRequest{
+		Branch:        "add-my-ns",
+		Title:         "Add my-ns",
+		CommitMessage: "Add my-ns",
+		RepoPath:      nsDir,
+		Files:         []string{"main.tf"},
+		Local:         true,
+	})
+	assert.ErrorContains(t, err, "failed to create PR: rate limited")
+	assert.Equal(t, "main", gitOutput(t, repo, "branch", "--show-current"), "the next PR is branched from main")
+	assert.Empty(t, gitOutput(t, repo, "status", "--porcelain"))
+}
+
+func TestOpenPR(t *testing.T) {
+	gh := mocks.NewGithubIface(t)
+	gh.On("ListOpenPRs", "Delete expired namespace ns:").Return([]*gogithub.PullRequest{
+		{Title: gogithub.String("Delete expired namespace ns-foo: remove the namespace"), HTMLURL: gogithub.String("https://github.com/pr/1")},
+		{Title: gogithub.String("delete expired namespace NS: remove the namespace"), HTMLURL: gogithub.String("https://github.com/pr/2")},
+	}, nil)
+	gh.On("ListOpenPRs", "Fix: RDS version").Return([]*gogithub.PullRequest{
+		{Title: gogithub.String("Fix: RDS version in ns"), HTMLURL: gogithub.String("https://github.com/pr/3")},
+		{Title: gogithub.String("Fix: rds version"), HTMLURL: gogithub.String("https://github.com/pr/4")},
+	}, nil)
+	gh.On("ListOpenPRs", "Fix: RDS version in ns-foo").Return([]*gogithub.PullRequest{
+		{Title: gogithub.String("Fix: RDS version in ns-foo-bar"), HTMLURL: gogithub.String("https://github.com/pr/5")},
+	}, nil)
+
+	url, err := openPR(gh, "Delete expired namespace ns:")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/pr/2", url, "the prefix ends at the namespace, so ns-foo's PR isn't ns's")
+
+	url, err = openPR(gh, "Fix: RDS version")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/pr/4", url, "a title without a delimiter has to match in full")
+
+	url, err = openPR(gh, "Fix: RDS version in ns-foo")
+	assert.NoError(t, err)
+	assert.Empty(t, url)
+}
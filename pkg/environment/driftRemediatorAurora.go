@@ -0,0 +1,17 @@
+package environment
+
+import "regexp"
+
+var auroraVersionMismatchRe = regexp.MustCompile(`Error: (?:updating|modifying) RDS Cluster .* api error InvalidParameterCombination:.* from .* (?:to|with requested version) .*`)
+
+// auroraRemediator fixes drift in the cloud-platform-terraform-rds-aurora module, where AWS
+// applies minor version upgrades to the whole cluster.
+type auroraRemediator struct {
+	moduleVersionRemediator
+}
+
+func (auroraRemediator) resource() string { return "Aurora" }
+
+func (auroraRemediator) parse(applyErr string) ([]versionFix, error) {
+	return parseVersionDowngrade(applyErr, auroraVersionMismatchRe, "aws_rds_cluster", "aurora")
+}
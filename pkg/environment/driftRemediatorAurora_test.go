@@ -0,0 +1,56 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuroraRemediator(t *testing.T) {
+	r := driftRemediators["aws_rds_cluster"]
+
+	tests := []struct {
+		name     string
+		applyErr string
+		want     []versionFix
+		wantErr  string
+	}{
+		{
+			name:     "downgrade",
+			applyErr: "Error: updating RDS Cluster (cloud-platform-a): operation error RDS: ModifyDBCluster, https response error StatusCode: 400, RequestID: xxx, api error InvalidParameterCombination: Cannot upgrade aurora-postgresql from 14.10 to 14.6, with module.aurora_db.aws_rds_cluster.aurora,",
+			want:     []versionFix{{ModuleName: "aurora_db", ActualVersion: "14.10", TerraformVersion: "14.6"}},
+		},
+		{
+			name:     "upgrade",
+			applyErr: "Error: updating RDS Cluster (cloud-platform-b): operation error RDS: ModifyDBCluster, api error InvalidParameterCombination: Cannot upgrade aurora-mysql from 8.0.mysql_aurora.3.04.0 to 8.0.mysql_aurora.3.05.2, with module.aurora_db.aws_rds_cluster.aurora,",
+			wantErr:  "isn't trying to downgrade the aurora version",
+		},
+		{
+			name:     "not a version mismatch",
+			applyErr: "Error: updating RDS Cluster (cloud-platform-c): operation error RDS: ModifyDBCluster, api error InvalidParameterValue: The parameter MasterUserPassword is not a valid password, with module.aurora_db.aws_rds_cluster.aurora,",
+			wantErr:  "doesn't look like a version mismatch for aurora",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixes, err := r.parse(tt.applyErr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, fixes)
+		})
+	}
+
+	dir := writeTfFiles(t, map[string]string{
+		"aurora.tf":    "module \"aurora_db\" {\n  engine_version = var.aurora_version\n}\n",
+		"variables.tf": "variable \"aurora_version\" {\n  default = \"14.6\"\n}\n",
+	})
+	files, err := loadTfFiles(dir)
+	assert.NoError(t, err)
+
+	changes, err := r.remediate(files, versionFix{ModuleName: "aurora_db", ActualVersion: "14.10", TerraformVersion: "14.6"})
+	assert.NoError(t, err)
+	assert.Equal(t, []versionChange{{File: "variables.tf", Address: "variable.aurora_version.default", Old: "14.6", New: "14.10"}}, changes)
+}
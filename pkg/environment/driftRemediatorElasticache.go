@@ -0,0 +1,16 @@
+package environment
+
+import "regexp"
+
+var elasticacheVersionMismatchRe = regexp.MustCompile(`Error: (?:updating|modifying) ElastiCache Replication Group .*InvalidParameterCombination:.* from .* (?:to|with requested version) .*`)
+
+// elasticacheRemediator fixes drift in the cloud-platform-terraform-elasticache-cluster module.
+type elasticacheRemediator struct {
+	moduleVersionRemediator
+}
+
+func (elasticacheRemediator) resource() string { return "ElastiCache" }
+
+func (elasticacheRemediator) parse(applyErr string) ([]versionFix, error) {
+	return parseVersionDowngrade(applyErr, elasticacheVersionMismatchRe, "aws_elasticache_replication_group", "elasticache")
+}
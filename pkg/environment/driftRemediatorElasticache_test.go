@@ -0,0 +1,55 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElasticacheRemediator(t *testing.T) {
+	r := driftRemediators["aws_elasticache_replication_group"]
+
+	tests := []struct {
+		name     string
+		applyErr string
+		want     []versionFix
+		wantErr  string
+	}{
+		{
+			name:     "downgrade",
+			applyErr: "Error: modifying ElastiCache Replication Group (cp-abc): operation error ElastiCache: ModifyReplicationGroup, https response error StatusCode: 400, RequestID: xxx, InvalidParameterCombination: Cannot modify engine version from 7.1 to 7.0, with module.redis.aws_elasticache_replication_group.ec_redis,",
+			want:     []versionFix{{ModuleName: "redis", ActualVersion: "7.1", TerraformVersion: "7.0"}},
+		},
+		{
+			name:     "upgrade",
+			applyErr: "Error: modifying ElastiCache Replication Group (cp-abc): InvalidParameterCombination: Cannot modify engine version from 6.2 to 7.0, with module.redis.aws_elasticache_replication_group.ec_redis,",
+			wantErr:  "isn't trying to downgrade the elasticache version",
+		},
+		{
+			name:     "not a version mismatch",
+			applyErr: "Error: modifying ElastiCache Replication Group (cp-abc): InvalidParameterValue: Node type cache.t2.nano is not supported, with module.redis.aws_elasticache_replication_group.ec_redis,",
+			wantErr:  "doesn't look like a version mismatch for elasticache",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixes, err := r.parse(tt.applyErr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, fixes)
+		})
+	}
+
+	dir := writeTfFiles(t, map[string]string{
+		"elasticache.tf": "module \"redis\" {\n  engine_version = \"7.0\"\n}\n",
+	})
+	files, err := loadTfFiles(dir)
+	assert.NoError(t, err)
+
+	changes, err := r.remediate(files, versionFix{ModuleName: "redis", ActualVersion: "7.1", TerraformVersion: "7.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, []versionChange{{File: "elasticache.tf", Address: "module.redis.engine_version", Old: "7.0", New: "7.1"}}, changes)
+}
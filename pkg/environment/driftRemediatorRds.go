@@ -0,0 +1,25 @@
+package environment
+
+// rdsInstanceRemediator fixes drift in the cloud-platform-terraform-rds-instance module.
+type rdsInstanceRemediator struct {
+	moduleVersionRemediator
+}
+
+func (rdsInstanceRemediator) resource() string { return "RDS" }
+
+func (rdsInstanceRemediator) parse(applyErr string) ([]versionFix, error) {
+	results, err := IsRdsVersionMismatched(applyErr)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []versionFix
+	for i, versions := range results.Versions {
+		fixes = append(fixes, versionFix{
+			ModuleName:       results.ModuleNames[i][0],
+			ActualVersion:    versions[0],
+			TerraformVersion: versions[1],
+		})
+	}
+	return fixes, nil
+}
@@ -0,0 +1,32 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRdsInstanceRemediator(t *testing.T) {
+	r := driftRemediators["aws_db_instance"]
+
+	fixes, err := r.parse("Error: updating RDS DB Instance (cloud-platform-a): operation error RDS: ModifyDBInstance, api error InvalidParameterCombination: Cannot upgrade postgres from 14.13 to 14.7., with module.rds_replica[0].aws_db_instance.rds,")
+	assert.NoError(t, err)
+	assert.Equal(t, []versionFix{{ModuleName: "rds_replica", ActualVersion: "14.13", TerraformVersion: "14.7"}}, fixes)
+
+	dir := writeTfFiles(t, map[string]string{
+		"rds.tf": "module \"rds_replica\" {\n  db_engine_version = \"14.7\"\n}\n",
+	})
+	files, err := loadTfFiles(dir)
+	assert.NoError(t, err)
+
+	changes, err := r.remediate(files, fixes[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []versionChange{{File: "rds.tf", Address: "module.rds_replica.db_engine_version", Old: "14.7", New: "14.13"}}, changes)
+
+	assert.NoError(t, files.writeChanged())
+	data, err := os.ReadFile(filepath.Join(dir, "rds.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `db_engine_version = "14.13"`)
+}
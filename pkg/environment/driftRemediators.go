@@ -0,0 +1,145 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// versionFix is a module whose configured engine version needs to be changed to match
+// the version AWS is actually running.
+type versionFix struct {
+	// ResourceType is the terraform resource that failed to apply, it decides which remediator fixes it.
+	ResourceType     string
+	ModuleName       string
+	ActualVersion    string
+	TerraformVersion string
+}
+
+// driftRemediator recognises the apply error terraform gives for one resource type when AWS has
+// upgraded the engine version behind its back, and knows how to correct the terraform so the
+// configured version matches the running one.
+type driftRemediator interface {
+	// parse returns the fixes described by a single apply error. It returns a notVersionDriftError
+	// if the error isn't a version drift.
+	parse(applyErr string) ([]versionFix, error)
+	// remediate changes the terraform in memory so the module is configured with the actual version.
+	remediate(files *tfFiles, fix versionFix) ([]versionChange, error)
+	// resource is the name of the resource fixed, as used in PR titles and messages, e.g. "RDS".
+	resource() string
+}
+
+// driftRemediators is the registry of remediators, keyed by the terraform resource type they handle.
+var driftRemediators = map[string]driftRemediator{
+	"aws_db_instance":                   rdsInstanceRemediator{moduleVersionRemediator{attribute: "db_engine_version"}},
+	"aws_rds_cluster":                   auroraRemediator{moduleVersionRemediator{attribute: "engine_version"}},
+	"aws_elasticache_replication_group": elasticacheRemediator{moduleVersionRemediator{attribute: "engine_version"}},
+}
+
+// notVersionDriftError is returned when terraform is failing for a reason other than version
+// drift. Those namespaces need a human to look at them, but aren't a failure of the checker.
+type notVersionDriftError struct {
+	msg string
+}
+
+func (e notVersionDriftError) Error() string {
+	return e.msg
+}
+
+// failedResourceRe finds the resource type in the "with module.<name>.<type>.<name>" line of an apply error.
+var failedResourceRe = regexp.MustCompile(`with module\.[^\s,]+?\.(aws_[a-z0-9_]+)\.`)
+
+// parseApplyErrors hands each apply error to the remediator registered for the resource that
+// failed, and returns the fixes for all of them. Every error has to be a version drift, as
+// fixing only some of them wouldn't make the apply pass.
+func parseApplyErrors(applyErrs []string) ([]versionFix, error) {
+	var fixes []versionFix
+	for _, applyErr := range applyErrs {
+		m := failedResourceRe.FindStringSubmatch(applyErr)
+		if m == nil {
+			return nil, notVersionDriftError{"terraform is failing but the error doesn't name the module resource that failed"}
+		}
+
+		remediator, ok := driftRemediators[m[1]]
+		if !ok {
+			return nil, notVersionDriftError{fmt.Sprintf("terraform is failing on a %s, which has no version drift remediator", m[1])}
+		}
+
+		found, err := remediator.parse(applyErr)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			f.ResourceType = m[1]
+			fixes = append(fixes, f)
+		}
+	}
+
+	return fixes, nil
+}
+
+// driftResources names the resources the fixes are for, in the order they were found, e.g.
+// "RDS and ElastiCache", for the title and messages of the PR which makes them.
+func driftResources(fixes []versionFix) string {
+	var names []string
+	seen := map[string]bool{}
+	for _, fix := range fixes {
+		remediator, ok := driftRemediators[fix.ResourceType]
+		if !ok || seen[remediator.resource()] {
+			continue
+		}
+		seen[remediator.resource()] = true
+		names = append(names, remediator.resource())
+	}
+
+	return strings.Join(names, " and ")
+}
+
+// isCriticalDriftFailure reports whether a namespace that couldn't be fixed should fail the checker.
+func isCriticalDriftFailure(err error) bool {
+	var notDrift notVersionDriftError
+	if errors.As(err, &notDrift) {
+		return false
+	}
+	return !strings.Contains(err.Error(), "a PR is already open for this namespace")
+}
+
+// moduleVersionRemediator is the remediation shared by the modules that expose the engine
+// version as a single attribute: it's set to the version AWS is running.
+type moduleVersionRemediator struct {
+	attribute string
+}
+
+func (r moduleVersionRemediator) remediate(files *tfFiles, fix versionFix) ([]versionChange, error) {
+	return files.updateVersion(fix.ModuleName, r.attribute, fix.ActualVersion, fix.TerraformVersion)
+}
+
+var downgradeVersionsRe = regexp.MustCompile(`(?i)from ([^\s,]+) (?:to|with requested version) ([^\s,]+)`)
+
+// parseVersionDowngrade checks an apply error matches errorRe, then returns the module of the
+// resourceType resource that failed and the versions it was being downgraded between. kind
+// names the service in error messages.
+func parseVersionDowngrade(applyErr string, errorRe *regexp.Regexp, resourceType, kind string) ([]versionFix, error) {
+	if !errorRe.MatchString(applyErr) {
+		return nil, notVersionDriftError{fmt.Sprintf("terraform is failing but it doesn't look like a version mismatch for %s", kind)}
+	}
+
+	versions := downgradeVersionsRe.FindStringSubmatch(applyErr)
+	moduleRe := regexp.MustCompile(`with module\.([^\s,]+?)\.` + regexp.QuoteMeta(resourceType) + `\.`)
+	module := moduleRe.FindStringSubmatch(applyErr)
+	if versions == nil || module == nil {
+		return nil, fmt.Errorf("error: couldn't find the %s versions and module name in the terraform error", kind)
+	}
+
+	actual, desired := strings.Trim(versions[1], " ,."), strings.Trim(versions[2], " ,.")
+	if !isBehind(desired, actual) {
+		return nil, fmt.Errorf("terraform is failing, but it isn't trying to downgrade the %s version so it needs more investigation", kind)
+	}
+
+	return []versionFix{{
+		ModuleName:       strings.Split(module[1], "[")[0],
+		ActualVersion:    actual,
+		TerraformVersion: desired,
+	}}, nil
+}
@@ -0,0 +1,79 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseApplyErrors(t *testing.T) {
+	rdsErr := "Error: updating RDS DB Instance (cloud-platform-a): operation error RDS: ModifyDBInstance, api error InvalidParameterCombination: Cannot upgrade postgres from 14.13 to 14.7., with module.rds.aws_db_instance.rds,"
+	auroraErr := "Error: updating RDS Cluster (cloud-platform-b): operation error RDS: ModifyDBCluster, api error InvalidParameterCombination: Cannot upgrade aurora-postgresql from 14.10 to 14.6, with module.aurora_db.aws_rds_cluster.aurora,"
+	storageErr := "Error: updating RDS DB Instance (cloud-platform-c): operation error RDS: ModifyDBInstance, api error InvalidParameterCombination: Max storage size must be greater than storage size, with module.rds.aws_db_instance.rds,"
+
+	tests := []struct {
+		name        string
+		applyErrs   []string
+		want        []versionFix
+		wantErr     string
+		wantNoDrift bool
+	}{
+		{
+			name:      "errors for different resource types go to their own remediator",
+			applyErrs: []string{rdsErr, auroraErr},
+			want: []versionFix{
+				{ResourceType: "aws_db_instance", ModuleName: "rds", ActualVersion: "14.13", TerraformVersion: "14.7"},
+				{ResourceType: "aws_rds_cluster", ModuleName: "aurora_db", ActualVersion: "14.10", TerraformVersion: "14.6"},
+			},
+		},
+		{
+			name:        "one error isn't a version drift",
+			applyErrs:   []string{rdsErr, storageErr},
+			wantErr:     "doesn't look like a rds version mismatch",
+			wantNoDrift: true,
+		},
+		{
+			name:        "resource type without a remediator",
+			applyErrs:   []string{"Error: updating S3 Bucket: AccessDenied, with module.s3.aws_s3_bucket.bucket,"},
+			wantErr:     "aws_s3_bucket, which has no version drift remediator",
+			wantNoDrift: true,
+		},
+		{
+			name:        "error without a module resource",
+			applyErrs:   []string{"Error: Kubernetes cluster unreachable"},
+			wantErr:     "doesn't name the module resource",
+			wantNoDrift: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixes, err := parseApplyErrors(tt.applyErrs)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Equal(t, !tt.wantNoDrift, isCriticalDriftFailure(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, fixes)
+		})
+	}
+}
+
+func TestDriftResources(t *testing.T) {
+	fixes := []versionFix{
+		{ResourceType: "aws_elasticache_replication_group", ModuleName: "redis"},
+		{ResourceType: "aws_db_instance", ModuleName: "rds"},
+		{ResourceType: "aws_db_instance", ModuleName: "rds_replica"},
+	}
+
+	assert.Equal(t, "ElastiCache and RDS", driftResources(fixes))
+	assert.Equal(t, "Aurora", driftResources([]versionFix{{ResourceType: "aws_rds_cluster"}}))
+}
+
+func TestIsCriticalDriftFailure(t *testing.T) {
+	assert.False(t, isCriticalDriftFailure(fmt.Errorf("parsing terraform error failed: %w", notVersionDriftError{"not drift"})))
+	assert.False(t, isCriticalDriftFailure(errors.New("PR creation failed: a PR is already open for this namespace, skipping")))
+	assert.True(t, isCriticalDriftFailure(errors.New("error updating Terraform: module \"rds\" not found")))
+}
@@ -0,0 +1,126 @@
+package environment
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultFailureCatalogue is used when no catalogue file is given.
+//
+//go:embed failureCatalogue.yaml
+var defaultFailureCatalogue []byte
+
+// failureCategory is a known cause of a failed apply, recognised by its patterns.
+type failureCategory struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Patterns    []string `yaml:"patterns"`
+
+	compiled []*regexp.Regexp
+}
+
+type failureCatalogue struct {
+	Categories []failureCategory `yaml:"categories"`
+}
+
+// failureClassification is the category an apply failure matched, and the resource that failed.
+type failureClassification struct {
+	Category    string
+	Description string
+	// Resource is the terraform address or kubectl file that failed, if it could be found.
+	Resource string
+}
+
+var (
+	terraformResourceRe = regexp.MustCompile(`with ([^\s,]+),`)
+	kubectlResourceRe   = regexp.MustCompile(`error when \w+ "([^"]+)"`)
+)
+
+// loadFailureCatalogue reads the catalogue of known failures from path, or the catalogue
+// built into the cli when path is empty, and compiles its patterns.
+func loadFailureCatalogue(path string) (*failureCatalogue, error) {
+	data := defaultFailureCatalogue
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading failure catalogue: %w", err)
+		}
+	}
+
+	var catalogue failureCatalogue
+	if err := yaml.UnmarshalStrict(data, &catalogue); err != nil {
+		return nil, fmt.Errorf("error parsing failure catalogue: %w", err)
+	}
+
+	for i := range catalogue.Categories {
+		c := &catalogue.Categories[i]
+		if c.Name == "" || len(c.Patterns) == 0 {
+			return nil, fmt.Errorf("failure catalogue category %d needs a name and at least one pattern", i+1)
+		}
+		for _, p := range c.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern in failure catalogue category %s: %w", c.Name, err)
+			}
+			c.compiled = append(c.compiled, re)
+		}
+	}
+
+	return &catalogue, nil
+}
+
+// classify returns the first category matching the apply output, or nil if the failure isn't
+// a known one. The failing resource is the first one named after the matching error.
+func (c *failureCatalogue) classify(output string) *failureClassification {
+	for _, category := range c.Categories {
+		for _, re := range category.compiled {
+			loc := re.FindStringIndex(output)
+			if loc == nil {
+				continue
+			}
+
+			return &failureClassification{
+				Category:    category.Name,
+				Description: category.Description,
+				Resource:    failedResource(output, loc[0]),
+			}
+		}
+	}
+
+	return nil
+}
+
+// failedResource finds the resource named in the error at position start in the output.
+// Terraform names it in a "with <address>," line after the error summary, and kubectl
+// names the file it was applying in the error itself.
+func failedResource(output string, start int) string {
+	if m := terraformResourceRe.FindStringSubmatch(output[start:]); m != nil {
+		return m[1]
+	}
+
+	lineStart := strings.LastIndex(output[:start], "\n") + 1
+	if m := kubectlResourceRe.FindStringSubmatch(output[lineStart:]); m != nil {
+		return m[1]
+	}
+
+	if m := terraformResourceRe.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+// slackText describes the classification for the failed build notification.
+func (f *failureClassification) slackText() string {
+	text := fmt.Sprintf("This looks like *%s*: %s.", f.Category, f.Description)
+	if f.Resource != "" {
+		text += fmt.Sprintf(" Failing resource: `%s`.", f.Resource)
+	}
+	return text
+}
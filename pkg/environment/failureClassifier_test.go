@@ -0,0 +1,121 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	catalogue, err := loadFailureCatalogue("")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		output       string
+		wantCategory string
+		wantResource string
+	}{
+		{
+			name: "version drift",
+			output: `Error: updating RDS DB Instance (cloud-platform-a): operation error RDS: ModifyDBInstance, api error InvalidParameterCombination: Cannot upgrade postgres from 14.13 to 14.7.
+
+  with module.rds.aws_db_instance.rds,
+  on rds.tf line 1, in module "rds":`,
+			wantCategory: "version-drift",
+			wantResource: "module.rds.aws_db_instance.rds",
+		},
+		{
+			name: "access denied names the resource after the matching error",
+			output: `Warning: Argument is deprecated
+
+  with module.ecr.aws_ecr_repository.repo,
+
+Error: creating S3 Bucket (cloud-platform-b): AccessDenied: Access Denied
+
+  with module.s3.aws_s3_bucket.bucket,`,
+			wantCategory: "iam-access-denied",
+			wantResource: "module.s3.aws_s3_bucket.bucket",
+		},
+		{
+			name:         "state lock",
+			output:       "Error: Error acquiring the state lock\n\nError message: ConditionalCheckFailedException: The conditional request failed",
+			wantCategory: "state-lock",
+		},
+		{
+			name:         "kubernetes resource quota",
+			output:       `Error from server (Forbidden): error when creating "namespaces/live/foo/deployment.yaml": pods "foo" is forbidden: exceeded quota: namespace-quota`,
+			wantCategory: "quota-exceeded",
+			wantResource: "namespaces/live/foo/deployment.yaml",
+		},
+		{
+			name: "resource already exists",
+			output: `Error: creating IAM Role (foo): EntityAlreadyExists: Role with name foo already exists.
+
+  with module.irsa.aws_iam_role.irsa,`,
+			wantCategory: "resource-already-exists",
+			wantResource: "module.irsa.aws_iam_role.irsa",
+		},
+		{
+			name:         "invalid provider configuration",
+			output:       "Error: Invalid provider configuration\n\nProvider \"registry.terraform.io/hashicorp/aws\" requires explicit configuration.",
+			wantCategory: "invalid-provider-config",
+		},
+		{
+			name:   "unknown failure",
+			output: "Error: Unsupported argument\n\n  on main.tf line 3, in module \"foo\":",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := catalogue.classify(tt.output)
+			if tt.wantCategory == "" {
+				assert.Nil(t, got)
+				return
+			}
+			if assert.NotNil(t, got) {
+				assert.Equal(t, tt.wantCategory, got.Category)
+				assert.Equal(t, tt.wantResource, got.Resource)
+			}
+		})
+	}
+}
+
+func TestLoadFailureCatalogue(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	custom := write("custom.yaml", `categories:
+  - name: pingdom
+    description: the pingdom check couldn't be created
+    patterns:
+      - 'pingdom.*403'
+`)
+	catalogue, err := loadFailureCatalogue(custom)
+	assert.NoError(t, err)
+	got := catalogue.classify("Error: pingdom api returned 403\n\n  with pingdom_check.foo,")
+	assert.Equal(t, &failureClassification{
+		Category:    "pingdom",
+		Description: "the pingdom check couldn't be created",
+		Resource:    "pingdom_check.foo",
+	}, got)
+	assert.Equal(t, "This looks like *pingdom*: the pingdom check couldn't be created. Failing resource: `pingdom_check.foo`.", got.slackText())
+
+	_, err = loadFailureCatalogue(write("bad-pattern.yaml", "categories:\n  - name: bad\n    patterns: ['(']\n"))
+	assert.ErrorContains(t, err, "invalid pattern in failure catalogue category bad")
+
+	_, err = loadFailureCatalogue(write("no-patterns.yaml", "categories:\n  - name: empty\n"))
+	assert.ErrorContains(t, err, "needs a name and at least one pattern")
+
+	_, err = loadFailureCatalogue(write("typo.yaml", "categories:\n  - name: typo\n    pattern: ['x']\n"))
+	assert.ErrorContains(t, err, "error parsing failure catalogue")
+
+	_, err = loadFailureCatalogue(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "error reading failure catalogue")
+}
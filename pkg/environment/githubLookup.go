@@ -0,0 +1,161 @@
+package environment
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+)
+
+// maxSuggestions is how many close matches are suggested for a team or repository which
+// can't be found.
+const maxSuggestions = 3
+
+// githubLookup confirms the github team and source repository of a namespace exist. A nil
+// lookup, i.e. without a github token, confirms everything, leaving only the format checks.
+type githubLookup struct {
+	gh  github.GithubIface
+	org string
+	out io.Writer
+	// offline is set when github can't be reached, after which nothing else is looked up.
+	offline bool
+	teams   []string
+	repos   map[string]bool
+}
+
+func newGithubLookup(gh github.GithubIface, out io.Writer) *githubLookup {
+	return &githubLookup{gh: gh, org: mojOwner, out: out, repos: map[string]bool{}}
+}
+
+func (l *githubLookup) goOffline(err error) {
+	l.offline = true
+	fmt.Fprintf(l.out, "Unable to reach github, only the format of the github team and source code will be checked: %s\n", err)
+}
+
+// checkTeam returns an error, suggesting close matches, if team isn't in the organisation.
+func (l *githubLookup) checkTeam(team string) error {
+	if l == nil || l.offline {
+		return nil
+	}
+
+	if l.teams == nil {
+		teams, err := l.gh.ListTeams(l.org)
+		if err != nil {
+			l.goOffline(err)
+			return nil
+		}
+		l.teams = teams
+	}
+	if util.Contains(l.teams, team) {
+		return nil
+	}
+
+	return notFoundError(fmt.Sprintf("team %q was not found in the %s organisation", team, l.org), closeMatches(team, l.teams, false))
+}
+
+// checkRepository warns, suggesting close matches, if the repository of a github URL can't be
+// found. It isn't an error, as the token may not be able to see the repository, e.g. a private
+// one. URLs which aren't of a github repository are left to the format check.
+func (l *githubLookup) checkRepository(url string) error {
+	if l == nil || l.offline {
+		return nil
+	}
+
+	path := strings.Trim(strings.TrimPrefix(url, "https://github.com/"), "/")
+	parts := strings.Split(path, "/")
+	if path == url || len(parts) < 2 {
+		return nil
+	}
+	owner, repo := parts[0], strings.TrimSuffix(parts[1], ".git")
+	fullName := owner + "/" + repo
+
+	exists, ok := l.repos[fullName]
+	if !ok {
+		var err error
+		exists, err = l.gh.RepositoryExists(owner, repo)
+		if err != nil {
+			l.goOffline(err)
+			return nil
+		}
+		l.repos[fullName] = exists
+	}
+	if exists {
+		return nil
+	}
+
+	// suggestions are best effort, the repository not existing is the error
+	var suggestions []string
+	found, err := l.gh.SearchRepositories(fmt.Sprintf("%s in:name org:%s", repo, owner))
+	if err == nil {
+		for _, name := range closeMatches(fullName, found, true) {
+			suggestions = append(suggestions, "https://github.com/"+name)
+		}
+	}
+
+	fmt.Fprintf(l.out, "Warning: %s, check the source code URL is right\n", notFoundError(fmt.Sprintf("repository %s was not found, or the github token can't see it", fullName), suggestions))
+	return nil
+}
+
+func notFoundError(msg string, suggestions []string) error {
+	if len(suggestions) == 0 {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%s, did you mean: %s?", msg, strings.Join(suggestions, ", "))
+}
+
+// closeMatches returns the candidates closest to target by edit distance, at most
+// maxSuggestions of them. Unless all is set, only candidates within a third of target's length
+// of it, or containing it, are returned.
+func closeMatches(target string, candidates []string, all bool) []string {
+	target = strings.ToLower(target)
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, c := range candidates {
+		d := editDistance(target, strings.ToLower(c))
+		if all || d <= len(target)/3+1 || strings.Contains(strings.ToLower(c), target) {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,81 @@
+package environment
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckTeam(t *testing.T) {
+	gh := new(mocks.GithubIface)
+	gh.On("ListTeams", "ministryofjustice").Return([]string{"webops", "web-ops-team", "laa-crime", "webops-admins"}, nil).Once()
+	lookup := newGithubLookup(gh, &strings.Builder{})
+
+	assert.NoError(t, lookup.checkTeam("webops"))
+	assert.EqualError(t, lookup.checkTeam("webop"), `team "webop" was not found in the ministryofjustice organisation, did you mean: webops, webops-admins?`)
+	assert.EqualError(t, lookup.checkTeam("hmpps-something"), `team "hmpps-something" was not found in the ministryofjustice organisation`)
+	gh.AssertExpectations(t)
+
+	var none *githubLookup
+	assert.NoError(t, none.checkTeam("anything"))
+}
+
+func TestCheckRepository(t *testing.T) {
+	gh := new(mocks.GithubIface)
+	gh.On("RepositoryExists", "ministryofjustice", "myapp").Return(true, nil).Once()
+	gh.On("RepositoryExists", "ministryofjustice", "my-ap").Return(false, nil).Once()
+	gh.On("SearchRepositories", "my-ap in:name org:ministryofjustice").Return([]string{"ministryofjustice/my-app", "ministryofjustice/my-app-infra"}, nil)
+	var out strings.Builder
+	lookup := newGithubLookup(gh, &out)
+
+	assert.NoError(t, lookup.checkRepository("https://github.com/ministryofjustice/myapp"))
+	assert.NoError(t, lookup.checkRepository("https://github.com/ministryofjustice/myapp.git"))
+	assert.Empty(t, out.String())
+
+	// the token may not be able to see a private repository, so it's only a warning
+	assert.NoError(t, lookup.checkRepository("https://github.com/ministryofjustice/my-ap/"))
+	assert.Equal(t, "Warning: repository ministryofjustice/my-ap was not found, or the github token can't see it, did you mean: https://github.com/ministryofjustice/my-app, https://github.com/ministryofjustice/my-app-infra?, check the source code URL is right\n", out.String())
+	assert.NoError(t, lookup.checkRepository("https://gitlab.com/ministryofjustice/myapp"))
+	gh.AssertExpectations(t)
+}
+
+func TestGithubLookupOffline(t *testing.T) {
+	gh := new(mocks.GithubIface)
+	gh.On("ListTeams", mock.Anything).Return(nil, errors.New("dial tcp: no such host"))
+	var out strings.Builder
+	lookup := newGithubLookup(gh, &out)
+
+	assert.NoError(t, lookup.checkTeam("webop"))
+	assert.NoError(t, lookup.checkRepository("https://github.com/ministryofjustice/my-ap"))
+	assert.Contains(t, out.String(), "Unable to reach github, only the format of the github team and source code will be checked: dial tcp: no such host")
+	gh.AssertNotCalled(t, "RepositoryExists", mock.Anything, mock.Anything)
+}
+
+func TestCreateNamespaceChecksGithub(t *testing.T) {
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(t.TempDir(), "namespaces")
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListTeams", "ministryofjustice").Return([]string{"webop"}, nil)
+	gh.On("RepositoryExists", "ministryofjustice", "myapp").Return(false, nil)
+	gh.On("SearchRepositories", mock.Anything).Return(nil, errors.New("rate limited"))
+
+	var out strings.Builder
+	_, err := createTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, Set: validAnswers()}, newGithubLookup(gh, &out))
+	assert.ErrorContains(t, err, `githubTeam: team "webops" was not found in the ministryofjustice organisation, did you mean: webop?`)
+	assert.NotContains(t, err.Error(), "sourceCode")
+	assert.Contains(t, out.String(), "Warning: repository ministryofjustice/myapp was not found, or the github token can't see it")
+	assert.NoDirExists(t, namespaceBaseFolder)
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("webops", "webops"))
+	assert.Equal(t, 1, editDistance("webop", "webops"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+	assert.Equal(t, 4, editDistance("", "abcd"))
+}
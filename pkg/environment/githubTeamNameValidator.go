@@ -1,9 +1,21 @@
 package environment
 
-type githubTeamNameValidator struct{}
+import "fmt"
+
+var githubTeamNameRule = &regexValidator{regex: `^[a-z0-9\-]+$`}
+
+type githubTeamNameValidator struct {
+	// lookup confirms the team exists, when set.
+	lookup *githubLookup
+}
 
 func (v *githubTeamNameValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^[a-z0-9\-]+$`
-	return r.isValid(s)
+	if !githubTeamNameRule.isValid(s) {
+		return false
+	}
+	if err := v.lookup.checkTeam(s); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
 }
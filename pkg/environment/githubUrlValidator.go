@@ -1,9 +1,21 @@
 package environment
 
-type githubUrlValidator struct{}
+import "fmt"
+
+var githubUrlRule = &regexValidator{regex: `^https:\/\/github\.com\/[a-z\/\-_\.]+$`}
+
+type githubUrlValidator struct {
+	// lookup confirms the repository exists, when set.
+	lookup *githubLookup
+}
 
 func (v *githubUrlValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^https:\/\/github\.com\/[a-z\/\-_\.]+$`
-	return r.isValid(s)
+	if !githubUrlRule.isValid(s) {
+		return false
+	}
+	if err := v.lookup.checkRepository(s); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
 }
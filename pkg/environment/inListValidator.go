@@ -10,12 +10,19 @@ type inListValidator struct {
 }
 
 func (v *inListValidator) isValid(s string) bool {
+	if err := v.validate(s); err != nil {
+		fmt.Printf("Value %s\n", err)
+		return false
+	}
+	return true
+}
+
+func (v *inListValidator) validate(s string) error {
 	for _, i := range v.list {
 		if s == i {
-			return true
+			return nil
 		}
 	}
 
-	fmt.Printf("Value must be in the list: %s\n", strings.Join(v.list, ", "))
-	return false
+	return fmt.Errorf("must be in the list: %s", strings.Join(v.list, ", "))
 }
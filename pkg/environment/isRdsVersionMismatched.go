@@ -18,7 +18,7 @@ type RdsVersionResults struct {
 func IsRdsVersionMismatched(csvErr string) (*RdsVersionResults, error) {
 	match, _ := regexp.MatchString("Error: updating RDS .* api error InvalidParameterCombination:.* from .* (?:to|with requested version) .*", csvErr)
 	if !match {
-		return nil, errors.New("terraform is failing but it doesn't look like a rds version mismatch")
+		return nil, notVersionDriftError{"terraform is failing but it doesn't look like a rds version mismatch"}
 	}
 
 	versionRegex := regexp.MustCompile(`(?i)from ([^\s]+) (?:to|with requested version) ([^\s]+)`)
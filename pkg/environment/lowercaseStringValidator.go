@@ -1,9 +1,9 @@
 package environment
 
+var lowercaseStringRule = &regexValidator{regex: `^\w+-*\w+$`}
+
 type lowercaseStringValidator struct{}
 
 func (v *lowercaseStringValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^\w+-*\w+$`
-	return r.isValid(s)
+	return lowercaseStringRule.isValid(s)
 }
@@ -0,0 +1,288 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	"gopkg.in/yaml.v2"
+)
+
+// ModuleUsage is a module block in a namespace, and the ref its source is pinned to.
+type ModuleUsage struct {
+	ClusterDir string `json:"clusterDir"`
+	Namespace  string `json:"namespace"`
+	// File is the path of the file declaring the module, relative to the namespace folder.
+	File       string `json:"file"`
+	Name       string `json:"name"`
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	// Latest and Behind are only set once the usage has been compared with the latest versions,
+	// Behind describes how far behind the ref is e.g. "2 minor".
+	Latest string `json:"latest,omitempty"`
+	Behind string `json:"behind,omitempty"`
+}
+
+// ModuleInventoryOptions selects which module usages are listed.
+type ModuleInventoryOptions struct {
+	// Module only lists usages of this module, matched the same way as bump-module.
+	Module string
+	// Constraint only lists usages whose ref meets this semver constraint e.g. "<2".
+	Constraint string
+	// Outdated only lists usages behind the latest version.
+	Outdated bool
+	// MinorsBehind is how far behind an outdated usage has to be: at least this many minor
+	// versions, or a major version. 0 counts any usage behind the latest version, even by a patch.
+	MinorsBehind int
+}
+
+// LatestModuleVersions maps a module repository, or its name, to its latest version.
+type LatestModuleVersions map[string]string
+
+// ModuleInventory walks the namespaces folder of the environments repository at root, and
+// returns every module block declared in a namespace.
+func ModuleInventory(root string) ([]ModuleUsage, error) {
+	nsRoot := filepath.Join(root, "namespaces")
+	return moduleUsages(nsRoot, nsRoot)
+}
+
+// moduleUsages returns the module blocks declared in the .tf files under dir, which is the
+// namespaces folder nsRoot or one of its namespaces. The modules terraform init has downloaded
+// into .terraform folders aren't included, and files which can't be parsed are skipped with a
+// warning rather than failing the whole walk.
+func moduleUsages(nsRoot, dir string) ([]ModuleUsage, error) {
+	var usages []ModuleUsage
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) != ".tf" {
+			return nil
+		}
+
+		// namespaces/<cluster>/<namespace>/.../<file>.tf
+		rel, err := filepath.Rel(nsRoot, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 3 {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: skipping %s: %v", path, err)
+			return nil
+		}
+
+		f, diags := hclwrite.ParseConfig(data, path, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			log.Printf("Warning: skipping %s, it can't be parsed: %s", path, diags)
+			return nil
+		}
+
+		for _, block := range f.Body().Blocks() {
+			source := moduleSource(block)
+			if source == "" {
+				continue
+			}
+
+			usages = append(usages, ModuleUsage{
+				ClusterDir: parts[0],
+				Namespace:  parts[1],
+				File:       strings.Join(parts[2:], "/"),
+				Name:       block.Labels()[0],
+				Repository: moduleRepository(source),
+				Ref:        moduleSourceRef(source),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+
+	return usages, nil
+}
+
+// LoadLatestModuleVersions reads the latest module versions from a YAML or JSON file of
+// repository: version pairs.
+func LoadLatestModuleVersions(path string) (LatestModuleVersions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading latest module versions: %w", err)
+	}
+
+	latest := make(LatestModuleVersions)
+	if err := yaml.Unmarshal(data, &latest); err != nil {
+		return nil, fmt.Errorf("error parsing latest module versions: %w", err)
+	}
+	return latest, nil
+}
+
+// LatestModuleVersionsFromGithub looks up the latest release of every Github repository used
+// by the module usages. Repositories without releases are left out.
+func LatestModuleVersionsFromGithub(gh github.GithubIface, usages []ModuleUsage) LatestModuleVersions {
+	latest := make(LatestModuleVersions)
+	for _, u := range usages {
+		if _, done := latest[u.Repository]; done {
+			continue
+		}
+
+		parts := strings.Split(u.Repository, "/")
+		if len(parts) != 3 || parts[0] != "github.com" {
+			continue
+		}
+
+		tag, err := gh.GetLatestRelease(parts[1], parts[2])
+		if err != nil {
+			log.Printf("Couldn't get the latest release of %s: %v", u.Repository, err)
+			tag = ""
+		}
+		latest[u.Repository] = tag
+	}
+
+	for repo, tag := range latest {
+		if tag == "" {
+			delete(latest, repo)
+		}
+	}
+	return latest
+}
+
+// lookup returns the latest version of a module repository, which may be listed by its
+// repository, its name, or its name without the cloud-platform-terraform- prefix.
+func (l LatestModuleVersions) lookup(repo string) (string, bool) {
+	name := path.Base(repo)
+	for _, key := range []string{repo, name, strings.TrimPrefix(name, "cloud-platform-terraform-")} {
+		if v, ok := l[key]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// CompareModuleVersions sets the latest version of each module usage, and how far behind it its ref is.
+func CompareModuleVersions(usages []ModuleUsage, latest LatestModuleVersions) {
+	for i := range usages {
+		v, ok := latest.lookup(usages[i].Repository)
+		if !ok {
+			continue
+		}
+		usages[i].Latest = v
+		usages[i].Behind = versionsBehind(usages[i].Ref, v)
+	}
+}
+
+// versionsBehind describes how far ref is behind latest by the most significant part of the
+// version that differs, e.g. 1.2.0 is "2 minor" behind 1.4.1. It returns an empty string if
+// ref is up to date or either isn't a semantic version.
+func versionsBehind(ref, latest string) string {
+	current, err := version.NewVersion(ref)
+	if err != nil {
+		return ""
+	}
+	target, err := version.NewVersion(latest)
+	if err != nil || !current.LessThan(target) {
+		return ""
+	}
+
+	c, t := current.Segments(), target.Segments()
+	for i, level := range []string{"major", "minor", "patch"} {
+		if c[i] != t[i] {
+			return fmt.Sprintf("%d %s", t[i]-c[i], level)
+		}
+	}
+	return "prerelease"
+}
+
+// FilterModuleUsages returns the module usages selected by the options.
+func FilterModuleUsages(usages []ModuleUsage, opt ModuleInventoryOptions) ([]ModuleUsage, error) {
+	if opt.MinorsBehind < 0 {
+		return nil, fmt.Errorf("the number of minor versions behind can't be negative, not %d", opt.MinorsBehind)
+	}
+
+	var constraint version.Constraints
+	if opt.Constraint != "" {
+		var err error
+		constraint, err = parseVersionConstraint(opt.Constraint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filtered []ModuleUsage
+	for _, u := range usages {
+		if opt.Module != "" && !isModuleRepository(u.Repository, opt.Module) {
+			continue
+		}
+		if constraint != nil {
+			v, err := version.NewVersion(u.Ref)
+			if err != nil || !constraint.Check(v) {
+				continue
+			}
+		}
+		if opt.Outdated && !isOutdated(u, opt.MinorsBehind) {
+			continue
+		}
+		filtered = append(filtered, u)
+	}
+	return filtered, nil
+}
+
+// isOutdated reports whether a module usage is a major version, or at least minorsBehind minor
+// versions, behind its latest version. With minorsBehind 0 any usage behind it is outdated.
+func isOutdated(u ModuleUsage, minorsBehind int) bool {
+	if u.Behind == "" {
+		return false
+	}
+	if minorsBehind == 0 {
+		return true
+	}
+	// both are versions, as the usage is behind
+	c := version.Must(version.NewVersion(u.Ref)).Segments()
+	t := version.Must(version.NewVersion(u.Latest)).Segments()
+	return c[0] != t[0] || t[1]-c[1] >= minorsBehind
+}
+
+// PrintModuleInventory writes the module usages to w either as a table or as json.
+func PrintModuleInventory(w io.Writer, usages []ModuleUsage, output string) error {
+	switch output {
+	case "json":
+		if usages == nil {
+			usages = []ModuleUsage{}
+		}
+		data, err := json.MarshalIndent(usages, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table", "":
+		t := table.NewWriter()
+		t.SetOutputMirror(w)
+		t.AppendHeader(table.Row{"Cluster", "Namespace", "Module", "Repository", "Ref", "Latest", "Behind"})
+		for _, u := range usages {
+			t.AppendRow(table.Row{u.ClusterDir, u.Namespace, u.Name, u.Repository, u.Ref, u.Latest, u.Behind})
+		}
+		t.SetStyle(table.StyleLight)
+		t.Render()
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: table, json", output)
+	}
+}
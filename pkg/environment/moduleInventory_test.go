@@ -0,0 +1,158 @@
+package environment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeNamespaceFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return root
+}
+
+func TestModuleInventory(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/foo/resources/main.tf": `module "serviceaccount" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount?ref=1.1.0"
+}
+
+module "rds" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+}
+
+resource "kubernetes_secret" "rds" {}
+`,
+		"namespaces/live-2/bar/resources/sa.tf": `module "sa" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount?ref=2.0.0"
+}
+`,
+		"namespaces/live/foo/00-namespace.yaml": "",
+		"namespaces/live/foo/resources/.terraform/modules/rds/main.tf": `module "downloaded" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-downloaded?ref=1.0.0"
+}
+`,
+		"namespaces/live/baz/resources/broken.tf": "module \"broken\" {\n",
+		"terraform/main.tf":                       "module \"ignored\" {\n  source = \"./modules/x\"\n}\n",
+	})
+
+	usages, err := ModuleInventory(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []ModuleUsage{
+		{ClusterDir: "live", Namespace: "foo", File: "resources/main.tf", Name: "serviceaccount", Repository: "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount", Ref: "1.1.0"},
+		{ClusterDir: "live", Namespace: "foo", File: "resources/main.tf", Name: "rds", Repository: "github.com/ministryofjustice/cloud-platform-terraform-rds-instance", Ref: "8.0.0"},
+		{ClusterDir: "live-2", Namespace: "bar", File: "resources/sa.tf", Name: "sa", Repository: "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount", Ref: "2.0.0"},
+	}, usages)
+
+	CompareModuleVersions(usages, LatestModuleVersions{"serviceaccount": "2.3.1", "github.com/ministryofjustice/cloud-platform-terraform-rds-instance": "8.0.0"})
+	assert.Equal(t, "2.3.1", usages[0].Latest)
+	assert.Equal(t, "1 major", usages[0].Behind)
+	assert.Equal(t, "", usages[1].Behind)
+	assert.Equal(t, "3 minor", usages[2].Behind)
+
+	filtered, err := FilterModuleUsages(usages, ModuleInventoryOptions{Module: "serviceaccount", Constraint: "<2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ModuleUsage{usages[0]}, filtered)
+
+	filtered, err = FilterModuleUsages(usages, ModuleInventoryOptions{Outdated: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []ModuleUsage{usages[0], usages[2]}, filtered)
+
+	filtered, err = FilterModuleUsages(usages, ModuleInventoryOptions{Outdated: true, MinorsBehind: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []ModuleUsage{usages[0], usages[2]}, filtered)
+
+	// a major version behind is always outdated
+	filtered, err = FilterModuleUsages(usages, ModuleInventoryOptions{Outdated: true, MinorsBehind: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []ModuleUsage{usages[0]}, filtered)
+
+	_, err = FilterModuleUsages(usages, ModuleInventoryOptions{Outdated: true, MinorsBehind: -1})
+	assert.ErrorContains(t, err, "can't be negative")
+
+	_, err = FilterModuleUsages(usages, ModuleInventoryOptions{Constraint: "<"})
+	assert.ErrorContains(t, err, "invalid version constraint")
+}
+
+func TestIsOutdated(t *testing.T) {
+	tests := []struct {
+		ref, latest  string
+		minorsBehind int
+		want         bool
+	}{
+		{"1.2.0", "1.2.3", 0, true},
+		{"1.2.0", "1.2.3", 1, false},
+		{"1.2.0", "1.3.0", 2, false},
+		{"1.2.0", "1.4.1", 2, true},
+		{"1.9.0", "2.0.0", 2, true},
+		{"1.2.0", "1.2.0", 0, false},
+		{"main", "1.2.0", 0, false},
+	}
+	for _, tt := range tests {
+		u := ModuleUsage{Ref: tt.ref, Latest: tt.latest, Behind: versionsBehind(tt.ref, tt.latest)}
+		assert.Equal(t, tt.want, isOutdated(u, tt.minorsBehind), "%s -> %s, %d minor", tt.ref, tt.latest, tt.minorsBehind)
+	}
+}
+
+func TestVersionsBehind(t *testing.T) {
+	tests := []struct{ ref, latest, want string }{
+		{"1.2.0", "1.4.1", "2 minor"},
+		{"1.2.0", "1.2.3", "3 patch"},
+		{"v1.9.9", "v3.0.0", "2 major"},
+		{"2.0.0", "1.0.0", ""},
+		{"1.0.0", "1.0", ""},
+		{"main", "1.0.0", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, versionsBehind(tt.ref, tt.latest), "%s -> %s", tt.ref, tt.latest)
+	}
+}
+
+func TestLatestModuleVersionsFromGithub(t *testing.T) {
+	gh := mocks.NewGithubIface(t)
+	gh.On("GetLatestRelease", "ministryofjustice", "cloud-platform-terraform-serviceaccount").Return("1.2.0", nil).Once()
+	gh.On("GetLatestRelease", "ministryofjustice", "cloud-platform-terraform-no-releases").Return("", errors.New("404 Not Found")).Once()
+
+	latest := LatestModuleVersionsFromGithub(gh, []ModuleUsage{
+		{Repository: "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount"},
+		{Repository: "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount"},
+		{Repository: "github.com/ministryofjustice/cloud-platform-terraform-no-releases"},
+		{Repository: "./modules/local"},
+	})
+	assert.Equal(t, LatestModuleVersions{"github.com/ministryofjustice/cloud-platform-terraform-serviceaccount": "1.2.0"}, latest)
+}
+
+func TestLoadLatestModuleVersions(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"latest.json": `{"rds-instance": "8.0.1"}`,
+	})
+	latest, err := LoadLatestModuleVersions(filepath.Join(root, "latest.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, LatestModuleVersions{"rds-instance": "8.0.1"}, latest)
+}
+
+func TestPrintModuleInventory(t *testing.T) {
+	usages := []ModuleUsage{{ClusterDir: "live", Namespace: "foo", Name: "sa", Repository: "github.com/org/sa", Ref: "1.0.0"}}
+
+	var out strings.Builder
+	assert.NoError(t, PrintModuleInventory(&out, usages, "json"))
+	assert.Contains(t, out.String(), `"ref": "1.0.0"`)
+	assert.NotContains(t, out.String(), "latest")
+
+	out.Reset()
+	assert.NoError(t, PrintModuleInventory(&out, nil, "json"))
+	assert.Equal(t, "[]\n", out.String())
+
+	assert.ErrorContains(t, PrintModuleInventory(&out, usages, "yaml"), "unsupported output format")
+}
@@ -0,0 +1,403 @@
+package environment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	gogithub "github.com/google/go-github/github"
+	"github.com/hashicorp/go-version"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// maxReleaseNoteLength is how much of each release's notes goes into the PR description,
+// to keep it readable and well under Github's limit on the size of a PR body.
+const maxReleaseNoteLength = 1500
+
+// ModuleUpgradeOptions configures an upgrade of a module across the environments repository,
+// with a PR raised for each namespace.
+type ModuleUpgradeOptions struct {
+	BumpModuleOptions
+	// Namespace only upgrades this namespace.
+	Namespace string
+	// Team only upgrades the namespaces this Github team has access to.
+	Team string
+	// Limit is the maximum number of PRs to raise, 0 means no limit.
+	Limit int
+	// GithubToken is used to read release notes and raise the PRs. The branches are pushed to the
+	// origin of the checkout the command is run in, as the user running it.
+	GithubToken string
+}
+
+// moduleUpgrade is the change to the modules of one namespace.
+type moduleUpgrade struct {
+	dir   string
+	files []bumpedFile
+	teams []string
+}
+
+// UpgradeModules bumps a module one namespace at a time, raising a PR for each namespace with
+// the release notes of the module between the old and new version, and asks the namespace's
+// Github teams to review it. Namespaces which already have an open upgrade PR are skipped.
+func UpgradeModules(gh github.GithubIface, opt ModuleUpgradeOptions) error {
+	return upgradeModules(".", gh, opt, os.Stdout, raisePR)
+}
+
+type prRaiser func(gh github.GithubIface, ghToken, repo string, pr pullRequest) (string, error)
+
+func upgradeModules(root string, gh github.GithubIface, opt ModuleUpgradeOptions, out io.Writer, raise prRaiser) error {
+	target, from, err := parseBumpVersions(opt.BumpModuleOptions)
+	if err != nil {
+		return err
+	}
+
+	usages, err := ModuleInventory(root)
+	if err != nil {
+		return err
+	}
+	usages, err = FilterModuleUsages(usages, ModuleInventoryOptions{Module: opt.Module})
+	if err != nil {
+		return err
+	}
+	if len(usages) == 0 {
+		return fmt.Errorf("no namespaces use the %s module", opt.Module)
+	}
+	repository := usages[0].Repository
+	releases := &moduleReleases{gh: gh}
+
+	successes := make(map[string]string)
+	failures := make(map[string]string)
+	skipped := make(map[string]string)
+	for _, ns := range namespacesUsing(usages) {
+		if opt.Limit > 0 && len(successes) >= opt.Limit {
+			break
+		}
+		if opt.Namespace != "" && ns.Namespace != opt.Namespace {
+			continue
+		}
+
+		name := ns.ClusterDir + "/" + ns.Namespace
+		upgrade, err := planModuleUpgrade(root, ns, usages, opt, target, from)
+		if err != nil {
+			failures[name] = err.Error()
+			continue
+		}
+		if len(upgrade.files) == 0 {
+			continue
+		}
+		if opt.Team != "" && !util.Contains(upgrade.teams, opt.Team) {
+			continue
+		}
+
+		title := moduleUpgradePRTitle(ns.Namespace, opt.Module, target.Original())
+		if !opt.DryRun {
+			if open, err := openPR(gh, moduleUpgradePRPrefix(ns.Namespace)); err != nil {
+				log.Printf("Warning: error listing open PRs: %v", err)
+			} else if open != "" {
+				skipped[name] = "an upgrade PR is already open: " + open
+				continue
+			}
+		}
+
+		description := moduleUpgradeDescription(releases, repository, upgrade, target.Original())
+
+		if opt.DryRun {
+			fmt.Fprintf(out, "## %s\n\nTitle: %s\nReviewers: %s\n\n%s\n\n", name, title, strings.Join(upgrade.teams, ", "), description)
+			for _, f := range upgrade.files {
+				if err := writeUnifiedDiff(out, f.path, f.before, f.after); err != nil {
+					return err
+				}
+			}
+			successes[name] = "dry run"
+			continue
+		}
+
+		prURL, err := upgrade.raise(gh, opt.GithubToken, raise, pullRequest{
+			Branch:        ns.Namespace + "-" + strings.TrimPrefix(filepath.Base(repository), "cloud-platform-terraform-") + "-" + target.Original(),
+			Title:         title,
+			Description:   description,
+			CommitMessage: title,
+			TeamReviewers: upgrade.teams,
+		})
+		if err != nil {
+			failures[name] = err.Error()
+			continue
+		}
+		successes[name] = prURL
+	}
+
+	printUpgradeSummary(out, "Upgraded namespaces", successes)
+	printUpgradeSummary(out, "Skipped namespaces", skipped)
+	printUpgradeSummary(out, "Failed namespaces", failures)
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to upgrade %d namespaces", len(failures))
+	}
+	return nil
+}
+
+// parseBumpVersions parses the version to bump to and the constraint on the current version.
+func parseBumpVersions(opt BumpModuleOptions) (*version.Version, version.Constraints, error) {
+	target, err := version.NewVersion(opt.Version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid module version %q: %w", opt.Version, err)
+	}
+
+	var from version.Constraints
+	if opt.From != "" {
+		from, err = parseVersionConstraint(opt.From)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return target, from, nil
+}
+
+// namespacesUsing returns each namespace in the module usages once, in order.
+func namespacesUsing(usages []ModuleUsage) []ModuleUsage {
+	seen := make(map[string]bool)
+	var namespaces []ModuleUsage
+	for _, u := range usages {
+		key := u.ClusterDir + "/" + u.Namespace
+		if !seen[key] {
+			seen[key] = true
+			namespaces = append(namespaces, u)
+		}
+	}
+	return namespaces
+}
+
+// planModuleUpgrade bumps the module in the files of a namespace in memory, and finds the
+// Github teams to review the change.
+func planModuleUpgrade(root string, ns ModuleUsage, usages []ModuleUsage, opt ModuleUpgradeOptions, target *version.Version, from version.Constraints) (*moduleUpgrade, error) {
+	upgrade := &moduleUpgrade{dir: filepath.Join(root, "namespaces", ns.ClusterDir, ns.Namespace)}
+
+	seen := make(map[string]bool)
+	for _, u := range usages {
+		if u.ClusterDir != ns.ClusterDir || u.Namespace != ns.Namespace || seen[u.File] {
+			continue
+		}
+		seen[u.File] = true
+
+		f, err := bumpFile(filepath.Join(upgrade.dir, u.File), opt.BumpModuleOptions, target, from)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.majorUpgrades) > 0 && !opt.AllowMajor {
+			b := f.majorUpgrades[0]
+			return nil, fmt.Errorf("refusing to change the major version of module.%s from %s to %s without --allow-major", b.Module, b.From, b.To)
+		}
+		if len(f.bumps) > 0 {
+			upgrade.files = append(upgrade.files, *f)
+		}
+	}
+
+	teams, err := namespaceGithubTeams(upgrade.dir)
+	if err != nil {
+		return nil, err
+	}
+	upgrade.teams = teams
+
+	return upgrade, nil
+}
+
+// raise writes the upgraded files and raises the PR. If the PR can't be raised the files are put
+// back, after raisePR has gone back to main, so the change isn't picked up by the next namespace. The PR is raised from the user's
+// own checkout, so it's committed as them and their origin is left alone.
+func (u *moduleUpgrade) raise(gh github.GithubIface, ghToken string, raise prRaiser, pr pullRequest) (string, error) {
+	pr.RepoPath = u.dir
+	pr.Local = true
+	for _, f := range u.files {
+		if err := os.WriteFile(f.path, f.after, 0o644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+		rel, err := filepath.Rel(u.dir, f.path)
+		if err != nil {
+			return "", err
+		}
+		pr.Files = append(pr.Files, rel)
+	}
+
+	prURL, err := raise(gh, ghToken, "cloud-platform-environments", pr)
+	if err != nil {
+		for _, f := range u.files {
+			if writeErr := os.WriteFile(f.path, f.before, 0o644); writeErr != nil {
+				log.Printf("Warning: failed to restore %s: %v", f.path, writeErr)
+			}
+		}
+		return "", err
+	}
+
+	return prURL, nil
+}
+
+// moduleUpgradePRPrefix is the start of the title of every module upgrade PR for a namespace,
+// used to find upgrades that are already open.
+func moduleUpgradePRPrefix(namespace string) string {
+	return "Module upgrade in " + namespace + ":"
+}
+
+func moduleUpgradePRTitle(namespace, module, to string) string {
+	return fmt.Sprintf("%s %s to %s", moduleUpgradePRPrefix(namespace), module, to)
+}
+
+// moduleUpgradeDescription lists the modules being upgraded, followed by the release notes of
+// the module for each release after the oldest version being upgraded from.
+func moduleUpgradeDescription(releases *moduleReleases, repository string, upgrade *moduleUpgrade, to string) string {
+	var b strings.Builder
+	b.WriteString("Upgrade of `" + repository + "` to `" + to + "`:\n\n")
+
+	var oldest *version.Version
+	for _, f := range upgrade.files {
+		for _, bump := range f.bumps {
+			rel, _ := filepath.Rel(upgrade.dir, f.path)
+			fmt.Fprintf(&b, "- `module.%s` in `%s`: %s -> %s\n", bump.Module, rel, bump.From, bump.To)
+			if v, err := version.NewVersion(bump.From); err == nil && (oldest == nil || v.LessThan(oldest)) {
+				oldest = v
+			}
+		}
+	}
+
+	notes, err := releaseNotes(releases, repository, oldest, to)
+	if err != nil {
+		log.Printf("Warning: couldn't get the release notes of %s: %v", repository, err)
+		return b.String()
+	}
+	if notes != "" {
+		b.WriteString("\n## Release notes\n\n" + notes)
+	}
+	return b.String()
+}
+
+// moduleReleases lists the releases of each module repository once, as an upgrade puts the same
+// release notes in the PR of every namespace, and listing them for each would use up Github's
+// rate limit.
+type moduleReleases struct {
+	gh    github.GithubIface
+	cache map[string]moduleReleaseList
+}
+
+type moduleReleaseList struct {
+	releases []*gogithub.RepositoryRelease
+	err      error
+}
+
+// list returns the releases of a repository, e.g. github.com/org/repo. A failure is remembered
+// too, so it isn't retried for every namespace.
+func (m *moduleReleases) list(repository string) ([]*gogithub.RepositoryRelease, error) {
+	if l, ok := m.cache[repository]; ok {
+		return l.releases, l.err
+	}
+
+	parts := strings.Split(repository, "/")
+	if len(parts) != 3 || parts[0] != "github.com" {
+		return nil, fmt.Errorf("%s isn't a Github repository", repository)
+	}
+	releases, err := m.gh.ListReleases(parts[1], parts[2])
+	if m.cache == nil {
+		m.cache = make(map[string]moduleReleaseList)
+	}
+	m.cache[repository] = moduleReleaseList{releases, err}
+	return releases, err
+}
+
+// releaseNotes returns an excerpt of the notes of every release of the repository after from,
+// up to and including to, oldest first.
+func releaseNotes(releases *moduleReleases, repository string, from *version.Version, to string) (string, error) {
+	target, err := version.NewVersion(to)
+	if err != nil {
+		return "", err
+	}
+
+	list, err := releases.list(repository)
+	if err != nil {
+		return "", err
+	}
+
+	type release struct {
+		version *version.Version
+		r       *gogithub.RepositoryRelease
+	}
+	var included []release
+	for _, r := range list {
+		v, err := version.NewVersion(r.GetTagName())
+		if err != nil || v.GreaterThan(target) || (from != nil && !v.GreaterThan(from)) {
+			continue
+		}
+		included = append(included, release{v, r})
+	}
+	sort.Slice(included, func(i, j int) bool {
+		return included[i].version.LessThan(included[j].version)
+	})
+
+	var b strings.Builder
+	for _, r := range included {
+		body := strings.TrimSpace(r.r.GetBody())
+		if len(body) > maxReleaseNoteLength {
+			// back off to the start of the rune, so a multi-byte character isn't cut in half
+			cut := maxReleaseNoteLength
+			for cut > 0 && !utf8.RuneStart(body[cut]) {
+				cut--
+			}
+			body = body[:cut] + "...\n\n[Full release notes](" + r.r.GetHTMLURL() + ")"
+		}
+		fmt.Fprintf(&b, "### [%s](%s)\n\n%s\n\n", r.r.GetTagName(), r.r.GetHTMLURL(), body)
+	}
+	return b.String(), nil
+}
+
+// namespaceGithubTeams returns the Github teams given access to a namespace by its rolebindings,
+// i.e. the subjects named github:<team>.
+func namespaceGithubTeams(nsDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(nsDir, "01-rbac.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type roleBinding struct {
+		Subjects []struct {
+			Kind string `yaml:"kind"`
+			Name string `yaml:"name"`
+		} `yaml:"subjects"`
+	}
+
+	var teams []string
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var rb roleBinding
+		if err := dec.Decode(&rb); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", filepath.Join(nsDir, "01-rbac.yaml"), err)
+		}
+
+		for _, s := range rb.Subjects {
+			if team, ok := strings.CutPrefix(s.Name, "github:"); ok && s.Kind == "Group" && !util.Contains(teams, team) {
+				teams = append(teams, team)
+			}
+		}
+	}
+	return teams, nil
+}
+
+func printUpgradeSummary(out io.Writer, heading string, results map[string]string) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%s (%d):\n", heading, len(results))
+	for _, ns := range sortedKeys(results) {
+		fmt.Fprintf(out, "  - %s: %s\n", ns, results[ns])
+	}
+}
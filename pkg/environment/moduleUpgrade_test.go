@@ -0,0 +1,229 @@
+package environment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	gogithub "github.com/google/go-github/github"
+	"github.com/hashicorp/go-version"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const upgradeTestRbac = `kind: RoleBinding
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: %s-admin
+subjects:
+  - kind: Group
+    name: "github:%s"
+    apiGroup: rbac.authorization.k8s.io
+  - kind: User
+    name: "github:someone"
+    apiGroup: rbac.authorization.k8s.io
+`
+
+func upgradeTestNamespaces(t *testing.T) string {
+	t.Helper()
+	sa := func(ref string) string {
+		return "module \"serviceaccount\" {\n  source = \"github.com/ministryofjustice/cloud-platform-terraform-serviceaccount?ref=" + ref + "\"\n}\n"
+	}
+	return writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/foo/resources/main.tf": sa("1.0.0"),
+		"namespaces/live/foo/01-rbac.yaml":      strings.ReplaceAll(upgradeTestRbac, "%s", "webops"),
+		"namespaces/live/bar/resources/main.tf": sa("1.1.0"),
+		"namespaces/live/bar/01-rbac.yaml":      strings.ReplaceAll(upgradeTestRbac, "%s", "other-team"),
+	})
+}
+
+func upgradeTestReleases() []*gogithub.RepositoryRelease {
+	release := func(tag, body string) *gogithub.RepositoryRelease {
+		return &gogithub.RepositoryRelease{
+			TagName: gogithub.String(tag),
+			Body:    gogithub.String(body),
+			HTMLURL: gogithub.String("https://github.com/ministryofjustice/cloud-platform-terraform-serviceaccount/releases/tag/" + tag),
+		}
+	}
+	return []*gogithub.RepositoryRelease{
+		release("1.3.0", "Too new"),
+		release("1.2.0", "Added a thing"),
+		release("1.1.0", "Fixed a bug"),
+		release("1.0.0", "First release"),
+	}
+}
+
+func TestUpgradeModules(t *testing.T) {
+	root := upgradeTestNamespaces(t)
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListReleases", "ministryofjustice", "cloud-platform-terraform-serviceaccount").Return(upgradeTestReleases(), nil)
+	gh.On("ListOpenPRs", "Module upgrade in bar:").Return([]*gogithub.PullRequest{{Title: gogithub.String("Module upgrade in bar: serviceaccount to 1.1.0"), HTMLURL: gogithub.String("https://github.com/pr/1")}}, nil)
+	gh.On("ListOpenPRs", "Module upgrade in foo:").Return([]*gogithub.PullRequest{}, nil)
+
+	var raised []pullRequest
+	raise := func(_ github.GithubIface, _, repo string, pr pullRequest) (string, error) {
+		assert.Equal(t, "cloud-platform-environments", repo)
+		// the files are written before the PR is raised
+		assert.True(t, checkModuleChange("?ref=1.2.0", filepath.Join(pr.RepoPath, pr.Files[0])))
+		raised = append(raised, pr)
+		return "https://github.com/pr/2", nil
+	}
+
+	var out strings.Builder
+	opt := ModuleUpgradeOptions{BumpModuleOptions: BumpModuleOptions{Module: "serviceaccount", Version: "1.2.0"}}
+	assert.NoError(t, upgradeModules(root, gh, opt, &out, raise))
+
+	assert.Len(t, raised, 1)
+	pr := raised[0]
+	assert.Equal(t, "foo-serviceaccount-1.2.0", pr.Branch)
+	assert.Equal(t, "Module upgrade in foo: serviceaccount to 1.2.0", pr.Title)
+	assert.Equal(t, []string{"resources/main.tf"}, pr.Files)
+	assert.Equal(t, []string{"webops"}, pr.TeamReviewers)
+	assert.True(t, pr.Local)
+	assert.Contains(t, pr.Description, "- `module.serviceaccount` in `resources/main.tf`: 1.0.0 -> 1.2.0")
+	assert.Contains(t, pr.Description, "Fixed a bug")
+	assert.Contains(t, pr.Description, "Added a thing")
+	assert.NotContains(t, pr.Description, "First release")
+	assert.NotContains(t, pr.Description, "Too new")
+
+	assert.Contains(t, out.String(), "live/foo: https://github.com/pr/2")
+	assert.Contains(t, out.String(), "live/bar: an upgrade PR is already open: https://github.com/pr/1")
+	assert.True(t, checkModuleChange("?ref=1.1.0", filepath.Join(root, "namespaces/live/bar/resources/main.tf")))
+}
+
+func TestUpgradeModulesListsReleasesOnce(t *testing.T) {
+	root := upgradeTestNamespaces(t)
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListReleases", "ministryofjustice", "cloud-platform-terraform-serviceaccount").Return(upgradeTestReleases(), nil)
+	gh.On("ListOpenPRs", mock.Anything).Return([]*gogithub.PullRequest{}, nil)
+
+	var raised []pullRequest
+	raise := func(_ github.GithubIface, _, _ string, pr pullRequest) (string, error) {
+		raised = append(raised, pr)
+		return "https://github.com/pr/" + pr.Branch, nil
+	}
+
+	var out strings.Builder
+	opt := ModuleUpgradeOptions{BumpModuleOptions: BumpModuleOptions{Module: "serviceaccount", Version: "1.2.0"}}
+	assert.NoError(t, upgradeModules(root, gh, opt, &out, raise))
+
+	assert.Len(t, raised, 2)
+	for _, pr := range raised {
+		assert.Contains(t, pr.Description, "Added a thing")
+	}
+	gh.AssertNumberOfCalls(t, "ListReleases", 1)
+}
+
+func TestModuleUpgradeRaiseKeepsOrigin(t *testing.T) {
+	repo := gitTestRepo(t)
+	origin := gitOutput(t, repo, "remote", "get-url", "origin")
+	nsDir := filepath.Join(repo, "namespaces", "live", "foo")
+	path := filepath.Join(nsDir, "resources", "main.tf")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListOpenPRs", "Module upgrade in foo: serviceaccount to 1.2.0").Return([]*gogithub.PullRequest{}, nil)
+	gh.On("CreatePR", "foo-serviceaccount-1.2.0", "Module upgrade in foo: serviceaccount to 1.2.0", "", mock.Anything).Return("https://github.com/pr/1", nil)
+
+	upgrade := &moduleUpgrade{dir: nsDir, files: []bumpedFile{{path: path, after: []byte("module \"serviceaccount\" {}\n")}}}
+	url, err := upgrade.raise(gh, "secret-token", raisePR, pullRequest{
+		Branch:        "foo-serviceaccount-1.2.0",
+		Title:         "Module upgrade in foo: serviceaccount to 1.2.0",
+		CommitMessage: "Module upgrade in foo: serviceaccount to 1.2.0",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/pr/1", url)
+
+	assert.Equal(t, origin, gitOutput(t, repo, "remote", "get-url", "origin"))
+	assert.Equal(t, "test", gitOutput(t, repo, "log", "-1", "--format=%an", "foo-serviceaccount-1.2.0"))
+}
+
+func TestUpgradeModulesTeamAndDryRun(t *testing.T) {
+	root := upgradeTestNamespaces(t)
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListReleases", "ministryofjustice", "cloud-platform-terraform-serviceaccount").Return(upgradeTestReleases(), nil)
+
+	raise := func(github.GithubIface, string, string, pullRequest) (string, error) {
+		t.Fatal("a dry run shouldn't raise PRs")
+		return "", nil
+	}
+
+	var out strings.Builder
+	opt := ModuleUpgradeOptions{
+		BumpModuleOptions: BumpModuleOptions{Module: "serviceaccount", Version: "1.2.0", DryRun: true},
+		Team:              "other-team",
+	}
+	assert.NoError(t, upgradeModules(root, gh, opt, &out, raise))
+
+	assert.Contains(t, out.String(), "## live/bar")
+	assert.Contains(t, out.String(), "Reviewers: other-team")
+	assert.Contains(t, out.String(), `+  source = "github.com/ministryofjustice/cloud-platform-terraform-serviceaccount?ref=1.2.0"`)
+	assert.NotContains(t, out.String(), "live/foo")
+	gh.AssertNotCalled(t, "ListOpenPRs", mock.Anything)
+	assert.True(t, checkModuleChange("?ref=1.1.0", filepath.Join(root, "namespaces/live/bar/resources/main.tf")))
+}
+
+func TestUpgradeModulesRestoresFilesOnFailure(t *testing.T) {
+	root := upgradeTestNamespaces(t)
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListReleases", mock.Anything, mock.Anything).Return(nil, errors.New("no releases"))
+	gh.On("ListOpenPRs", mock.Anything).Return([]*gogithub.PullRequest{}, nil)
+
+	raise := func(github.GithubIface, string, string, pullRequest) (string, error) {
+		return "", errors.New("push failed")
+	}
+
+	var out strings.Builder
+	opt := ModuleUpgradeOptions{BumpModuleOptions: BumpModuleOptions{Module: "serviceaccount", Version: "1.2.0"}, Namespace: "foo"}
+	err := upgradeModules(root, gh, opt, &out, raise)
+	assert.ErrorContains(t, err, "failed to upgrade 1 namespaces")
+	assert.Contains(t, out.String(), "live/foo: push failed")
+
+	data, err := os.ReadFile(filepath.Join(root, "namespaces/live/foo/resources/main.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "?ref=1.0.0")
+}
+
+func TestUpgradeModulesRefusesMajor(t *testing.T) {
+	root := upgradeTestNamespaces(t)
+
+	var out strings.Builder
+	opt := ModuleUpgradeOptions{BumpModuleOptions: BumpModuleOptions{Module: "serviceaccount", Version: "2.0.0", DryRun: true}}
+	err := upgradeModules(root, new(mocks.GithubIface), opt, &out, raisePR)
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "without --allow-major")
+}
+
+func TestReleaseNotesTruncated(t *testing.T) {
+	gh := new(mocks.GithubIface)
+	gh.On("ListReleases", "org", "repo").Return([]*gogithub.RepositoryRelease{
+		{TagName: gogithub.String("v2.0.0"), Body: gogithub.String(strings.Repeat("a", maxReleaseNoteLength+10)), HTMLURL: gogithub.String("https://example.com/v2")},
+	}, nil)
+
+	notes, err := releaseNotes(&moduleReleases{gh: gh}, "github.com/org/repo", version.Must(version.NewVersion("1.0.0")), "v2.0.0")
+	assert.NoError(t, err)
+	assert.Contains(t, notes, "### [v2.0.0](https://example.com/v2)")
+	assert.Contains(t, notes, strings.Repeat("a", maxReleaseNoteLength)+"...")
+	assert.NotContains(t, notes, strings.Repeat("a", maxReleaseNoteLength+1))
+	assert.Contains(t, notes, "[Full release notes](https://example.com/v2)")
+
+	gh.On("ListReleases", "org", "multibyte").Return([]*gogithub.RepositoryRelease{
+		{TagName: gogithub.String("v2.0.0"), Body: gogithub.String("a" + strings.Repeat("é", maxReleaseNoteLength))},
+	}, nil)
+	notes, err = releaseNotes(&moduleReleases{gh: gh}, "github.com/org/multibyte", version.Must(version.NewVersion("1.0.0")), "v2.0.0")
+	assert.NoError(t, err)
+	assert.True(t, utf8.ValidString(notes), "a character isn't cut in half")
+	assert.Contains(t, notes, "a"+strings.Repeat("é", (maxReleaseNoteLength-1)/2)+"...")
+
+	_, err = releaseNotes(&moduleReleases{gh: gh}, "gitlab.com/org/repo", nil, "v2.0.0")
+	assert.Error(t, err)
+}
@@ -48,43 +48,66 @@ func (ns *Namespace) readYamlFile(filename string) error {
 	return nil
 }
 
+// namespaceYamlField is a label or annotation of 00-namespace.yaml and the field of Namespace
+// it's read into, and written from.
+type namespaceYamlField struct {
+	section string
+	key     string
+	field   func(ns *Namespace) *string
+}
+
+const ownerAnnotation = "cloud-platform.justice.gov.uk/owner"
+
+var namespaceYamlFields = []namespaceYamlField{
+	{"labels", "cloud-platform.justice.gov.uk/is-production", func(ns *Namespace) *string { return &ns.IsProduction }},
+	{"labels", "cloud-platform.justice.gov.uk/environment-name", func(ns *Namespace) *string { return &ns.Environment }},
+	{"annotations", "cloud-platform.justice.gov.uk/business-unit", func(ns *Namespace) *string { return &ns.BusinessUnit }},
+	{"annotations", "cloud-platform.justice.gov.uk/slack-channel", func(ns *Namespace) *string { return &ns.SlackChannel }},
+	{"annotations", "cloud-platform.justice.gov.uk/application", func(ns *Namespace) *string { return &ns.Application }},
+	{"annotations", "cloud-platform.justice.gov.uk/source-code", func(ns *Namespace) *string { return &ns.SourceCode }},
+	{"annotations", "cloud-platform.justice.gov.uk/team-name", func(ns *Namespace) *string { return &ns.GithubTeam }},
+	{"annotations", "cloud-platform.justice.gov.uk/service-area", func(ns *Namespace) *string { return &ns.ServiceArea }},
+	{"annotations", "cloud-platform.justice.gov.uk/review-after", func(ns *Namespace) *string { return &ns.ReviewAfter }},
+}
+
+// parseYaml reads the metadata of a namespace from its 00-namespace.yaml. The owner annotation
+// is "<team>: <email>", which is read into Owner and InfrastructureSupport, the same as they're
+// asked for when a namespace is created. OwnerEmail is the same as InfrastructureSupport.
 func (ns *Namespace) parseYaml(yamlData []byte) error {
 	type envNamespace struct {
-		APIVersion string `yaml:"apiVersion"`
-		Kind       string `yaml:"kind"`
-		Metadata   struct {
-			Namespace string `yaml:"name"`
-			Labels    struct {
-				IsProduction string `yaml:"cloud-platform.justice.gov.uk/is-production"`
-				Environment  string `yaml:"cloud-platform.justice.gov.uk/environment-name"`
-			} `yaml:"labels"`
-			Annotations struct {
-				BusinessUnit string `yaml:"cloud-platform.justice.gov.uk/business-unit"`
-				Application  string `yaml:"cloud-platform.justice.gov.uk/application"`
-				Owner        string `yaml:"cloud-platform.justice.gov.uk/owner"`
-				SourceCode   string `yaml:"cloud-platform.justice.gov.uk/source-code"`
-				ReviewAfter  string `yaml:"cloud-platform.justice.gov.uk/review-after"`
-			} `yaml:"annotations"`
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name        string            `yaml:"name"`
+			Labels      map[string]string `yaml:"labels"`
+			Annotations map[string]string `yaml:"annotations"`
 		} `yaml:"metadata"`
 	}
 
 	t := envNamespace{}
-
 	err := yaml.Unmarshal(yamlData, &t)
 	if err != nil {
-		fmt.Printf("Could not decode namespace YAML: %v", err)
-		return err
+		return fmt.Errorf("could not decode namespace YAML: %w", err)
+	}
+	if t.Kind != "" && t.Kind != "Namespace" {
+		return fmt.Errorf("expected a Namespace, found a %s", t.Kind)
 	}
 
-	ns.Application = t.Metadata.Annotations.Application
-	ns.BusinessUnit = t.Metadata.Annotations.BusinessUnit
-	ns.Environment = t.Metadata.Labels.Environment
-	ns.IsProduction = t.Metadata.Labels.IsProduction
-	ns.Namespace = t.Metadata.Namespace
-	ns.Owner = t.Metadata.Annotations.Owner
-	ns.OwnerEmail = strings.Split(t.Metadata.Annotations.Owner, ": ")[1]
-	ns.SourceCode = t.Metadata.Annotations.SourceCode
-	ns.ReviewAfter = t.Metadata.Annotations.ReviewAfter
+	ns.Namespace = t.Metadata.Name
+	for _, f := range namespaceYamlFields {
+		values := t.Metadata.Labels
+		if f.section == "annotations" {
+			values = t.Metadata.Annotations
+		}
+		*f.field(ns) = values[f.key]
+	}
+
+	owner := t.Metadata.Annotations[ownerAnnotation]
+	ns.Owner = owner
+	ns.InfrastructureSupport = ""
+	if team, email, ok := strings.Cut(owner, ": "); ok {
+		ns.Owner, ns.InfrastructureSupport = team, email
+	}
+	ns.OwnerEmail = ns.InfrastructureSupport
 
 	return nil
 }
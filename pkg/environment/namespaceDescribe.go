@@ -0,0 +1,354 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceDescribeOptions are the options of environment describe.
+type NamespaceDescribeOptions struct {
+	Namespace string
+	// RepoPath is the local path to the cloud-platform-environments repository.
+	RepoPath string
+	// ClusterDir is the folder under namespaces/ to find the namespace in. It's only needed if
+	// the namespace is in more than one.
+	ClusterDir string
+	// Kubeconfig is used to describe the namespace in its current cluster.
+	Kubeconfig string
+	// SkipCluster only describes the namespace's folder.
+	SkipCluster bool
+	Output      string
+}
+
+// NamespaceDescription is a namespace's configuration in the environments repository, and its
+// status in a cluster.
+type NamespaceDescription struct {
+	ClusterDir            string   `json:"clusterDir"`
+	Namespace             string   `json:"namespace"`
+	Owner                 string   `json:"owner"`
+	InfrastructureSupport string   `json:"infrastructureSupport,omitempty"`
+	Team                  string   `json:"team,omitempty"`
+	Teams                 []string `json:"teams,omitempty"`
+	BusinessUnit          string   `json:"businessUnit,omitempty"`
+	Application           string   `json:"application,omitempty"`
+	Environment           string   `json:"environment,omitempty"`
+	// Production is set unless the namespace's is-production label is "false", as namespace
+	// expiry does, so a namespace whose label is missing or mistyped is shown as production.
+	Production bool `json:"production"`
+	// IsProduction is the value of the is-production label.
+	IsProduction string `json:"isProduction"`
+	ReviewAfter  string `json:"reviewAfter,omitempty"`
+	SlackChannel string `json:"slackChannel,omitempty"`
+	SourceCode   string `json:"sourceCode,omitempty"`
+	// Modules are the module blocks of the namespace's terraform.
+	Modules []ModuleUsage `json:"modules"`
+	// Blockers are the files in the namespace's folder which stop the pipeline applying it.
+	Blockers []string `json:"blockers"`
+	// Cluster is nil if the cluster wasn't asked.
+	Cluster *NamespaceClusterStatus `json:"cluster,omitempty"`
+}
+
+// NamespaceClusterStatus is the status of a namespace in a cluster.
+type NamespaceClusterStatus struct {
+	Exists bool `json:"exists"`
+	// Error is why the cluster couldn't be asked, the rest of the status is then unknown.
+	Error       string       `json:"error,omitempty"`
+	Phase       string       `json:"phase,omitempty"`
+	Quotas      []QuotaUsage `json:"quotas"`
+	UnreadyPods []UnreadyPod `json:"unreadyPods"`
+}
+
+// QuotaUsage is how much of a resource of a namespace's resource quota is used.
+type QuotaUsage struct {
+	Quota    string `json:"quota"`
+	Resource string `json:"resource"`
+	Used     string `json:"used"`
+	Hard     string `json:"hard"`
+}
+
+// UnreadyPod is a pod which hasn't finished and isn't ready, with why if it's known.
+type UnreadyPod struct {
+	Name   string `json:"name"`
+	Phase  string `json:"phase"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DescribeNamespace reads a namespace's folder, and its status in the current cluster of the
+// kubeconfig unless SkipCluster is set.
+func DescribeNamespace(opt NamespaceDescribeOptions) (*NamespaceDescription, error) {
+	var kube kubernetes.Interface
+	var kubeErr error
+	if !opt.SkipCluster {
+		kube, kubeErr = createKubeClient(opt.Kubeconfig)
+	}
+
+	d, err := describeNamespace(opt, kube)
+	if err != nil {
+		return nil, err
+	}
+	if kubeErr != nil {
+		d.Cluster = &NamespaceClusterStatus{Error: kubeErr.Error()}
+	}
+	return d, nil
+}
+
+// describeNamespace describes the namespace, asking kube about its status if it isn't nil.
+func describeNamespace(opt NamespaceDescribeOptions, kube kubernetes.Interface) (*NamespaceDescription, error) {
+	root := filepath.Clean(opt.RepoPath)
+	clusterDir, err := findNamespaceClusterDir(root, opt.Namespace, opt.ClusterDir)
+	if err != nil {
+		return nil, err
+	}
+	nsRoot := filepath.Join(root, "namespaces")
+	nsDir := filepath.Join(nsRoot, clusterDir, opt.Namespace)
+
+	folder, err := ReadNamespaceFolder(nsDir)
+	if err != nil {
+		return nil, err
+	}
+	ns := folder.Metadata
+	d := &NamespaceDescription{
+		ClusterDir:            clusterDir,
+		Namespace:             opt.Namespace,
+		Owner:                 ns.Owner,
+		InfrastructureSupport: ns.InfrastructureSupport,
+		Team:                  ns.GithubTeam,
+		Teams:                 folder.Teams,
+		BusinessUnit:          ns.BusinessUnit,
+		Application:           ns.Application,
+		Environment:           ns.Environment,
+		Production:            ns.IsProduction != "false",
+		IsProduction:          ns.IsProduction,
+		ReviewAfter:           ns.ReviewAfter,
+		SlackChannel:          ns.SlackChannel,
+		SourceCode:            ns.SourceCode,
+		Blockers:              []string{},
+	}
+
+	if d.Modules, err = moduleUsages(nsRoot, nsDir); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{applySkipFile, secretBlockerFile} {
+		if _, err := os.Stat(filepath.Join(nsDir, name)); err == nil {
+			d.Blockers = append(d.Blockers, name)
+		}
+	}
+
+	if kube != nil {
+		d.Cluster = namespaceClusterStatus(kube, opt.Namespace)
+	}
+	return d, nil
+}
+
+// findNamespaceClusterDir returns the folder under namespaces/ which has the namespace.
+func findNamespaceClusterDir(root, namespace, clusterDir string) (string, error) {
+	if clusterDir != "" {
+		if _, err := os.Stat(filepath.Join(root, "namespaces", clusterDir, namespace, NamespaceYamlFile)); err != nil {
+			return "", fmt.Errorf("namespace %s isn't in namespaces/%s: %w", namespace, clusterDir, err)
+		}
+		return clusterDir, nil
+	}
+
+	clusterDirs, err := listClusterDirs(root)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, dir := range clusterDirs {
+		if _, err := os.Stat(filepath.Join(root, "namespaces", dir, namespace, NamespaceYamlFile)); err == nil {
+			found = append(found, dir)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("namespace %s isn't in the environments repository", namespace)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("namespace %s is in %s, choose one with --clusterdir", namespace, strings.Join(found, " and "))
+	}
+}
+
+// namespaceClusterStatus asks the cluster whether the namespace exists, how much of its quotas
+// it's using and which of its pods aren't ready.
+func namespaceClusterStatus(kube kubernetes.Interface, namespace string) *NamespaceClusterStatus {
+	ctx := context.Background()
+	status := &NamespaceClusterStatus{Quotas: []QuotaUsage{}, UnreadyPods: []UnreadyPod{}}
+
+	ns, err := kube.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return status
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Exists = true
+	status.Phase = string(ns.Status.Phase)
+
+	quotas, err := kube.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, q := range quotas.Items {
+		resources := make([]string, 0, len(q.Status.Hard))
+		for r := range q.Status.Hard {
+			resources = append(resources, string(r))
+		}
+		sort.Strings(resources)
+		for _, r := range resources {
+			hard, used := q.Status.Hard[v1.ResourceName(r)], q.Status.Used[v1.ResourceName(r)]
+			status.Quotas = append(status.Quotas, QuotaUsage{Quota: q.Name, Resource: r, Used: used.String(), Hard: hard.String()})
+		}
+	}
+
+	pods, err := kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, p := range pods.Items {
+		if p.Status.Phase == v1.PodSucceeded || podReady(p) {
+			continue
+		}
+		status.UnreadyPods = append(status.UnreadyPods, UnreadyPod{Name: p.Name, Phase: string(p.Status.Phase), Reason: podUnreadyReason(p)})
+	}
+	return status
+}
+
+func podReady(p v1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podUnreadyReason is the reason a container of the pod is waiting or was terminated, e.g.
+// CrashLoopBackOff, falling back to the pod's own reason.
+func podUnreadyReason(p v1.Pod) string {
+	for _, c := range p.Status.ContainerStatuses {
+		if c.State.Waiting != nil && c.State.Waiting.Reason != "" {
+			return c.State.Waiting.Reason
+		}
+		if c.State.Terminated != nil && c.State.Terminated.Reason != "" {
+			return c.State.Terminated.Reason
+		}
+	}
+	return p.Status.Reason
+}
+
+// PrintNamespaceDescription writes the description to w either as tables or as json.
+func PrintNamespaceDescription(w io.Writer, d *NamespaceDescription, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table", "":
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: table, json", output)
+	}
+
+	render := func(t table.Writer) {
+		t.SetOutputMirror(w)
+		t.SetStyle(table.StyleLight)
+		t.Render()
+	}
+
+	owner := d.Owner
+	if d.InfrastructureSupport != "" {
+		owner += " (" + d.InfrastructureSupport + ")"
+	}
+	blockers := "none"
+	if len(d.Blockers) > 0 {
+		blockers = strings.Join(d.Blockers, ", ")
+	}
+	production := fmt.Sprint(d.Production)
+	switch d.IsProduction {
+	case "true", "false":
+	case "":
+		production += " (no is-production label)"
+	default:
+		production += fmt.Sprintf(" (is-production label is %q)", d.IsProduction)
+	}
+	t := table.NewWriter()
+	t.SetTitle("Namespace %s", d.Namespace)
+	t.AppendRows([]table.Row{
+		{"Cluster", d.ClusterDir},
+		{"Owner", owner},
+		{"Team", d.Team},
+		{"Github teams", strings.Join(d.Teams, ", ")},
+		{"Business unit", d.BusinessUnit},
+		{"Application", d.Application},
+		{"Environment", d.Environment},
+		{"Production", production},
+		{"Review after", d.ReviewAfter},
+		{"Slack channel", d.SlackChannel},
+		{"Source code", d.SourceCode},
+		{"Pipeline blockers", blockers},
+	})
+	render(t)
+
+	if len(d.Modules) > 0 {
+		t = table.NewWriter()
+		t.SetTitle("Modules")
+		t.AppendHeader(table.Row{"Module", "Repository", "Ref", "File"})
+		for _, m := range d.Modules {
+			t.AppendRow(table.Row{m.Name, m.Repository, m.Ref, m.File})
+		}
+		render(t)
+	}
+
+	c := d.Cluster
+	switch {
+	case c == nil:
+		return nil
+	case c.Error != "":
+		_, err := fmt.Fprintf(w, "Cluster status unknown: %s\n", c.Error)
+		return err
+	case !c.Exists:
+		_, err := fmt.Fprintf(w, "Namespace %s doesn't exist in the cluster\n", d.Namespace)
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Namespace %s is %s in the cluster, %d pod(s) aren't ready\n", d.Namespace, c.Phase, len(c.UnreadyPods)); err != nil {
+		return err
+	}
+	if len(c.Quotas) > 0 {
+		t = table.NewWriter()
+		t.SetTitle("Quotas")
+		t.AppendHeader(table.Row{"Quota", "Resource", "Used", "Hard"})
+		for _, q := range c.Quotas {
+			t.AppendRow(table.Row{q.Quota, q.Resource, q.Used, q.Hard})
+		}
+		render(t)
+	}
+	if len(c.UnreadyPods) > 0 {
+		t = table.NewWriter()
+		t.SetTitle("Pods which aren't ready")
+		t.AppendHeader(table.Row{"Pod", "Phase", "Reason"})
+		for _, p := range c.UnreadyPods {
+			t.AppendRow(table.Row{p.Name, p.Phase, p.Reason})
+		}
+		render(t)
+	}
+	return nil
+}
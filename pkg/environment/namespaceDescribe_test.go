@@ -0,0 +1,168 @@
+package environment
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func describeTestRepo(t *testing.T) string {
+	t.Helper()
+	return writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/my-ns/00-namespace.yaml": folderTestNamespace + "    cloud-platform.justice.gov.uk/review-after: \"2027-01-01\"\n",
+		"namespaces/live/my-ns/01-rbac.yaml":      strings.ReplaceAll(upgradeTestRbac, "%s", "my-team"),
+		"namespaces/live/my-ns/resources/rds.tf": `module "rds" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+}
+`,
+		"namespaces/live/my-ns/SECRET_ROTATE_BLOCK": "",
+		"namespaces/live/both/00-namespace.yaml":    expiryTestNamespace("both", "false", ""),
+		"namespaces/live-2/both/00-namespace.yaml":  expiryTestNamespace("both", "false", ""),
+	})
+}
+
+func TestDescribeNamespace(t *testing.T) {
+	root := describeTestRepo(t)
+	pod := func(name string, phase v1.PodPhase, ready v1.ConditionStatus, waiting string) *v1.Pod {
+		p := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-ns"},
+			Status: v1.PodStatus{
+				Phase:      phase,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: ready}},
+			},
+		}
+		if waiting != "" {
+			p.Status.ContainerStatuses = []v1.ContainerStatus{{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: waiting}}}}
+		}
+		return p
+	}
+	kube := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "my-ns"}, Status: v1.NamespaceStatus{Phase: v1.NamespaceActive}},
+		&v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "namespace-quota", Namespace: "my-ns"},
+			Status: v1.ResourceQuotaStatus{
+				Hard: v1.ResourceList{v1.ResourcePods: resource.MustParse("50"), v1.ResourceRequestsMemory: resource.MustParse("6000Mi")},
+				Used: v1.ResourceList{v1.ResourcePods: resource.MustParse("3")},
+			},
+		},
+		pod("app", v1.PodRunning, v1.ConditionTrue, ""),
+		pod("job", v1.PodSucceeded, v1.ConditionFalse, ""),
+		pod("worker", v1.PodRunning, v1.ConditionFalse, "CrashLoopBackOff"),
+	)
+
+	d, err := describeNamespace(NamespaceDescribeOptions{Namespace: "my-ns", RepoPath: root}, kube)
+	assert.NoError(t, err)
+	assert.Equal(t, &NamespaceDescription{
+		ClusterDir:            "live",
+		Namespace:             "my-ns",
+		Owner:                 "My Team",
+		InfrastructureSupport: "my-team@digital.justice.gov.uk",
+		Team:                  "my-team",
+		Teams:                 []string{"my-team"},
+		BusinessUnit:          "HMPPS",
+		Application:           "My App",
+		Environment:           "production",
+		Production:            true,
+		IsProduction:          "true",
+		ReviewAfter:           "2027-01-01",
+		SlackChannel:          "my-team",
+		SourceCode:            "https://github.com/ministryofjustice/my-app",
+		Modules: []ModuleUsage{{
+			ClusterDir: "live",
+			Namespace:  "my-ns",
+			File:       "resources/rds.tf",
+			Name:       "rds",
+			Repository: "github.com/ministryofjustice/cloud-platform-terraform-rds-instance",
+			Ref:        "8.0.0",
+		}},
+		Blockers: []string{"SECRET_ROTATE_BLOCK"},
+		Cluster: &NamespaceClusterStatus{
+			Exists: true,
+			Phase:  "Active",
+			Quotas: []QuotaUsage{
+				{Quota: "namespace-quota", Resource: "pods", Used: "3", Hard: "50"},
+				{Quota: "namespace-quota", Resource: "requests.memory", Used: "0", Hard: "6000Mi"},
+			},
+			UnreadyPods: []UnreadyPod{{Name: "worker", Phase: "Running", Reason: "CrashLoopBackOff"}},
+		},
+	}, d)
+
+	var out strings.Builder
+	assert.NoError(t, PrintNamespaceDescription(&out, d, "table"))
+	assert.Contains(t, out.String(), "My Team (my-team@digital.justice.gov.uk)")
+	assert.Contains(t, out.String(), "SECRET_ROTATE_BLOCK")
+	assert.Contains(t, out.String(), "Namespace my-ns is Active in the cluster, 1 pod(s) aren't ready")
+	assert.Contains(t, out.String(), "CrashLoopBackOff")
+
+	out.Reset()
+	assert.NoError(t, PrintNamespaceDescription(&out, d, "json"))
+	assert.Contains(t, out.String(), `"blockers": [`)
+	assert.EqualError(t, PrintNamespaceDescription(&out, d, "yaml"), `unsupported output format "yaml", must be one of: table, json`)
+}
+
+func TestDescribeNamespaceProduction(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/sandbox/00-namespace.yaml":    expiryTestNamespace("sandbox", "false", ""),
+		"namespaces/live/unlabelled/00-namespace.yaml": expiryTestNamespace("unlabelled", "", ""),
+		"namespaces/live/mistyped/00-namespace.yaml":   expiryTestNamespace("mistyped", "ture", ""),
+	})
+
+	tests := []struct {
+		namespace  string
+		production bool
+		table      string
+	}{
+		{"sandbox", false, "false"},
+		// namespace expiry never deletes these, so they're shown as production too
+		{"unlabelled", true, "true (no is-production label)"},
+		{"mistyped", true, `true (is-production label is "ture")`},
+	}
+	for _, tt := range tests {
+		d, err := describeNamespace(NamespaceDescribeOptions{Namespace: tt.namespace, RepoPath: root}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.production, d.Production, tt.namespace)
+
+		var out strings.Builder
+		assert.NoError(t, PrintNamespaceDescription(&out, d, "table"))
+		assert.Regexp(t, `Production +│ `+regexp.QuoteMeta(tt.table)+` +│`, out.String(), tt.namespace)
+	}
+}
+
+func TestDescribeNamespaceNotInCluster(t *testing.T) {
+	root := describeTestRepo(t)
+
+	d, err := describeNamespace(NamespaceDescribeOptions{Namespace: "both", RepoPath: root, ClusterDir: "live-2"}, fake.NewSimpleClientset())
+	assert.NoError(t, err)
+	assert.Equal(t, "live-2", d.ClusterDir)
+	assert.Empty(t, d.Modules)
+	assert.Equal(t, []string{}, d.Blockers)
+	assert.False(t, d.Cluster.Exists)
+
+	var out strings.Builder
+	assert.NoError(t, PrintNamespaceDescription(&out, d, "table"))
+	assert.Contains(t, out.String(), "none")
+	assert.Contains(t, out.String(), "Namespace both doesn't exist in the cluster")
+
+	d, err = describeNamespace(NamespaceDescribeOptions{Namespace: "my-ns", RepoPath: root}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, d.Cluster, "the cluster isn't asked without a client")
+}
+
+func TestDescribeNamespaceErrors(t *testing.T) {
+	root := describeTestRepo(t)
+
+	_, err := describeNamespace(NamespaceDescribeOptions{Namespace: "both", RepoPath: root}, nil)
+	assert.EqualError(t, err, "namespace both is in live and live-2, choose one with --clusterdir")
+
+	_, err = describeNamespace(NamespaceDescribeOptions{Namespace: "missing", RepoPath: root}, nil)
+	assert.EqualError(t, err, "namespace missing isn't in the environments repository")
+
+	_, err = describeNamespace(NamespaceDescribeOptions{Namespace: "my-ns", RepoPath: root, ClusterDir: "live-2"}, nil)
+	assert.ErrorContains(t, err, "namespace my-ns isn't in namespaces/live-2")
+}
@@ -0,0 +1,352 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/slack"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+)
+
+// ExpiredNamespacesOptions are the options of environment expired.
+type ExpiredNamespacesOptions struct {
+	// RepoPath is the local path to the cloud-platform-environments repository.
+	RepoPath string
+	// ClusterDir only looks for expired namespaces in this folder under namespaces/.
+	ClusterDir string
+	// RaisePRs raises a PR deleting each expired namespace whose is-production label is "false",
+	// and tells the namespace's team in its slack channel.
+	RaisePRs bool
+	// DryRun prints the PRs RaisePRs would raise, without changing any files.
+	DryRun bool
+	// Limit is the maximum number of PRs to raise, 0 means no limit.
+	Limit int
+	// GithubToken is used to push the branches.
+	GithubToken string
+	// SlackWebhookUrl posts to the teams' channels, they aren't told if it isn't set.
+	SlackWebhookUrl string
+}
+
+// ExpiredNamespace is a namespace whose cloud-platform.justice.gov.uk/review-after date has
+// passed, usually a sandbox namespace.
+type ExpiredNamespace struct {
+	ClusterDir  string `json:"clusterDir"`
+	Namespace   string `json:"namespace"`
+	ReviewAfter string `json:"reviewAfter"`
+	// Production is set unless the namespace's cloud-platform.justice.gov.uk/is-production label
+	// is "false", so a namespace whose label is missing or mistyped is never deleted.
+	Production bool `json:"production"`
+	// IsProduction is the value of the is-production label.
+	IsProduction          string `json:"isProduction"`
+	Owner                 string `json:"owner"`
+	InfrastructureSupport string `json:"infrastructureSupport,omitempty"`
+	SlackChannel          string `json:"slackChannel,omitempty"`
+	// Teams are the Github teams given access to the namespace by its rbac.
+	Teams []string `json:"teams,omitempty"`
+	// Resources are the terraform files of resources/, besides the ones every namespace has,
+	// which have to be deleted, so the pipeline destroys what they create, before the namespace.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// channelNotifier posts a message to a slack channel.
+type channelNotifier func(channel, text, webhookUrl string) error
+
+// ExpiredNamespaces lists the namespaces of the environments repository whose review-after
+// date is before today.
+func ExpiredNamespaces(opt ExpiredNamespacesOptions) ([]ExpiredNamespace, error) {
+	return expiredNamespaces(opt, time.Now())
+}
+
+func expiredNamespaces(opt ExpiredNamespacesOptions, now time.Time) ([]ExpiredNamespace, error) {
+	root := filepath.Clean(opt.RepoPath)
+	clusterDirs := []string{opt.ClusterDir}
+	if opt.ClusterDir == "" {
+		var err error
+		clusterDirs, err = listClusterDirs(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	today := now.UTC().Format("2006-01-02")
+
+	var expired []ExpiredNamespace
+	for _, clusterDir := range clusterDirs {
+		entries, err := os.ReadDir(filepath.Join(root, "namespaces", clusterDir))
+		if err != nil {
+			return nil, fmt.Errorf("error reading cluster folder: %w", err)
+		}
+
+		for _, e := range entries {
+			nsDir := filepath.Join(root, "namespaces", clusterDir, e.Name())
+			if _, err := os.Stat(filepath.Join(nsDir, NamespaceYamlFile)); !e.IsDir() || err != nil {
+				continue
+			}
+			folder, err := ReadNamespaceFolder(nsDir)
+			if err != nil {
+				log.Printf("Warning: skipping %s/%s: %v", clusterDir, e.Name(), err)
+				continue
+			}
+
+			ns := folder.Metadata
+			if ns.ReviewAfter == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", ns.ReviewAfter); err != nil {
+				log.Printf("Warning: skipping %s/%s: its review-after %q isn't a date of the form YYYY-MM-DD", clusterDir, e.Name(), ns.ReviewAfter)
+				continue
+			}
+			if ns.ReviewAfter >= today {
+				continue
+			}
+
+			resources, err := namespaceResourceFiles(nsDir)
+			if err != nil {
+				return nil, err
+			}
+			expired = append(expired, ExpiredNamespace{
+				ClusterDir:            clusterDir,
+				Namespace:             e.Name(),
+				ReviewAfter:           ns.ReviewAfter,
+				Production:            ns.IsProduction != "false",
+				IsProduction:          ns.IsProduction,
+				Owner:                 ns.Owner,
+				InfrastructureSupport: ns.InfrastructureSupport,
+				SlackChannel:          ns.SlackChannel,
+				Teams:                 folder.Teams,
+				Resources:             resources,
+			})
+		}
+	}
+
+	return expired, nil
+}
+
+// namespaceResourceFiles returns the terraform files in the resources folder of a namespace
+// which weren't generated for it by environment create. The ones that were configure the
+// providers and backend, so they're needed until the resources have been destroyed.
+func namespaceResourceFiles(nsDir string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(nsDir, "resources", "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []string
+	for _, name := range names {
+		rel := "resources/" + filepath.Base(name)
+		if !util.Contains(namespaceTemplateNames, rel) {
+			resources = append(resources, rel)
+		}
+	}
+	return resources, nil
+}
+
+// PrintExpiredNamespaces writes the expired namespaces to w either as a table or as json.
+func PrintExpiredNamespaces(w io.Writer, namespaces []ExpiredNamespace, output string) error {
+	switch output {
+	case "json":
+		if namespaces == nil {
+			namespaces = []ExpiredNamespace{}
+		}
+		data, err := json.MarshalIndent(namespaces, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table", "":
+		t := table.NewWriter()
+		t.SetOutputMirror(w)
+		t.AppendHeader(table.Row{"Cluster", "Namespace", "Review After", "Production", "Owner", "Slack Channel", "Resources"})
+		for _, ns := range namespaces {
+			owner := ns.Owner
+			if ns.InfrastructureSupport != "" {
+				owner += " (" + ns.InfrastructureSupport + ")"
+			}
+			t.AppendRow(table.Row{ns.ClusterDir, ns.Namespace, ns.ReviewAfter, ns.Production, owner, ns.SlackChannel, len(ns.Resources)})
+		}
+		t.SetStyle(table.StyleLight)
+		t.Render()
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: table, json", output)
+	}
+}
+
+// DeleteExpiredNamespaces raises a PR deleting each expired namespace whose is-production label
+// is "false", and tells the namespace's team in its slack channel. A namespace with terraform resources
+// first gets a PR deleting them, so the pipeline destroys them while it still can, and only
+// gets the PR deleting the namespace when it's run again after that's merged. Namespaces which
+// already have an open deletion PR are skipped.
+func DeleteExpiredNamespaces(gh github.GithubIface, opt ExpiredNamespacesOptions) error {
+	return deleteExpiredNamespaces(gh, opt, time.Now(), os.Stdout, raisePR, slack.PostToChannel)
+}
+
+func deleteExpiredNamespaces(gh github.GithubIface, opt ExpiredNamespacesOptions, now time.Time, out io.Writer, raise prRaiser, notify channelNotifier) error {
+	expired, err := expiredNamespaces(opt, now)
+	if err != nil {
+		return err
+	}
+
+	successes := make(map[string]string)
+	failures := make(map[string]string)
+	skipped := make(map[string]string)
+	for _, ns := range expired {
+		if opt.Limit > 0 && len(successes) >= opt.Limit {
+			break
+		}
+
+		name := ns.ClusterDir + "/" + ns.Namespace
+		switch {
+		case ns.IsProduction == "true":
+			skipped[name] = "production namespaces are never deleted"
+			continue
+		case ns.IsProduction == "":
+			skipped[name] = "it has no is-production label, so it's treated as production and never deleted"
+			continue
+		case ns.Production:
+			skipped[name] = fmt.Sprintf("its is-production label is %q rather than \"false\", so it's treated as production and never deleted", ns.IsProduction)
+			continue
+		}
+
+		pr := expiredNamespacePR(ns)
+		if opt.DryRun {
+			fmt.Fprintf(out, "## %s\n\nTitle: %s\nReviewers: %s\nDeletes: %s\n\n%s\n", name, pr.Title, strings.Join(pr.TeamReviewers, ", "), strings.Join(pr.Files, ", "), pr.Description)
+			successes[name] = "dry run"
+			continue
+		}
+
+		if open, err := openPR(gh, expiredNamespacePRPrefix(ns.Namespace)); err != nil {
+			log.Printf("Warning: error listing open PRs: %v", err)
+		} else if open != "" {
+			skipped[name] = "a deletion PR is already open: " + open
+			continue
+		}
+
+		pr.RepoPath = filepath.Clean(opt.RepoPath)
+		prURL, err := deleteAndRaise(gh, opt.GithubToken, raise, pr)
+		if err != nil {
+			failures[name] = err.Error()
+			continue
+		}
+		successes[name] = prURL
+
+		if ns.SlackChannel != "" && opt.SlackWebhookUrl != "" {
+			if err := notify(ns.SlackChannel, expiredNamespaceMessage(ns, prURL), opt.SlackWebhookUrl); err != nil {
+				log.Printf("Warning: failed to post to #%s: %v", ns.SlackChannel, err)
+			}
+		}
+	}
+
+	printUpgradeSummary(out, "Deletion PRs raised", successes)
+	printUpgradeSummary(out, "Skipped namespaces", skipped)
+	printUpgradeSummary(out, "Failed namespaces", failures)
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to raise deletion PRs for %d namespaces", len(failures))
+	}
+	return nil
+}
+
+// expiredNamespacePRPrefix is the start of the title of every deletion PR for a namespace, used
+// to find the ones that are already open.
+func expiredNamespacePRPrefix(namespace string) string {
+	return "Delete expired namespace " + namespace + ":"
+}
+
+// expiredNamespacePR is the PR deleting the terraform resources of an expired namespace, or the
+// namespace itself when it has none left. Its files are relative to the repository.
+func expiredNamespacePR(ns ExpiredNamespace) pullRequest {
+	nsDir := "namespaces/" + ns.ClusterDir + "/" + ns.Namespace
+
+	pr := pullRequest{
+		Branch:        "delete-expired-" + ns.Namespace,
+		Title:         expiredNamespacePRPrefix(ns.Namespace) + " remove the namespace",
+		Files:         []string{nsDir},
+		TeamReviewers: ns.Teams,
+	}
+	if len(ns.Resources) > 0 {
+		pr.Branch += "-resources"
+		pr.Title = expiredNamespacePRPrefix(ns.Namespace) + " remove its terraform resources"
+		pr.Files = nil
+		for _, r := range ns.Resources {
+			pr.Files = append(pr.Files, nsDir+"/"+r)
+		}
+	}
+	pr.CommitMessage = pr.Title
+	pr.Description = expiredNamespacePRDescription(ns)
+	return pr
+}
+
+func expiredNamespacePRDescription(ns ExpiredNamespace) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The review-after date of the `%s` namespace in `%s`, %s, has passed.\n\n", ns.Namespace, ns.ClusterDir, ns.ReviewAfter)
+	if len(ns.Resources) > 0 {
+		b.WriteString("This PR deletes its terraform resources, so the pipeline destroys them:\n\n")
+		for _, r := range ns.Resources {
+			fmt.Fprintf(&b, "- `%s`\n", r)
+		}
+		b.WriteString("\nThe namespace itself will be deleted by a second PR once this one is merged.\n\n")
+	} else {
+		b.WriteString("This PR deletes the namespace.\n\n")
+	}
+	fmt.Fprintf(&b, "If the namespace is still needed, close this PR and move the `cloud-platform.justice.gov.uk/review-after` annotation in `%s` forward.\n", NamespaceYamlFile)
+	return b.String()
+}
+
+func expiredNamespaceMessage(ns ExpiredNamespace, prURL string) string {
+	return fmt.Sprintf("The review-after date of the %s namespace, %s, has passed, so a PR has been raised to delete it: %s\nIf it's still needed, close the PR and move the review-after annotation in %s forward.", ns.Namespace, ns.ReviewAfter, prURL, NamespaceYamlFile)
+}
+
+// deleteAndRaise deletes the files of the PR and raises it. If the PR can't be raised the files
+// are put back, so they aren't missing from the next namespace's PR branch.
+func deleteAndRaise(gh github.GithubIface, ghToken string, raise prRaiser, pr pullRequest) (string, error) {
+	deleted := make(map[string][]byte)
+	restore := func() {
+		for path, data := range deleted {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				log.Printf("Warning: failed to restore %s: %v", path, err)
+				continue
+			}
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				log.Printf("Warning: failed to restore %s: %v", path, err)
+			}
+		}
+	}
+
+	for _, f := range pr.Files {
+		err := filepath.WalkDir(filepath.Join(pr.RepoPath, f), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			deleted[path] = data
+			return nil
+		})
+		if err == nil {
+			err = os.RemoveAll(filepath.Join(pr.RepoPath, f))
+		}
+		if err != nil {
+			restore()
+			return "", fmt.Errorf("failed to delete %s: %w", f, err)
+		}
+	}
+
+	prURL, err := raise(gh, ghToken, cloudPlatformEnvRepo, pr)
+	if err != nil {
+		restore()
+		return "", err
+	}
+	return prURL, nil
+}
@@ -0,0 +1,210 @@
+package environment
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/github"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+)
+
+var expiryTestNow = time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+func expiryTestNamespace(name, isProduction, reviewAfter string) string {
+	label := `    cloud-platform.justice.gov.uk/is-production: "` + isProduction + "\"\n"
+	if isProduction == "" {
+		label = ""
+	}
+	ns := strings.NewReplacer("my-ns", name, "    cloud-platform.justice.gov.uk/is-production: \"true\"\n", label).Replace(folderTestNamespace)
+	if reviewAfter != "" {
+		ns += "    cloud-platform.justice.gov.uk/review-after: \"" + reviewAfter + "\"\n"
+	}
+	return ns
+}
+
+func expiryTestRepo(t *testing.T) string {
+	t.Helper()
+	return writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/sandbox-a/00-namespace.yaml":     expiryTestNamespace("sandbox-a", "false", "2026-10-18"),
+		"namespaces/live/sandbox-a/01-rbac.yaml":          strings.ReplaceAll(upgradeTestRbac, "%s", "my-team"),
+		"namespaces/live/sandbox-a/resources/main.tf":     "provider \"aws\" {}\n",
+		"namespaces/live/sandbox-a/resources/sqs.tf":      "module \"sqs\" {}\n",
+		"namespaces/live/sandbox-a/resources/s3.tf":       "module \"s3\" {}\n",
+		"namespaces/live/sandbox-b/00-namespace.yaml":     expiryTestNamespace("sandbox-b", "false", "2026-01-01"),
+		"namespaces/live/sandbox-b/resources/main.tf":     "provider \"aws\" {}\n",
+		"namespaces/live/today/00-namespace.yaml":         expiryTestNamespace("today", "false", "2026-10-19"),
+		"namespaces/live/no-review/00-namespace.yaml":     expiryTestNamespace("no-review", "false", ""),
+		"namespaces/live/invalid/00-namespace.yaml":       expiryTestNamespace("invalid", "false", "next year"),
+		"namespaces/live-2/prod/00-namespace.yaml":        expiryTestNamespace("prod", "true", "2025-06-30"),
+		"namespaces/live-2/prod/resources/rds.tf":         "module \"rds\" {}\n",
+		"namespaces/live-2/not-a-namespace/README.md":     "nothing here\n",
+		"namespaces/live-2/broken/00-namespace.yaml":      "metadata: [\n",
+		"namespaces/live-2/broken/resources/variables.tf": "variable \"namespace\" {}\n",
+	})
+}
+
+func TestExpiredNamespaces(t *testing.T) {
+	root := expiryTestRepo(t)
+
+	expired, err := expiredNamespaces(ExpiredNamespacesOptions{RepoPath: root}, expiryTestNow)
+	assert.NoError(t, err)
+	assert.Equal(t, []ExpiredNamespace{
+		{
+			ClusterDir:            "live",
+			Namespace:             "sandbox-a",
+			ReviewAfter:           "2026-10-18",
+			IsProduction:          "false",
+			Owner:                 "My Team",
+			InfrastructureSupport: "my-team@digital.justice.gov.uk",
+			SlackChannel:          "my-team",
+			Teams:                 []string{"my-team"},
+			Resources:             []string{"resources/s3.tf", "resources/sqs.tf"},
+		},
+		{
+			ClusterDir:            "live",
+			Namespace:             "sandbox-b",
+			ReviewAfter:           "2026-01-01",
+			IsProduction:          "false",
+			Owner:                 "My Team",
+			InfrastructureSupport: "my-team@digital.justice.gov.uk",
+			SlackChannel:          "my-team",
+		},
+		{
+			ClusterDir:            "live-2",
+			Namespace:             "prod",
+			ReviewAfter:           "2025-06-30",
+			Production:            true,
+			IsProduction:          "true",
+			Owner:                 "My Team",
+			InfrastructureSupport: "my-team@digital.justice.gov.uk",
+			SlackChannel:          "my-team",
+			Resources:             []string{"resources/rds.tf"},
+		},
+	}, expired)
+
+	expired, err = expiredNamespaces(ExpiredNamespacesOptions{RepoPath: root, ClusterDir: "live-2"}, expiryTestNow)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+
+	var out strings.Builder
+	assert.NoError(t, PrintExpiredNamespaces(&out, expired, "table"))
+	assert.Contains(t, out.String(), "My Team (my-team@digital.justice.gov.uk)")
+	assert.EqualError(t, PrintExpiredNamespaces(&out, expired, "yaml"), `unsupported output format "yaml", must be one of: table, json`)
+}
+
+func TestDeleteExpiredNamespaces(t *testing.T) {
+	root := expiryTestRepo(t)
+
+	gh := new(mocks.GithubIface)
+	gh.On("ListOpenPRs", "Delete expired namespace sandbox-a:").Return([]*gogithub.PullRequest{}, nil)
+	gh.On("ListOpenPRs", "Delete expired namespace sandbox-b:").Return([]*gogithub.PullRequest{{Title: gogithub.String("Delete expired namespace sandbox-b: remove the namespace"), HTMLURL: gogithub.String("https://github.com/pr/1")}}, nil)
+
+	var raised []pullRequest
+	raise := func(_ github.GithubIface, _, repo string, pr pullRequest) (string, error) {
+		assert.Equal(t, "cloud-platform-environments", repo)
+		// the files are deleted before the PR is raised
+		assert.NoFileExists(t, filepath.Join(pr.RepoPath, pr.Files[0]))
+		raised = append(raised, pr)
+		return "https://github.com/pr/2", nil
+	}
+	var posted []string
+	notify := func(channel, text, webhookUrl string) error {
+		assert.Equal(t, "https://hooks.slack.com/test", webhookUrl)
+		posted = append(posted, channel+": "+text)
+		return nil
+	}
+
+	var out strings.Builder
+	opt := ExpiredNamespacesOptions{RepoPath: root, RaisePRs: true, SlackWebhookUrl: "https://hooks.slack.com/test"}
+	assert.NoError(t, deleteExpiredNamespaces(gh, opt, expiryTestNow, &out, raise, notify))
+
+	assert.Len(t, raised, 1)
+	pr := raised[0]
+	assert.Equal(t, "delete-expired-sandbox-a-resources", pr.Branch)
+	assert.Equal(t, "Delete expired namespace sandbox-a: remove its terraform resources", pr.Title)
+	assert.Equal(t, []string{"namespaces/live/sandbox-a/resources/s3.tf", "namespaces/live/sandbox-a/resources/sqs.tf"}, pr.Files)
+	assert.Equal(t, []string{"my-team"}, pr.TeamReviewers)
+	assert.Contains(t, pr.Description, "The namespace itself will be deleted by a second PR")
+	assert.FileExists(t, filepath.Join(root, "namespaces/live/sandbox-a/resources/main.tf"))
+
+	assert.Len(t, posted, 1)
+	assert.Contains(t, posted[0], "my-team: The review-after date of the sandbox-a namespace, 2026-10-18, has passed, so a PR has been raised to delete it: https://github.com/pr/2")
+
+	assert.Contains(t, out.String(), "live/sandbox-a: https://github.com/pr/2")
+	assert.Contains(t, out.String(), "live/sandbox-b: a deletion PR is already open: https://github.com/pr/1")
+	assert.Contains(t, out.String(), "live-2/prod: production namespaces are never deleted")
+	assert.FileExists(t, filepath.Join(root, "namespaces/live-2/prod/resources/rds.tf"))
+}
+
+func TestDeleteExpiredNamespaceFolder(t *testing.T) {
+	root := expiryTestRepo(t)
+	gh := new(mocks.GithubIface)
+	gh.On("ListOpenPRs", "Delete expired namespace sandbox-a:").Return([]*gogithub.PullRequest{{Title: gogithub.String("Delete expired namespace sandbox-a: remove its terraform resources"), HTMLURL: gogithub.String("https://github.com/pr/1")}}, nil)
+	gh.On("ListOpenPRs", "Delete expired namespace sandbox-b:").Return([]*gogithub.PullRequest{}, nil)
+
+	raise := func(_ github.GithubIface, _, _ string, pr pullRequest) (string, error) {
+		assert.Equal(t, "Delete expired namespace sandbox-b: remove the namespace", pr.Title)
+		assert.Equal(t, []string{"namespaces/live/sandbox-b"}, pr.Files)
+		assert.NoDirExists(t, filepath.Join(root, "namespaces/live/sandbox-b"))
+		return "", errors.New("push failed")
+	}
+	notify := func(string, string, string) error {
+		t.Fatal("the team shouldn't be told about a PR which wasn't raised")
+		return nil
+	}
+
+	var out strings.Builder
+	opt := ExpiredNamespacesOptions{RepoPath: root, ClusterDir: "live", RaisePRs: true, Limit: 1, SlackWebhookUrl: "https://hooks.slack.com/test"}
+	err := deleteExpiredNamespaces(gh, opt, expiryTestNow, &out, raise, notify)
+	assert.EqualError(t, err, "failed to raise deletion PRs for 1 namespaces")
+	assert.Contains(t, out.String(), "live/sandbox-b: push failed")
+	assert.FileExists(t, filepath.Join(root, "namespaces/live/sandbox-b/00-namespace.yaml"), "the files are put back")
+	assert.FileExists(t, filepath.Join(root, "namespaces/live/sandbox-b/resources/main.tf"))
+}
+
+func TestDeleteExpiredNamespacesDryRun(t *testing.T) {
+	root := expiryTestRepo(t)
+	raise := func(github.GithubIface, string, string, pullRequest) (string, error) {
+		t.Fatal("a dry run shouldn't raise PRs")
+		return "", nil
+	}
+
+	var out strings.Builder
+	opt := ExpiredNamespacesOptions{RepoPath: root, RaisePRs: true, DryRun: true}
+	assert.NoError(t, deleteExpiredNamespaces(new(mocks.GithubIface), opt, expiryTestNow, &out, raise, nil))
+	assert.Contains(t, out.String(), "## live/sandbox-a\n\nTitle: Delete expired namespace sandbox-a: remove its terraform resources\nReviewers: my-team\nDeletes: namespaces/live/sandbox-a/resources/s3.tf, namespaces/live/sandbox-a/resources/sqs.tf")
+	assert.Contains(t, out.String(), "## live/sandbox-b\n\nTitle: Delete expired namespace sandbox-b: remove the namespace")
+	assert.FileExists(t, filepath.Join(root, "namespaces/live/sandbox-a/resources/sqs.tf"))
+}
+
+func TestDeleteExpiredNamespacesNeedsIsProductionFalse(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/unlabelled/00-namespace.yaml": expiryTestNamespace("unlabelled", "", "2026-01-01"),
+		"namespaces/live/mistyped/00-namespace.yaml":   expiryTestNamespace("mistyped", "True", "2026-01-01"),
+		"namespaces/live/yes/00-namespace.yaml":        expiryTestNamespace("yes", "yes", "2026-01-01"),
+	})
+	raise := func(github.GithubIface, string, string, pullRequest) (string, error) {
+		t.Fatal("only namespaces labelled as not production should be deleted")
+		return "", nil
+	}
+
+	expired, err := expiredNamespaces(ExpiredNamespacesOptions{RepoPath: root}, expiryTestNow)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 3)
+	for _, ns := range expired {
+		assert.True(t, ns.Production, ns.Namespace)
+	}
+
+	var out strings.Builder
+	opt := ExpiredNamespacesOptions{RepoPath: root, RaisePRs: true}
+	assert.NoError(t, deleteExpiredNamespaces(new(mocks.GithubIface), opt, expiryTestNow, &out, raise, nil))
+	assert.Contains(t, out.String(), "live/unlabelled: it has no is-production label, so it's treated as production and never deleted")
+	assert.Contains(t, out.String(), `live/mistyped: its is-production label is "True" rather than "false", so it's treated as production and never deleted`)
+	assert.Contains(t, out.String(), `live/yes: its is-production label is "yes" rather than "false"`)
+	assert.FileExists(t, filepath.Join(root, "namespaces/live/unlabelled/00-namespace.yaml"))
+}
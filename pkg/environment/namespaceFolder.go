@@ -0,0 +1,166 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zclconf/go-cty/cty"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// NamespaceFolder is a namespace folder of the environments repository: the metadata of its
+// 00-namespace.yaml, the Github teams of its rbac and the variables of its terraform. The
+// metadata and variables can be changed and written back, leaving the rest of the files, their
+// comments and formatting, as they were.
+type NamespaceFolder struct {
+	Dir string
+	// Metadata is read from 00-namespace.yaml.
+	Metadata *Namespace
+	// Teams are the Github teams given access to the namespace by 01-rbac.yaml.
+	Teams []string
+	// Variables are the values of the variables of resources/, by name. Variables whose value
+	// isn't a string literal, e.g. it's set with a function, are left out.
+	Variables map[string]string
+
+	read     Namespace
+	yaml     []byte
+	document *yamlv3.Node
+	tf       *tfFiles
+}
+
+// ReadNamespaceFolder reads a namespace folder, which must have a 00-namespace.yaml. The rbac
+// and terraform are optional.
+func ReadNamespaceFolder(nsDir string) (*NamespaceFolder, error) {
+	name := filepath.Join(nsDir, NamespaceYamlFile)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &NamespaceFolder{Dir: nsDir, Metadata: &Namespace{}, Variables: map[string]string{}}
+	if err := f.Metadata.parseYaml(data); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	f.read = *f.Metadata
+
+	if err := f.setYaml(data); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", name, err)
+	}
+
+	if f.Teams, err = namespaceGithubTeams(nsDir); err != nil {
+		return nil, err
+	}
+
+	tf, err := loadTfFiles(filepath.Join(nsDir, "resources"))
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.tf = tf
+	_, blocks := tf.findBlocks("variable")
+	for _, b := range blocks {
+		if len(b.Labels()) != 1 {
+			continue
+		}
+		if target, err := tf.resolveVariable(b.Labels()[0], 0); err == nil {
+			f.Variables[b.Labels()[0]] = target.value
+		}
+	}
+
+	return f, nil
+}
+
+// SetVariable changes the value of a variable of resources/, where it's set, following it
+// through locals and tfvars files. It's written out by Write.
+func (f *NamespaceFolder) SetVariable(name, value string) error {
+	if f.tf == nil {
+		return fmt.Errorf("%s has no terraform", f.Dir)
+	}
+	target, err := f.tf.resolveVariable(name, 0)
+	if err != nil {
+		return err
+	}
+	target.body.SetAttributeValue(target.name, cty.StringVal(value))
+	f.Variables[name] = value
+	return nil
+}
+
+// Write writes the changes made to the metadata and variables back to the namespace folder.
+// Files which haven't changed aren't written.
+func (f *NamespaceFolder) Write() error {
+	if *f.Metadata != f.read {
+		data, err := f.Metadata.updateYaml(f.yaml, f.document)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", NamespaceYamlFile, err)
+		}
+		if err := os.WriteFile(filepath.Join(f.Dir, NamespaceYamlFile), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", NamespaceYamlFile, err)
+		}
+		if err := f.setYaml(data); err != nil {
+			return err
+		}
+		f.read = *f.Metadata
+	}
+
+	if f.tf != nil {
+		return f.tf.writeChanged()
+	}
+	return nil
+}
+
+// setYaml keeps the text of 00-namespace.yaml and the document of the namespace, which is the
+// first in the file, to update it with.
+func (f *NamespaceFolder) setYaml(data []byte) error {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return errors.New("it isn't a kubernetes manifest")
+	}
+	f.yaml, f.document = data, &doc
+	return nil
+}
+
+// updateYaml sets the name, labels and annotations of the namespace in the text of its
+// 00-namespace.yaml, whose document is doc. Only the values which changed are rewritten, so the
+// rest of the file, including any other documents, comments and blank lines, is kept as it was.
+// Metadata which is empty is removed.
+func (ns *Namespace) updateYaml(data []byte, doc *yamlv3.Node) ([]byte, error) {
+	e := newYamlEditor(data)
+	metadata, err := e.mapping(doc.Content[0], "metadata")
+	if err != nil {
+		return nil, err
+	}
+	if err := e.set(metadata, "name", ns.Namespace); err != nil {
+		return nil, err
+	}
+
+	for _, field := range namespaceYamlFields {
+		section, err := e.mapping(metadata, field.section)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.set(section, field.key, *field.field(ns)); err != nil {
+			return nil, err
+		}
+	}
+
+	owner := ns.Owner
+	if ns.InfrastructureSupport != "" {
+		owner += ": " + ns.InfrastructureSupport
+	}
+	annotations, err := e.mapping(metadata, "annotations")
+	if err != nil {
+		return nil, err
+	}
+	if err := e.set(annotations, ownerAnnotation, owner); err != nil {
+		return nil, err
+	}
+
+	return e.output()
+}
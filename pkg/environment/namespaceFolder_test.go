@@ -0,0 +1,235 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const folderTestNamespace = `# the namespace of my app
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-ns
+  labels:
+    cloud-platform.justice.gov.uk/is-production: "true"
+    cloud-platform.justice.gov.uk/environment-name: "production"
+    pod-security.kubernetes.io/enforce: restricted
+  annotations:
+    cloud-platform.justice.gov.uk/business-unit: "HMPPS"
+    cloud-platform.justice.gov.uk/slack-channel: "my-team"
+    cloud-platform.justice.gov.uk/application: "My App"
+    cloud-platform.justice.gov.uk/owner: "My Team: my-team@digital.justice.gov.uk" # the team's mailbox
+    cloud-platform.justice.gov.uk/source-code: "https://github.com/ministryofjustice/my-app"
+    cloud-platform.justice.gov.uk/team-name: "my-team"
+    cloud-platform.justice.gov.uk/service-area: "Hosting"
+`
+
+func namespaceFolderTestDir(t *testing.T) string {
+	t.Helper()
+	root := writeNamespaceFiles(t, map[string]string{
+		"my-ns/00-namespace.yaml":      folderTestNamespace,
+		"my-ns/01-rbac.yaml":           strings.ReplaceAll(upgradeTestRbac, "%s", "my-team"),
+		"my-ns/resources/variables.tf": metadataTestVariables,
+		"my-ns/resources/locals.tf":    "locals {\n  is_production = \"true\"\n}\n",
+	})
+	return filepath.Join(root, "my-ns")
+}
+
+func TestReadNamespaceFolder(t *testing.T) {
+	f, err := ReadNamespaceFolder(namespaceFolderTestDir(t))
+	assert.NoError(t, err)
+
+	assert.Equal(t, Namespace{
+		Application:           "My App",
+		BusinessUnit:          "HMPPS",
+		Environment:           "production",
+		GithubTeam:            "my-team",
+		InfrastructureSupport: "my-team@digital.justice.gov.uk",
+		IsProduction:          "true",
+		Namespace:             "my-ns",
+		Owner:                 "My Team",
+		OwnerEmail:            "my-team@digital.justice.gov.uk",
+		SlackChannel:          "my-team",
+		SourceCode:            "https://github.com/ministryofjustice/my-app",
+		ServiceArea:           "Hosting",
+	}, *f.Metadata)
+	assert.Equal(t, []string{"my-team"}, f.Teams)
+	assert.Equal(t, map[string]string{
+		"business_unit": "HQ",
+		"application":   "My App",
+		"is_production": "true",
+		"environment":   "production",
+		"namespace":     "my-ns",
+	}, f.Variables, "infrastructure_support is set with a function so it's left out")
+}
+
+func TestNamespaceFolderWrite(t *testing.T) {
+	dir := namespaceFolderTestDir(t)
+	f, err := ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.Write())
+	data, err := os.ReadFile(filepath.Join(dir, NamespaceYamlFile))
+	assert.NoError(t, err)
+	assert.Equal(t, folderTestNamespace, string(data), "nothing changed")
+
+	f.Metadata.BusinessUnit = "HQ"
+	f.Metadata.InfrastructureSupport = "other-team@digital.justice.gov.uk"
+	f.Metadata.SlackChannel = ""
+	f.Metadata.ReviewAfter = "2027-01-01"
+	assert.NoError(t, f.SetVariable("is_production", "false"))
+	assert.NoError(t, f.Write())
+
+	data, err = os.ReadFile(filepath.Join(dir, NamespaceYamlFile))
+	assert.NoError(t, err)
+	want := strings.NewReplacer(
+		`business-unit: "HMPPS"`, `business-unit: "HQ"`,
+		"    cloud-platform.justice.gov.uk/slack-channel: \"my-team\"\n", "",
+		"My Team: my-team@", "My Team: other-team@",
+	).Replace(folderTestNamespace) + "    cloud-platform.justice.gov.uk/review-after: \"2027-01-01\"\n"
+	assert.Equal(t, want, string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "resources", "locals.tf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "locals {\n  is_production = \"false\"\n}\n", string(data))
+
+	f, err = ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "HQ", f.Metadata.BusinessUnit)
+	assert.Equal(t, "2027-01-01", f.Metadata.ReviewAfter)
+	assert.Equal(t, "false", f.Variables["is_production"])
+}
+
+func TestReadNamespaceFolderErrors(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"no-email/00-namespace.yaml": strings.ReplaceAll(folderTestNamespace, "My Team: my-team@digital.justice.gov.uk", "My Team"),
+		"not-ns/00-namespace.yaml":   "kind: ConfigMap\n",
+		"invalid/00-namespace.yaml":  "metadata: [\n",
+		"list/00-namespace.yaml":     "- kind: Namespace\n",
+	})
+
+	f, err := ReadNamespaceFolder(filepath.Join(root, "no-email"))
+	assert.NoError(t, err)
+	assert.Equal(t, "My Team", f.Metadata.Owner)
+	assert.Empty(t, f.Metadata.InfrastructureSupport)
+	assert.Nil(t, f.Teams)
+	assert.Empty(t, f.Variables)
+	assert.ErrorContains(t, f.SetVariable("namespace", "x"), "has no terraform")
+
+	_, err = ReadNamespaceFolder(filepath.Join(root, "not-ns"))
+	assert.ErrorContains(t, err, "expected a Namespace, found a ConfigMap")
+
+	_, err = ReadNamespaceFolder(filepath.Join(root, "invalid"))
+	assert.ErrorContains(t, err, "could not decode namespace YAML")
+
+	_, err = ReadNamespaceFolder(filepath.Join(root, "list"))
+	assert.ErrorContains(t, err, "could not decode namespace YAML")
+
+	_, err = ReadNamespaceFolder(filepath.Join(root, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestNamespaceFolderWriteKeepsTheRestOfTheFile(t *testing.T) {
+	namespace := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-ns
+
+  labels:
+    cloud-platform.justice.gov.uk/is-production: 'true' # only prod
+    cloud-platform.justice.gov.uk/environment-name: production
+  annotations:
+    cloud-platform.justice.gov.uk/business-unit: "HMPPS"
+
+    cloud-platform.justice.gov.uk/slack-channel: "my-team"
+    cloud-platform.justice.gov.uk/owner: "My Team: my-team@digital.justice.gov.uk"
+---
+apiVersion: v1
+kind: LimitRange
+metadata:
+  name: limitrange
+  namespace: my-ns
+
+spec:
+  limits:
+    - default: {cpu: 1000m}
+      type: Container
+`
+	dir := filepath.Join(writeNamespaceFiles(t, map[string]string{"my-ns/00-namespace.yaml": namespace}), "my-ns")
+	read := func() string {
+		data, err := os.ReadFile(filepath.Join(dir, NamespaceYamlFile))
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	f, err := ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+	f.Metadata.SlackChannel = "my-team"
+	assert.NoError(t, f.Write())
+	assert.Equal(t, namespace, read(), "nothing changed")
+
+	f.Metadata.SlackChannel = "other-team"
+	assert.NoError(t, f.Write())
+	want := strings.Replace(namespace, `slack-channel: "my-team"`, `slack-channel: "other-team"`, 1)
+	assert.Equal(t, want, read(), "only the slack channel changed")
+
+	f.Metadata.IsProduction = "false"
+	f.Metadata.Environment = "development"
+	f.Metadata.BusinessUnit = ""
+	assert.NoError(t, f.Write())
+	want = strings.NewReplacer(
+		`is-production: 'true'`, `is-production: 'false'`,
+		`environment-name: production`, `environment-name: "development"`,
+		"    cloud-platform.justice.gov.uk/business-unit: \"HMPPS\"\n", "",
+	).Replace(want)
+	assert.Equal(t, want, read())
+
+	f, err = ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "other-team", f.Metadata.SlackChannel)
+	assert.Equal(t, "false", f.Metadata.IsProduction)
+}
+
+func TestNamespaceFolderWriteAddsMetadata(t *testing.T) {
+	dir := filepath.Join(writeNamespaceFiles(t, map[string]string{
+		"my-ns/00-namespace.yaml": "kind: Namespace\nmetadata:\n  name: my-ns\n---\nkind: ResourceQuota\n",
+	}), "my-ns")
+
+	f, err := ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+	f.Metadata.IsProduction = "false"
+	f.Metadata.SlackChannel = "my-team"
+	assert.NoError(t, f.Write())
+
+	data, err := os.ReadFile(filepath.Join(dir, NamespaceYamlFile))
+	assert.NoError(t, err)
+	assert.Equal(t, `kind: Namespace
+metadata:
+  name: my-ns
+  labels:
+    cloud-platform.justice.gov.uk/is-production: "false"
+  annotations:
+    cloud-platform.justice.gov.uk/slack-channel: "my-team"
+---
+kind: ResourceQuota
+`, string(data))
+}
+
+func TestNamespaceFolderWriteRefusesMultiLineValues(t *testing.T) {
+	dir := filepath.Join(writeNamespaceFiles(t, map[string]string{
+		"my-ns/00-namespace.yaml": "kind: Namespace\nmetadata:\n  name: my-ns\n  annotations:\n    cloud-platform.justice.gov.uk/application: |\n      My App\n",
+	}), "my-ns")
+
+	f, err := ReadNamespaceFolder(dir)
+	assert.NoError(t, err)
+	f.Metadata.Application = "Other App"
+	assert.ErrorContains(t, f.Write(), "the value on line 5 can't be changed in place")
+
+	data, err := os.ReadFile(filepath.Join(dir, NamespaceYamlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "My App", "the file isn't written")
+}
@@ -0,0 +1,101 @@
+package environment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// metadataVariable is a piece of namespace metadata in 00-namespace.yaml, and the terraform
+// variable which the namespace's resources, and their default tags, get the same value from.
+type metadataVariable struct {
+	metadata string
+	variable string
+	value    func(ns *Namespace) string
+}
+
+var namespaceMetadataVariables = []metadataVariable{
+	{"business-unit", "business_unit", func(ns *Namespace) string { return ns.BusinessUnit }},
+	{"application", "application", func(ns *Namespace) string { return ns.Application }},
+	{"is-production", "is_production", func(ns *Namespace) string { return ns.IsProduction }},
+	{"environment-name", "environment", func(ns *Namespace) string { return ns.Environment }},
+	{"name", "namespace", func(ns *Namespace) string { return ns.Namespace }},
+	{"owner", "infrastructure_support", func(ns *Namespace) string { return ns.OwnerEmail }},
+	{"source-code", "source_code", func(ns *Namespace) string { return ns.SourceCode }},
+}
+
+// MetadataMismatch is a terraform variable whose value doesn't match the namespace metadata
+// in 00-namespace.yaml.
+type MetadataMismatch struct {
+	// Metadata is the label or annotation in 00-namespace.yaml, e.g. business-unit.
+	Metadata string `json:"metadata"`
+	Variable string `json:"variable"`
+	// File is where the variable's value is set, relative to the namespace folder.
+	File      string `json:"file,omitempty"`
+	Namespace string `json:"namespaceValue"`
+	Terraform string `json:"terraformValue,omitempty"`
+	// Error is set when the variable's value can't be worked out, e.g. it's set from a function.
+	Error string `json:"error,omitempty"`
+	// Fixed is true when the variable was changed to the value in the metadata.
+	Fixed bool `json:"fixed,omitempty"`
+}
+
+// readNamespaceMetadata reads the 00-namespace.yaml of a namespace folder, it returns nil if
+// the namespace doesn't have one.
+func readNamespaceMetadata(nsDir string) (*Namespace, error) {
+	data, err := os.ReadFile(filepath.Join(nsDir, NamespaceYamlFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ns := &Namespace{}
+	if err := ns.parseYaml(data); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", NamespaceYamlFile, err)
+	}
+	return ns, nil
+}
+
+// checkMetadata compares the metadata of the namespace with the terraform variables which
+// should have the same value and, if fix is set, sets the mismatched variables to the metadata's
+// value in memory. Metadata which isn't set, and variables which aren't declared, are skipped.
+func checkMetadata(files *tfFiles, ns *Namespace, fix bool) []MetadataMismatch {
+	var mismatches []MetadataMismatch
+	for _, m := range namespaceMetadataVariables {
+		want := strings.TrimSpace(m.value(ns))
+		if want == "" {
+			continue
+		}
+		if _, blocks := files.findBlocks("variable", m.variable); len(blocks) == 0 {
+			continue
+		}
+
+		target, err := files.resolveVariable(m.variable, 0)
+		if err != nil {
+			mismatches = append(mismatches, MetadataMismatch{Metadata: m.metadata, Variable: m.variable, Namespace: want, Error: err.Error()})
+			continue
+		}
+		if target.value == want {
+			continue
+		}
+
+		mismatches = append(mismatches, MetadataMismatch{
+			Metadata:  m.metadata,
+			Variable:  m.variable,
+			File:      target.file,
+			Namespace: want,
+			Terraform: target.value,
+			Fixed:     fix,
+		})
+		if fix {
+			target.body.SetAttributeValue(target.name, cty.StringVal(want))
+		}
+	}
+
+	return mismatches
+}
@@ -0,0 +1,110 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const metadataTestNamespace = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: my-ns
+  labels:
+    cloud-platform.justice.gov.uk/is-production: "true"
+    cloud-platform.justice.gov.uk/environment-name: "production"
+  annotations:
+    cloud-platform.justice.gov.uk/business-unit: "HMPPS"
+    cloud-platform.justice.gov.uk/application: "My App"
+    cloud-platform.justice.gov.uk/owner: "My Team: my-team@digital.justice.gov.uk"
+    cloud-platform.justice.gov.uk/source-code: "https://github.com/ministryofjustice/my-app"
+`
+
+const metadataTestVariables = `variable "business_unit" {
+  default = "HQ"
+}
+
+variable "application" {
+  default = "My App"
+}
+
+variable "is_production" {
+  default = local.is_production
+}
+
+variable "environment" {
+  default = "production"
+}
+
+variable "namespace" {
+  default = "my-ns"
+}
+
+variable "infrastructure_support" {
+  default = format("%s@%s", "my-team", "digital.justice.gov.uk")
+}
+`
+
+func TestNamespaceTaggingMetadata(t *testing.T) {
+	root := writeNamespaceFiles(t, map[string]string{
+		"namespaces/live/my-ns/00-namespace.yaml":        metadataTestNamespace,
+		"namespaces/live/my-ns/resources/variables.tf":   metadataTestVariables,
+		"namespaces/live/my-ns/resources/locals.tf":      "locals {\n  is_production = \"false\"\n}\n",
+		"namespaces/live/my-ns/resources/main.tf":        "provider \"aws\" {\n  default_tags {\n    tags = {\n      business-unit = var.business_unit\n      application   = var.application\n      is-production = var.is_production\n      owner         = var.team_name\n      namespace     = var.namespace\n      service-area  = var.service_area\n    }\n  }\n}\n",
+		"namespaces/live/no-yaml/resources/variables.tf": "variable \"business_unit\" {\n  default = \"HQ\"\n}\n",
+	})
+
+	tc := newTagChecker(root)
+	result := tc.checkNamespace("my-ns", false, false)
+	assert.Empty(t, result.Error)
+	assert.False(t, result.Compliant)
+	assert.Equal(t, []MetadataMismatch{
+		{Metadata: "business-unit", Variable: "business_unit", File: "resources/variables.tf", Namespace: "HMPPS", Terraform: "HQ"},
+		{Metadata: "is-production", Variable: "is_production", File: "resources/locals.tf", Namespace: "true", Terraform: "false"},
+		{Metadata: "owner", Variable: "infrastructure_support", Namespace: "my-team@digital.justice.gov.uk", Error: "variable.infrastructure_support.default in variables.tf is set to format(\"%s@%s\", \"my-team\", \"digital.justice.gov.uk\"), only string literals, var. and local. references are supported"},
+	}, result.Metadata)
+
+	var out strings.Builder
+	printNamespaceTags(&out, result)
+	assert.Contains(t, out.String(), `Namespace: my-ns var.business_unit is "HQ" in resources/variables.tf but the business-unit in 00-namespace.yaml is "HMPPS"`)
+	assert.Contains(t, out.String(), "Namespace: my-ns var.infrastructure_support can't be checked against the owner in 00-namespace.yaml")
+
+	// check mode doesn't change anything
+	data, err := os.ReadFile(filepath.Join(root, "namespaces/live/my-ns/resources/variables.tf"))
+	assert.NoError(t, err)
+	assert.Equal(t, metadataTestVariables, string(data))
+
+	// adding missing tags doesn't change the values without fixMetadata
+	result = tc.checkNamespace("my-ns", true, false)
+	assert.False(t, result.Fixed)
+	assert.False(t, result.Compliant)
+	data, err = os.ReadFile(filepath.Join(root, "namespaces/live/my-ns/resources/variables.tf"))
+	assert.NoError(t, err)
+	assert.Equal(t, metadataTestVariables, string(data))
+
+	result = tc.checkNamespace("my-ns", true, true)
+	assert.True(t, result.Fixed)
+	// the variable set from a function call still can't be checked
+	assert.False(t, result.Compliant)
+
+	out.Reset()
+	printNamespaceTags(&out, result)
+	assert.Contains(t, out.String(), `Namespace: my-ns var.business_unit in resources/variables.tf: changed "HQ" to "HMPPS" to match the business-unit in 00-namespace.yaml`)
+	assert.True(t, checkModuleChange(`default = "HMPPS"`, filepath.Join(root, "namespaces/live/my-ns/resources/variables.tf")))
+	assert.True(t, checkModuleChange(`is_production = "true"`, filepath.Join(root, "namespaces/live/my-ns/resources/locals.tf")))
+
+	result = tc.checkNamespace("no-yaml", false, false)
+	assert.Empty(t, result.Error)
+	assert.Empty(t, result.Metadata)
+}
+
+func TestParseYamlOwnerWithoutEmail(t *testing.T) {
+	ns := &Namespace{}
+	err := ns.parseYaml([]byte(strings.ReplaceAll(metadataTestNamespace, "My Team: my-team@digital.justice.gov.uk", "My Team")))
+	assert.NoError(t, err)
+	assert.Equal(t, "My Team", ns.Owner)
+	assert.Empty(t, ns.OwnerEmail)
+}
@@ -0,0 +1,351 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MigrateOptions are the options of environment migrate.
+type MigrateOptions struct {
+	Namespace string
+	// To is the cluster to move the namespace to, e.g. live-2.
+	To string
+	// RepoPath is the local path to the cloud-platform-environments repository.
+	RepoPath string
+	// DryRun prints what would change without moving or changing any files.
+	DryRun bool
+	// MoveState copies the namespace's terraform state to the key of the new cluster, which
+	// needs terraform and access to the state bucket.
+	MoveState bool
+	// Backend is where the pipelines keep the namespaces' terraform state.
+	Backend StateBackend
+}
+
+// StateBackend is the S3 backend of the namespaces' terraform state, as configured for the
+// pipelines by PIPELINE_STATE_BUCKET, PIPELINE_STATE_KEY_PREFIX and PIPELINE_STATE_REGION.
+type StateBackend struct {
+	Bucket    string
+	KeyPrefix string
+	Region    string
+}
+
+// key is the state key of a namespace in a cluster, the same as the pipelines use.
+func (b StateBackend) key(c migrationCluster, namespace string) string {
+	return b.KeyPrefix + c.stateDir + "/" + namespace + "/terraform.tfstate"
+}
+
+// migrationCluster is a cluster namespaces can be migrated between.
+type migrationCluster struct {
+	name string
+	// dir is the cluster's folder under namespaces/, which is also its domain.
+	dir string
+	// stateDir is the cluster's folder in the state bucket, its PIPELINE_CLUSTER_STATE.
+	stateDir string
+}
+
+var migrationClusters = []migrationCluster{
+	{name: "live", dir: filepath.Base(liveBaseDir), stateDir: "live-1.cloud-platform.service.justice.gov.uk"},
+	{name: "live-2", dir: filepath.Base(betaBaseDir), stateDir: filepath.Base(betaBaseDir)},
+}
+
+func findMigrationCluster(name string) (*migrationCluster, error) {
+	names := make([]string, 0, len(migrationClusters))
+	for i, c := range migrationClusters {
+		if name == c.name || name == c.dir {
+			return &migrationClusters[i], nil
+		}
+		names = append(names, c.name)
+	}
+	return nil, fmt.Errorf("unknown cluster %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// domainPattern matches the cluster's domain, e.g. in ingress hostnames under apps.<domain>,
+// but not as the end of another cluster's domain.
+func (c migrationCluster) domainPattern() *regexp.Regexp {
+	return regexp.MustCompile(`(^|[^a-z0-9-])` + regexp.QuoteMeta(c.dir))
+}
+
+// stateMover copies the terraform state of the configuration in dir from one key of the
+// backend to another.
+type stateMover func(dir string, backend StateBackend, from, to string) error
+
+var moveState stateMover = runStateMove
+
+// namespaceMigration is the move of a namespace's folder from one cluster to another.
+type namespaceMigration struct {
+	namespace string
+	from, to  migrationCluster
+	fromDir   string
+	toDir     string
+	// rewritten are the files with references to the old cluster, relative to the folder, and
+	// their content with the references changed.
+	rewritten map[string][]byte
+	// references counts the references to the old cluster rewritten in each file.
+	references map[string]int
+}
+
+// MigrateNamespace moves a namespace's folder to another cluster's, rewriting the references
+// to the old cluster's domain in its files. It prints the terraform state move the namespace
+// needs, running it if asked, and a checklist of the rest of the migration.
+func MigrateNamespace(opt MigrateOptions) error {
+	return migrateNamespace(opt, os.Stdout, moveState)
+}
+
+func migrateNamespace(opt MigrateOptions, out io.Writer, move stateMover) error {
+	if opt.DryRun && opt.MoveState {
+		return errors.New("--move-state can't be used with --dry-run")
+	}
+	m, err := planNamespaceMigration(filepath.Clean(opt.RepoPath), opt.Namespace, opt.To)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Migrating %s from %s to %s\n", m.namespace, m.from.name, m.to.name)
+	for _, name := range sortedKeys(m.references) {
+		fmt.Fprintf(out, "  %s: %d reference(s) to %s rewritten\n", name, m.references[name], m.from.dir)
+	}
+
+	if !opt.DryRun {
+		if err := m.apply(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Moved %s to %s\n", m.fromDir, m.toDir)
+	}
+
+	fromKey, toKey := opt.Backend.key(m.from, m.namespace), opt.Backend.key(m.to, m.namespace)
+	fmt.Fprintf(out, "\nThe terraform state has to be copied from %s to %s, in resources/:\n\n%s\n", fromKey, toKey, stateMoveScript(opt.Backend, fromKey, toKey))
+
+	stateMoved := false
+	if opt.MoveState {
+		if err := move(filepath.Join(m.toDir, "resources"), opt.Backend, fromKey, toKey); err != nil {
+			return fmt.Errorf("the namespace was moved, but copying its terraform state failed: %w", err)
+		}
+		stateMoved = true
+		fmt.Fprintf(out, "Copied the terraform state to %s\n\n", toKey)
+	}
+
+	fmt.Fprint(out, migrationChecklist(m, fromKey, !opt.DryRun, stateMoved))
+	return nil
+}
+
+// planNamespaceMigration finds the namespace in the folder of another cluster and works out
+// the changes to its files, without changing anything.
+func planNamespaceMigration(root, namespace, to string) (*namespaceMigration, error) {
+	target, err := findMigrationCluster(to)
+	if err != nil {
+		return nil, err
+	}
+	m := &namespaceMigration{
+		namespace:  namespace,
+		to:         *target,
+		toDir:      filepath.Join(root, "namespaces", target.dir, namespace),
+		rewritten:  map[string][]byte{},
+		references: map[string]int{},
+	}
+	if _, err := os.Stat(m.toDir); err == nil {
+		return nil, fmt.Errorf("%s is already in %s", namespace, m.toDir)
+	}
+
+	var found []migrationCluster
+	for _, c := range migrationClusters {
+		if _, err := os.Stat(filepath.Join(root, "namespaces", c.dir, namespace)); c.name != target.name && err == nil {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("namespace %s isn't in the folder of another cluster", namespace)
+	case 1:
+		m.from = found[0]
+		m.fromDir = filepath.Join(root, "namespaces", m.from.dir, namespace)
+	default:
+		return nil, fmt.Errorf("namespace %s is in more than one cluster's folder", namespace)
+	}
+
+	pattern := m.from.domainPattern()
+	err = filepath.WalkDir(m.fromDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		matches := pattern.FindAllIndex(data, -1)
+		if len(matches) == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(m.fromDir, path)
+		if err != nil {
+			return err
+		}
+		m.rewritten[rel] = pattern.ReplaceAll(data, []byte("${1}"+m.to.dir))
+		m.references[rel] = len(matches)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// apply moves the namespace's folder and writes the rewritten files.
+func (m *namespaceMigration) apply() error {
+	if err := os.MkdirAll(filepath.Dir(m.toDir), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(m.fromDir, m.toDir); err != nil {
+		return fmt.Errorf("failed to move the namespace: %w", err)
+	}
+	for name, data := range m.rewritten {
+		if err := os.WriteFile(filepath.Join(m.toDir, name), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func stateMoveScript(b StateBackend, fromKey, toKey string) string {
+	init := func(key string) string {
+		return fmt.Sprintf("terraform init -reconfigure -backend-config=bucket=%s -backend-config=key=%s -backend-config=region=%s", b.Bucket, key, b.Region)
+	}
+	return strings.Join([]string{
+		init(fromKey),
+		"terraform state pull > terraform.tfstate.migrate",
+		init(toKey),
+		"terraform state push terraform.tfstate.migrate",
+		"rm terraform.tfstate.migrate",
+	}, "\n") + "\n"
+}
+
+// migrationChecklist lists the steps of the migration, ticking the ones done.
+func migrationChecklist(m *namespaceMigration, fromKey string, moved, stateMoved bool) string {
+	step := func(done bool, text string) string {
+		box := "[ ]"
+		if done {
+			box = "[x]"
+		}
+		return fmt.Sprintf("- %s %s\n", box, text)
+	}
+	rerun := fmt.Sprintf("cloud-platform environment migrate %s --to %s", m.namespace, m.to.name)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nMigration checklist for %s:\n\n", m.namespace)
+	b.WriteString(step(moved, fmt.Sprintf("Move the namespace to namespaces/%s, rewriting its references to %s", m.to.dir, m.from.dir)))
+	b.WriteString(step(stateMoved, "Copy the terraform state to the new cluster's key, with the commands above or --move-state"))
+	b.WriteString(step(false, "Raise a PR with the move, the pipeline creates the namespace and takes over its resources in "+m.to.name))
+	b.WriteString(step(false, fmt.Sprintf("Deploy the application to %s, with its ingress hosts under apps.%s", m.to.name, m.to.dir)))
+	b.WriteString(step(false, "Give every ingress, in both clusters, an external-dns.alpha.kubernetes.io/set-identifier annotation unique to the cluster"))
+	b.WriteString(step(false, fmt.Sprintf("Send the traffic to %s with `%s --dns-weight 100` against %s, then `--dns-weight 0` against %s", m.to.name, rerun, m.to.name, m.from.name)))
+	b.WriteString(step(false, fmt.Sprintf("Remove the old terraform state, %s, so deleting the namespace from %s doesn't destroy its resources", fromKey, m.from.name)))
+	b.WriteString(step(false, fmt.Sprintf("Delete the namespace from %s: kubectl delete namespace %s", m.from.name, m.namespace)))
+	return b.String()
+}
+
+// runStateMove copies the state with terraform state pull and push, run in a copy of the
+// namespace's terraform so the backend configuration isn't left in it.
+func runStateMove(dir string, backend StateBackend, from, to string) error {
+	execPath, err := exec.LookPath("terraform")
+	if err != nil {
+		return errors.New("terraform isn't installed")
+	}
+	tmp, err := copyTerraformFiles(dir)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	tf, err := tfexec.NewTerraform(tmp, execPath)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	init := func(key string) error {
+		return tf.Init(ctx, tfexec.Reconfigure(true),
+			tfexec.BackendConfig("bucket="+backend.Bucket),
+			tfexec.BackendConfig("key="+key),
+			tfexec.BackendConfig("region="+backend.Region))
+	}
+
+	if err := init(from); err != nil {
+		return fmt.Errorf("terraform init with %s failed: %w", from, err)
+	}
+	state, err := tf.StatePull(ctx)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(state) == "" {
+		return fmt.Errorf("there's no terraform state at %s", from)
+	}
+	stateFile := filepath.Join(tmp, "terraform.tfstate.migrate")
+	if err := os.WriteFile(stateFile, []byte(state), 0o600); err != nil {
+		return err
+	}
+
+	if err := init(to); err != nil {
+		return fmt.Errorf("terraform init with %s failed: %w", to, err)
+	}
+	return tf.StatePush(ctx, stateFile)
+}
+
+const (
+	setIdentifierAnnotation = "external-dns.alpha.kubernetes.io/set-identifier"
+	awsWeightAnnotation     = "external-dns.alpha.kubernetes.io/aws-weight"
+)
+
+// SetNamespaceDNSWeight sets the weight of the DNS records of the namespace's ingresses in the
+// current cluster of the kubeconfig, to move traffic between clusters during a migration.
+func SetNamespaceDNSWeight(namespace string, weight int, kubeconfig string) error {
+	kube, err := createKubeClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	return setNamespaceDNSWeight(kube, namespace, weight, os.Stdout)
+}
+
+// setNamespaceDNSWeight annotates every ingress of the namespace with the weight. The ingresses
+// need a set-identifier, so each cluster's record is kept, rather than replaced by the other's.
+func setNamespaceDNSWeight(kube kubernetes.Interface, namespace string, weight int, out io.Writer) error {
+	if weight < 0 || weight > 255 {
+		return fmt.Errorf("dns weight %d must be from 0 to 255", weight)
+	}
+
+	ctx := context.Background()
+	ingresses, err := kube.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing the ingresses of %s: %w", namespace, err)
+	}
+	if len(ingresses.Items) == 0 {
+		return fmt.Errorf("namespace %s has no ingresses in this cluster", namespace)
+	}
+
+	var errs []error
+	for i := range ingresses.Items {
+		ing := &ingresses.Items[i]
+		if ing.Annotations[setIdentifierAnnotation] == "" {
+			errs = append(errs, fmt.Errorf("ingress %s has no %s annotation", ing.Name, setIdentifierAnnotation))
+			continue
+		}
+		ing.Annotations[awsWeightAnnotation] = strconv.Itoa(weight)
+		if _, err := kube.NetworkingV1().Ingresses(namespace).Update(ctx, ing, metav1.UpdateOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("error updating ingress %s: %w", ing.Name, err))
+			continue
+		}
+		fmt.Fprintf(out, "Ingress %s: %s set to %d\n", ing.Name, awsWeightAnnotation, weight)
+	}
+	return errors.Join(errs...)
+}
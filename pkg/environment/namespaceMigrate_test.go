@@ -0,0 +1,138 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	migrateTestLive  = "namespaces/live.cloud-platform.service.justice.gov.uk/"
+	migrateTestLive2 = "namespaces/live-2.cloud-platform.service.justice.gov.uk/"
+)
+
+var migrateTestBackend = StateBackend{Bucket: "state-bucket", KeyPrefix: "cloud-platform-environments/", Region: "eu-west-2"}
+
+func migrateTestRepo(t *testing.T) string {
+	t.Helper()
+	return writeNamespaceFiles(t, map[string]string{
+		migrateTestLive + "my-ns/00-namespace.yaml": folderTestNamespace,
+		migrateTestLive + "my-ns/resources/main.tf": "provider \"aws\" {}\n",
+		migrateTestLive + "my-ns/resources/route53.tf": `resource "aws_route53_zone" "zone" {
+  name = "my-app.apps.live.cloud-platform.service.justice.gov.uk"
+}
+
+locals {
+  hosts = ["a.apps.live.cloud-platform.service.justice.gov.uk", "b.apps.live-2.cloud-platform.service.justice.gov.uk"]
+}
+`,
+		migrateTestLive + "both/00-namespace.yaml":   "",
+		migrateTestLive2 + "both/00-namespace.yaml":  "",
+		migrateTestLive2 + "moved/00-namespace.yaml": "",
+	})
+}
+
+func TestMigrateNamespace(t *testing.T) {
+	root := migrateTestRepo(t)
+	move := func(dir string, backend StateBackend, from, to string) error {
+		assert.Equal(t, filepath.Join(root, migrateTestLive2, "my-ns", "resources"), dir)
+		assert.Equal(t, migrateTestBackend, backend)
+		assert.Equal(t, "cloud-platform-environments/live-1.cloud-platform.service.justice.gov.uk/my-ns/terraform.tfstate", from)
+		assert.Equal(t, "cloud-platform-environments/live-2.cloud-platform.service.justice.gov.uk/my-ns/terraform.tfstate", to)
+		return nil
+	}
+
+	var out strings.Builder
+	opt := MigrateOptions{Namespace: "my-ns", To: "live-2", RepoPath: root, MoveState: true, Backend: migrateTestBackend}
+	assert.NoError(t, migrateNamespace(opt, &out, move))
+
+	assert.NoDirExists(t, filepath.Join(root, migrateTestLive, "my-ns"))
+	data, err := os.ReadFile(filepath.Join(root, migrateTestLive2, "my-ns", "resources", "route53.tf"))
+	assert.NoError(t, err)
+	assert.Equal(t, `resource "aws_route53_zone" "zone" {
+  name = "my-app.apps.live-2.cloud-platform.service.justice.gov.uk"
+}
+
+locals {
+  hosts = ["a.apps.live-2.cloud-platform.service.justice.gov.uk", "b.apps.live-2.cloud-platform.service.justice.gov.uk"]
+}
+`, string(data))
+	assert.FileExists(t, filepath.Join(root, migrateTestLive2, "my-ns", NamespaceYamlFile))
+
+	assert.Contains(t, out.String(), "resources/route53.tf: 2 reference(s) to live.cloud-platform.service.justice.gov.uk rewritten")
+	assert.Contains(t, out.String(), "terraform init -reconfigure -backend-config=bucket=state-bucket -backend-config=key=cloud-platform-environments/live-1.cloud-platform.service.justice.gov.uk/my-ns/terraform.tfstate -backend-config=region=eu-west-2\nterraform state pull > terraform.tfstate.migrate\n")
+	assert.Contains(t, out.String(), "- [x] Move the namespace to namespaces/live-2.cloud-platform.service.justice.gov.uk")
+	assert.Contains(t, out.String(), "- [x] Copy the terraform state")
+	assert.Contains(t, out.String(), "- [ ] Send the traffic to live-2 with `cloud-platform environment migrate my-ns --to live-2 --dns-weight 100` against live-2")
+	assert.Contains(t, out.String(), "- [ ] Delete the namespace from live: kubectl delete namespace my-ns")
+}
+
+func TestMigrateNamespaceDryRun(t *testing.T) {
+	root := migrateTestRepo(t)
+	move := func(string, StateBackend, string, string) error {
+		t.Fatal("a dry run shouldn't move the state")
+		return nil
+	}
+
+	var out strings.Builder
+	opt := MigrateOptions{Namespace: "my-ns", To: "live-2.cloud-platform.service.justice.gov.uk", RepoPath: root, DryRun: true, Backend: migrateTestBackend}
+	assert.NoError(t, migrateNamespace(opt, &out, move))
+	assert.DirExists(t, filepath.Join(root, migrateTestLive, "my-ns"))
+	assert.NoDirExists(t, filepath.Join(root, migrateTestLive2, "my-ns"))
+	assert.Contains(t, out.String(), "- [ ] Move the namespace")
+
+	opt.MoveState = true
+	assert.EqualError(t, migrateNamespace(opt, &out, move), "--move-state can't be used with --dry-run")
+}
+
+func TestMigrateNamespaceErrors(t *testing.T) {
+	root := migrateTestRepo(t)
+	move := func(string, StateBackend, string, string) error { return errors.New("access denied") }
+
+	tests := []struct {
+		namespace, to, err string
+	}{
+		{"my-ns", "live-3", `unknown cluster "live-3", expected one of: live, live-2`},
+		{"missing", "live-2", "namespace missing isn't in the folder of another cluster"},
+		{"moved", "live-2", "moved is already in " + filepath.Join(root, migrateTestLive2, "moved")},
+		{"both", "live", "both is already in " + filepath.Join(root, migrateTestLive, "both")},
+		{"my-ns", "live-2", "the namespace was moved, but copying its terraform state failed: access denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace+" to "+tt.to, func(t *testing.T) {
+			opt := MigrateOptions{Namespace: tt.namespace, To: tt.to, RepoPath: root, MoveState: true}
+			assert.EqualError(t, migrateNamespace(opt, &strings.Builder{}, move), tt.err)
+		})
+	}
+}
+
+func TestSetNamespaceDNSWeight(t *testing.T) {
+	ingress := func(name, identifier string) *networkingv1.Ingress {
+		ing := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-ns", Annotations: map[string]string{}}}
+		if identifier != "" {
+			ing.Annotations[setIdentifierAnnotation] = identifier
+		}
+		return ing
+	}
+	kube := fake.NewSimpleClientset(ingress("app", "app-my-ns-green"), ingress("admin", ""))
+
+	var out strings.Builder
+	err := setNamespaceDNSWeight(kube, "my-ns", 100, &out)
+	assert.EqualError(t, err, "ingress admin has no external-dns.alpha.kubernetes.io/set-identifier annotation")
+	assert.Equal(t, "Ingress app: external-dns.alpha.kubernetes.io/aws-weight set to 100\n", out.String())
+
+	app, err := kube.NetworkingV1().Ingresses("my-ns").Get(context.Background(), "app", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "100", app.Annotations[awsWeightAnnotation])
+
+	assert.EqualError(t, setNamespaceDNSWeight(kube, "other", 0, &out), "namespace other has no ingresses in this cluster")
+	assert.EqualError(t, setNamespaceDNSWeight(kube, "my-ns", 256, &out), "dns weight 256 must be from 0 to 255")
+}
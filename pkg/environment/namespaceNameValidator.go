@@ -1,9 +1,21 @@
 package environment
 
-type namespaceNameValidator struct{}
+import "fmt"
+
+var namespaceNameRule = &regexValidator{regex: `^[a-z0-9\-]+$`}
+
+type namespaceNameValidator struct {
+	// names confirms the name isn't taken, when set.
+	names *namespaceNames
+}
 
 func (v *namespaceNameValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^[a-z0-9\-]+$`
-	return r.isValid(s)
+	if !namespaceNameRule.isValid(s) {
+		return false
+	}
+	if err := v.names.check(s); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
 }
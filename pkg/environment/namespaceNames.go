@@ -0,0 +1,144 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceCheckOptions are the options for checking a new namespace's name isn't taken.
+type NamespaceCheckOptions struct {
+	// Force creates the namespace even if its name clashes with an existing namespace.
+	Force bool
+	// Kubeconfig is used to also check the namespaces of its current cluster, the cluster isn't
+	// checked without it.
+	Kubeconfig string
+}
+
+// namespaceNames checks a new namespace's name against the namespaces in every cluster folder
+// of the environments repository, and optionally a cluster. The same name is refused, and so are
+// names whose ingress hostnames would clash with a prototype's: a prototype serves each branch
+// at <namespace>-<branch>.apps.<domain>, so a namespace named <prototype>-<something> would have
+// the same hostname as the prototype's <something> branch. Other names where one is the other
+// followed by a dash, e.g. myapp and myapp-dev, are the usual <app>-<env> naming and are allowed.
+type namespaceNames struct {
+	root  string
+	kube  kubernetes.Interface
+	force bool
+	out   io.Writer
+	// prototype is set when the new namespace is a prototype.
+	prototype bool
+	// existing maps every namespace name to where it was found, read on the first check.
+	existing map[string][]string
+	// prototypes are the existing namespaces which are prototypes.
+	prototypes map[string]bool
+	checked    map[string]error
+}
+
+func newNamespaceNames(opt NamespaceCheckOptions, out io.Writer) (*namespaceNames, error) {
+	n := &namespaceNames{root: ".", force: opt.Force, out: out, checked: map[string]error{}}
+	if opt.Kubeconfig != "" {
+		kube, err := createKubeClient(opt.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		n.kube = kube
+	}
+	return n, nil
+}
+
+func (n *namespaceNames) load() error {
+	n.existing = map[string][]string{}
+	n.prototypes = map[string]bool{}
+
+	clusterDirs, err := listClusterDirs(n.root)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, cluster := range clusterDirs {
+		dir := filepath.Join("namespaces", cluster)
+		entries, err := os.ReadDir(filepath.Join(n.root, dir))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			n.existing[e.Name()] = append(n.existing[e.Name()], dir)
+			// only prototypes have the basic-auth environment create prototype adds
+			if _, err := os.Stat(filepath.Join(n.root, dir, e.Name(), "resources", "basic-auth.tf")); err == nil {
+				n.prototypes[e.Name()] = true
+			}
+		}
+	}
+
+	if n.kube != nil {
+		namespaces, err := n.kube.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing the cluster's namespaces: %w", err)
+		}
+		for _, ns := range namespaces.Items {
+			n.existing[ns.Name] = append(n.existing[ns.Name], "the cluster")
+		}
+	}
+
+	return nil
+}
+
+// clashes describes where a namespace called name already exists, and the prototypes whose
+// ingress hostnames would clash with it.
+func (n *namespaceNames) clashes(name string) ([]string, error) {
+	if n.existing == nil {
+		if err := n.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	var clashes []string
+	for _, existing := range sortedKeys(n.existing) {
+		where := strings.Join(n.existing[existing], ", ")
+		switch {
+		case existing == name:
+			clashes = append(clashes, fmt.Sprintf("namespace %s already exists in %s", name, where))
+		case n.prototypes[existing] && strings.HasPrefix(name, existing+"-"):
+			clashes = append(clashes, fmt.Sprintf("the hostname %s.apps.<domain> is also the hostname of the %s branch of prototype %s in %s", name, strings.TrimPrefix(name, existing+"-"), existing, where))
+		case n.prototype && strings.HasPrefix(existing, name+"-"):
+			clashes = append(clashes, fmt.Sprintf("the prototype's %s branch would have the hostname %s.apps.<domain> of namespace %s in %s", strings.TrimPrefix(existing, name+"-"), existing, existing, where))
+		}
+	}
+	return clashes, nil
+}
+
+// check returns an error listing the namespaces name clashes with, unless forced, when they are
+// printed as warnings instead. A nil namespaceNames doesn't check anything.
+func (n *namespaceNames) check(name string) error {
+	if n == nil {
+		return nil
+	}
+	if err, ok := n.checked[name]; ok {
+		return err
+	}
+
+	clashes, err := n.clashes(name)
+	switch {
+	case err != nil:
+	case len(clashes) > 0 && n.force:
+		for _, c := range clashes {
+			fmt.Fprintf(n.out, "Warning: %s, creating it anyway as --force was given\n", c)
+		}
+	case len(clashes) > 0:
+		err = fmt.Errorf("%s, use --force to create it anyway", strings.Join(clashes, "; "))
+	}
+
+	n.checked[name] = err
+	return err
+}
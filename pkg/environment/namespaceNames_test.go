@@ -0,0 +1,96 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func namespaceNamesTestRepo(t *testing.T) string {
+	t.Helper()
+	return writeNamespaceFiles(t, map[string]string{
+		"namespaces/live.cloud-platform.service.justice.gov.uk/myapp-dev/00-namespace.yaml":   "",
+		"namespaces/live-2.cloud-platform.service.justice.gov.uk/myapp-dev/00-namespace.yaml": "",
+		"namespaces/live.cloud-platform.service.justice.gov.uk/other/00-namespace.yaml":       "",
+		"namespaces/live.cloud-platform.service.justice.gov.uk/proto/resources/basic-auth.tf": "",
+	})
+}
+
+func TestNamespaceNamesCheck(t *testing.T) {
+	var out strings.Builder
+	names := &namespaceNames{root: namespaceNamesTestRepo(t), out: &out, checked: map[string]error{}}
+
+	err := names.check("myapp-dev")
+	assert.ErrorContains(t, err, "namespace myapp-dev already exists in namespaces/live-2.cloud-platform.service.justice.gov.uk, namespaces/live.cloud-platform.service.justice.gov.uk")
+	assert.ErrorContains(t, err, "use --force to create it anyway")
+
+	// <app> next to <app>-<env> is the usual naming, so it's allowed
+	out.Reset()
+	assert.NoError(t, names.check("myapp"))
+	assert.NoError(t, names.check("myapp-dev-main"))
+	assert.NoError(t, names.check("myapp-de"))
+	assert.NoError(t, names.check("another"))
+	assert.Empty(t, out.String())
+
+	// but a prototype serves its branches at <namespace>-<branch>
+	err = names.check("proto-main")
+	assert.EqualError(t, err, "the hostname proto-main.apps.<domain> is also the hostname of the main branch of prototype proto in namespaces/live.cloud-platform.service.justice.gov.uk, use --force to create it anyway")
+	assert.NoError(t, names.check("protos"))
+
+	var none *namespaceNames
+	assert.NoError(t, none.check("myapp-dev"))
+}
+
+func TestNamespaceNamesForce(t *testing.T) {
+	var out strings.Builder
+	names := &namespaceNames{root: namespaceNamesTestRepo(t), force: true, out: &out, checked: map[string]error{}}
+
+	assert.NoError(t, names.check("other"))
+	assert.NoError(t, names.check("other"))
+	assert.Equal(t, "Warning: namespace other already exists in namespaces/live.cloud-platform.service.justice.gov.uk, creating it anyway as --force was given\n", out.String())
+}
+
+func TestNamespaceNamesPrototype(t *testing.T) {
+	var out strings.Builder
+	names := &namespaceNames{root: namespaceNamesTestRepo(t), prototype: true, out: &out, checked: map[string]error{}}
+
+	assert.EqualError(t, names.check("myapp"), "the prototype's dev branch would have the hostname myapp-dev.apps.<domain> of namespace myapp-dev in namespaces/live-2.cloud-platform.service.justice.gov.uk, namespaces/live.cloud-platform.service.justice.gov.uk, use --force to create it anyway")
+	assert.NoError(t, names.check("myap"))
+
+	names.force = true
+	names.checked = map[string]error{}
+	assert.NoError(t, names.check("myapp"))
+	assert.Contains(t, out.String(), "Warning: the prototype's dev branch would have the hostname myapp-dev.apps.<domain>")
+}
+
+func TestNamespaceNamesCluster(t *testing.T) {
+	kube := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-only"}})
+	names := &namespaceNames{root: t.TempDir(), kube: kube, checked: map[string]error{}}
+
+	assert.EqualError(t, names.check("cluster-only"), "namespace cluster-only already exists in the cluster, use --force to create it anyway")
+	assert.NoError(t, names.check("myapp-dev"))
+}
+
+func TestCreateNamespaceRefusesExistingName(t *testing.T) {
+	root := namespaceNamesTestRepo(t)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(root))
+	defer func() { assert.NoError(t, os.Chdir(wd)) }()
+
+	opt := CreateNamespaceOptions{SkipEnvCheck: true, Set: validAnswers()}
+	_, err = createTemplateNamespace(opt, nil)
+	assert.ErrorContains(t, err, "namespace myapp-dev already exists")
+	assert.NoFileExists(t, filepath.Join(namespaceBaseFolder, "myapp-dev", "01-rbac.yaml"))
+
+	opt.Force = true
+	_, err = createTemplateNamespace(opt, nil)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(namespaceBaseFolder, "myapp-dev", "01-rbac.yaml"))
+}
@@ -0,0 +1,54 @@
+package environment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+)
+
+// namespacePR is the PR adding a new namespace's folder, and the .checksum of it the auto pr
+// github action checks, to the environments repository.
+func namespacePR(ns *Namespace) pullRequest {
+	title := "Create namespace " + ns.Namespace
+	return pullRequest{
+		Branch:        ns.Namespace,
+		Title:         title,
+		Description:   namespacePRDescription(ns),
+		CommitMessage: title,
+		Files:         []string{namespaceBaseFolder + "/" + ns.Namespace, ".checksum"},
+		Local:         true,
+	}
+}
+
+func namespacePRDescription(ns *Namespace) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Creates the `%s` namespace in `%s`, generated by `cloud-platform environment create`.\n\n", ns.Namespace, namespaceBaseFolder)
+	b.WriteString("| | |\n|---|---|\n")
+	rows := [][2]string{
+		{"Application", ns.Application},
+		{"Environment", ns.Environment},
+		{"Production", ns.IsProduction},
+		{"Owning team", fmt.Sprintf("[%s](https://github.com/orgs/%s/teams/%s)", ns.GithubTeam, mojOwner, ns.GithubTeam)},
+		{"Business unit", ns.BusinessUnit},
+		{"Service area", ns.ServiceArea},
+		{"Owner", ns.Owner},
+		{"Infrastructure support", ns.InfrastructureSupport},
+		{"Slack channel", "#" + ns.SlackChannel},
+		{"Source code", ns.SourceCode},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", r[0], r[1])
+	}
+	return b.String()
+}
+
+// openNamespacePR commits the new namespace to a branch named after it, pushes it and raises
+// a PR, returning its URL.
+func openNamespacePR(gh github.GithubIface, ghToken string, ns *Namespace, raise prRaiser) (string, error) {
+	prURL, err := raise(gh, ghToken, cloudPlatformEnvRepo, namespacePR(ns))
+	if err != nil {
+		return "", fmt.Errorf("namespace files were generated, but raising the PR failed: %w", err)
+	}
+	return prURL, nil
+}
@@ -0,0 +1,73 @@
+package environment
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+	mocks "github.com/ministryofjustice/cloud-platform-cli/pkg/mocks/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenNamespacePR(t *testing.T) {
+	ns := &Namespace{}
+	assert.NoError(t, ns.setAnswers(validAnswers()))
+
+	var raised pullRequest
+	raise := func(gh github.GithubIface, ghToken, repo string, pr pullRequest) (string, error) {
+		assert.Equal(t, "token", ghToken)
+		assert.Equal(t, "cloud-platform-environments", repo)
+		raised = pr
+		return "https://github.com/ministryofjustice/cloud-platform-environments/pull/1", nil
+	}
+
+	url, err := openNamespacePR(new(mocks.GithubIface), "token", ns, raise)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/ministryofjustice/cloud-platform-environments/pull/1", url)
+
+	assert.Equal(t, "myapp-dev", raised.Branch)
+	assert.Equal(t, "Create namespace myapp-dev", raised.Title)
+	assert.Equal(t, []string{namespaceBaseFolder + "/myapp-dev", ".checksum"}, raised.Files)
+	assert.True(t, raised.Local)
+	assert.Contains(t, raised.Description, "| Owning team | [webops](https://github.com/orgs/ministryofjustice/teams/webops) |")
+	assert.Contains(t, raised.Description, "| Business unit | Platforms |")
+	assert.Contains(t, raised.Description, "| Source code | https://github.com/ministryofjustice/myapp |")
+}
+
+func TestOpenNamespacePRFailure(t *testing.T) {
+	raise := func(github.GithubIface, string, string, pullRequest) (string, error) {
+		return "", errors.New("failed to push branch")
+	}
+
+	_, err := openNamespacePR(new(mocks.GithubIface), "token", &Namespace{Namespace: "myapp-dev"}, raise)
+	assert.EqualError(t, err, "namespace files were generated, but raising the PR failed: failed to push branch")
+}
+
+func TestCreateNamespaceOpenPRExistingBranch(t *testing.T) {
+	repo := gitTestRepo(t)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(repo))
+	defer func() { assert.NoError(t, os.Chdir(wd)) }()
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(repo, "namespaces")
+
+	assert.False(t, branchExists("", "myapp-dev"))
+	assert.NoError(t, runGit("", "branch", "myapp-dev"))
+	assert.True(t, branchExists("", "myapp-dev"))
+
+	_, err = createTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, Set: validAnswers(), OpenPR: true}, nil)
+	assert.EqualError(t, err, "a branch called myapp-dev already exists in this checkout, delete it or raise the PR yourself without --open-pr")
+	assert.NoDirExists(t, namespaceBaseFolder)
+}
+
+func TestCreateNamespaceOpenPRNeedsToken(t *testing.T) {
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(t.TempDir(), "namespaces")
+
+	err := CreateTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, Set: validAnswers(), OpenPR: true})
+	assert.ErrorContains(t, err, "a github token is needed to open a PR")
+	assert.NoDirExists(t, namespaceBaseFolder)
+}
@@ -0,0 +1,421 @@
+package environment
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	dir "golang.org/x/mod/sumdb/dirhash"
+)
+
+// NamespaceValidateOptions are the options of environment validate.
+type NamespaceValidateOptions struct {
+	// Dirs are the namespace folders to validate, e.g. namespaces/live.cloud-platform.service.justice.gov.uk/myapp-dev
+	Dirs []string
+	// SkipTerraform skips terraform validate, which has to download the namespace's providers
+	// and modules.
+	SkipTerraform bool
+	// Output is the format of the report, text or json.
+	Output string
+}
+
+// NamespaceValidateReport is the result of validating namespace folders.
+type NamespaceValidateReport struct {
+	Namespaces []NamespaceValidation `json:"namespaces"`
+}
+
+// NamespaceValidation is the result of validating one namespace folder.
+type NamespaceValidation struct {
+	Namespace string              `json:"namespace"`
+	Dir       string              `json:"dir"`
+	Problems  []ValidationProblem `json:"problems"`
+	// Valid is true when there are no errors, warnings don't make a namespace invalid.
+	Valid bool `json:"valid"`
+}
+
+// ValidationProblem is something wrong with a namespace folder.
+type ValidationProblem struct {
+	// Check is the check which found the problem: metadata, name, files, fmt, validate or checksum.
+	Check string `json:"check"`
+	// Severity is error or warning.
+	Severity string `json:"severity"`
+	// File is relative to the namespace folder.
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// namespaceMetadataRule is a label or annotation of 00-namespace.yaml and the rule its value,
+// as read by Namespace.parseYaml, must follow.
+type namespaceMetadataRule struct {
+	key      string
+	optional bool
+	rule     answerRule
+	value    func(ns *Namespace) string
+}
+
+var namespaceMetadataRules = []namespaceMetadataRule{
+	{key: "label cloud-platform.justice.gov.uk/is-production", rule: isProductionRule, value: func(ns *Namespace) string { return ns.IsProduction }},
+	{key: "label cloud-platform.justice.gov.uk/environment-name", rule: lowercaseStringRule, value: func(ns *Namespace) string { return ns.Environment }},
+	{key: "annotation cloud-platform.justice.gov.uk/business-unit", rule: businessUnitRule, value: func(ns *Namespace) string { return ns.BusinessUnit }},
+	{key: "annotation cloud-platform.justice.gov.uk/application", rule: new(notEmptyValidator), value: func(ns *Namespace) string { return ns.Application }},
+	{key: "annotation cloud-platform.justice.gov.uk/owner", rule: new(notEmptyValidator), value: func(ns *Namespace) string { return ns.Owner }},
+	{key: "annotation cloud-platform.justice.gov.uk/source-code", rule: githubUrlRule, value: func(ns *Namespace) string { return ns.SourceCode }},
+	{key: "annotation cloud-platform.justice.gov.uk/review-after", optional: true, rule: reviewAfterRule, value: func(ns *Namespace) string { return ns.ReviewAfter }},
+}
+
+// namespaceKubernetesFiles are the files every namespace needs besides 00-namespace.yaml.
+var namespaceKubernetesFiles = []string{
+	"01-rbac.yaml",
+	"02-limitrange.yaml",
+	"03-resourcequota.yaml",
+	"04-networkpolicy.yaml",
+}
+
+// terraformValidator runs terraform validate on a folder of terraform, it's a variable so
+// tests don't need terraform or the network.
+var terraformValidator = runTerraformValidate
+
+// ValidateNamespaces lints namespace folders before a PR is raised: their metadata, files,
+// terraform formatting and configuration, and the .checksum environment create writes. It
+// returns an error if any namespace has errors, so it can be used in pre-commit.
+func ValidateNamespaces(opt NamespaceValidateOptions) error {
+	return validateNamespaces(opt, os.Stdout)
+}
+
+func validateNamespaces(opt NamespaceValidateOptions, out io.Writer) error {
+	if opt.Output != "" && opt.Output != "text" && opt.Output != "json" {
+		return fmt.Errorf("unsupported output format %q, must be one of: text, json", opt.Output)
+	}
+	dirs := opt.Dirs
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var report NamespaceValidateReport
+	for _, d := range dirs {
+		if info, err := os.Stat(d); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s isn't a namespace folder", d)
+		}
+		report.Namespaces = append(report.Namespaces, validateNamespace(d, opt.SkipTerraform))
+	}
+
+	if err := PrintNamespaceValidateReport(out, report, opt.Output); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, ns := range report.Namespaces {
+		if !ns.Valid {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d namespaces have errors", failed, len(report.Namespaces))
+	}
+	return nil
+}
+
+// validateNamespace runs every check on a namespace folder.
+func validateNamespace(nsDir string, skipTerraform bool) NamespaceValidation {
+	v := NamespaceValidation{Dir: nsDir}
+	if abs, err := filepath.Abs(nsDir); err == nil {
+		nsDir = abs
+	}
+	folder := filepath.Base(nsDir)
+	v.Namespace = folder
+
+	ns, problems := checkNamespaceMetadata(nsDir)
+	v.Problems = append(v.Problems, problems...)
+	if ns != nil && ns.Namespace != "" {
+		v.Namespace = ns.Namespace
+		v.Problems = append(v.Problems, checkNamespaceName(ns.Namespace, folder)...)
+	}
+
+	for _, name := range namespaceKubernetesFiles {
+		if _, err := os.Stat(filepath.Join(nsDir, name)); err != nil {
+			v.Problems = append(v.Problems, ValidationProblem{Check: "files", Severity: severityError, File: name, Message: "is missing"})
+		}
+	}
+
+	v.Problems = append(v.Problems, checkTerraformFormat(nsDir)...)
+	if !skipTerraform {
+		v.Problems = append(v.Problems, checkTerraformValidate(nsDir)...)
+	}
+	v.Problems = append(v.Problems, checkNamespaceChecksum(nsDir, v.Namespace)...)
+
+	v.Valid = true
+	for _, p := range v.Problems {
+		if p.Severity == severityError {
+			v.Valid = false
+		}
+	}
+	return v
+}
+
+func checkNamespaceMetadata(nsDir string) (*Namespace, []ValidationProblem) {
+	problem := func(format string, a ...any) ValidationProblem {
+		return ValidationProblem{Check: "metadata", Severity: severityError, File: NamespaceYamlFile, Message: fmt.Sprintf(format, a...)}
+	}
+
+	ns, err := readNamespaceMetadata(nsDir)
+	if err != nil {
+		return nil, []ValidationProblem{problem("%s", err)}
+	}
+	if ns == nil {
+		return nil, []ValidationProblem{problem("is missing")}
+	}
+
+	var problems []ValidationProblem
+	if ns.Namespace == "" {
+		problems = append(problems, problem("metadata.name is missing"))
+	}
+	for _, r := range namespaceMetadataRules {
+		value := r.value(ns)
+		switch {
+		case value == "" && r.optional:
+		case value == "":
+			problems = append(problems, problem("%s is missing", r.key))
+		default:
+			if err := r.rule.validate(value); err != nil {
+				problems = append(problems, problem("%s: %q %s", r.key, value, err))
+			}
+		}
+	}
+	if ns.Owner != "" {
+		if ns.OwnerEmail == "" {
+			problems = append(problems, problem(`annotation cloud-platform.justice.gov.uk/owner: %q should be of the form "<team>: <email>"`, ns.Owner))
+		} else if err := teamEmailRule.validate(ns.OwnerEmail); err != nil {
+			problems = append(problems, problem("annotation cloud-platform.justice.gov.uk/owner: email %q %s", ns.OwnerEmail, err))
+		}
+	}
+
+	return ns, problems
+}
+
+func checkNamespaceName(namespace, folder string) []ValidationProblem {
+	var problems []ValidationProblem
+	if namespace != folder {
+		problems = append(problems, ValidationProblem{Check: "name", Severity: severityError, File: NamespaceYamlFile, Message: fmt.Sprintf("metadata.name %q doesn't match the folder name %q", namespace, folder)})
+	}
+	if err := namespaceNameRule.validate(namespace); err != nil {
+		problems = append(problems, ValidationProblem{Check: "name", Severity: severityError, File: NamespaceYamlFile, Message: fmt.Sprintf("metadata.name %q %s", namespace, err)})
+	}
+	return problems
+}
+
+// checkTerraformFormat is terraform fmt -check of the namespace's resources/ folder, using the
+// formatter terraform fmt does so it works without terraform.
+func checkTerraformFormat(nsDir string) []ValidationProblem {
+	names, _ := filepath.Glob(filepath.Join(nsDir, "resources", "*.tf"))
+
+	var problems []ValidationProblem
+	for _, name := range names {
+		file := filepath.ToSlash(filepath.Join("resources", filepath.Base(name)))
+		data, err := os.ReadFile(name)
+		if err != nil {
+			problems = append(problems, ValidationProblem{Check: "fmt", Severity: severityError, File: file, Message: err.Error()})
+			continue
+		}
+		if _, diags := hclwrite.ParseConfig(data, name, hcl.InitialPos); diags.HasErrors() {
+			for _, d := range diags {
+				problems = append(problems, ValidationProblem{Check: "fmt", Severity: severityError, File: file, Message: diagnosticMessage(d.Subject, d.Summary, d.Detail)})
+			}
+			continue
+		}
+		if !bytes.Equal(hclwrite.Format(data), data) {
+			problems = append(problems, ValidationProblem{Check: "fmt", Severity: severityError, File: file, Message: "isn't formatted, run terraform fmt"})
+		}
+	}
+	return problems
+}
+
+func diagnosticMessage(r *hcl.Range, summary, detail string) string {
+	msg := summary
+	if detail != "" {
+		msg += ": " + detail
+	}
+	if r != nil {
+		msg = fmt.Sprintf("line %d: %s", r.Start.Line, msg)
+	}
+	return msg
+}
+
+// checkTerraformValidate runs terraform validate on the namespace's resources/ folder. It
+// can't be run without terraform, or offline, which are warnings so the other checks still
+// decide whether the namespace is valid.
+func checkTerraformValidate(nsDir string) []ValidationProblem {
+	resources := filepath.Join(nsDir, "resources")
+	if names, _ := filepath.Glob(filepath.Join(resources, "*.tf")); len(names) == 0 {
+		return nil
+	}
+
+	problems, err := terraformValidator(resources)
+	if err != nil {
+		return []ValidationProblem{{Check: "validate", Severity: severityWarning, Message: fmt.Sprintf("terraform validate was skipped: %s", err)}}
+	}
+	return problems
+}
+
+// runTerraformValidate validates a copy of the terraform files in resources, so the
+// .terraform folder and lock file terraform init creates don't end up in the namespace.
+func runTerraformValidate(resources string) ([]ValidationProblem, error) {
+	execPath, err := exec.LookPath("terraform")
+	if err != nil {
+		return nil, errors.New("terraform isn't installed")
+	}
+
+	tmp, err := copyTerraformFiles(resources)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	tf, err := tfexec.NewTerraform(tmp, execPath)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := tf.Init(ctx, tfexec.Backend(false)); err != nil {
+		return nil, fmt.Errorf("terraform init failed: %w", err)
+	}
+	result, err := tf.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []ValidationProblem
+	for _, d := range result.Diagnostics {
+		p := ValidationProblem{Check: "validate", Severity: string(d.Severity), Message: d.Summary}
+		if d.Detail != "" {
+			p.Message += ": " + d.Detail
+		}
+		if d.Range != nil {
+			p.File = filepath.ToSlash(filepath.Join("resources", d.Range.Filename))
+			p.Message = fmt.Sprintf("line %d: %s", d.Range.Start.Line, p.Message)
+		}
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// copyTerraformFiles copies the .tf files of dir to a new temporary folder, for terraform to be
+// run in without leaving anything behind in dir. The caller removes the folder.
+func copyTerraformFiles(dir string) (string, error) {
+	tmp, err := os.MkdirTemp("", "cloud-platform-terraform")
+	if err != nil {
+		return "", err
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.tf"))
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(tmp, filepath.Base(name)), data, 0o644)
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+	return tmp, nil
+}
+
+// checkNamespaceChecksum compares the hash of the namespace folder with the .checksum
+// createDirHash wrote at the root of the repository, namespaces/<cluster>/<namespace> up. The
+// .checksum is only for the last namespace created, so there's nothing to check for others.
+func checkNamespaceChecksum(nsDir, namespace string) []ValidationProblem {
+	file := filepath.Join(nsDir, "..", "..", "..", ".checksum")
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	// the first line is a comment, then the namespace and its hash
+	if len(lines) < 3 || lines[1] != namespace {
+		return nil
+	}
+
+	hash, err := dir.HashDir(nsDir, namespace, dir.Hash1)
+	if err != nil {
+		return []ValidationProblem{{Check: "checksum", Severity: severityError, Message: err.Error()}}
+	}
+	if hash != lines[2] {
+		return []ValidationProblem{{Check: "checksum", Severity: severityError, Message: ".checksum doesn't match the namespace folder, which has changed since environment create generated it. Regenerate the namespace, or remove .checksum if the changes are intended"}}
+	}
+	return nil
+}
+
+// PrintNamespaceValidateReport writes the report in the output format, text or json.
+func PrintNamespaceValidateReport(w io.Writer, report NamespaceValidateReport, output string) error {
+	switch output {
+	case "json":
+		if report.Namespaces == nil {
+			report.Namespaces = []NamespaceValidation{}
+		}
+		for i := range report.Namespaces {
+			if report.Namespaces[i].Problems == nil {
+				report.Namespaces[i].Problems = []ValidationProblem{}
+			}
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "text", "":
+		for _, ns := range report.Namespaces {
+			printNamespaceValidation(w, ns)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: text, json", output)
+	}
+}
+
+func printNamespaceValidation(w io.Writer, ns NamespaceValidation) {
+	var errs, warnings int
+	for _, p := range ns.Problems {
+		if p.Severity == severityError {
+			errs++
+		} else {
+			warnings++
+		}
+		if p.File != "" {
+			fmt.Fprintf(w, "Namespace: %s %s in %s: %s\n", ns.Namespace, p.Severity, p.File, p.Message)
+		} else {
+			fmt.Fprintf(w, "Namespace: %s %s: %s\n", ns.Namespace, p.Severity, p.Message)
+		}
+	}
+
+	switch {
+	case ns.Valid && warnings == 0:
+		fmt.Fprintf(w, "Namespace: %s is valid.\n", ns.Namespace)
+	case ns.Valid:
+		fmt.Fprintf(w, "Namespace: %s is valid, with %d warning(s).\n", ns.Namespace, warnings)
+	default:
+		fmt.Fprintf(w, "Namespace: %s has %d error(s) and %d warning(s).\n", ns.Namespace, errs, warnings)
+	}
+}
@@ -0,0 +1,147 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	dir "golang.org/x/mod/sumdb/dirhash"
+)
+
+func validNamespaceFiles(ns string) map[string]string {
+	base := "namespaces/live/" + ns + "/"
+	return map[string]string{
+		base + "00-namespace.yaml":      strings.ReplaceAll(metadataTestNamespace, "my-ns", ns),
+		base + "01-rbac.yaml":           "kind: RoleBinding\n",
+		base + "02-limitrange.yaml":     "kind: LimitRange\n",
+		base + "03-resourcequota.yaml":  "kind: ResourceQuota\n",
+		base + "04-networkpolicy.yaml":  "kind: NetworkPolicy\n",
+		base + "resources/variables.tf": "variable \"namespace\" {\n  default = \"" + ns + "\"\n}\n",
+	}
+}
+
+func stubTerraformValidator(t *testing.T, problems []ValidationProblem, err error) {
+	t.Helper()
+	original := terraformValidator
+	t.Cleanup(func() { terraformValidator = original })
+	terraformValidator = func(string) ([]ValidationProblem, error) { return problems, err }
+}
+
+func TestValidateNamespace(t *testing.T) {
+	stubTerraformValidator(t, nil, nil)
+	root := writeNamespaceFiles(t, validNamespaceFiles("my-ns"))
+
+	v := validateNamespace(filepath.Join(root, "namespaces/live/my-ns"), false)
+	assert.True(t, v.Valid)
+	assert.Empty(t, v.Problems)
+	assert.Equal(t, "my-ns", v.Namespace)
+}
+
+func TestValidateNamespaceProblems(t *testing.T) {
+	stubTerraformValidator(t, []ValidationProblem{{Check: "validate", Severity: severityError, File: "resources/main.tf", Message: "line 1: Unsupported argument"}}, nil)
+
+	files := validNamespaceFiles("my-ns")
+	delete(files, "namespaces/live/my-ns/02-limitrange.yaml")
+	files["namespaces/live/my-ns/00-namespace.yaml"] = strings.NewReplacer(
+		"name: my-ns", "name: other-ns",
+		`is-production: "true"`, `is-production: "yes"`,
+		`business-unit: "HMPPS"`, `business-unit: ""`,
+		"My Team: my-team@digital.justice.gov.uk", "My Team",
+	).Replace(metadataTestNamespace)
+	files["namespaces/live/my-ns/resources/main.tf"] = "locals {\n  a=1\n}\n"
+	files["namespaces/live/my-ns/resources/broken.tf"] = "locals {\n"
+	root := writeNamespaceFiles(t, files)
+
+	v := validateNamespace(filepath.Join(root, "namespaces/live/my-ns"), false)
+	assert.False(t, v.Valid)
+	assert.Equal(t, "other-ns", v.Namespace)
+
+	messages := map[string][]string{}
+	for _, p := range v.Problems {
+		messages[p.Check] = append(messages[p.Check], p.File+": "+p.Message)
+	}
+	assert.Equal(t, []string{
+		`00-namespace.yaml: label cloud-platform.justice.gov.uk/is-production: "yes" must be in the list: true, false`,
+		"00-namespace.yaml: annotation cloud-platform.justice.gov.uk/business-unit is missing",
+		`00-namespace.yaml: annotation cloud-platform.justice.gov.uk/owner: "My Team" should be of the form "<team>: <email>"`,
+	}, messages["metadata"])
+	assert.Equal(t, []string{`00-namespace.yaml: metadata.name "other-ns" doesn't match the folder name "my-ns"`}, messages["name"])
+	assert.Equal(t, []string{"02-limitrange.yaml: is missing"}, messages["files"])
+	assert.Len(t, messages["fmt"], 2)
+	assert.Contains(t, messages["fmt"][0], "resources/broken.tf: line")
+	assert.Equal(t, "resources/main.tf: isn't formatted, run terraform fmt", messages["fmt"][1])
+	assert.Equal(t, []string{"resources/main.tf: line 1: Unsupported argument"}, messages["validate"])
+}
+
+func TestValidateNamespaceWithoutTerraform(t *testing.T) {
+	stubTerraformValidator(t, nil, errors.New("terraform isn't installed"))
+	root := writeNamespaceFiles(t, validNamespaceFiles("my-ns"))
+	nsDir := filepath.Join(root, "namespaces/live/my-ns")
+
+	v := validateNamespace(nsDir, false)
+	assert.True(t, v.Valid, "a skipped terraform validate is only a warning")
+	assert.Equal(t, []ValidationProblem{{Check: "validate", Severity: severityWarning, Message: "terraform validate was skipped: terraform isn't installed"}}, v.Problems)
+
+	v = validateNamespace(nsDir, true)
+	assert.Empty(t, v.Problems)
+}
+
+func TestValidateNamespaceChecksum(t *testing.T) {
+	stubTerraformValidator(t, nil, nil)
+	root := writeNamespaceFiles(t, validNamespaceFiles("my-ns"))
+	nsDir := filepath.Join(root, "namespaces/live/my-ns")
+
+	hash, err := dir.HashDir(nsDir, "my-ns", dir.Hash1)
+	assert.NoError(t, err)
+	checksum := filepath.Join(root, ".checksum")
+	assert.NoError(t, os.WriteFile(checksum, []byte("#This file is used by the auto pr github action. Please commit\nmy-ns\n"+hash+"\n"), 0o644))
+
+	assert.Empty(t, validateNamespace(nsDir, false).Problems)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(nsDir, "resources", "main.tf"), []byte("locals {}\n"), 0o644))
+	v := validateNamespace(nsDir, false)
+	assert.False(t, v.Valid)
+	assert.Len(t, v.Problems, 1)
+	assert.Equal(t, "checksum", v.Problems[0].Check)
+
+	// a checksum for another namespace isn't checked
+	assert.NoError(t, os.WriteFile(checksum, []byte("#comment\nother-ns\n"+hash+"\n"), 0o644))
+	assert.Empty(t, validateNamespace(nsDir, false).Problems)
+}
+
+func TestValidateNamespacesReport(t *testing.T) {
+	stubTerraformValidator(t, nil, nil)
+	files := validNamespaceFiles("my-ns")
+	for name, content := range validNamespaceFiles("bad-ns") {
+		if !strings.HasSuffix(name, "01-rbac.yaml") {
+			files[name] = content
+		}
+	}
+	root := writeNamespaceFiles(t, files)
+	good := filepath.Join(root, "namespaces/live/my-ns")
+	bad := filepath.Join(root, "namespaces/live/bad-ns")
+
+	var out strings.Builder
+	err := validateNamespaces(NamespaceValidateOptions{Dirs: []string{good, bad}}, &out)
+	assert.EqualError(t, err, "1 of 2 namespaces have errors")
+	assert.Equal(t, "Namespace: my-ns is valid.\nNamespace: bad-ns error in 01-rbac.yaml: is missing\nNamespace: bad-ns has 1 error(s) and 0 warning(s).\n", out.String())
+
+	out.Reset()
+	err = validateNamespaces(NamespaceValidateOptions{Dirs: []string{good}, Output: "json"}, &out)
+	assert.NoError(t, err)
+	var report NamespaceValidateReport
+	assert.NoError(t, json.Unmarshal([]byte(out.String()), &report))
+	assert.Len(t, report.Namespaces, 1)
+	assert.True(t, report.Namespaces[0].Valid)
+	assert.Contains(t, out.String(), `"problems": []`)
+
+	err = validateNamespaces(NamespaceValidateOptions{Dirs: []string{good}, Output: "yaml"}, &out)
+	assert.EqualError(t, err, `unsupported output format "yaml", must be one of: text, json`)
+
+	err = validateNamespaces(NamespaceValidateOptions{Dirs: []string{filepath.Join(root, "missing")}}, &out)
+	assert.ErrorContains(t, err, "isn't a namespace folder")
+}
@@ -2,70 +2,167 @@ package environment
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
-)
 
-var (
-	defaultTagsPattern = regexp.MustCompile(`\s*default_tags\s*=?\s*{`)
-	tagsPattern        = regexp.MustCompile(`\s*tags\s*=\s*{`)
-	providerAwsPattern = regexp.MustCompile(`provider\s+"aws"\s*{`)
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type TagChecker struct {
 	searchTags []string
 	baseDir    string
+	// clusterDir restricts the namespaces to namespaces/<clusterDir>, when set.
+	clusterDir string
+}
+
+// NamespaceTagsOptions configures which namespaces NamespaceTagging checks, and whether it fixes them.
+type NamespaceTagsOptions struct {
+	// RepoPath is the local path to the cloud-platform-environments repository.
+	RepoPath   string
+	Namespaces []string
+	// ClusterDir is the folder under namespaces/ to look for the namespaces in.
+	ClusterDir string
+	// All checks every namespace with terraform in ClusterDir instead of Namespaces.
+	All bool
+	// Check reports the missing tags without changing any files.
+	Check bool
+	// Yes adds the missing tags without asking for confirmation first.
+	Yes bool
+	// FixMetadata also changes the variables the tags are set from to match 00-namespace.yaml.
+	// Without it, mismatched values are only reported.
+	FixMetadata bool
+	// Output is the format of the report, text or json.
+	Output string
+}
+
+// NamespaceTagsReport is the result of checking the default tags of a set of namespaces.
+type NamespaceTagsReport struct {
+	Namespaces []NamespaceTags `json:"namespaces"`
+}
+
+// NamespaceTags is the result of checking the default tags of every aws provider in a namespace.
+type NamespaceTags struct {
+	Namespace string `json:"namespace"`
+	// Dir is the namespace folder, relative to the repository.
+	Dir       string         `json:"dir,omitempty"`
+	Providers []ProviderTags `json:"providers"`
+	// Metadata lists the terraform variables the tags are set from whose values don't match
+	// the namespace's 00-namespace.yaml.
+	Metadata []MetadataMismatch `json:"metadata,omitempty"`
+	// Compliant is true when every provider has all the default tags, and their values match
+	// the namespace metadata, once the run has finished. So a fixed namespace is compliant.
+	Compliant bool `json:"compliant"`
+	// Fixed is true when missing tags were added to the namespace, or variables changed to
+	// match its metadata with FixMetadata.
+	Fixed bool `json:"fixed"`
+	// Error is set when the namespace couldn't be checked, e.g. it has no terraform files.
+	Error string `json:"error,omitempty"`
+}
+
+// ProviderTags is the result of checking the default tags of one aws provider in a namespace.
+type ProviderTags struct {
+	// File is the file declaring the provider, relative to the namespace folder.
+	File string `json:"file"`
+	// Provider is aws, or aws.<alias> for an aliased provider.
+	Provider string   `json:"provider"`
+	Missing  []string `json:"missing,omitempty"`
+	// Error is set when the tags can't be worked out from the configuration, e.g. tags = var.tags
+	Error string `json:"error,omitempty"`
+}
+
+// NamespaceTagging checks the aws providers of each namespace have the default tags, and that
+// the variables the tags are set from match the namespace's 00-namespace.yaml. It adds the
+// missing tags unless opt.Check is set, and corrects the variables if opt.FixMetadata is set. It
+// returns an error if any namespace isn't compliant afterwards, so check mode can be used in CI.
+func NamespaceTagging(opt NamespaceTagsOptions) error {
+	return namespaceTagging(opt, os.Stdin, os.Stdout)
 }
 
-func NamespaceTagging(opt Options) error {
+func namespaceTagging(opt NamespaceTagsOptions, in io.Reader, out io.Writer) error {
 	baseDir := filepath.Clean(opt.RepoPath)
-	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
-		log.Fatalf("The specified repository path does not exist: %s", baseDir)
+	if _, err := os.Stat(baseDir); err != nil {
+		return fmt.Errorf("the specified repository path does not exist: %s", baseDir)
 	}
 
-	tagChecker := newTagChecker(baseDir)
-
-	var namespacesToProcess []string
-	requestedNamespaces := strings.Split(strings.Join(opt.Namespaces, ","), ",")
-	for _, ns := range requestedNamespaces {
-		ns = strings.TrimSpace(ns)
-		if ns != "" {
-			for _, existingNs := range requestedNamespaces {
-				if existingNs == ns {
-					namespacesToProcess = append(namespacesToProcess, ns)
-					break
-				}
-			}
+	// --all without a cluster folder checks every cluster, with a checker for each so a
+	// namespace name used in more than one cluster is found in the right one
+	clusterDirs := []string{opt.ClusterDir}
+	if opt.All && opt.ClusterDir == "" {
+		var err error
+		clusterDirs, err = listClusterDirs(baseDir)
+		if err != nil {
+			return err
 		}
 	}
-	fmt.Printf("\nProcessing %d namespaces: %v\n", len(namespacesToProcess), namespacesToProcess)
 
+	type namespaceToCheck struct {
+		checker *TagChecker
+		name    string
+	}
+	var namespacesToProcess []namespaceToCheck
+	var names []string
+	for _, clusterDir := range clusterDirs {
+		tagChecker := newTagChecker(baseDir)
+		tagChecker.clusterDir = clusterDir
+
+		namespaces, err := tagChecker.namespacesToCheck(opt)
+		if err != nil {
+			return err
+		}
+		for _, ns := range namespaces {
+			namespacesToProcess = append(namespacesToProcess, namespaceToCheck{tagChecker, ns})
+			names = append(names, ns)
+		}
+	}
 	if len(namespacesToProcess) == 0 {
-		return fmt.Errorf("no namespaces found for environment: %s", namespacesToProcess)
+		return fmt.Errorf("no namespaces found to check")
 	}
 
-	fmt.Printf("\nDo you want to check and add missing tags for %s environment(s)? (y/N): ", namespacesToProcess)
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	response := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if !opt.Check && !opt.Yes {
+		fmt.Fprintf(out, "\nDo you want to check and add missing tags for %d namespace(s) %v? (y/N): ", len(names), names)
+		scanner := bufio.NewScanner(in)
+		scanner.Scan()
+		response := strings.ToLower(strings.TrimSpace(scanner.Text()))
 
-	if response != "y" && response != "yes" {
-		fmt.Printf("Exiting without making changes.")
-		return nil
+		if response != "y" && response != "yes" {
+			fmt.Fprintln(out, "Exiting without making changes.")
+			return nil
+		}
+	}
+
+	var report NamespaceTagsReport
+	for _, ns := range namespacesToProcess {
+		report.Namespaces = append(report.Namespaces, ns.checker.checkNamespace(ns.name, !opt.Check, opt.FixMetadata && !opt.Check))
 	}
 
-	fmt.Printf("\nChecking tags for %s namespaces...\n", namespacesToProcess)
+	if err := PrintNamespaceTagsReport(out, report, opt.Output); err != nil {
+		return err
+	}
 
-	for i, ns := range namespacesToProcess {
-		fmt.Printf("[%d/%d] Processing namespace: %s\n", i+1, len(namespacesToProcess), ns)
-		if err := tagChecker.checkAndAddTags(ns); err != nil {
-			fmt.Printf("Error processing namespace %s: %v\n", ns, err)
+	var failed int
+	for _, ns := range report.Namespaces {
+		if !ns.Compliant {
+			failed++
 		}
 	}
+	if failed > 0 && opt.Check {
+		return fmt.Errorf("%d of %d namespaces are missing default tags or have tag values which don't match their metadata", failed, len(report.Namespaces))
+	}
+	if failed > 0 && !opt.FixMetadata {
+		return fmt.Errorf("%d of %d namespaces are still missing default tags or have tag values which don't match their metadata, use --fix-metadata to correct the values", failed, len(report.Namespaces))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to fix the default tags of %d of %d namespaces", failed, len(report.Namespaces))
+	}
+
 	return nil
 }
 
@@ -76,94 +173,239 @@ func newTagChecker(baseDir string) *TagChecker {
 	}
 }
 
-func (tc *TagChecker) checkAndAddTags(namespace string) error {
-	// Find the terraform file path
-	tfFilePath, err := tc.findTerraformFile(namespace)
+// listClusterDirs returns the cluster folders under namespaces/ in the repository.
+func listClusterDirs(baseDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, "namespaces"))
 	if err != nil {
-		fmt.Printf("Terraform file not found for namespace: %s (%v)\n", namespace, err)
-		return nil // Don't treat this as a fatal error
+		return nil, fmt.Errorf("error reading namespaces folder: %w", err)
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(tfFilePath); os.IsNotExist(err) {
-		fmt.Printf("Terraform file not found for namespace: %s\n", namespace)
-		return nil
+	var clusterDirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			clusterDirs = append(clusterDirs, e.Name())
+		}
+	}
+	return clusterDirs, nil
+}
+
+// namespacesToCheck returns the requested namespaces without duplicates, or with opt.All every
+// namespace in the cluster folder with a resources folder.
+func (tc *TagChecker) namespacesToCheck(opt NamespaceTagsOptions) ([]string, error) {
+	var namespaces []string
+	if !opt.All {
+		for _, ns := range strings.Split(strings.Join(opt.Namespaces, ","), ",") {
+			ns = strings.TrimSpace(ns)
+			if ns != "" && !util.Contains(namespaces, ns) {
+				namespaces = append(namespaces, ns)
+			}
+		}
+		return namespaces, nil
+	}
+
+	if tc.clusterDir == "" {
+		return nil, fmt.Errorf("checking all namespaces needs the cluster folder to look in")
+	}
+
+	clusterPath := filepath.Join(tc.baseDir, "namespaces", tc.clusterDir)
+	entries, err := os.ReadDir(clusterPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster folder: %w", err)
 	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(clusterPath, e.Name(), "resources")); err == nil && info.IsDir() {
+			namespaces = append(namespaces, e.Name())
+		}
+	}
+
+	return namespaces, nil
+}
 
-	// Read the file
-	content, err := os.ReadFile(tfFilePath)
+// checkNamespace checks the default tags of every aws provider in the namespace, and the
+// variables in its resources folder against its metadata. If fix is set the missing tags are
+// written to its files, and if fixMetadata is set the corrected variables are too.
+func (tc *TagChecker) checkNamespace(namespace string, fix, fixMetadata bool) NamespaceTags {
+	result := NamespaceTags{Namespace: namespace, Providers: []ProviderTags{}}
+
+	nsDir, err := tc.findNamespaceDir(namespace)
 	if err != nil {
-		return fmt.Errorf("error reading file %s: %w", tfFilePath, err)
+		result.Error = err.Error()
+		return result
+	}
+	if rel, err := filepath.Rel(tc.baseDir, nsDir); err == nil {
+		result.Dir = filepath.ToSlash(rel)
 	}
 
-	// Check for missing tags
-	missingTags := tc.findMissingTags(string(content))
+	metadata, err := readNamespaceMetadata(nsDir)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
 
-	if len(missingTags) > 0 {
-		fmt.Printf("Namespace: %s is missing tags: %v\n", namespace, missingTags)
+	dirs, err := terraformDirs(nsDir)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
 
-		// Add missing tags
-		err = tc.addMissingTags(tfFilePath, string(content), missingTags)
+	for _, dir := range dirs {
+		files, err := loadTfFiles(dir)
 		if err != nil {
-			return fmt.Errorf("error adding tags to %s: %w", tfFilePath, err)
+			result.Error = err.Error()
+			return result
+		}
+
+		dirResults := tc.addMissingTags(files)
+		if metadata != nil && dir == filepath.Join(nsDir, "resources") {
+			for _, m := range checkMetadata(files, metadata, fixMetadata) {
+				if m.File != "" {
+					m.File = filepath.ToSlash(filepath.Join("resources", m.File))
+				}
+				result.Metadata = append(result.Metadata, m)
+			}
+		}
+		if fix || fixMetadata {
+			if err := files.writeChanged(); err != nil {
+				result.Error = err.Error()
+				return result
+			}
 		}
 
-		for _, tag := range missingTags {
-			fmt.Printf("Adding tag: %s to %s\n", tag, tfFilePath)
+		rel, err := filepath.Rel(nsDir, dir)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, r := range dirResults {
+			r.File = filepath.ToSlash(filepath.Join(rel, r.File))
+			result.Providers = append(result.Providers, r)
 		}
-	} else {
-		fmt.Printf("Namespace: %s has all default tags.\n", namespace)
 	}
 
-	return nil
+	result.Compliant = true
+	for _, p := range result.Providers {
+		switch {
+		case p.Error != "":
+			result.Compliant = false
+		case len(p.Missing) > 0 && fix:
+			result.Fixed = true
+		case len(p.Missing) > 0:
+			result.Compliant = false
+		}
+	}
+	for _, m := range result.Metadata {
+		switch {
+		case m.Error != "":
+			result.Compliant = false
+		case m.Fixed:
+			result.Fixed = true
+		default:
+			result.Compliant = false
+		}
+	}
+
+	return result
 }
 
-func (tc *TagChecker) findTerraformFile(namespace string) (string, error) {
-	// Try multiple glob patterns to find the terraform file
-	patterns := []string{
-		filepath.Join(tc.baseDir, "namespaces", "live.*", "*", namespace, "resources", "main.tf"),
-		filepath.Join(tc.baseDir, "namespaces", "live-2.*", "*", namespace, "resources", "main.tf"),
+// PrintNamespaceTagsReport writes the report to w either as text or as json.
+func PrintNamespaceTagsReport(w io.Writer, report NamespaceTagsReport, output string) error {
+	switch output {
+	case "json":
+		if report.Namespaces == nil {
+			report.Namespaces = []NamespaceTags{}
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "text", "":
+		for _, ns := range report.Namespaces {
+			printNamespaceTags(w, ns)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: text, json", output)
 	}
+}
 
-	for _, pattern := range patterns {
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			continue
+func printNamespaceTags(w io.Writer, ns NamespaceTags) {
+	if ns.Error != "" {
+		fmt.Fprintf(w, "Namespace: %s can't be checked: %s\n", ns.Namespace, ns.Error)
+		return
+	}
+	if len(ns.Providers) == 0 {
+		fmt.Fprintf(w, "Namespace: %s has no aws providers.\n", ns.Namespace)
+	}
+
+	complete := len(ns.Providers) > 0
+	for _, p := range ns.Providers {
+		switch {
+		case p.Error != "":
+			complete = false
+			fmt.Fprintf(w, "Namespace: %s provider %s in %s can't be checked: %s\n", ns.Namespace, p.Provider, p.File, p.Error)
+		case len(p.Missing) > 0 && ns.Fixed:
+			complete = false
+			fmt.Fprintf(w, "Namespace: %s provider %s in %s: added missing tags %v\n", ns.Namespace, p.Provider, p.File, p.Missing)
+		case len(p.Missing) > 0:
+			complete = false
+			fmt.Fprintf(w, "Namespace: %s provider %s in %s is missing tags: %v\n", ns.Namespace, p.Provider, p.File, p.Missing)
 		}
+	}
 
-		if len(matches) > 0 {
-			return matches[0], nil
+	for _, m := range ns.Metadata {
+		complete = false
+		switch {
+		case m.Error != "":
+			fmt.Fprintf(w, "Namespace: %s var.%s can't be checked against the %s in %s: %s\n", ns.Namespace, m.Variable, m.Metadata, NamespaceYamlFile, m.Error)
+		case m.Fixed:
+			fmt.Fprintf(w, "Namespace: %s var.%s in %s: changed %q to %q to match the %s in %s\n", ns.Namespace, m.Variable, m.File, m.Terraform, m.Namespace, m.Metadata, NamespaceYamlFile)
+		default:
+			fmt.Fprintf(w, "Namespace: %s var.%s is %q in %s but the %s in %s is %q\n", ns.Namespace, m.Variable, m.Terraform, m.File, m.Metadata, NamespaceYamlFile, m.Namespace)
 		}
 	}
 
-	// If not found, try a more comprehensive search
-	return tc.findTerraformFileRecursive(namespace)
+	if complete {
+		fmt.Fprintf(w, "Namespace: %s has all default tags.\n", ns.Namespace)
+	}
 }
 
-func (tc *TagChecker) findTerraformFileRecursive(namespace string) (string, error) {
-	var foundPath string
+// findNamespaceDir returns the folder of a namespace in the environments repository, which is
+// usually namespaces/<cluster>/<namespace>.
+func (tc *TagChecker) findNamespaceDir(namespace string) (string, error) {
+	if namespace == "" {
+		return "", fmt.Errorf("no terraform files found for an empty namespace")
+	}
 
 	namespacesDir := filepath.Join(tc.baseDir, "namespaces")
 
-	err := filepath.Walk(namespacesDir, func(path string, info os.FileInfo, err error) error {
+	if tc.clusterDir != "" {
+		nsDir := filepath.Join(namespacesDir, tc.clusterDir, namespace)
+		if info, err := os.Stat(filepath.Join(nsDir, "resources")); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("no terraform files found for namespace %s in %s", namespace, tc.clusterDir)
+		}
+		return nsDir, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(namespacesDir, "*", namespace, "resources"))
+	if err == nil && len(matches) > 0 {
+		return filepath.Dir(matches[0]), nil
+	}
+
+	// If not found, try a more comprehensive search
+	var foundDir string
+	err = filepath.Walk(namespacesDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Continue walking despite errors
 		}
 
-		// Check if this is the main.tf file we're looking for
-		if info.Name() == "main.tf" {
-			// Check if this path contains our namespace and resources directory
-			if strings.Contains(path, namespace) && strings.Contains(path, "resources") {
-				// Verify this is actually the right namespace directory structure
-				dir := filepath.Dir(path)
-				if filepath.Base(dir) == "resources" {
-					parentDir := filepath.Dir(dir)
-					if filepath.Base(parentDir) == namespace {
-						foundPath = path
-						return filepath.SkipDir // Found it, stop walking this branch
-					}
-				}
-			}
+		if info.IsDir() && info.Name() == "resources" && filepath.Base(filepath.Dir(path)) == namespace {
+			foundDir = filepath.Dir(path)
+			return filepath.SkipAll
 		}
 
 		return nil
@@ -172,170 +414,261 @@ func (tc *TagChecker) findTerraformFileRecursive(namespace string) (string, erro
 		return "", err
 	}
 
-	if foundPath == "" {
-		return "", fmt.Errorf("no terraform file found for namespace %s", namespace)
+	if foundDir == "" {
+		return "", fmt.Errorf("no terraform files found for namespace %s", namespace)
 	}
 
-	return foundPath, nil
+	return foundDir, nil
 }
 
-func (tc *TagChecker) findMissingTags(content string) []string {
-	var missingTags []string
+// terraformDirs returns every folder under dir containing .tf files, skipping the .terraform
+// folders terraform init downloads modules into.
+func terraformDirs(dir string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".tf" && !util.Contains(dirs, filepath.Dir(path)) {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+
+	return dirs, nil
+}
+
+// addMissingTags checks the default_tags of every aws provider in the files, and adds the
+// missing tags in memory. Providers whose tags can't be worked out are left alone.
+func (tc *TagChecker) addMissingTags(files *tfFiles) []ProviderTags {
+	var results []ProviderTags
+
+	names, providers := files.findBlocks("provider", "aws")
+	for i, provider := range providers {
+		result := ProviderTags{File: names[i], Provider: providerName(provider)}
 
-	// Extract default_tags blocks from providers
-	defaultTagsPattern := `(?s)default_tags\s*\{[^}]*tags\s*=\s*\{[^}]*\}`
-	defaultTagsRegex := regexp.MustCompile(defaultTagsPattern)
-	defaultTagsMatches := defaultTagsRegex.FindAllString(content, -1)
+		missing, err := tc.findMissingTags(files, provider)
+		if err == nil && len(missing) > 0 {
+			err = tc.addTags(provider, missing)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Missing = missing
+		}
 
-	// Also check for default_tags = { ... } format in providers
-	defaultTagsPatternAlt := `(?s)default_tags\s*=\s*\{[^}]*\}`
-	defaultTagsRegexAlt := regexp.MustCompile(defaultTagsPatternAlt)
-	defaultTagsMatchesAlt := defaultTagsRegexAlt.FindAllString(content, -1)
+		results = append(results, result)
+	}
 
-	// Extract default_tags from locals block (more common pattern)
-	localsDefaultTagsPattern := `(?s)locals\s*\{[^}]*default_tags\s*=\s*\{[^}]*\}`
-	localsDefaultTagsRegex := regexp.MustCompile(localsDefaultTagsPattern)
-	localsDefaultTagsMatches := localsDefaultTagsRegex.FindAllString(content, -1)
+	return results
+}
 
-	// Combine all matches
-	allDefaultTagsBlocks := append(defaultTagsMatches, defaultTagsMatchesAlt...)
-	allDefaultTagsBlocks = append(allDefaultTagsBlocks, localsDefaultTagsMatches...)
+// providerName returns aws, or aws.<alias> if the provider has an alias.
+func providerName(provider *hclwrite.Block) string {
+	alias := provider.Body().GetAttribute("alias")
+	if alias == nil {
+		return provider.Labels()[0]
+	}
+	return provider.Labels()[0] + "." + strings.Trim(strings.TrimSpace(string(alias.Expr().BuildTokens(nil).Bytes())), `"`)
+}
 
-	// If no default_tags blocks found, all tags are missing
-	if len(allDefaultTagsBlocks) == 0 {
-		return tc.searchTags
+// findMissingTags returns the tags missing from the default_tags of an aws provider.
+func (tc *TagChecker) findMissingTags(files *tfFiles, provider *hclwrite.Block) ([]string, error) {
+	defaultTags := provider.Body().FirstMatchingBlock("default_tags", nil)
+	if defaultTags == nil || defaultTags.Body().GetAttribute("tags") == nil {
+		return tc.searchTags, nil
 	}
 
-	// Combine all default_tags content
-	combinedTagsContent := strings.Join(allDefaultTagsBlocks, " ")
+	expr, err := parseAttributeExpr(defaultTags.Body().GetAttribute("tags"))
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tag := range tc.searchTags {
-		// Check for the tag in various formats within the combined tags content
-		patterns := []string{
-			fmt.Sprintf(`\b%s\s*=`, tag), // business-unit =
-			fmt.Sprintf(`"%s"\s*=`, tag), // "business-unit" =
-			fmt.Sprintf(`'%s'\s*=`, tag), // 'business-unit' =
-		}
-
-		found := false
-		for _, pattern := range patterns {
-			if matched, _ := regexp.MatchString(pattern, combinedTagsContent); matched {
-				found = true
-				break
-			}
-		}
+	keys, err := tagKeys(files, expr, 0)
+	if err != nil {
+		return nil, err
+	}
 
-		if !found {
+	var missingTags []string
+	for _, tag := range tc.searchTags {
+		if !util.Contains(keys, tag) {
 			missingTags = append(missingTags, tag)
 		}
 	}
 
-	return missingTags
+	return missingTags, nil
 }
 
-func (tc *TagChecker) addMissingTags(filePath, content string, missingTags []string) error {
-	lines := strings.Split(content, "\n")
-	var newLines []string
-
-	inProviderBlock := false
-	inDefaultTagsBlock := false
-	providerBraceCount := 0
-	defaultTagsBraceCount := 0
-	currentProviderHasDefaultTags := false
-	tagsAdded := false
-
-	for i, line := range lines {
-		// Check if we're entering an AWS provider block
-		if providerAwsPattern.MatchString(line) {
-			inProviderBlock = true
-			providerBraceCount = strings.Count(line, "{") - strings.Count(line, "}")
-			currentProviderHasDefaultTags = false
-			tagsAdded = false
-			newLines = append(newLines, line)
-			continue
-		}
+func parseAttributeExpr(attr *hclwrite.Attribute) (hclsyntax.Expression, error) {
+	src := attr.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("error parsing %s: %s", strings.TrimSpace(string(src)), diags)
+	}
+	return expr, nil
+}
 
-		// Track brace count in provider block
-		if inProviderBlock {
-			providerBraceCount += strings.Count(line, "{")
-			providerBraceCount -= strings.Count(line, "}")
+// tagKeys returns the keys of a tags expression. Object literals, local. references and
+// calls to merge() are followed, anything else can't be known without running terraform.
+func tagKeys(files *tfFiles, expr hclsyntax.Expression, depth int) ([]string, error) {
+	if depth > maxReferenceDepth {
+		return nil, fmt.Errorf("too many references followed resolving tags")
+	}
 
-			// Check if we're entering a default_tags block
-			if defaultTagsPattern.MatchString(line) && !inDefaultTagsBlock {
-				inDefaultTagsBlock = true
-				currentProviderHasDefaultTags = true
-				defaultTagsBraceCount = strings.Count(line, "{") - strings.Count(line, "}")
-				newLines = append(newLines, line)
-				continue
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		var keys []string
+		for _, item := range e.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || !key.Type().Equals(cty.String) {
+				return nil, fmt.Errorf("tag keys must be literal strings")
 			}
+			keys = append(keys, key.AsString())
+		}
+		return keys, nil
 
-			// Inside default_tags block
-			if inDefaultTagsBlock {
-				defaultTagsBraceCount += strings.Count(line, "{")
-				defaultTagsBraceCount -= strings.Count(line, "}")
-
-				// Check if we're in the tags section
-				if tagsPattern.MatchString(line) && !tagsAdded {
-					newLines = append(newLines, line)
-					// Add missing tags
-					for _, tag := range missingTags {
-						tagValue := tc.getTagValue(tag)
-						tagLine := fmt.Sprintf("      %s = %s", tag, tagValue)
-						newLines = append(newLines, tagLine)
-					}
-					tagsAdded = true
-					continue
-				}
-
-				newLines = append(newLines, line)
+	case *hclsyntax.ScopeTraversalExpr:
+		if e.Traversal.RootName() != "local" || len(e.Traversal) != 2 {
+			break
+		}
+		step, ok := e.Traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			break
+		}
 
-				// Check if we're exiting default_tags block
-				if defaultTagsBraceCount == 0 {
-					inDefaultTagsBlock = false
+		_, locals := files.findBlocks("locals")
+		for _, b := range locals {
+			if attr := b.Body().GetAttribute(step.Name); attr != nil {
+				local, err := parseAttributeExpr(attr)
+				if err != nil {
+					return nil, err
 				}
-				continue
+				return tagKeys(files, local, depth+1)
 			}
+		}
+		return nil, fmt.Errorf("local %q is not defined in %s", step.Name, files.dir)
 
-			// If we're closing the provider block and it didn't have default_tags, add it
-			if providerBraceCount == 1 && !currentProviderHasDefaultTags && !tagsAdded {
-				// Insert default_tags block before the closing brace
-				// Check if the next line is the closing brace
-				if i+1 < len(lines) && strings.TrimSpace(lines[i+1]) == "}" {
-					newLines = append(newLines, "  default_tags {")
-					newLines = append(newLines, "    tags = {")
-					for _, tag := range tc.searchTags {
-						tagValue := tc.getTagValue(tag)
-						tagLine := fmt.Sprintf("      %s = %s", tag, tagValue)
-						newLines = append(newLines, tagLine)
-					}
-					newLines = append(newLines, "    }")
-					newLines = append(newLines, "  }")
-					tagsAdded = true
-				}
+	case *hclsyntax.FunctionCallExpr:
+		if e.Name != "merge" {
+			break
+		}
+		var keys []string
+		for _, arg := range e.Args {
+			argKeys, err := tagKeys(files, arg, depth+1)
+			if err != nil {
+				return nil, err
 			}
+			keys = append(keys, argKeys...)
+		}
+		return keys, nil
+	}
 
-			newLines = append(newLines, line)
+	return nil, fmt.Errorf("tags are set from an expression that can't be checked, only object literals, local. references and merge() are supported")
+}
 
-			// Check if we're exiting provider block
-			if providerBraceCount == 0 {
-				inProviderBlock = false
-			}
-			continue
-		}
+// addTags adds the missing tags to the default_tags of the provider, creating the block if
+// there isn't one. Tags set from a local or merge() are merged with an object of the missing tags.
+func (tc *TagChecker) addTags(provider *hclwrite.Block, missingTags []string) error {
+	defaultTags := provider.Body().FirstMatchingBlock("default_tags", nil)
+	if defaultTags == nil {
+		defaultTags = provider.Body().AppendNewBlock("default_tags", nil)
+	}
 
-		// Not in any special block, just copy the line
-		newLines = append(newLines, line)
+	var newTags []hclwrite.ObjectAttrTokens
+	for _, tag := range missingTags {
+		newTags = append(newTags, hclwrite.ObjectAttrTokens{
+			Name:  hclwrite.TokensForIdentifier(tag),
+			Value: tc.tagValueTokens(tag),
+		})
 	}
 
-	newContent := strings.Join(newLines, "\n")
-	err := os.WriteFile(filePath, []byte(newContent), 0o644)
+	attr := defaultTags.Body().GetAttribute("tags")
+	if attr == nil {
+		defaultTags.Body().SetAttributeRaw("tags", hclwrite.TokensForObject(newTags))
+		return nil
+	}
+
+	expr, err := parseAttributeExpr(attr)
 	if err != nil {
-		return fmt.Errorf("error writing file: %w", err)
+		return err
+	}
+
+	existing := attr.Expr().BuildTokens(nil)
+	if _, ok := expr.(*hclsyntax.ObjectConsExpr); !ok {
+		defaultTags.Body().SetAttributeRaw("tags", hclwrite.TokensForFunctionCall("merge", existing, hclwrite.TokensForObject(newTags)))
+		return nil
+	}
+
+	// add the tags before the closing brace of the object, each on its own line so they're
+	// separated from the existing tags even if the object is on one line
+	newline := func(tokens hclwrite.Tokens) hclwrite.Tokens {
+		if tokens[len(tokens)-1].Type == hclsyntax.TokenNewline {
+			return tokens
+		}
+		return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte{'\n'}})
 	}
 
+	closing := existing[len(existing)-1]
+	tokens := append(hclwrite.Tokens{}, existing[:len(existing)-1]...)
+	if !strings.Contains(string(existing.Bytes()), "\n") {
+		tokens = splitObjectLines(tokens)
+	}
+	for _, tag := range newTags {
+		tokens = newline(tokens)
+		tokens = append(tokens, tag.Name...)
+		tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenEqual, Bytes: []byte{'='}})
+		tokens = append(tokens, tag.Value...)
+	}
+	tokens = append(newline(tokens), closing)
+
+	defaultTags.Body().SetAttributeRaw("tags", tokens)
 	return nil
 }
 
+// splitObjectLines puts each item of an object written on one line on its own line, by adding
+// a newline after the opening brace and the commas between the items.
+func splitObjectLines(tokens hclwrite.Tokens) hclwrite.Tokens {
+	var split hclwrite.Tokens
+	depth := 0
+	for _, t := range tokens {
+		split = append(split, t)
+		switch t.Type {
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack, hclsyntax.TokenOParen:
+			depth++
+			if depth > 1 {
+				continue
+			}
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen:
+			depth--
+			continue
+		case hclsyntax.TokenComma:
+			if depth > 1 {
+				continue
+			}
+		default:
+			continue
+		}
+		split = append(split, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte{'\n'}})
+	}
+	return split
+}
+
+// tagValueTokens returns the tokens of the variable a tag is set from, e.g. var.business_unit
+func (tc *TagChecker) tagValueTokens(tag string) hclwrite.Tokens {
+	parts := strings.Split(tc.getTagValue(tag), ".")
+	traversal := hcl.Traversal{hcl.TraverseRoot{Name: parts[0]}}
+	for _, p := range parts[1:] {
+		traversal = append(traversal, hcl.TraverseAttr{Name: p})
+	}
+	return hclwrite.TokensForTraversal(traversal)
+}
+
 func (tc *TagChecker) getTagValue(tag string) string {
 	switch tag {
 	case "business-unit":
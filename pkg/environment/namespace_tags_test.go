@@ -1,6 +1,8 @@
 package environment
 
 import (
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -71,7 +73,7 @@ func Test_newTagChecker(t *testing.T) {
 	}
 }
 
-func TestTagChecker_checkAndAddTags(t *testing.T) {
+func TestTagChecker_checkNamespace(t *testing.T) {
 	tests := []struct {
 		name      string
 		baseDir   string
@@ -82,192 +84,97 @@ func TestTagChecker_checkAndAddTags(t *testing.T) {
 			name:      "Non-existent namespace",
 			baseDir:   "/path/to/repo",
 			namespace: "nonexistent-namespace",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Existing namespace with all tags",
 			baseDir:   "/path/to/repo",
 			namespace: "existing-namespace-with-tags",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Existing namespace missing some tags",
 			baseDir:   "/path/to/repo",
 			namespace: "existing-namespace-missing-tags",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Invalid base directory",
 			baseDir:   "/invalid/path",
 			namespace: "some-namespace",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Empty namespace",
 			baseDir:   "/path/to/repo",
 			namespace: "",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Namespace with special characters",
 			baseDir:   "/path/to/repo",
 			namespace: "namespace-!@#$%^&*()",
-			wantErr:   false,
+			wantErr:   true,
 		},
 		{
 			name:      "Very long namespace",
 			baseDir:   "/path/to/repo",
 			namespace: "this-is-a-very-long-namespace-name-to-test-the-functionality-of-the-tag-checker-in-handling-long-strings",
-			wantErr:   false,
+			wantErr:   true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tc := newTagChecker(tt.baseDir)
-			gotErr := tc.checkAndAddTags(tt.namespace)
-			if gotErr != nil {
-				if !tt.wantErr {
-					t.Errorf("checkAndAddTags() failed: %v", gotErr)
-				}
-				return
+			got := tc.checkNamespace(tt.namespace, true, false)
+			if (got.Error != "") != tt.wantErr {
+				t.Errorf("checkNamespace() error = %q, wantErr %v", got.Error, tt.wantErr)
 			}
-			if tt.wantErr {
-				t.Fatal("checkAndAddTags() succeeded unexpectedly")
+			if got.Error != "" && got.Compliant {
+				t.Error("checkNamespace() namespace that couldn't be checked is compliant")
 			}
 		})
 	}
 }
 
-func TestTagChecker_findTerraformFile(t *testing.T) {
+func TestTagChecker_findNamespaceDir(t *testing.T) {
 	tests := []struct {
 		name       string
 		namespace  string
 		mockSetup  func() *mockFileSystem
-		wantPath   string
+		wantDir    string
 		wantErr    bool
 		wantErrMsg string
 	}{
 		{
-			name:      "Valid namespace with existing terraform file",
+			name:      "Valid namespace with standard structure",
 			namespace: "existing-namespace",
 			mockSetup: func() *mockFileSystem {
 				mfs := newMockFileSystem()
-				path := "/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace/resources/main.tf"
-				mfs.addFile(path, "# terraform config")
+				mfs.addFile("/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace/resources/main.tf", "# terraform config")
 				return mfs
 			},
-			wantPath: "/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace/resources/main.tf",
-			wantErr:  false,
+			wantDir: "/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace",
 		},
 		{
 			name:      "Namespace in live-2 cluster",
 			namespace: "test-namespace",
 			mockSetup: func() *mockFileSystem {
 				mfs := newMockFileSystem()
-				path := "/mock/repo/namespaces/live-2.cloud-platform.service.justice.gov.uk/test-namespace/resources/main.tf"
-				mfs.addFile(path, "# terraform config")
-				return mfs
-			},
-			wantPath: "/mock/repo/namespaces/live-2.cloud-platform.service.justice.gov.uk/test-namespace/resources/main.tf",
-			wantErr:  false,
-		},
-		{
-			name:      "Non-existent namespace",
-			namespace: "nonexistent-namespace",
-			mockSetup: func() *mockFileSystem {
-				return newMockFileSystem()
-			},
-			wantErr:    true,
-			wantErrMsg: "no terraform file found for namespace",
-		},
-		{
-			name:      "Empty namespace",
-			namespace: "",
-			mockSetup: func() *mockFileSystem {
-				return newMockFileSystem()
-			},
-			wantErr:    true,
-			wantErrMsg: "no terraform file found for namespace",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Create temp directory for actual file system test
-			tmpDir := t.TempDir()
-			mfs := tt.mockSetup()
-
-			// Create actual files based on mock
-			for path := range mfs.files {
-				// Replace /mock/repo with tmpDir
-				actualPath := strings.Replace(path, "/mock/repo", tmpDir, 1)
-				dir := filepath.Dir(actualPath)
-				if err := os.MkdirAll(dir, 0o755); err != nil {
-					t.Fatalf("Failed to create directory: %v", err)
-				}
-				if err := os.WriteFile(actualPath, []byte(mfs.files[path]), 0o644); err != nil {
-					t.Fatalf("Failed to write file: %v", err)
-				}
-			}
-
-			tc := newTagChecker(tmpDir)
-			got, gotErr := tc.findTerraformFile(tt.namespace)
-
-			if tt.wantErr {
-				if gotErr == nil {
-					t.Fatal("findTerraformFile() succeeded unexpectedly")
-				}
-				if tt.wantErrMsg != "" && !strings.Contains(gotErr.Error(), tt.wantErrMsg) {
-					t.Errorf("findTerraformFile() error = %v, want error containing %q", gotErr, tt.wantErrMsg)
-				}
-				return
-			}
-
-			if gotErr != nil {
-				t.Errorf("findTerraformFile() failed: %v", gotErr)
-				return
-			}
-
-			// Adjust expected path
-			expectedPath := strings.Replace(tt.wantPath, "/mock/repo", tmpDir, 1)
-			if got != expectedPath {
-				t.Errorf("findTerraformFile() = %v, want %v", got, expectedPath)
-			}
-		})
-	}
-}
-
-func TestTagChecker_findTerraformFileRecursive(t *testing.T) {
-	tests := []struct {
-		name       string
-		namespace  string
-		mockSetup  func() *mockFileSystem
-		wantPath   string
-		wantErr    bool
-		wantErrMsg string
-	}{
-		{
-			name:      "Valid namespace with standard structure",
-			namespace: "existing-namespace",
-			mockSetup: func() *mockFileSystem {
-				mfs := newMockFileSystem()
-				path := "/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace/resources/main.tf"
-				mfs.addFile(path, "# terraform config")
+				mfs.addFile("/mock/repo/namespaces/live-2.cloud-platform.service.justice.gov.uk/test-namespace/resources/main.tf", "# terraform config")
 				return mfs
 			},
-			wantPath: "/mock/repo/namespaces/live.cloud-platform.service.justice.gov.uk/existing-namespace/resources/main.tf",
-			wantErr:  false,
+			wantDir: "/mock/repo/namespaces/live-2.cloud-platform.service.justice.gov.uk/test-namespace",
 		},
 		{
 			name:      "Valid namespace with custom nested path",
 			namespace: "custom-namespace",
 			mockSetup: func() *mockFileSystem {
 				mfs := newMockFileSystem()
-				path := "/mock/repo/namespaces/custom/deep/path/custom-namespace/resources/main.tf"
-				mfs.addFile(path, "# custom terraform")
+				mfs.addFile("/mock/repo/namespaces/custom/deep/path/custom-namespace/resources/main.tf", "# custom terraform")
 				return mfs
 			},
-			wantPath: "/mock/repo/namespaces/custom/deep/path/custom-namespace/resources/main.tf",
-			wantErr:  false,
+			wantDir: "/mock/repo/namespaces/custom/deep/path/custom-namespace",
 		},
 		{
 			name:      "Multiple namespaces, finds correct one",
@@ -278,20 +185,18 @@ func TestTagChecker_findTerraformFileRecursive(t *testing.T) {
 				mfs.addFile("/mock/repo/namespaces/live/target-namespace/resources/main.tf", "# target")
 				return mfs
 			},
-			wantPath: "/mock/repo/namespaces/live/target-namespace/resources/main.tf",
-			wantErr:  false,
+			wantDir: "/mock/repo/namespaces/live/target-namespace",
 		},
 		{
 			name:      "Non-existent namespace",
 			namespace: "nonexistent-namespace",
 			mockSetup: func() *mockFileSystem {
 				mfs := newMockFileSystem()
-				// Add some other namespaces but not the target
 				mfs.addFile("/mock/repo/namespaces/live/other-namespace/resources/main.tf", "# other")
 				return mfs
 			},
 			wantErr:    true,
-			wantErrMsg: "no terraform file found for namespace",
+			wantErrMsg: "no terraform files found for namespace",
 		},
 		{
 			name:      "Empty namespace",
@@ -300,169 +205,203 @@ func TestTagChecker_findTerraformFileRecursive(t *testing.T) {
 				return newMockFileSystem()
 			},
 			wantErr:    true,
-			wantErrMsg: "no terraform file found for namespace",
+			wantErrMsg: "no terraform files found",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create temp directory for actual file system test
-			tmpDir := t.TempDir()
-			mfs := tt.mockSetup()
-
-			// Create actual files based on mock
-			for path := range mfs.files {
-				// Replace /mock/repo with tmpDir
-				actualPath := strings.Replace(path, "/mock/repo", tmpDir, 1)
-				dir := filepath.Dir(actualPath)
-				if err := os.MkdirAll(dir, 0o755); err != nil {
-					t.Fatalf("Failed to create directory: %v", err)
-				}
-				if err := os.WriteFile(actualPath, []byte(mfs.files[path]), 0o644); err != nil {
-					t.Fatalf("Failed to write file: %v", err)
-				}
-			}
+			tmpDir := writeMockFiles(t, tt.mockSetup())
 
 			tc := newTagChecker(tmpDir)
-			got, gotErr := tc.findTerraformFileRecursive(tt.namespace)
+			got, gotErr := tc.findNamespaceDir(tt.namespace)
 
 			if tt.wantErr {
 				if gotErr == nil {
-					t.Fatal("findTerraformFileRecursive() succeeded unexpectedly")
+					t.Fatal("findNamespaceDir() succeeded unexpectedly")
 				}
 				if tt.wantErrMsg != "" && !strings.Contains(gotErr.Error(), tt.wantErrMsg) {
-					t.Errorf("findTerraformFileRecursive() error = %v, want error containing %q", gotErr, tt.wantErrMsg)
+					t.Errorf("findNamespaceDir() error = %v, want error containing %q", gotErr, tt.wantErrMsg)
 				}
 				return
 			}
 
 			if gotErr != nil {
-				t.Errorf("findTerraformFileRecursive() failed: %v", gotErr)
+				t.Errorf("findNamespaceDir() failed: %v", gotErr)
 				return
 			}
 
-			// Adjust expected path
-			expectedPath := strings.Replace(tt.wantPath, "/mock/repo", tmpDir, 1)
-			if got != expectedPath {
-				t.Errorf("findTerraformFileRecursive() = %v, want %v", got, expectedPath)
+			expectedDir := strings.Replace(tt.wantDir, "/mock/repo", tmpDir, 1)
+			if got != expectedDir {
+				t.Errorf("findNamespaceDir() = %v, want %v", got, expectedDir)
 			}
 		})
 	}
 }
 
+// writeMockFiles creates the files of the mock file system in a temporary directory, which
+// replaces /mock/repo in their paths.
+func writeMockFiles(t *testing.T, mfs *mockFileSystem) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	for path, content := range mfs.files {
+		actualPath := strings.Replace(path, "/mock/repo", tmpDir, 1)
+		if err := os.MkdirAll(filepath.Dir(actualPath), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(actualPath, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return tmpDir
+}
+
+// loadTestTfFiles writes content to main.tf in a temporary directory and parses it.
+func loadTestTfFiles(t *testing.T, content string) *tfFiles {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	files, err := loadTfFiles(dir)
+	if err != nil {
+		t.Fatalf("loadTfFiles() failed: %v", err)
+	}
+	return files
+}
+
 func TestTagChecker_findMissingTags(t *testing.T) {
+	allTags := []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"}
 	tests := []struct {
 		name    string
 		content string
 		want    []string
+		wantErr string
 	}{
 		{
 			name: "All tags present in provider default_tags",
 			content: `provider "aws" {
-		region = "eu-west-2"
-		default_tags {
-			tags = {
-				business-unit  = var.business_unit
-				application    = var.application
-				is-production  = var.is_production
-				owner          = var.team_name
-				namespace      = var.namespace
-				service-area   = var.service_area
-			}
-		}
-	}`,
-			want: []string{},
+  region = "eu-west-2"
+  default_tags {
+    tags = {
+      business-unit = var.business_unit
+      application   = var.application
+      is-production = var.is_production
+      owner         = var.team_name
+      namespace     = var.namespace
+      service-area  = var.service_area
+    }
+  }
+}`,
+			want: nil,
 		},
 		{
-			name: "All tags present in locals block",
+			name: "All tags set from a local",
 			content: `locals {
-		default_tags = {
-			business-unit  = var.business_unit
-			application    = var.application
-			is-production  = var.is_production
-			owner          = var.team_name
-			namespace      = var.namespace
-			service-area   = var.service_area
-		}
-	}`,
-			want: []string{},
+  default_tags = {
+    business-unit = var.business_unit
+    application   = var.application
+    is-production = var.is_production
+    owner         = var.team_name
+    namespace     = var.namespace
+    service-area  = var.service_area
+  }
+}
+
+provider "aws" {
+  default_tags {
+    tags = local.default_tags
+  }
+}`,
+			want: nil,
+		},
+		{
+			name: "Tags merged from a local and an object",
+			content: `locals {
+  default_tags = {
+    business-unit = var.business_unit
+    application   = var.application
+  }
+}
+
+provider "aws" {
+  default_tags {
+    tags = merge(local.default_tags, { owner = var.team_name })
+  }
+}`,
+			want: []string{"is-production", "namespace", "service-area"},
 		},
 		{
 			name: "Some tags missing in default_tags",
 			content: `provider "aws" {
-		region = "eu-west-2"
-		default_tags {
-			tags = {
-				business-unit  = var.business_unit
-				owner          = var.team_name
-			}
-		}
-	}`,
+  region = "eu-west-2"
+  default_tags {
+    tags = {
+      business-unit = var.business_unit
+      owner         = var.team_name
+    }
+  }
+}`,
 			want: []string{"application", "is-production", "namespace", "service-area"},
 		},
 		{
 			name: "No default_tags block present",
 			content: `provider "aws" {
-		region = "eu-west-2"
-	}`,
-			want: []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"},
+  region = "eu-west-2"
+}`,
+			want: allTags,
 		},
 		{
-			name:    "Empty content",
-			content: ``,
-			want:    []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"},
+			name: "Mixed - some quoted, comments and braces in strings",
+			content: `provider "aws" {
+  # default_tags { tags = { owner = "x" } }
+  region = "}"
+  default_tags {
+    tags = {
+      "business-unit" = var.business_unit
+      application     = "{application}"
+    }
+  }
+}`,
+			want: []string{"is-production", "owner", "namespace", "service-area"},
 		},
 		{
-			name: "Tags with quoted keys",
+			name: "Tags from a variable can't be checked",
 			content: `provider "aws" {
-		default_tags {
-			tags = {
-				"business-unit"  = var.business_unit
-				"application"    = var.application
-				"is-production"  = var.is_production
-				"owner"          = var.team_name
-				"namespace"      = var.namespace
-				"service-area"   = var.service_area
-			}
-		}
-	}`,
-			want: []string{},
+  default_tags {
+    tags = var.tags
+  }
+}`,
+			wantErr: "can't be checked",
 		},
 		{
-			name: "Mixed - some quoted, some missing",
+			name: "Undefined local",
 			content: `provider "aws" {
-		default_tags {
-			tags = {
-				"business-unit"  = var.business_unit
-				application      = var.application
-			}
-		}
-	}`,
-			want: []string{"is-production", "owner", "namespace", "service-area"},
+  default_tags {
+    tags = local.missing
+  }
+}`,
+			wantErr: `local "missing" is not defined`,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			files := loadTestTfFiles(t, tt.content)
+			_, providers := files.findBlocks("provider", "aws")
+
 			tc := newTagChecker("/test")
-			got := tc.findMissingTags(tt.content)
+			got, gotErr := tc.findMissingTags(files, providers[0])
 
-			// Compare lengths first
-			if len(got) != len(tt.want) {
-				t.Errorf("findMissingTags() returned %d tags, want %d\nGot:  %v\nWant: %v", len(got), len(tt.want), got, tt.want)
+			if tt.wantErr != "" {
+				if gotErr == nil || !strings.Contains(gotErr.Error(), tt.wantErr) {
+					t.Errorf("findMissingTags() error = %v, want error containing %q", gotErr, tt.wantErr)
+				}
 				return
 			}
-
-			// Check each expected tag is in the result
-			for _, wantTag := range tt.want {
-				found := false
-				for _, gotTag := range got {
-					if gotTag == wantTag {
-						found = true
-						break
-					}
-				}
-				if !found {
-					t.Errorf("findMissingTags() missing expected tag %q\nGot:  %v\nWant: %v", wantTag, got, tt.want)
-				}
+			if gotErr != nil {
+				t.Fatalf("findMissingTags() failed: %v", gotErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findMissingTags() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -472,8 +411,8 @@ func TestTagChecker_addMissingTags(t *testing.T) {
 	tests := []struct {
 		name        string
 		content     string
-		missingTags []string
-		wantErr     bool
+		want        string
+		wantResults []ProviderTags
 	}{
 		{
 			name: "Add missing tags to existing default_tags block",
@@ -481,148 +420,230 @@ func TestTagChecker_addMissingTags(t *testing.T) {
   region = "eu-west-2"
   default_tags {
     tags = {
-      business-unit  = var.business_unit
-      owner          = var.team_name
+      business-unit = var.business_unit
+      application   = var.application
+      owner         = var.team_name
     }
   }
-}`,
-			missingTags: []string{"application", "is-production", "namespace"},
-			wantErr:     false,
-		},
-		{
-			name: "Create default_tags block when missing",
-			content: `provider "aws" {
+}
+`,
+			want: `provider "aws" {
   region = "eu-west-2"
-}`,
-			missingTags: []string{"business-unit", "application", "is-production", "owner", "namespace"},
-			wantErr:     false,
-		},
-		{
-			name: "No missing tags - should not modify file",
-			content: `provider "aws" {
   default_tags {
     tags = {
-      business-unit  = var.business_unit
-      application    = var.application
-      is-production  = var.is_production
-      owner          = var.team_name
-      namespace      = var.namespace
+      business-unit = var.business_unit
+      application   = var.application
+      owner         = var.team_name
+      is-production = var.is_production
+      namespace     = var.namespace
+      service-area  = var.service_area
     }
   }
-}`,
-			missingTags: []string{},
-			wantErr:     false,
+}
+`,
+			wantResults: []ProviderTags{{File: "main.tf", Provider: "aws", Missing: []string{"is-production", "namespace", "service-area"}}},
 		},
 		{
-			name: "Add single missing tag",
+			name: "Multiple AWS providers - add default_tags to the aliased one",
 			content: `provider "aws" {
+  region = "eu-west-2"
   default_tags {
     tags = {
-      business-unit  = var.business_unit
-      application    = var.application
-      is-production  = var.is_production
-      owner          = var.team_name
+      business-unit = var.business_unit
+      application   = var.application
+      is-production = var.is_production
+      owner         = var.team_name
+      namespace     = var.namespace
+      service-area  = var.service_area
     }
   }
-}`,
-			missingTags: []string{"namespace"},
-			wantErr:     false,
-		},
-		{
-			name: "Multiple AWS providers - add default_tags to all",
-			content: `provider "aws" {
-  region = "eu-west-2"
 }
 
+# the virginia provider is used for cloudfront
 provider "aws" {
   alias  = "virginia"
-  region = "us-east-1"
-}`,
-			missingTags: []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"},
-			wantErr:     false,
-		},
-		{
-			name: "Multiple providers - one has default_tags, one doesn't",
-			content: `provider "aws" {
+  region = "us-east-1" # {
+}
+`,
+			want: `provider "aws" {
   region = "eu-west-2"
   default_tags {
     tags = {
       business-unit = var.business_unit
-      application = var.application
+      application   = var.application
       is-production = var.is_production
-      owner = var.team_name
-      namespace = var.namespace
-      service-area = var.service_area
+      owner         = var.team_name
+      namespace     = var.namespace
+      service-area  = var.service_area
     }
   }
 }
 
+# the virginia provider is used for cloudfront
 provider "aws" {
   alias  = "virginia"
-  region = "us-east-1"
-}`,
-			missingTags: []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"},
-			wantErr:     false,
+  region = "us-east-1" # {
+  default_tags {
+    tags = {
+      business-unit = var.business_unit
+      application   = var.application
+      is-production = var.is_production
+      owner         = var.team_name
+      namespace     = var.namespace
+      service-area  = var.service_area
+    }
+  }
+}
+`,
+			wantResults: []ProviderTags{
+				{File: "main.tf", Provider: "aws"},
+				{File: "main.tf", Provider: "aws.virginia", Missing: []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"}},
+			},
+		},
+		{
+			name: "Add missing tags to an object on one line",
+			content: `provider "aws" {
+  default_tags {
+    tags = { business-unit = var.business_unit, application = var.application, is-production = var.is_production, owner = var.team_name, namespace = var.namespace }
+  }
+}
+`,
+			want: `provider "aws" {
+  default_tags {
+    tags = {
+      business-unit = var.business_unit,
+      application   = var.application,
+      is-production = var.is_production,
+      owner         = var.team_name,
+      namespace     = var.namespace
+      service-area  = var.service_area
+    }
+  }
+}
+`,
+			wantResults: []ProviderTags{{File: "main.tf", Provider: "aws", Missing: []string{"service-area"}}},
+		},
+		{
+			name: "Merge missing tags with tags set from a local",
+			content: `locals {
+  tags = {
+    business-unit = var.business_unit
+    application   = var.application
+    is-production = var.is_production
+    owner         = var.team_name
+  }
+}
+
+provider "aws" {
+  default_tags {
+    tags = local.tags
+  }
+}
+`,
+			want: `locals {
+  tags = {
+    business-unit = var.business_unit
+    application   = var.application
+    is-production = var.is_production
+    owner         = var.team_name
+  }
+}
+
+provider "aws" {
+  default_tags {
+    tags = merge(local.tags, {
+      namespace    = var.namespace
+      service-area = var.service_area
+    })
+  }
+}
+`,
+			wantResults: []ProviderTags{{File: "main.tf", Provider: "aws", Missing: []string{"namespace", "service-area"}}},
+		},
+		{
+			name: "Leave tags that can't be checked alone",
+			content: `provider "aws" {
+  default_tags {
+    tags = var.tags
+  }
+}
+`,
+			want: `provider "aws" {
+  default_tags {
+    tags = var.tags
+  }
+}
+`,
+		},
+		{
+			name:        "No AWS providers",
+			content:     "provider \"kubernetes\" {}\n",
+			want:        "provider \"kubernetes\" {}\n",
+			wantResults: nil,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create temp directory and file
-			tmpDir := t.TempDir()
-			filePath := filepath.Join(tmpDir, "main.tf")
-
-			// Create the file with initial content
-			dir := filepath.Dir(filePath)
-			if err := os.MkdirAll(dir, 0o755); err != nil {
-				t.Fatalf("Failed to create directory: %v", err)
-			}
-			if err := os.WriteFile(filePath, []byte(tt.content), 0o644); err != nil {
-				t.Fatalf("Failed to write initial file: %v", err)
-			}
-
-			tc := newTagChecker(tmpDir)
-			gotErr := tc.addMissingTags(filePath, tt.content, tt.missingTags)
-
-			if tt.wantErr {
-				if gotErr == nil {
-					t.Fatal("addMissingTags() succeeded unexpectedly")
-				}
-				return
-			}
+			files := loadTestTfFiles(t, tt.content)
 
-			if gotErr != nil {
-				t.Errorf("addMissingTags() failed: %v", gotErr)
-				return
+			tc := newTagChecker(files.dir)
+			results := tc.addMissingTags(files)
+			if err := files.writeChanged(); err != nil {
+				t.Fatalf("writeChanged() failed: %v", err)
 			}
 
-			// Verify file was written
-			modifiedContent, err := os.ReadFile(filePath)
+			modifiedContent, err := os.ReadFile(filepath.Join(files.dir, "main.tf"))
 			if err != nil {
 				t.Fatalf("Failed to read modified file: %v", err)
 			}
-
-			// Verify all missing tags were added
-			contentStr := string(modifiedContent)
-			for _, tag := range tt.missingTags {
-				if !strings.Contains(contentStr, tag) {
-					t.Errorf("addMissingTags() modified content missing tag %q\nContent:\n%s", tag, contentStr)
-				}
+			if string(modifiedContent) != tt.want {
+				t.Errorf("addMissingTags() content:\n%s\nwant:\n%s", modifiedContent, tt.want)
 			}
 
-			// For multiple provider tests, verify both providers got default_tags
-			if tt.name == "Multiple AWS providers - add default_tags to all" ||
-				tt.name == "Multiple providers - one has default_tags, one doesn't" {
-				// Count occurrences of default_tags
-				defaultTagsCount := strings.Count(contentStr, "default_tags")
-				expectedCount := 2
-				if defaultTagsCount != expectedCount {
-					t.Errorf("Expected %d default_tags blocks, got %d\nContent:\n%s", expectedCount, defaultTagsCount, contentStr)
+			if tt.name == "Leave tags that can't be checked alone" {
+				if len(results) != 1 || results[0].Error == "" {
+					t.Errorf("addMissingTags() = %+v, want an error for the provider", results)
 				}
+				return
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("addMissingTags() = %+v, want %+v", results, tt.wantResults)
 			}
 		})
 	}
 }
 
+func TestTagChecker_checkNamespaceAllFiles(t *testing.T) {
+	tmpDir := writeMockFiles(t, func() *mockFileSystem {
+		mfs := newMockFileSystem()
+		mfs.addFile("/mock/repo/namespaces/live/ns/resources/main.tf", "terraform {}\n")
+		mfs.addFile("/mock/repo/namespaces/live/ns/resources/providers.tf", "provider \"aws\" {\n  alias = \"london\"\n}\n")
+		mfs.addFile("/mock/repo/namespaces/live/ns/resources/unformatted.tf", "resource   \"x\" \"y\" {}\n")
+		mfs.addFile("/mock/repo/namespaces/live/ns/resources/.terraform/modules/m/main.tf", "provider \"aws\" {}\n")
+		return mfs
+	}())
+
+	tc := newTagChecker(tmpDir)
+	got := tc.checkNamespace("ns", true, false)
+	if !got.Compliant || !got.Fixed || got.Dir != "namespaces/live/ns" {
+		t.Errorf("checkNamespace() = %+v, want a fixed compliant namespace", got)
+	}
+
+	resources := filepath.Join(tmpDir, "namespaces/live/ns/resources")
+	providers, _ := os.ReadFile(filepath.Join(resources, "providers.tf"))
+	if !strings.Contains(string(providers), "default_tags {") {
+		t.Errorf("expected default_tags to be added to providers.tf:\n%s", providers)
+	}
+	unformatted, _ := os.ReadFile(filepath.Join(resources, "unformatted.tf"))
+	if string(unformatted) != "resource   \"x\" \"y\" {}\n" {
+		t.Errorf("expected unformatted.tf not to be rewritten:\n%s", unformatted)
+	}
+	downloaded, _ := os.ReadFile(filepath.Join(resources, ".terraform/modules/m/main.tf"))
+	if strings.Contains(string(downloaded), "default_tags") {
+		t.Errorf("expected .terraform to be skipped:\n%s", downloaded)
+	}
+}
+
 func TestTagChecker_getTagValue(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -677,3 +698,106 @@ func TestTagChecker_getTagValue(t *testing.T) {
 		})
 	}
 }
+
+func TestNamespaceTagging(t *testing.T) {
+	const untagged = "provider \"aws\" {\n  region = \"eu-west-2\"\n}\n"
+	newRepo := func(t *testing.T) string {
+		return writeMockFiles(t, func() *mockFileSystem {
+			mfs := newMockFileSystem()
+			mfs.addFile("/mock/repo/namespaces/live/untagged/resources/main.tf", untagged)
+			mfs.addFile("/mock/repo/namespaces/live/no-providers/resources/main.tf", "terraform {}\n")
+			mfs.addFile("/mock/repo/namespaces/live/no-terraform/00-namespace.yaml", "")
+			mfs.addFile("/mock/repo/namespaces/live-2/untagged/resources/main.tf", untagged)
+			return mfs
+		}())
+	}
+
+	t.Run("Check all namespaces in a cluster as json", func(t *testing.T) {
+		repo := newRepo(t)
+		var out strings.Builder
+		err := namespaceTagging(NamespaceTagsOptions{RepoPath: repo, ClusterDir: "live", All: true, Check: true, Output: "json"}, strings.NewReader(""), &out)
+		if err == nil || !strings.Contains(err.Error(), "1 of 2 namespaces are missing default tags") {
+			t.Errorf("namespaceTagging() error = %v", err)
+		}
+
+		var report NamespaceTagsReport
+		if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+			t.Fatalf("invalid json report: %v\n%s", err, out.String())
+		}
+		want := NamespaceTagsReport{Namespaces: []NamespaceTags{
+			{Namespace: "no-providers", Dir: "namespaces/live/no-providers", Providers: []ProviderTags{}, Compliant: true},
+			{Namespace: "untagged", Dir: "namespaces/live/untagged", Providers: []ProviderTags{
+				{File: "resources/main.tf", Provider: "aws", Missing: []string{"business-unit", "application", "is-production", "owner", "namespace", "service-area"}},
+			}},
+		}}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("namespaceTagging() report = %+v, want %+v", report, want)
+		}
+
+		content, _ := os.ReadFile(filepath.Join(repo, "namespaces/live/untagged/resources/main.tf"))
+		if string(content) != untagged {
+			t.Errorf("check mode changed the file:\n%s", content)
+		}
+	})
+
+	t.Run("Fix without asking", func(t *testing.T) {
+		repo := newRepo(t)
+		var out strings.Builder
+		err := namespaceTagging(NamespaceTagsOptions{RepoPath: repo, Namespaces: []string{"untagged", "untagged"}, ClusterDir: "live-2", Yes: true}, strings.NewReader(""), &out)
+		if err != nil {
+			t.Fatalf("namespaceTagging() failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "Namespace: untagged provider aws in resources/main.tf: added missing tags") {
+			t.Errorf("unexpected output:\n%s", out.String())
+		}
+
+		fixed, _ := os.ReadFile(filepath.Join(repo, "namespaces/live-2/untagged/resources/main.tf"))
+		if !strings.Contains(string(fixed), "default_tags") {
+			t.Errorf("expected default_tags to be added:\n%s", fixed)
+		}
+		other, _ := os.ReadFile(filepath.Join(repo, "namespaces/live/untagged/resources/main.tf"))
+		if string(other) != untagged {
+			t.Errorf("namespace in another cluster was changed:\n%s", other)
+		}
+	})
+
+	t.Run("Declining the prompt makes no changes", func(t *testing.T) {
+		repo := newRepo(t)
+		var out strings.Builder
+		err := namespaceTagging(NamespaceTagsOptions{RepoPath: repo, Namespaces: []string{"untagged"}, ClusterDir: "live"}, strings.NewReader("n\n"), &out)
+		if err != nil {
+			t.Fatalf("namespaceTagging() failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "Exiting without making changes.") {
+			t.Errorf("unexpected output:\n%s", out.String())
+		}
+	})
+
+	t.Run("Missing repository", func(t *testing.T) {
+		err := namespaceTagging(NamespaceTagsOptions{RepoPath: "/does/not/exist", Namespaces: []string{"ns"}, Check: true}, strings.NewReader(""), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("namespaceTagging() error = %v", err)
+		}
+	})
+
+	t.Run("All without a cluster folder checks every cluster", func(t *testing.T) {
+		var out strings.Builder
+		err := namespaceTagging(NamespaceTagsOptions{RepoPath: newRepo(t), All: true, Check: true, Output: "json"}, strings.NewReader(""), &out)
+		if err == nil || !strings.Contains(err.Error(), "2 of 3 namespaces") {
+			t.Errorf("namespaceTagging() error = %v", err)
+		}
+
+		var report NamespaceTagsReport
+		if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+			t.Fatalf("invalid json report: %v\n%s", err, out.String())
+		}
+		var dirs []string
+		for _, ns := range report.Namespaces {
+			dirs = append(dirs, ns.Dir)
+		}
+		want := []string{"namespaces/live/no-providers", "namespaces/live/untagged", "namespaces/live-2/untagged"}
+		if !reflect.DeepEqual(dirs, want) {
+			t.Errorf("namespaceTagging() checked %v, want %v", dirs, want)
+		}
+	})
+}
@@ -31,10 +31,14 @@ func TestNamespaceFromYamlFile(t *testing.T) {
 		t.Errorf("Expect foobar, got: %s", ns.BusinessUnit)
 	}
 
-	if ns.Owner != "Cloud Platform: david.salgado@digital.justice.gov.uk" {
+	if ns.Owner != "Cloud Platform" {
 		t.Errorf("Expect foobar, got: %s", ns.Owner)
 	}
 
+	if ns.InfrastructureSupport != "david.salgado@digital.justice.gov.uk" {
+		t.Errorf("Expect foobar, got: %s", ns.InfrastructureSupport)
+	}
+
 	if ns.OwnerEmail != "david.salgado@digital.justice.gov.uk" {
 		t.Errorf("Expect foobar, got: %s", ns.OwnerEmail)
 	}
@@ -1,13 +1,23 @@
 package environment
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type notEmptyValidator struct{}
 
 func (v *notEmptyValidator) isValid(s string) bool {
-	if s == "" {
+	if err := v.validate(s); err != nil {
 		fmt.Println("A value is required")
 		return false
 	}
 	return true
 }
+
+func (v *notEmptyValidator) validate(s string) error {
+	if s == "" {
+		return errors.New("a value is required")
+	}
+	return nil
+}
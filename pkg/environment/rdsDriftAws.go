@@ -0,0 +1,325 @@
+package environment
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/client"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
+)
+
+// rdsModuleSource is the repository of the terraform module used to create rds instances.
+const rdsModuleSource = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance"
+
+// rdsDescriber is the part of the RDS api used to find the running engine versions,
+// so it can be replaced with a fake in tests.
+type rdsDescriber interface {
+	DescribeDBInstancesPages(*rds.DescribeDBInstancesInput, func(*rds.DescribeDBInstancesOutput, bool) bool) error
+	DescribeDBClustersPages(*rds.DescribeDBClustersInput, func(*rds.DescribeDBClustersOutput, bool) bool) error
+}
+
+// rdsModule is an rds-instance module declared in a namespace, with the values used
+// to match it to a database in AWS.
+type rdsModule struct {
+	Namespace string
+	Name      string
+	File      string
+	Engine    string
+	DBName    string
+	Version   string
+}
+
+// rdsDrift is an rds module whose configured engine version is behind the version AWS is running.
+type rdsDrift struct {
+	Module        rdsModule
+	Identifier    string
+	ActualVersion string
+}
+
+// RdsDriftCheckerFromAws finds every rds-instance module in the live cluster folder of the
+// environments repository, compares its db_engine_version with the version the database is
+// running in AWS, and raises a PR per namespace to correct any drift before the apply fails.
+func RdsDriftCheckerFromAws(opt RdsDriftCheckerOptions) error {
+	modules, err := findRdsModules(liveBaseDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %d rds modules in %s\n", len(modules), liveBaseDir)
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultAwsRegion
+	}
+	creds, err := client.NewAwsCreds(region)
+	if err != nil {
+		return fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	drifts, unmatched, err := detectRdsDrift(modules, rds.New(creds.Session))
+	if err != nil {
+		return err
+	}
+
+	ghClient := github.NewGithubClient(&github.GithubClientConfig{
+		Repository: "cloud-platform-environments",
+		Owner:      "ministryofjustice",
+	}, os.Getenv("TF_VAR_github_token"))
+
+	fixes := rdsFixesByNamespace(drifts)
+	successes := make(map[string]string)
+	failures := make(map[string]string)
+	criticalFailureCount := 0
+	for _, ns := range sortedKeys(fixes) {
+		log.Printf("Processing namespace: %s", ns)
+		prURL, err := fixVersionDrift(ns, fixes[ns], ghClient, opt)
+		if err != nil {
+			log.Printf("Failed to process namespace %s: %v\n\n", ns, err)
+			failures[ns] = err.Error()
+			if isCriticalDriftFailure(err) {
+				criticalFailureCount++
+			}
+			continue
+		}
+		successes[ns] = prURL
+	}
+
+	log.Println("\n\n==================== SUMMARY ====================")
+	fmt.Printf("RDS modules checked: %d\n", len(modules))
+	fmt.Printf("RDS modules with version drift: %d\n", len(drifts))
+	for _, d := range drifts {
+		fmt.Printf("  - %s module.%s (%s): terraform %s, aws %s\n", d.Module.Namespace, d.Module.Name, d.Identifier, d.Module.Version, d.ActualVersion)
+	}
+	if len(unmatched) > 0 {
+		fmt.Printf("\nRDS modules that couldn't be matched to a database (%d):\n", len(unmatched))
+		for _, u := range unmatched {
+			fmt.Printf("  - %s\n", u)
+		}
+	}
+	if len(successes) > 0 {
+		fmt.Printf("\n%s (%d):\n", opt.resultHeading(), len(successes))
+		for ns, url := range successes {
+			fmt.Printf("  - %s: %s\n", ns, url)
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Printf("\nFailed to process namespaces (%d):\n", len(failures))
+		for ns, reason := range failures {
+			fmt.Printf("  - %s: %s\n", ns, reason)
+		}
+	}
+
+	if criticalFailureCount > 0 {
+		return fmt.Errorf("failed to create PR for %d namespaces", criticalFailureCount)
+	}
+
+	return nil
+}
+
+// findRdsModules returns the rds-instance modules declared in the resources folder of every
+// namespace under clusterDir. Modules whose version can't be resolved are logged and skipped.
+func findRdsModules(clusterDir string) ([]rdsModule, error) {
+	nsDirs, err := os.ReadDir(clusterDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces in %s: %w", clusterDir, err)
+	}
+
+	var modules []rdsModule
+	for _, nsDir := range nsDirs {
+		tfDir := filepath.Join(clusterDir, nsDir.Name(), "resources")
+		if !nsDir.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(tfDir); err != nil {
+			continue
+		}
+
+		files, err := loadTfFiles(tfDir)
+		if err != nil {
+			log.Printf("Skipping namespace %s: %v", nsDir.Name(), err)
+			continue
+		}
+
+		names, blocks := files.findBlocks("module")
+		for i, b := range blocks {
+			source, _ := files.resolveAttribute(names[i], "source", b.Body(), "source", 0)
+			if source == nil || moduleRepository(source.value) != rdsModuleSource {
+				continue
+			}
+
+			m := rdsModule{Namespace: nsDir.Name(), Name: b.Labels()[0], File: names[i]}
+			version, err := files.resolveAttribute(names[i], "module."+m.Name+".db_engine_version", b.Body(), "db_engine_version", 0)
+			if err != nil {
+				log.Printf("Skipping module %s in namespace %s: %v", m.Name, m.Namespace, err)
+				continue
+			}
+			m.Version = version.value
+
+			// the engine and database name are optional, they are only used to tell several databases apart
+			if engine, err := files.resolveAttribute(names[i], "db_engine", b.Body(), "db_engine", 0); err == nil {
+				m.Engine = engine.value
+			}
+			if dbName, err := files.resolveAttribute(names[i], "db_name", b.Body(), "db_name", 0); err == nil {
+				m.DBName = dbName.value
+			}
+
+			modules = append(modules, m)
+		}
+	}
+
+	return modules, nil
+}
+
+// moduleRepository strips the scheme, subdirectory and ref from a module source,
+// e.g. git::https://github.com/org/repo//sub?ref=1.0 becomes github.com/org/repo
+func moduleRepository(source string) string {
+	s := strings.TrimPrefix(source, "git::")
+	s = strings.TrimPrefix(s, "https://")
+	s = strings.TrimPrefix(s, "git@")
+	s = strings.Replace(s, "github.com:", "github.com/", 1)
+	s, _, _ = strings.Cut(s, "?")
+	if i := strings.Index(s, "//"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(s, ".git")
+}
+
+// detectRdsDrift matches each module to a database in AWS by its namespace tag, narrowing down by
+// engine and database name when a namespace has more than one database, and returns the modules
+// configured with an older version than the one running. Modules that can't be matched to exactly
+// one database are returned as descriptions so they can be reported.
+func detectRdsDrift(modules []rdsModule, api rdsDescriber) ([]rdsDrift, []string, error) {
+	clusterVersions := make(map[string]string)
+	err := api.DescribeDBClustersPages(&rds.DescribeDBClustersInput{}, func(out *rds.DescribeDBClustersOutput, last bool) bool {
+		for _, c := range out.DBClusters {
+			clusterVersions[aws.StringValue(c.DBClusterIdentifier)] = aws.StringValue(c.EngineVersion)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe db clusters: %w", err)
+	}
+
+	byNamespace := make(map[string][]*rds.DBInstance)
+	err = api.DescribeDBInstancesPages(&rds.DescribeDBInstancesInput{}, func(out *rds.DescribeDBInstancesOutput, last bool) bool {
+		for _, db := range out.DBInstances {
+			for _, tag := range db.TagList {
+				if aws.StringValue(tag.Key) == "namespace" {
+					ns := aws.StringValue(tag.Value)
+					byNamespace[ns] = append(byNamespace[ns], db)
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe db instances: %w", err)
+	}
+
+	var drifts []rdsDrift
+	var unmatched []string
+	for _, m := range modules {
+		candidates := matchRdsInstances(m, byNamespace[m.Namespace])
+		if len(candidates) != 1 {
+			unmatched = append(unmatched, fmt.Sprintf("%s module.%s: %d matching databases", m.Namespace, m.Name, len(candidates)))
+			continue
+		}
+
+		db := candidates[0]
+		actual := aws.StringValue(db.EngineVersion)
+		if v, ok := clusterVersions[aws.StringValue(db.DBClusterIdentifier)]; ok {
+			actual = v
+		}
+
+		if isBehind(m.Version, actual) {
+			drifts = append(drifts, rdsDrift{Module: m, Identifier: aws.StringValue(db.DBInstanceIdentifier), ActualVersion: actual})
+		}
+	}
+
+	return drifts, unmatched, nil
+}
+
+func matchRdsInstances(m rdsModule, dbs []*rds.DBInstance) []*rds.DBInstance {
+	candidates := dbs
+	if len(candidates) > 1 && m.Engine != "" {
+		candidates = filterRdsInstances(candidates, func(db *rds.DBInstance) bool {
+			return aws.StringValue(db.Engine) == m.Engine
+		})
+	}
+	if len(candidates) > 1 && m.DBName != "" {
+		candidates = filterRdsInstances(candidates, func(db *rds.DBInstance) bool {
+			return aws.StringValue(db.DBName) == m.DBName
+		})
+	}
+	return candidates
+}
+
+func filterRdsInstances(dbs []*rds.DBInstance, keep func(*rds.DBInstance) bool) []*rds.DBInstance {
+	var out []*rds.DBInstance
+	for _, db := range dbs {
+		if keep(db) {
+			out = append(out, db)
+		}
+	}
+	return out
+}
+
+// isBehind reports whether the configured version is older than the actual one. A configured
+// version that is a prefix of the actual one, e.g. 14 for 14.7, lets AWS pick the minor version
+// so it isn't treated as drift.
+func isBehind(configured, actual string) bool {
+	c, a := versionSegments(configured), versionSegments(actual)
+	for i := range c {
+		if i >= len(a) {
+			return false
+		}
+		if c[i] != a[i] {
+			return c[i] < a[i]
+		}
+	}
+	return false
+}
+
+// versionSegments splits a version into its numeric parts,
+// e.g. 19.0.0.0.ru-2024-10.rur-2024-10.r1 becomes [19 0 0 0 2024 10 2024 10 1]
+func versionSegments(version string) []int64 {
+	parts := strings.FieldsFunc(version, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+
+	segments := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		n, _ := strconv.ParseInt(p, 10, 64)
+		segments = append(segments, n)
+	}
+	return segments
+}
+
+func rdsFixesByNamespace(drifts []rdsDrift) map[string][]versionFix {
+	fixes := make(map[string][]versionFix)
+	for _, d := range drifts {
+		fixes[d.Module.Namespace] = append(fixes[d.Module.Namespace], versionFix{
+			ResourceType:     "aws_db_instance",
+			ModuleName:       d.Module.Name,
+			ActualVersion:    d.ActualVersion,
+			TerraformVersion: d.Module.Version,
+		})
+	}
+	return fixes
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,148 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRds struct {
+	instances []*rds.DBInstance
+	clusters  []*rds.DBCluster
+}
+
+func (f *fakeRds) DescribeDBInstancesPages(in *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool) error {
+	fn(&rds.DescribeDBInstancesOutput{DBInstances: f.instances}, true)
+	return nil
+}
+
+func (f *fakeRds) DescribeDBClustersPages(in *rds.DescribeDBClustersInput, fn func(*rds.DescribeDBClustersOutput, bool) bool) error {
+	fn(&rds.DescribeDBClustersOutput{DBClusters: f.clusters}, true)
+	return nil
+}
+
+func dbInstance(id, namespace, engine, dbName, version string) *rds.DBInstance {
+	return &rds.DBInstance{
+		DBInstanceIdentifier: aws.String(id),
+		Engine:               aws.String(engine),
+		DBName:               aws.String(dbName),
+		EngineVersion:        aws.String(version),
+		TagList:              []*rds.Tag{{Key: aws.String("namespace"), Value: aws.String(namespace)}},
+	}
+}
+
+func TestFindRdsModules(t *testing.T) {
+	clusterDir := t.TempDir()
+	files := map[string]string{
+		"foo/resources/rds.tf": `module "rds" {
+  source            = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+  db_engine         = "postgres"
+  db_engine_version = var.db_version
+}
+
+module "aurora" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-aurora?ref=1.0.0"
+}
+`,
+		"foo/resources/variables.tf": "variable \"db_version\" {\n  default = \"14.7\"\n}\n",
+		"bar/resources/main.tf": `module "db" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+}
+`,
+		"baz/00-namespace.yaml": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(clusterDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	modules, err := findRdsModules(clusterDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []rdsModule{
+		{Namespace: "foo", Name: "rds", File: "rds.tf", Engine: "postgres", Version: "14.7"},
+	}, modules)
+}
+
+func TestDetectRdsDrift(t *testing.T) {
+	modules := []rdsModule{
+		{Namespace: "single", Name: "rds", Version: "14.7"},
+		{Namespace: "upgrade-pending", Name: "rds", Version: "15.2"},
+		{Namespace: "major-only", Name: "rds", Version: "14"},
+		{Namespace: "two-dbs", Name: "pg", Engine: "postgres", Version: "16.1"},
+		{Namespace: "two-dbs", Name: "mysql", Engine: "mysql", Version: "8.0.35"},
+		{Namespace: "aurora", Name: "rds", Version: "13.9"},
+		{Namespace: "ambiguous", Name: "rds", Version: "14.7"},
+		{Namespace: "missing", Name: "rds", Version: "14.7"},
+	}
+
+	aurora := dbInstance("aurora-1", "aurora", "aurora-postgresql", "", "13.9")
+	aurora.DBClusterIdentifier = aws.String("aurora-cluster")
+
+	api := &fakeRds{
+		instances: []*rds.DBInstance{
+			dbInstance("single-db", "single", "postgres", "", "14.13"),
+			dbInstance("pending-db", "upgrade-pending", "postgres", "", "15.1"),
+			dbInstance("major-db", "major-only", "postgres", "", "14.13"),
+			dbInstance("two-pg", "two-dbs", "postgres", "", "16.1"),
+			dbInstance("two-mysql", "two-dbs", "mysql", "", "8.0.36"),
+			aurora,
+			dbInstance("ambiguous-1", "ambiguous", "postgres", "", "14.7"),
+			dbInstance("ambiguous-2", "ambiguous", "postgres", "", "14.7"),
+		},
+		clusters: []*rds.DBCluster{
+			{DBClusterIdentifier: aws.String("aurora-cluster"), EngineVersion: aws.String("13.12")},
+		},
+	}
+
+	drifts, unmatched, err := detectRdsDrift(modules, api)
+	assert.NoError(t, err)
+	assert.Equal(t, []rdsDrift{
+		{Module: modules[0], Identifier: "single-db", ActualVersion: "14.13"},
+		{Module: modules[4], Identifier: "two-mysql", ActualVersion: "8.0.36"},
+		{Module: modules[5], Identifier: "aurora-1", ActualVersion: "13.12"},
+	}, drifts)
+	assert.Equal(t, []string{
+		"ambiguous module.rds: 2 matching databases",
+		"missing module.rds: 0 matching databases",
+	}, unmatched)
+
+	assert.Equal(t, map[string][]versionFix{
+		"single":  {{ResourceType: "aws_db_instance", ModuleName: "rds", ActualVersion: "14.13", TerraformVersion: "14.7"}},
+		"two-dbs": {{ResourceType: "aws_db_instance", ModuleName: "mysql", ActualVersion: "8.0.36", TerraformVersion: "8.0.35"}},
+		"aurora":  {{ResourceType: "aws_db_instance", ModuleName: "rds", ActualVersion: "13.12", TerraformVersion: "13.9"}},
+	}, rdsFixesByNamespace(drifts))
+}
+
+func TestIsBehind(t *testing.T) {
+	tests := []struct {
+		configured, actual string
+		want               bool
+	}{
+		{"14.7", "14.13", true},
+		{"14.13", "14.7", false},
+		{"14.7", "14.7", false},
+		{"14", "14.7", false},
+		{"9.6", "10.1", true},
+		{"19.0.0.0.ru-2024-10.rur-2024-10.r1", "19.0.0.0.ru-2025-01.rur-2025-01.r1", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isBehind(tt.configured, tt.actual), "%s -> %s", tt.configured, tt.actual)
+	}
+}
+
+func TestModuleRepository(t *testing.T) {
+	tests := map[string]string{
+		"github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0":                "github.com/ministryofjustice/cloud-platform-terraform-rds-instance",
+		"git::https://github.com/ministryofjustice/cloud-platform-terraform-rds-instance.git?ref=1.0": "github.com/ministryofjustice/cloud-platform-terraform-rds-instance",
+		"git@github.com:ministryofjustice/cloud-platform-terraform-rds-instance//sub?ref=1.0":         "github.com/ministryofjustice/cloud-platform-terraform-rds-instance",
+		"github.com/ministryofjustice/cloud-platform-terraform-rds-instance-aurora":                   "github.com/ministryofjustice/cloud-platform-terraform-rds-instance-aurora",
+	}
+	for source, want := range tests {
+		assert.Equal(t, want, moduleRepository(source), source)
+	}
+}
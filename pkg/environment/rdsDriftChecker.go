@@ -2,50 +2,52 @@ package environment
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
-	"github.com/spf13/cobra"
 )
 
-func RdsDriftChecker(cmd *cobra.Command, args []string) error {
-	sourceLocation := args[0]
-	localCSV := "merged-rds-errored-namespaces.csv"
-
-	if strings.HasPrefix(sourceLocation, "file://") {
-		localFilePath := strings.TrimPrefix(sourceLocation, "file://")
-		fmt.Printf("Using local CSV file: %s\n", localFilePath)
+// RdsDriftCheckerOptions configures what the rds drift checker does with the drift it finds.
+type RdsDriftCheckerOptions struct {
+	// DryRun prints the planned version changes without changing any files.
+	DryRun bool
+	// PatchDir is a directory to write a unified diff per namespace to, instead of
+	// changing the repository and raising PRs.
+	PatchDir string
+}
 
-		data, err := os.ReadFile(localFilePath)
-		if err != nil {
-			return fmt.Errorf("error reading local CSV: %v", err)
-		}
-		if err := os.WriteFile(localCSV, data, 0o644); err != nil {
-			return fmt.Errorf("error copying local CSV: %v", err)
-		}
-	} else {
-		fmt.Printf("Downloading CSV from S3: %s\n", sourceLocation)
-		if err := downloadFromS3(sourceLocation, localCSV); err != nil {
-			return fmt.Errorf("error downloading CSV: %v", err)
-		}
+// resultHeading describes the result of processing a namespace in the summary.
+func (o RdsDriftCheckerOptions) resultHeading() string {
+	switch {
+	case o.DryRun:
+		return "Namespaces with planned changes"
+	case o.PatchDir != "":
+		return "Patches written"
+	default:
+		return "Successfully created PRs"
 	}
+}
 
-	file, err := os.Open(localCSV)
+// RdsDriftChecker reads a CSV of namespaces and the terraform errors from their failed applies
+// from sourceLocation, and corrects the rds version drift causing them.
+func RdsDriftChecker(opt RdsDriftCheckerOptions, sourceLocation string) error {
+	input, err := openDriftCheckerInput(sourceLocation, os.Stdin, newS3Client)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer input.Close()
 
-	reader := csv.NewReader(file)
+	reader := csv.NewReader(input)
 	reader.TrimLeadingSpace = true
 
 	records, err := reader.ReadAll()
 	if err != nil {
-		return err
+		return fmt.Errorf("error parsing CSV: %w", err)
 	}
 
 	nsMap := make(map[string][]string)
@@ -67,12 +69,15 @@ func RdsDriftChecker(cmd *cobra.Command, args []string) error {
 	successes := make(map[string]string)
 	failures := make(map[string]string)
 
+	criticalFailureCount := 0
 	for namespace, errorsList := range nsMap {
-		combinedErrorMsg := strings.Join(errorsList, "\n")
-		prURL, err := processRecord(namespace, combinedErrorMsg, ghClient)
+		prURL, err := processRecord(namespace, errorsList, ghClient, opt)
 		if err != nil {
 			log.Printf("Failed to process namespace %s: %v\n\n", namespace, err)
 			failures[namespace] = err.Error()
+			if isCriticalDriftFailure(err) {
+				criticalFailureCount++
+			}
 			continue
 		}
 		successes[namespace] = prURL
@@ -99,7 +104,7 @@ func RdsDriftChecker(cmd *cobra.Command, args []string) error {
 		}
 	}
 	if len(successes) > 0 {
-		fmt.Printf("\nSuccessfully created PRs (%d):\n", len(successes))
+		fmt.Printf("\n%s (%d):\n", opt.resultHeading(), len(successes))
 		for ns, url := range successes {
 			fmt.Printf("  - %s: %s\n", ns, url)
 		}
@@ -111,14 +116,6 @@ func RdsDriftChecker(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	criticalFailureCount := 0
-	for _, reason := range failures {
-		if !strings.Contains(reason, "terraform is failing but it doesn't look like a rds version mismatch") &&
-			!strings.Contains(reason, "a PR is already open for this namespace") {
-			criticalFailureCount++
-		}
-	}
-
 	if criticalFailureCount > 0 {
 		return fmt.Errorf("failed to create PR for %d namespaces", criticalFailureCount)
 	}
@@ -126,58 +123,102 @@ func RdsDriftChecker(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func downloadFromS3(s3Location, localPath string) error {
-	cmd := exec.Command("aws", "s3", "cp", s3Location, localPath)
-	return cmd.Run()
-}
-
-func processRecord(namespace, csvErr string, ghClient github.GithubIface) (string, error) {
+// processRecord works out the version fixes for the apply errors of a namespace and makes them.
+func processRecord(namespace string, applyErrs []string, ghClient github.GithubIface, opt RdsDriftCheckerOptions) (string, error) {
 	log.Printf("Processing namespace: %s", namespace)
 
-	results, err := IsRdsVersionMismatched(csvErr)
+	fixes, err := parseApplyErrors(applyErrs)
 	if err != nil {
-		return "", fmt.Errorf("parsing terraform error failed: %v", err)
+		return "", fmt.Errorf("parsing terraform error failed: %w", err)
 	}
 
-	tfDir := "namespaces/live.cloud-platform.service.justice.gov.uk/" + namespace + "/resources"
+	return fixVersionDrift(namespace, fixes, ghClient, opt)
+}
+
+// fixVersionDrift updates the terraform of a namespace so the modules match the versions
+// running in AWS, using the remediator registered for each resource type, raises a PR with the
+// changes and posts it to #ask-cloud-platform. With DryRun or PatchDir set, the changes are only
+// printed or written as a patch.
+func fixVersionDrift(namespace string, fixes []versionFix, ghClient github.GithubIface, opt RdsDriftCheckerOptions) (string, error) {
+	tfDir := liveBaseDir + "/" + namespace + "/resources"
+
+	files, err := loadTfFiles(tfDir)
+	if err != nil {
+		return "", fmt.Errorf("error reading Terraform: %v", err)
+	}
 
-	var filesChanged []string
-	versionDescription := fmt.Sprintf("- Fix Terraform RDS version drift for namespace: `%s`\n\n```", namespace)
+	versionDescription := fmt.Sprintf("- Fix Terraform version drift for namespace: `%s`\n\n```", namespace)
+	var plan []string
 
-	for i, versions := range results.Versions {
-		moduleName := results.ModuleNames[i][0]
-		actualVersion := versions[0]
-		tfVersion := versions[1]
+	for _, fix := range fixes {
+		remediator, ok := driftRemediators[fix.ResourceType]
+		if !ok {
+			return "", fmt.Errorf("no version drift remediator for %s", fix.ResourceType)
+		}
 
-		files, updateErr := updateVersion(moduleName, actualVersion, tfVersion, tfDir)
+		changes, updateErr := remediator.remediate(files, fix)
 		if updateErr != nil {
 			return "", fmt.Errorf("error updating Terraform: %v", updateErr)
 		}
 
-		for _, f := range files {
-			duplicate := false
-			for _, v := range filesChanged {
-				if f == v {
-					duplicate = true
-					break
-				}
-			}
-			if !duplicate {
-				filesChanged = append(filesChanged, f)
-			}
+		for _, c := range changes {
+			line := fmt.Sprintf("module.%s: downgrade from %s to %s (%s)", fix.ModuleName, fix.ActualVersion, fix.TerraformVersion, c)
+			plan = append(plan, line)
+			versionDescription += "\n" + line
 		}
-		versionDescription += fmt.Sprintf("\nmodule.%s: downgrade from %s to %s", moduleName, actualVersion, tfVersion)
+	}
+
+	filesChanged := files.changedFiles()
+	if len(filesChanged) == 0 {
+		return "", errors.New("no terraform changes were needed, the versions are already up to date")
+	}
+
+	if opt.DryRun {
+		fmt.Printf("Planned changes for namespace %s:\n", namespace)
+		for _, line := range plan {
+			fmt.Printf("  - %s\n", line)
+		}
+		return strings.Join(filesChanged, ", "), nil
+	}
+
+	if opt.PatchDir != "" {
+		return writeNamespacePatch(files, namespace, opt.PatchDir)
+	}
+
+	if err := files.writeChanged(); err != nil {
+		return "", fmt.Errorf("error updating Terraform: %v", err)
 	}
 
 	versionDescription += "\n```"
 	description := versionDescription
-	prCreator := createPR(description, namespace, os.Getenv("TF_VAR_github_token"), "cloud-platform-environments")
+	resources := driftResources(fixes)
+	prCreator := createPR(description, namespace, resources, os.Getenv("TF_VAR_github_token"), "cloud-platform-environments")
 	prUrl, err := prCreator(ghClient, filesChanged)
 	if err != nil {
 		return "", fmt.Errorf("PR creation failed: %v", err)
 	}
 
 	log.Printf("Successfully created PR: %s\n\n", prUrl)
-	postPR(prUrl, os.Getenv("SLACK_WEBHOOK_URL"))
+	postPR(prUrl, resources, os.Getenv("SLACK_WEBHOOK_URL"))
 	return prUrl, nil
 }
+
+// writeNamespacePatch writes the in memory changes of a namespace to <patchDir>/<namespace>.patch,
+// with paths relative to the root of the environments repository.
+func writeNamespacePatch(files *tfFiles, namespace, patchDir string) (string, error) {
+	patch, err := files.diff(files.dir)
+	if err != nil {
+		return "", fmt.Errorf("error creating patch: %v", err)
+	}
+
+	if err := os.MkdirAll(patchDir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating patch directory: %v", err)
+	}
+
+	patchFile := filepath.Join(patchDir, namespace+".patch")
+	if err := os.WriteFile(patchFile, []byte(patch), 0o644); err != nil {
+		return "", fmt.Errorf("error writing patch: %v", err)
+	}
+
+	return patchFile, nil
+}
@@ -0,0 +1,108 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/client"
+)
+
+// defaultAwsRegion is used for AWS api calls when AWS_REGION isn't set.
+const defaultAwsRegion = "eu-west-2"
+
+// s3ObjectGetter is the part of the S3 api used to fetch the drift checker input,
+// so it can be replaced with a fake in tests.
+type s3ObjectGetter interface {
+	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// newS3Client builds an S3 client from the same AWS session the rest of the cli uses.
+func newS3Client() (s3ObjectGetter, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultAwsRegion
+	}
+
+	creds, err := client.NewAwsCreds(region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	return s3.New(creds.Session), nil
+}
+
+// openDriftCheckerInput returns a reader for the drift checker CSV. The location can be
+// an s3://bucket/key url, a file://path or "-" to read from stdin. The S3 client is only
+// created when it is needed, so local files work without AWS credentials.
+func openDriftCheckerInput(location string, stdin io.Reader, newS3 func() (s3ObjectGetter, error)) (io.ReadCloser, error) {
+	switch {
+	case location == "-":
+		fmt.Println("Reading CSV from stdin")
+		return io.NopCloser(stdin), nil
+
+	case strings.HasPrefix(location, "file://"):
+		path := strings.TrimPrefix(location, "file://")
+		fmt.Printf("Using local CSV file: %s\n", path)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading local CSV: %w", err)
+		}
+		return f, nil
+
+	case strings.HasPrefix(location, "s3://"):
+		bucket, key, err := parseS3Location(location)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Downloading CSV from S3: %s\n", location)
+
+		s3Client, err := newS3()
+		if err != nil {
+			return nil, err
+		}
+
+		return downloadFromS3(s3Client, bucket, key)
+
+	default:
+		return nil, fmt.Errorf("unsupported CSV location %q, must start with s3:// or file://, or be - for stdin", location)
+	}
+}
+
+// parseS3Location splits an s3://bucket/key url into the bucket and the key.
+func parseS3Location(location string) (string, string, error) {
+	bucket, key, found := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if !found || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 location %q, must be of the form s3://bucket/key", location)
+	}
+
+	return bucket, key, nil
+}
+
+// downloadFromS3 streams the object body, the caller is responsible for closing it.
+func downloadFromS3(s3Client s3ObjectGetter, bucket, key string) (io.ReadCloser, error) {
+	out, err := s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) {
+			switch aerr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				return nil, fmt.Errorf("bucket %s does not exist: %w", bucket, err)
+			case s3.ErrCodeNoSuchKey:
+				return nil, fmt.Errorf("object %s does not exist in bucket %s: %w", key, bucket, err)
+			}
+		}
+		return nil, fmt.Errorf("error downloading s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return out.Body, nil
+}
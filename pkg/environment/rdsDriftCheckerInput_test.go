@@ -0,0 +1,71 @@
+package environment
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeS3 struct {
+	objects map[string]string
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[*in.Bucket+"/"+*in.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestOpenDriftCheckerInput(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "errors.csv")
+	if err := os.WriteFile(csvFile, []byte("ns,from file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeS3{objects: map[string]string{"bucket/path/errors.csv": "ns,from s3"}}
+	newFake := func() (s3ObjectGetter, error) { return fake, nil }
+	noS3 := func() (s3ObjectGetter, error) {
+		return nil, errors.New("s3 client should not be created")
+	}
+
+	tests := []struct {
+		name     string
+		location string
+		newS3    func() (s3ObjectGetter, error)
+		want     string
+		wantErr  string
+	}{
+		{name: "stdin", location: "-", newS3: noS3, want: "ns,from stdin"},
+		{name: "local file", location: "file://" + csvFile, newS3: noS3, want: "ns,from file"},
+		{name: "missing local file", location: "file://" + csvFile + ".missing", newS3: noS3, wantErr: "error reading local CSV"},
+		{name: "s3 object", location: "s3://bucket/path/errors.csv", newS3: newFake, want: "ns,from s3"},
+		{name: "missing s3 object", location: "s3://bucket/missing.csv", newS3: newFake, wantErr: "object missing.csv does not exist in bucket bucket"},
+		{name: "s3 location without key", location: "s3://bucket", newS3: noS3, wantErr: "invalid S3 location"},
+		{name: "s3 client error", location: "s3://bucket/key", newS3: noS3, wantErr: "s3 client should not be created"},
+		{name: "unsupported scheme", location: "https://example.com/errors.csv", newS3: noS3, wantErr: "unsupported CSV location"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := openDriftCheckerInput(tt.location, strings.NewReader("ns,from stdin"), tt.newS3)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -1,14 +1,15 @@
 package environment
 
+var rdsEngineRule = &inListValidator{
+	list: []string{
+		"postgresql",
+		"mysql",
+		"mssql",
+	},
+}
+
 type rdsEngineValidator struct{}
 
 func (r *rdsEngineValidator) isValid(s string) bool {
-	l := inListValidator{
-		list: []string{
-			"postgresql",
-			"mysql",
-			"mssql",
-		},
-	}
-	return l.isValid(s)
+	return rdsEngineRule.isValid(s)
 }
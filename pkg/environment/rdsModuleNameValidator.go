@@ -0,0 +1,19 @@
+package environment
+
+import "fmt"
+
+type rdsModuleNameValidator struct {
+	// existing confirms the names generated from the module name aren't taken, when set.
+	existing *existingResources
+}
+
+func (v *rdsModuleNameValidator) isValid(s string) bool {
+	if !moduleNameRule.isValid(s) {
+		return false
+	}
+	if err := v.existing.checkRds(newRdsNames(s)); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package environment
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// the allocated storage of an RDS instance is in GiB, up to the 64TiB RDS allows
+const (
+	minRdsStorage = 10
+	maxRdsStorage = 65536
+)
+
+type rdsStorageValidator struct{}
+
+func (v *rdsStorageValidator) isValid(s string) bool {
+	if err := v.validate(s); err != nil {
+		fmt.Printf("Value %s\n", err)
+		return false
+	}
+	return true
+}
+
+func (v *rdsStorageValidator) validate(s string) error {
+	gib, err := strconv.Atoi(s)
+	if err != nil || gib < minRdsStorage || gib > maxRdsStorage {
+		return fmt.Errorf("%q must be a whole number of GiB from %d to %d", s, minRdsStorage, maxRdsStorage)
+	}
+	return nil
+}
@@ -10,10 +10,17 @@ type regexValidator struct {
 }
 
 func (v *regexValidator) isValid(s string) bool {
-	matched, _ := regexp.MatchString(v.regex, s)
-	if !matched {
-		fmt.Printf("Value must match: %s\n", v.regex)
+	if err := v.validate(s); err != nil {
+		fmt.Printf("Value %s\n", err)
 		return false
 	}
 	return true
 }
+
+func (v *regexValidator) validate(s string) error {
+	matched, _ := regexp.MatchString(v.regex, s)
+	if !matched {
+		return fmt.Errorf("must match: %s", v.regex)
+	}
+	return nil
+}
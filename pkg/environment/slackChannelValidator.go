@@ -1,9 +1,9 @@
 package environment
 
+var slackChannelRule = &regexValidator{regex: `^[a-z0-9\-_]+$`}
+
 type slackChannelValidator struct{}
 
 func (v *slackChannelValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^[a-z0-9\-_]+$`
-	return r.isValid(s)
+	return slackChannelRule.isValid(s)
 }
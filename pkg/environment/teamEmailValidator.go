@@ -1,9 +1,9 @@
 package environment
 
+var teamEmailRule = &regexValidator{regex: `^[a-z\-\.]+\@[a-z\-\.]+$`}
+
 type teamEmailValidator struct{}
 
 func (v *teamEmailValidator) isValid(s string) bool {
-	r := new(regexValidator)
-	r.regex = `^[a-z\-\.]+\@[a-z\-\.]+$`
-	return r.isValid(s)
+	return teamEmailRule.isValid(s)
 }
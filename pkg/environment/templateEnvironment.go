@@ -1,6 +1,7 @@
 package environment
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -8,49 +9,124 @@ import (
 
 	"github.com/MakeNowJust/heredoc"
 	"github.com/gookit/color"
+	"github.com/ministryofjustice/cloud-platform-cli/pkg/github"
 	dir "golang.org/x/mod/sumdb/dirhash"
-	"gopkg.in/yaml.v2"
 )
 
-func CreateTemplateNamespace(skipEnvCheck bool, answersFile string) error {
-	if !skipEnvCheck {
+// CreateNamespaceOptions are the options for generating a new namespace's files.
+type CreateNamespaceOptions struct {
+	SkipEnvCheck bool
+	// AnswersFile is a YAML file of the namespace's values, see AnswersSchema.
+	AnswersFile string
+	// Set are key=value answers, applied over the answers file. With either of them set the
+	// user isn't prompted, so every value must be given.
+	Set []string
+	// GithubToken is used to confirm the github team and source repository exist, without it
+	// only their format is checked.
+	GithubToken string
+	// OpenPR commits the namespace to a new branch, pushes it and raises a PR, which needs
+	// GithubToken.
+	OpenPR bool
+	NamespaceCheckOptions
+}
+
+func CreateTemplateNamespace(opt CreateNamespaceOptions) error {
+	if opt.OpenPR && opt.GithubToken == "" {
+		return errors.New("a github token is needed to open a PR, set --github-token or TF_VAR_github_token")
+	}
+
+	var gh github.GithubIface
+	var lookup *githubLookup
+	if opt.GithubToken != "" {
+		gh = github.NewGithubClient(&github.GithubClientConfig{Repository: cloudPlatformEnvRepo, Owner: mojOwner}, opt.GithubToken)
+		lookup = newGithubLookup(gh, os.Stdout)
+	}
+
+	nsValues, err := createTemplateNamespace(opt, lookup)
+	if err != nil || !opt.OpenPR {
+		return err
+	}
+
+	prURL, err := openNamespacePR(gh, opt.GithubToken, nsValues, raisePR)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Raised the PR for namespace %s: %s\n", nsValues.Namespace, prURL)
+	return nil
+}
+
+func createTemplateNamespace(opt CreateNamespaceOptions, lookup *githubLookup) (*Namespace, error) {
+	if !opt.SkipEnvCheck {
 		re := RepoEnvironment{}
 		err := re.mustBeInCloudPlatformEnvironments()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	names, err := newNamespaceNames(opt.NamespaceCheckOptions, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
 	nsValues := &Namespace{}
-	if answersFile != "" {
-		if err := nsValues.readAnswersFile(answersFile); err != nil {
-			return err
+	if opt.AnswersFile != "" || len(opt.Set) > 0 {
+		if opt.AnswersFile != "" {
+			if err := nsValues.readAnswersFile(opt.AnswersFile); err != nil {
+				return nil, err
+			}
+		}
+		if err := nsValues.setAnswers(opt.Set); err != nil {
+			return nil, err
 		}
 	} else {
-		if err := nsValues.promptUserForNamespaceValues(); err != nil {
-			return err
+		if err := nsValues.promptUserForNamespaceValues(lookup, names); err != nil {
+			return nil, err
 		}
 	}
 
-	err := createNamespaceFiles(nsValues)
+	if err := nsValues.validate(); err != nil {
+		return nil, err
+	}
+	if err := nsValues.checkGithub(lookup); err != nil {
+		return nil, err
+	}
+	if err := names.check(nsValues.Namespace); err != nil {
+		return nil, err
+	}
+	// the PR's branch is checked before any files are generated, so they aren't left behind
+	if branch := namespacePR(nsValues).Branch; opt.OpenPR && branchExists("", branch) {
+		return nil, fmt.Errorf("a branch called %s already exists in this checkout, delete it or raise the PR yourself without --open-pr", branch)
+	}
+
+	// If the user requests a namespace for a beta environment,
+	// we need to create the namespace in the live-2 directory.
+	if strings.ToLower(nsValues.Environment) == "beta" {
+		namespaceBaseFolder = betaBaseDir
+	}
+
+	err = createNamespaceFiles(nsValues)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = createDirHash(nsValues)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	fmt.Printf("Namespace files generated under %s/%s\n", namespaceBaseFolder, nsValues.Namespace)
-	color.Info.Tips("Please review before raising PR")
+	fmt.Printf("Namespace files generated under %s/%s from %s\n", namespaceBaseFolder, nsValues.Namespace, templates.version(namespaceTemplates))
+	if !opt.OpenPR {
+		color.Info.Tips("Please review before raising PR")
+	}
 
-	return nil
+	return nsValues, nil
 }
 
 //------------------------------------------------------------------------------
 
-func (values *Namespace) promptUserForNamespaceValues() error {
+func (values *Namespace) promptUserForNamespaceValues(lookup *githubLookup, names *namespaceNames) error {
 	q := userQuestion{
 		description: heredoc.Doc(`
 			 What is the name of your namespace?
@@ -58,7 +134,7 @@ func (values *Namespace) promptUserForNamespaceValues() error {
 			 e.g. myapp-dev (lower-case letters and dashes only)
 			 `),
 		prompt:    "Name",
-		validator: new(namespaceNameValidator),
+		validator: &namespaceNameValidator{names: names},
 	}
 	_ = q.getAnswer()
 	values.Namespace = q.value
@@ -74,12 +150,6 @@ func (values *Namespace) promptUserForNamespaceValues() error {
 	_ = q.getAnswer()
 	values.Environment = q.value
 
-	// If the user requests a namespace for a beta environment,
-	// we need to create the namespace in the live-2 directory.
-	if strings.ToLower(q.value) == "beta" {
-		namespaceBaseFolder = betaBaseDir
-	}
-
 	if q.value == "development" || q.value == "dev" {
 		values.IsProduction = "false"
 
@@ -132,7 +202,7 @@ func (values *Namespace) promptUserForNamespaceValues() error {
 			(this must be an exact match, or you will not have access to your namespace)",
 			 `),
 		prompt:    "GitHub Team",
-		validator: new(githubTeamNameValidator),
+		validator: &githubTeamNameValidator{lookup: lookup},
 	}
 	_ = q.getAnswer()
 	values.GithubTeam = q.value
@@ -189,7 +259,7 @@ func (values *Namespace) promptUserForNamespaceValues() error {
 			the source code for this application?
 			 `),
 		prompt:    "Github Repo",
-		validator: new(githubUrlValidator),
+		validator: &githubUrlValidator{lookup: lookup},
 	}
 	_ = q.getAnswer()
 	values.SourceCode = q.value
@@ -208,70 +278,40 @@ func (values *Namespace) promptUserForNamespaceValues() error {
 	return nil
 }
 
-func downloadAndInitialiseTemplates(namespace string) ([]*templateFromUrl, error) {
-	templates := []*templateFromUrl{
-		{
-			name: "00-namespace.yaml",
-			url:  envTemplateLocation + "/" + "00-namespace.yaml",
-		},
-		{
-			name: "01-rbac.yaml",
-			url:  envTemplateLocation + "/" + "01-rbac.yaml",
-		},
-		{
-			name: "02-limitrange.yaml",
-			url:  envTemplateLocation + "/" + "02-limitrange.yaml",
-		},
-		{
-			name: "03-resourcequota.yaml",
-			url:  envTemplateLocation + "/" + "03-resourcequota.yaml",
-		},
-		{
-			name: "04-networkpolicy.yaml",
-			url:  envTemplateLocation + "/" + "04-networkpolicy.yaml",
-		},
-		{
-			name: "resources/main.tf",
-			url:  envTemplateLocation + "/" + "resources/main.tf",
-		},
-		{
-			name: "resources/versions.tf",
-			url:  envTemplateLocation + "/" + "resources/versions.tf",
-		},
-		{
-			name: "resources/variables.tf",
-			url:  envTemplateLocation + "/" + "resources/variables.tf",
-		},
-	}
-
-	err := downloadTemplateContents(templates)
-	if err != nil {
-		return nil, err
-	}
+// namespaceTemplateNames are the files generated for a new namespace, from the templates in
+// namespace-resources-cli-template.
+var namespaceTemplateNames = []string{
+	"00-namespace.yaml",
+	"01-rbac.yaml",
+	"02-limitrange.yaml",
+	"03-resourcequota.yaml",
+	"04-networkpolicy.yaml",
+	"resources/main.tf",
+	"resources/versions.tf",
+	"resources/variables.tf",
+}
 
-	for _, s := range templates {
-		s.outputPath = fmt.Sprintf("%s/%s/", namespaceBaseFolder, namespace) + s.name
+// namespaceTemplateFiles lists the files generated for a new namespace.
+func namespaceTemplateFiles(namespace string) []*templateFile {
+	files := make([]*templateFile, 0, len(namespaceTemplateNames))
+	for _, name := range namespaceTemplateNames {
+		files = append(files, &templateFile{
+			template:   namespaceTemplates + "/" + name,
+			outputPath: fmt.Sprintf("%s/%s/", namespaceBaseFolder, namespace) + name,
+		})
 	}
-	return templates, nil
+	return files
 }
 
 func createNamespaceFiles(nsValues *Namespace) error {
-	err := os.MkdirAll(fmt.Sprintf("%s/%s/resources", namespaceBaseFolder, nsValues.Namespace), 0o755)
-	if err != nil {
-		return err
-	}
-
-	templates, err := downloadAndInitialiseTemplates(nsValues.Namespace)
-	if err != nil {
-		return err
-	}
+	files := namespaceTemplateFiles(nsValues.Namespace)
 
-	err = createFilesFromTemplates(templates, *nsValues)
+	err := renderTemplates(files, *nsValues)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return writeTemplateFiles(files)
 }
 
 // createDirHash calls the dirhash package to create a sha256 hash of the users
@@ -311,17 +351,3 @@ func createDirHash(nsValues *Namespace) error {
 func reviewAfter() string {
 	return string(time.Now().AddDate(0, 3, 0).Format("2006-01-02"))
 }
-
-func (ns *Namespace) readAnswersFile(fileName string) error {
-	f, err := os.ReadFile(fileName)
-	if err != nil {
-		return err
-	}
-
-	err = yaml.Unmarshal(f, ns)
-	if err != nil {
-		return err
-	}
-
-	return err
-}
@@ -17,13 +17,13 @@ func cleanUpNamespacesFolder(namespace string) {
 }
 
 func TestCreateNamespaceWithAnswersFile(t *testing.T) {
-	answersFile := "../../testdata/environments-answers.yaml"
-	err := CreateTemplateNamespace(true, answersFile)
+	answersFile := "../../testdata/environments-answers-valid.yaml"
+	err := CreateTemplateNamespace(CreateNamespaceOptions{SkipEnvCheck: true, AnswersFile: answersFile})
 	if err != nil {
 		t.Errorf("Namespace created with answersFile errored: %s", err)
 	}
 
-	dir := namespaceBaseFolder + "/testNamespace/"
+	dir := namespaceBaseFolder + "/test-namespace/"
 	namespaceFile := dir + "00-namespace.yaml"
 	rbacFile := dir + "01-rbac.yaml"
 	variablesTfFile := dir + "resources/variables.tf"
@@ -46,14 +46,14 @@ func TestCreateNamespaceWithAnswersFile(t *testing.T) {
 	}
 
 	stringsInFiles := map[string]string{
-		namespaceFile: `name: "testNamespace"`,
+		namespaceFile: "name: test-namespace",
 	}
 
 	for filename, searchString := range stringsInFiles {
 		util.FileContainsString(t, filename, searchString)
 	}
 
-	defer cleanUpNamespacesFolder("testNamespace")
+	defer cleanUpNamespacesFolder("test-namespace")
 	defer os.RemoveAll(".checksum")
 }
 
@@ -120,11 +120,9 @@ func TestCreateNamespace(t *testing.T) {
 		namespaceFile:   "cloud-platform.justice.gov.uk/owner: \"Some Team: some-team@digital.justice.gov.uk\"",
 		namespaceFile:   "cloud-platform.justice.gov.uk/source-code: \"https://github.com/ministryofjustice/somerepo\"",
 		namespaceFile:   "cloud-platform.justice.gov.uk/is-production: \"false\"",
-		namespaceFile:   "pod-security.kubernetes.io/enforce: restricted",
 		rbacFile:        "name: \"github:my-github-2-team\"",
 		variablesTfFile: "my-team-slack_channel",
 		variablesTfFile: "my-github-2-team",
-		variablesTfFile: "My Service Area",
 	}
 
 	for filename, searchString := range stringsInFiles {
@@ -135,7 +133,7 @@ func TestCreateNamespace(t *testing.T) {
 }
 
 func TestRunningOutsideEnvironmentsWorkingCopy(t *testing.T) {
-	err := CreateTemplateNamespace(false, "")
+	err := CreateTemplateNamespace(CreateNamespaceOptions{})
 	if err.Error() != "this command may only be run from within a working copy of the cloud-platform-environments repository" {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -2,20 +2,25 @@ package environment
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/MakeNowJust/heredoc"
 )
 
-const prototypeTemplateUrl = "https://raw.githubusercontent.com/ministryofjustice/cloud-platform-environments/main/namespace-resources-cli-template/resources/prototype"
-
-func CreateTemplatePrototype() error {
+func CreateTemplatePrototype(opt NamespaceCheckOptions) error {
 	re := RepoEnvironment{}
 	err := re.mustBeInCloudPlatformEnvironments()
 	if err != nil {
 		return err
 	}
 
-	proto, err := promptUserForPrototypeValues()
+	names, err := newNamespaceNames(opt, os.Stdout)
+	if err != nil {
+		return err
+	}
+	names.prototype = true
+
+	proto, err := promptUserForPrototypeValues(names)
 	if err != nil {
 		return (err)
 	}
@@ -31,13 +36,10 @@ func CreateTemplatePrototype() error {
 NOTE: Prototype kit websites must be protected by HTTP basic authentication,
 this is so citizens don't mistake them for real government services.
 
-A default username and password will be set for your site, these credentials
-will be stored in plaintext in a public github repository. This means the
-site will not be secure and should not contain information that should not
-be accessible by the public.
-
-USERNAME: prototype
-PASSWORD: notarealwebsite
+The username and password are the basic-auth-username and basic-auth-password
+variables of the namespace's terraform. They have no defaults, so they're never
+written to this public repository; ask in #ask-cloud-platform on slack for them
+to be set before the pull request is merged.
 
 Please run:
 
@@ -55,7 +57,7 @@ on slack.
 
 //------------------------------------------------------------------------------
 
-func promptUserForPrototypeValues() (*Prototype, error) {
+func promptUserForPrototypeValues(names *namespaceNames) (*Prototype, error) {
 	proto := Prototype{}
 	values := Namespace{}
 
@@ -79,10 +81,9 @@ func promptUserForPrototypeValues() (*Prototype, error) {
 			 where "main" is the branch you have published
 			 `),
 		prompt:    "Name",
-		validator: new(namespaceNameValidator),
+		validator: &namespaceNameValidator{names: names},
 	}
 	_ = q.getAnswer()
-	// TODO: check that there isn't already a namespace or github repository with this name
 	values.Namespace = q.value
 
 	q = userQuestion{
@@ -144,26 +145,41 @@ func promptUserForPrototypeValues() (*Prototype, error) {
 	return &proto, nil
 }
 
+// prototypeBasicAuthVariables declares the credentials of the prototype's basic authentication,
+// without defaults so they aren't committed to the environments repository.
+const prototypeBasicAuthVariables = `variable "basic-auth-username" {
+  description = "Username of the prototype kit website's http basic authentication"
+  type        = string
+  sensitive   = true
+}
+
+variable "basic-auth-password" {
+  description = "Password of the prototype kit website's http basic authentication"
+  type        = string
+  sensitive   = true
+}
+`
+
 func createPrototypeFiles(p *Prototype) error {
-	err := createNamespaceFiles(&p.Namespace)
+	files := namespaceTemplateFiles(p.Namespace.Namespace)
+	err := renderTemplates(files, p.Namespace)
 	if err != nil {
 		return err
 	}
 
+	// The prototype's terraform is copied as is, after the namespace templates
 	nsdir := namespaceBaseFolder + "/" + p.Namespace.Namespace
-
-	err = CopyUrlToFile(prototypeTemplateUrl+"/ecr.tf", nsdir+"/resources/ecr.tf")
-	if err != nil {
-		return err
+	resources := []*templateFile{
+		{template: prototypeTemplates + "/ecr.tf", outputPath: nsdir + "/resources/ecr.tf"},
+		{template: prototypeTemplates + "/serviceaccount.tf", outputPath: nsdir + "/resources/serviceaccount.tf"},
+		{template: prototypeTemplates + "/basic-auth.tf", outputPath: nsdir + "/resources/basic-auth.tf"},
 	}
-	err = CopyUrlToFile(prototypeTemplateUrl+"/serviceaccount.tf", nsdir+"/resources/serviceaccount.tf")
-	if err != nil {
-		return err
-	}
-	err = CopyUrlToFile(prototypeTemplateUrl+"/basic-auth.tf", nsdir+"/resources/basic-auth.tf")
+	err = renderTemplates(resources, nil)
 	if err != nil {
 		return err
 	}
+	// basic-auth.tf uses these, and the templates don't declare them
+	resources = append(resources, &templateFile{outputPath: nsdir + "/resources/basic-auth-variables.tf", content: []byte(prototypeBasicAuthVariables)})
 
-	return nil
+	return writeTemplateFiles(append(files, resources...))
 }
@@ -49,6 +49,7 @@ func TestCreatePrototype(t *testing.T) {
 		ecrTfFile,
 		dir + "resources/serviceaccount.tf",
 		dir + "resources/basic-auth.tf",
+		dir + "resources/basic-auth-variables.tf",
 		dir + "resources/versions.tf",
 	}
 
@@ -69,7 +70,6 @@ func TestCreatePrototype(t *testing.T) {
 		rbacFile:        "name: \"github:my-github-team\"",
 		variablesTfFile: "my-team-slack_channel",
 		variablesTfFile: "my-github-team",
-		variablesTfFile: "My Service Area",
 		ecrTfFile:       "github_repositories = [var.namespace]",
 	}
 
@@ -81,7 +81,7 @@ func TestCreatePrototype(t *testing.T) {
 }
 
 func TestOutsideEnvironmentsWorkingCopy(t *testing.T) {
-	err := CreateTemplatePrototype()
+	err := CreateTemplatePrototype(NamespaceCheckOptions{})
 	if err.Error() != "this command may only be run from within a working copy of the cloud-platform-environments repository" {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -14,7 +14,7 @@ func TestCreateServiceAccountFile(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = createSvcAccTfFile()
+	err = addDefaultResource("serviceaccount")
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
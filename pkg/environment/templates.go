@@ -0,0 +1,236 @@
+package environment
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"gopkg.in/yaml.v2"
+)
+
+// templateBundle holds the templates used to generate environment files, so they can be
+// generated offline, and always from the templates this version of the cli was built with.
+// The bundle mirrors the repositories the templates are copied from:
+// templates/<repository>/<path in the repository>, bundle.yaml records the ref of each.
+//
+//go:embed all:templates
+var templateBundle embed.FS
+
+// rawGithubUrl is where templates are downloaded from with a template ref.
+var rawGithubUrl = "https://raw.githubusercontent.com"
+
+const (
+	templateBundleDir      = "templates"
+	templateBundleManifest = "bundle.yaml"
+
+	namespaceTemplates = cloudPlatformEnvRepo + "/namespace-resources-cli-template"
+	prototypeTemplates = namespaceTemplates + "/resources/prototype"
+)
+
+// TemplateOptions choose where the templates come from, the templates embedded in the cli are
+// used unless one of them is set.
+type TemplateOptions struct {
+	// Dir is a local folder laid out like the embedded bundle, e.g. a folder holding clones of
+	// cloud-platform-environments and the module repositories.
+	Dir string
+	// Ref is a branch, tag or commit to download the templates from, in the repository each
+	// template is copied from.
+	Ref string
+}
+
+// templateSource reads templates by their path in the bundle, e.g.
+// cloud-platform-environments/namespace-resources-cli-template/00-namespace.yaml
+type templateSource interface {
+	read(name string) ([]byte, error)
+	// version describes where a template comes from, so generated files can be traced back to it.
+	version(name string) string
+}
+
+// templates is where the templates are read from, set with UseTemplates.
+var templates templateSource = embeddedTemplates{}
+
+// UseTemplates sets where the templates are read from.
+func UseTemplates(opt TemplateOptions) error {
+	switch {
+	case opt.Dir != "" && opt.Ref != "":
+		return errors.New("only one of a template dir or a template ref can be used")
+	case opt.Dir != "":
+		info, err := os.Stat(opt.Dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("template dir %s is not a directory", opt.Dir)
+		}
+		templates = dirTemplates(opt.Dir)
+	case opt.Ref != "":
+		templates = githubTemplates(opt.Ref)
+	default:
+		templates = embeddedTemplates{}
+	}
+
+	return nil
+}
+
+type templateManifest struct {
+	Repositories map[string]string `yaml:"repositories"`
+}
+
+type embeddedTemplates struct{}
+
+func (embeddedTemplates) read(name string) ([]byte, error) {
+	return templateBundle.ReadFile(path.Join(templateBundleDir, name))
+}
+
+func (embeddedTemplates) version(name string) string {
+	repo := templateRepository(name)
+
+	data, err := templateBundle.ReadFile(path.Join(templateBundleDir, templateBundleManifest))
+	if err != nil {
+		return repo + " (embedded)"
+	}
+	var m templateManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return repo + " (embedded)"
+	}
+
+	return fmt.Sprintf("%s@%s (embedded)", repo, m.Repositories[repo])
+}
+
+type dirTemplates string
+
+func (d dirTemplates) read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirTemplates) version(name string) string {
+	return filepath.Join(string(d), templateRepository(name))
+}
+
+type githubTemplates string
+
+// read downloads the template at the ref. If Github can't be reached the embedded template is
+// used instead, so the cli still works offline, but a template missing at the ref is an error.
+func (ref githubTemplates) read(name string) ([]byte, error) {
+	repo, file, _ := strings.Cut(name, "/")
+	content, err := downloadTemplate(fmt.Sprintf("%s/%s/%s/%s/%s", rawGithubUrl, mojOwner, repo, ref, file))
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		log.Printf("Warning: couldn't download %s from %s, using the template embedded in the cli: %v", file, ref.version(name), err)
+		return embeddedTemplates{}.read(name)
+	}
+	return content, err
+}
+
+func (ref githubTemplates) version(name string) string {
+	return templateRepository(name) + "@" + string(ref)
+}
+
+func templateRepository(name string) string {
+	repo, _, _ := strings.Cut(name, "/")
+	return repo
+}
+
+// templateFile is a file generated from a template.
+type templateFile struct {
+	// template is the path of the template in the bundle.
+	template   string
+	outputPath string
+	content    []byte
+}
+
+// renderTemplates reads every template, executes it with values, or copies it as is if values
+// is nil, and checks the output parses. Nothing is written, so a missing or broken template
+// doesn't leave half the files behind.
+func renderTemplates(files []*templateFile, values any) error {
+	for _, f := range files {
+		content, err := templates.read(f.template)
+		if err != nil {
+			return fmt.Errorf("error reading template %s: %w", f.template, err)
+		}
+
+		if values != nil {
+			t, err := template.New(path.Base(f.template)).Parse(string(content))
+			if err != nil {
+				return fmt.Errorf("error parsing template %s from %s: %w", f.template, templates.version(f.template), err)
+			}
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, values); err != nil {
+				return fmt.Errorf("error executing template %s from %s: %w", f.template, templates.version(f.template), err)
+			}
+			content = buf.Bytes()
+		}
+
+		if err := validateTemplateOutput(f.outputPath, content); err != nil {
+			return fmt.Errorf("template %s from %s: %w", f.template, templates.version(f.template), err)
+		}
+		f.content = content
+	}
+
+	return nil
+}
+
+// validateTemplateOutput checks a generated file is valid terraform or yaml, going by its name.
+func validateTemplateOutput(name string, content []byte) error {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return errors.New("the template is empty")
+	}
+
+	switch filepath.Ext(name) {
+	case ".tf":
+		if _, diags := hclwrite.ParseConfig(content, name, hcl.InitialPos); diags.HasErrors() {
+			return fmt.Errorf("%s is not valid terraform: %s", name, diags.Error())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var doc interface{}
+			err := dec.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s is not valid yaml: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeTemplateFiles writes rendered files, creating their folders.
+func writeTemplateFiles(files []*templateFile) error {
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.outputPath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.outputPath, f.content, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyTemplateToFile writes a template as is to target, name is the path of the template in the
+// bundle.
+func CopyTemplateToFile(name, target string) error {
+	files := []*templateFile{{template: name, outputPath: target}}
+	if err := renderTemplates(files, nil); err != nil {
+		return err
+	}
+
+	return writeTemplateFiles(files)
+}
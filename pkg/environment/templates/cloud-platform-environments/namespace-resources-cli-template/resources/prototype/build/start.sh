@@ -0,0 +1,5 @@
+#!/bin/sh
+
+set -eu pipefail
+
+npm run serve
\ No newline at end of file
@@ -0,0 +1,34 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "dynamodb" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-dynamodb-cluster?ref=4.0.0"
+
+  # Table configuration
+  hash_key          = "id"
+  enable_encryption = "true"
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  team_name              = var.team_name
+  namespace              = var.namespace
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+}
+
+resource "kubernetes_secret" "dynamodb" {
+  metadata {
+    name      = "dynamodb-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    table_name = module.dynamodb.table_name
+    table_arn  = module.dynamodb.table_arn
+  }
+}
@@ -0,0 +1,43 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "irsa" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-irsa?ref=2.1.0"
+
+  # EKS configuration
+  eks_cluster_name = var.eks_cluster_name
+
+  # IRSA configuration
+  service_account_name = "${var.team_name}-${var.environment}"
+  namespace            = var.namespace
+
+  # Attach the policies of the resources the service account needs, as a key => value map.
+  # Cloud Platform modules, e.g. s3-bucket and sqs, have an irsa_policy_arn output for this.
+  role_policy_arns = {
+    s3 = module.s3_bucket.irsa_policy_arn
+  }
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  team_name              = var.team_name
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+}
+
+resource "kubernetes_secret" "irsa" {
+  metadata {
+    name      = "irsa-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    role           = module.irsa.role_name
+    rolearn        = module.irsa.role_arn
+    serviceaccount = module.irsa.service_account.name
+  }
+}
@@ -0,0 +1,46 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "rds_mssql" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+
+  # VPC configuration
+  vpc_name = var.vpc_name
+
+  # Database configuration
+  db_engine            = "sqlserver-ex"
+  db_engine_version    = "15.00"
+  rds_family           = "sqlserver-ex-15.0"
+  db_instance_class    = "db.t3.small"
+  db_allocated_storage = "20"
+  license_model        = "license-included"
+  db_parameter         = []
+  option_group_name    = null
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  namespace              = var.namespace
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+  team_name              = var.team_name
+}
+
+resource "kubernetes_secret" "rds_mssql" {
+  metadata {
+    name      = "rds-mssql-instance-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    rds_instance_endpoint = module.rds_mssql.rds_instance_endpoint
+    database_name         = module.rds_mssql.database_name
+    database_username     = module.rds_mssql.database_username
+    database_password     = module.rds_mssql.database_password
+    rds_instance_address  = module.rds_mssql.rds_instance_address
+  }
+}
@@ -0,0 +1,43 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "rds_mysql" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0"
+
+  # VPC configuration
+  vpc_name = var.vpc_name
+
+  # Database configuration
+  db_engine            = "mysql"
+  db_engine_version    = "8.0"
+  rds_family           = "mysql8.0"
+  db_instance_class    = "db.t4g.micro"
+  db_allocated_storage = "10"
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  namespace              = var.namespace
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+  team_name              = var.team_name
+}
+
+resource "kubernetes_secret" "rds_mysql" {
+  metadata {
+    name      = "rds-mysql-instance-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    rds_instance_endpoint = module.rds_mysql.rds_instance_endpoint
+    database_name         = module.rds_mysql.database_name
+    database_username     = module.rds_mysql.database_username
+    database_password     = module.rds_mysql.database_password
+    rds_instance_address  = module.rds_mysql.rds_instance_address
+  }
+}
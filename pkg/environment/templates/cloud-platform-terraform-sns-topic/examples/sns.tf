@@ -0,0 +1,33 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "sns_topic" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-sns-topic?ref=5.1.0"
+
+  # Topic configuration
+  topic_display_name = "example-topic"
+  encrypt_sns_kms    = true
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  team_name              = var.team_name
+  namespace              = var.namespace
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+}
+
+resource "kubernetes_secret" "sns_topic" {
+  metadata {
+    name      = "sns-topic-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    topic_arn = module.sns_topic.topic_arn
+  }
+}
@@ -0,0 +1,36 @@
+/*
+ * Make sure that you use the latest version of the module by changing the
+ * `ref=` value in the `source` attribute to the latest version listed on the
+ * releases page of this repository.
+ *
+ */
+module "sqs" {
+  source = "github.com/ministryofjustice/cloud-platform-terraform-sqs?ref=5.1.0"
+
+  # Queue configuration
+  sqs_name                  = "example-queue"
+  encrypt_sqs_kms           = "true"
+  message_retention_seconds = 1209600
+
+  # Tags
+  business_unit          = var.business_unit
+  application            = var.application
+  is_production          = var.is_production
+  team_name              = var.team_name
+  namespace              = var.namespace
+  environment_name       = var.environment
+  infrastructure_support = var.infrastructure_support
+}
+
+resource "kubernetes_secret" "sqs" {
+  metadata {
+    name      = "sqs-output"
+    namespace = var.namespace
+  }
+
+  data = {
+    sqs_id   = module.sqs.sqs_id
+    sqs_arn  = module.sqs.sqs_arn
+    sqs_name = module.sqs.sqs_name
+  }
+}
@@ -14,7 +14,7 @@ func TestCreatesEcrTfFile(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = createEcrTfFile()
+	err = addDefaultResource("ecr")
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -1,40 +1,70 @@
 package environment
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"math/rand"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/MakeNowJust/heredoc"
 	"github.com/gookit/color"
-	"github.com/spf13/cobra"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
 )
 
-const (
-	rdsTemplateFilePrefix = "https://raw.githubusercontent.com/ministryofjustice/cloud-platform-terraform-rds-instance/main/examples/"
-	rdsTfFilePrefix       = "resources/"
+const rdsTemplateFilePrefix = "cloud-platform-terraform-rds-instance/examples/"
+
+// RdsOptions are the values of a new RDS instance. Unless Engine is set the user is asked for
+// them, otherwise anything not set is taken from the engine's example in the rds-instance module.
+type RdsOptions struct {
+	// Engine is one of postgresql, mysql or mssql.
+	Engine string
+	// ModuleName is the name of the terraform module, by default rds_<engine> with a number
+	// appended if that's taken.
+	ModuleName    string
+	EngineVersion string
+	InstanceClass string
+	// Storage is the allocated storage in GiB.
+	Storage string
+	// DBName is the name of the database, by default the module picks one.
+	DBName      string
+	ReadReplica bool
+}
+
+var (
+	rdsInstanceClassRule = &regexValidator{regex: `^db\.[a-z0-9]+\.[a-z0-9]+$`}
+	rdsDBNameRule        = &regexValidator{regex: `^([A-Za-z][A-Za-z0-9_]{0,62})?$`}
+	rdsEngineVersionRule = map[string]*regexValidator{
+		"postgresql": {regex: `^[0-9]+(\.[0-9]+)?$`},
+		"mysql":      {regex: `^[0-9]+\.[0-9]+(\.[0-9]+)?$`},
+		"mssql":      {regex: `^[0-9]+\.[0-9]+(\.[0-9a-z.]+)?$`},
+	}
 )
 
-// CreateTemplateRds creates the terraform files from environment's template folder
-func CreateTemplateRds(cmd *cobra.Command, args []string) error {
+// CreateTemplateRds creates the terraform file of an RDS instance from the rds-instance module's
+// example for the engine.
+func CreateTemplateRds(opt RdsOptions) error {
 	re := RepoEnvironment{}
 	err := re.mustBeInANamespaceFolder()
 	if err != nil {
 		return err
 	}
 
-	engineValues, err := promptUserForRDSValues()
-	if err != nil {
-		return err
+	if opt.Engine == "" {
+		if err := promptUserForRDSValues(&opt); err != nil {
+			return err
+		}
 	}
 
-	rdsTfFile, err := createRdsTfFile(engineValues)
+	rdsTfFile, err := createRdsTfFile(opt)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("RDS File generated in %s\n", rdsTfFile)
+	fmt.Printf("RDS File generated in %s from %s\n", rdsTfFile, templates.version(rdsTemplateFilePrefix))
 	color.Info.Tips("This template is using default values provided by your namespace information. Please review before raising PR")
 
 	return nil
@@ -42,7 +72,7 @@ func CreateTemplateRds(cmd *cobra.Command, args []string) error {
 
 //------------------------------------------------------------------------------
 
-func promptUserForRDSValues() (string, error) {
+func promptUserForRDSValues(opt *RdsOptions) error {
 	q := userQuestion{
 		description: heredoc.Doc(`
 			 What RDS Engine you want to create?
@@ -52,28 +82,379 @@ func promptUserForRDSValues() (string, error) {
 		validator: new(rdsEngineValidator),
 	}
 	_ = q.getAnswer()
-	return q.value, nil
+	opt.Engine = q.value
+
+	example, err := readRdsExample(opt.Engine)
+	if err != nil {
+		return err
+	}
+	defaults := example.defaults()
+
+	existing, err := loadExistingResources(resourcesDir)
+	if err != nil {
+		return err
+	}
+
+	q = userQuestion{
+		description: heredoc.Doc(`
+			 What should the terraform module be called?
+			 Lower-case letters, digits and underscores, the secret and file are named after it.
+			 `),
+		prompt:       "Module name",
+		validator:    &rdsModuleNameValidator{existing: existing},
+		defaultValue: existing.freeRdsModuleName(opt.Engine),
+	}
+	_ = q.getAnswer()
+	opt.ModuleName = q.value
+
+	q = userQuestion{
+		description:  "Which version of the engine?",
+		prompt:       "Engine version",
+		validator:    rdsEngineVersionRule[opt.Engine],
+		defaultValue: defaults.EngineVersion,
+	}
+	_ = q.getAnswer()
+	opt.EngineVersion = q.value
+
+	q = userQuestion{
+		description:  "Which instance class? e.g. db.t4g.micro, db.t4g.small, db.m6g.large",
+		prompt:       "Instance class",
+		validator:    rdsInstanceClassRule,
+		defaultValue: defaults.InstanceClass,
+	}
+	_ = q.getAnswer()
+	opt.InstanceClass = q.value
+
+	q = userQuestion{
+		description:  "How much storage should be allocated, in GiB?",
+		prompt:       "Storage",
+		validator:    new(rdsStorageValidator),
+		defaultValue: defaults.Storage,
+	}
+	_ = q.getAnswer()
+	opt.Storage = q.value
+
+	// SQL Server Express has neither a database name nor read replicas
+	if opt.Engine == "mssql" {
+		return nil
+	}
+
+	q = userQuestion{
+		description: "What should the database be called? Leave empty to let the module pick a name.",
+		prompt:      "Database name",
+		validator:   rdsDBNameRule,
+		optional:    true,
+	}
+	_ = q.getAnswer()
+	opt.DBName = q.value
+
+	q = userQuestion{
+		description:  "Do you need a read replica? (yes/no)",
+		prompt:       "Read replica",
+		validator:    &inListValidator{list: []string{"yes", "no"}},
+		defaultValue: "no",
+	}
+	_ = q.getAnswer()
+	opt.ReadReplica = q.value == "yes"
+
+	return nil
 }
 
-func createRdsTfFile(engineValues string) (string, error) {
-	// The rds "template" is actually an example file. Based on engineValues
-	// fetch the relevant example file into the user's resources/ directory as `rds-<engine>.tf`
-	rdsTemplateFile := rdsTemplateFilePrefix + "rds-" + engineValues + ".tf"
-	rdsTfFile := rdsTfFilePrefix + "rds-" + engineValues + ".tf"
+// createRdsTfFile validates the options, renders the engine's example with them and writes it
+// to a file named after the module, returning the file's path. Nothing is written if any of it
+// fails.
+func createRdsTfFile(opt RdsOptions) (string, error) {
+	if err := rdsEngineRule.validate(opt.Engine); err != nil {
+		return "", fmt.Errorf("engine %w", err)
+	}
+
+	example, err := readRdsExample(opt.Engine)
+	if err != nil {
+		return "", err
+	}
+	defaults := example.defaults()
+	if opt.EngineVersion == "" {
+		opt.EngineVersion = defaults.EngineVersion
+	}
+	if opt.InstanceClass == "" {
+		opt.InstanceClass = defaults.InstanceClass
+	}
+	if opt.Storage == "" {
+		opt.Storage = defaults.Storage
+	}
+
+	existing, err := loadExistingResources(resourcesDir)
+	if err != nil {
+		return "", err
+	}
+	if opt.ModuleName == "" {
+		opt.ModuleName = existing.freeRdsModuleName(opt.Engine)
+	}
 
-	if tfFileExists(rdsTfFile) {
-		// generate a random string and append to the filename
-		randomInt := strconv.Itoa(rand.Intn(10))
-		rdsTfFile = rdsTfFilePrefix + "rds-" + engineValues + randomInt + ".tf"
+	if err := validateRdsOptions(opt); err != nil {
+		return "", err
+	}
+	names := newRdsNames(opt.ModuleName)
+	if err := existing.checkRds(names); err != nil {
+		return "", err
 	}
 
-	err := CopyUrlToFile(rdsTemplateFile, rdsTfFile)
+	content, err := example.render(opt, names)
 	if err != nil {
 		return "", err
 	}
+
+	rdsTfFile := resourcesDir + names.file
+	if err := validateTemplateOutput(rdsTfFile, content); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(rdsTfFile, content, 0o644); err != nil {
+		return "", err
+	}
 	return rdsTfFile, nil
 }
 
+// validateRdsOptions returns every invalid option, once the defaults have been filled in.
+func validateRdsOptions(opt RdsOptions) error {
+	var errs []error
+	if err := moduleNameRule.validate(opt.ModuleName); err != nil {
+		errs = append(errs, fmt.Errorf("module name %q %w", opt.ModuleName, err))
+	}
+	if err := rdsEngineVersionRule[opt.Engine].validate(opt.EngineVersion); err != nil {
+		errs = append(errs, fmt.Errorf("engine version %q %w", opt.EngineVersion, err))
+	}
+	if err := rdsInstanceClassRule.validate(opt.InstanceClass); err != nil {
+		errs = append(errs, fmt.Errorf("instance class %q %w", opt.InstanceClass, err))
+	}
+	if err := new(rdsStorageValidator).validate(opt.Storage); err != nil {
+		errs = append(errs, fmt.Errorf("storage %w", err))
+	}
+	if err := rdsDBNameRule.validate(opt.DBName); err != nil {
+		errs = append(errs, fmt.Errorf("database name %q %w", opt.DBName, err))
+	}
+	if opt.Engine == "mssql" && opt.DBName != "" {
+		errs = append(errs, errors.New("database name can't be set for mssql"))
+	}
+	if opt.Engine == "mssql" && opt.ReadReplica {
+		errs = append(errs, errors.New("read replicas aren't supported for mssql"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid rds values:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// rdsNames are the names generated from a module name, which mustn't already be used in the
+// namespace. The read replica's names are always reserved, so one can be added later.
+type rdsNames struct {
+	module, secret, secretName                      string
+	replicaModule, replicaSecret, replicaSecretName string
+	file                                            string
+}
+
+func newRdsNames(module string) rdsNames {
+	dashed := strings.ReplaceAll(module, "_", "-")
+	return rdsNames{
+		module:            module,
+		secret:            module,
+		secretName:        dashed + "-instance-output",
+		replicaModule:     module + "_read_replica",
+		replicaSecret:     module + "_read_replica",
+		replicaSecretName: dashed + "-read-replica-output",
+		file:              dashed + ".tf",
+	}
+}
+
+// checkRds returns an error for every one of names already used. A nil existingResources
+// doesn't check anything.
+func (e *existingResources) checkRds(names rdsNames) error {
+	if e == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, m := range []string{names.module, names.replicaModule} {
+		if file, ok := e.modules[m]; ok {
+			errs = append(errs, fmt.Errorf("module %s already exists in %s", m, file))
+		}
+	}
+	for _, s := range []string{names.secret, names.replicaSecret} {
+		if file, ok := e.resources["kubernetes_secret."+s]; ok {
+			errs = append(errs, fmt.Errorf("kubernetes_secret %s already exists in %s", s, file))
+		}
+	}
+	for _, s := range []string{names.secretName, names.replicaSecretName} {
+		if file, ok := e.secretNames[s]; ok {
+			errs = append(errs, fmt.Errorf("a secret named %s already exists in %s", s, file))
+		}
+	}
+	if e.files[names.file] {
+		errs = append(errs, fmt.Errorf("%s%s already exists", resourcesDir, names.file))
+	}
+
+	return errors.Join(errs...)
+}
+
+// freeRdsModuleName returns rds_<engine>, or the first of rds_<engine>_2, rds_<engine>_3... whose
+// names aren't taken.
+func (e *existingResources) freeRdsModuleName(engine string) string {
+	name := "rds_" + engine
+	for i := 2; e.checkRds(newRdsNames(name)) != nil; i++ {
+		name = fmt.Sprintf("rds_%s_%d", engine, i)
+	}
+	return name
+}
+
+// rdsExample is the rds-instance module's example of an engine, which is rewritten into the
+// requested instance so the module's own settings for the engine are kept.
+type rdsExample struct {
+	name   string
+	file   *hclwrite.File
+	module *hclwrite.Block
+	secret *hclwrite.Block
+}
+
+func readRdsExample(engine string) (*rdsExample, error) {
+	name := rdsTemplateFilePrefix + "rds-" + engine + ".tf"
+	data, err := templates.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, diags := hclwrite.ParseConfig(data, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s is not valid terraform: %s", name, diags.Error())
+	}
+
+	example := &rdsExample{name: name, file: f}
+	for _, b := range f.Body().Blocks() {
+		switch {
+		case b.Type() == "module" && example.module == nil:
+			example.module = b
+		case b.Type() == "resource" && len(b.Labels()) == 2 && b.Labels()[0] == "kubernetes_secret" && example.secret == nil:
+			example.secret = b
+		}
+	}
+	if example.module == nil || example.secret == nil {
+		return nil, fmt.Errorf("%s should have a module and a kubernetes_secret", name)
+	}
+
+	return example, nil
+}
+
+func (e *rdsExample) attribute(name string) string {
+	attr := e.module.Body().GetAttribute(name)
+	if attr == nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(string(attr.Expr().BuildTokens(nil).Bytes())), `"`)
+}
+
+// defaults returns the example's engine version, instance class and storage.
+func (e *rdsExample) defaults() RdsOptions {
+	return RdsOptions{
+		EngineVersion: e.attribute("db_engine_version"),
+		InstanceClass: e.attribute("db_instance_class"),
+		Storage:       e.attribute("db_allocated_storage"),
+	}
+}
+
+// render returns the example with the options and names applied, and a read replica and its
+// secret appended if asked for.
+func (e *rdsExample) render(opt RdsOptions, names rdsNames) ([]byte, error) {
+	oldModule := e.module.Labels()[0]
+
+	body := e.module.Body()
+	e.module.SetLabels([]string{names.module})
+	body.SetAttributeValue("db_engine_version", cty.StringVal(opt.EngineVersion))
+	body.SetAttributeValue("rds_family", cty.StringVal(rdsFamily(e.attribute("db_engine"), opt.EngineVersion)))
+	body.SetAttributeValue("db_instance_class", cty.StringVal(opt.InstanceClass))
+	body.SetAttributeValue("db_allocated_storage", cty.StringVal(opt.Storage))
+	if opt.DBName != "" {
+		appendComment(body, "Database name")
+		body.SetAttributeValue("db_name", cty.StringVal(opt.DBName))
+	}
+
+	e.secret.SetLabels([]string{"kubernetes_secret", names.secret})
+	if metadata := e.secret.Body().FirstMatchingBlock("metadata", nil); metadata != nil {
+		metadata.Body().SetAttributeValue("name", cty.StringVal(names.secretName))
+	}
+
+	content := e.file.Bytes()
+	if opt.ReadReplica {
+		replica, err := e.readReplica(names)
+		if err != nil {
+			return nil, err
+		}
+		content = append(append(content, '\n'), replica...)
+	}
+
+	content = bytes.ReplaceAll(content, []byte("module."+oldModule+"."), []byte("module."+names.module+"."))
+	return hclwrite.Format(content), nil
+}
+
+// readReplica returns a copy of the module replicating it, and a secret of its endpoint.
+func (e *rdsExample) readReplica(names rdsNames) ([]byte, error) {
+	f, diags := hclwrite.ParseConfig(e.module.BuildTokens(nil).Bytes(), e.name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to copy the module of %s: %s", e.name, diags.Error())
+	}
+
+	replica := f.Body().Blocks()[0]
+	replica.SetLabels([]string{names.replicaModule})
+	body := replica.Body()
+	appendComment(body, "Read replica")
+	body.SetAttributeValue("db_name", cty.NullVal(cty.String))
+	body.SetAttributeTraversal("replicate_source_db", hcl.Traversal{
+		hcl.TraverseRoot{Name: "module"},
+		hcl.TraverseAttr{Name: names.module},
+		hcl.TraverseAttr{Name: "db_identifier"},
+	})
+	// a replica is recreated from its source, so has no backups or final snapshot of its own
+	body.SetAttributeValue("skip_final_snapshot", cty.StringVal("true"))
+	body.SetAttributeValue("db_backup_retention_period", cty.NumberIntVal(0))
+
+	secret := fmt.Sprintf(heredoc.Doc(`
+		resource "kubernetes_secret" %q {
+		  metadata {
+		    name      = %q
+		    namespace = var.namespace
+		  }
+
+		  data = {
+		    rds_instance_endpoint = module.%s.rds_instance_endpoint
+		    rds_instance_address  = module.%s.rds_instance_address
+		  }
+		}
+		`), names.replicaSecret, names.replicaSecretName, names.replicaModule, names.replicaModule)
+
+	return append(append(f.Bytes(), '\n'), secret...), nil
+}
+
+// appendComment starts a new group of attributes at the end of body, as hclwrite can only add
+// attributes at the end, after the example's tags.
+func appendComment(body *hclwrite.Body, comment string) {
+	body.AppendNewline()
+	body.AppendUnstructuredTokens(hclwrite.Tokens{{Type: hclsyntax.TokenComment, Bytes: []byte("# " + comment + "\n")}})
+}
+
+// rdsFamily returns the parameter group family of an engine version, e.g. postgres16, mysql8.0
+// or sqlserver-ex-15.0.
+func rdsFamily(dbEngine, version string) string {
+	parts := strings.Split(version, ".")
+	switch {
+	case dbEngine == "postgres":
+		return "postgres" + parts[0]
+	case strings.HasPrefix(dbEngine, "sqlserver"):
+		return dbEngine + "-" + parts[0] + ".0"
+	case len(parts) > 1:
+		return dbEngine + parts[0] + "." + parts[1]
+	default:
+		return dbEngine + version
+	}
+}
+
 func tfFileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
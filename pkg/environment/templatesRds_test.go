@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ministryofjustice/cloud-platform-cli/pkg/util"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCreatesRdsTfFile(t *testing.T) {
@@ -14,7 +15,7 @@ func TestCreatesRdsTfFile(t *testing.T) {
 		t.Error(err)
 	}
 
-	rdsFile, err := createRdsTfFile("postgresql")
+	rdsFile, err := createRdsTfFile(RdsOptions{Engine: "postgresql"})
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -24,6 +25,7 @@ func TestCreatesRdsTfFile(t *testing.T) {
 
 	moduleName := "github.com/ministryofjustice/cloud-platform-terraform-rds-instance"
 	util.FileContainsString(t, filename, moduleName)
+	util.FileContainsString(t, filename, `module "rds_postgresql"`)
 
 	os.Remove(filename)
 	os.Remove("resources")
@@ -32,18 +34,82 @@ func TestCreatesRdsTfFile(t *testing.T) {
 func TestRdsFileAlreadyExists(t *testing.T) {
 	filename := "resources/rds-postgresql.tf"
 	_ = os.Mkdir("resources", 0o755)
+	defer os.RemoveAll("resources")
 
-	_, err := os.Create(filename)
-	if err != nil {
-		t.Error(err)
-	}
+	_, err := createRdsTfFile(RdsOptions{Engine: "postgresql"})
+	assert.NoError(t, err)
 
-	_, err = createRdsTfFile("postgresql")
-	if err != nil {
-		t.Errorf("Unexpected error: %s", err)
+	rdsFile, err := createRdsTfFile(RdsOptions{Engine: "postgresql"})
+	assert.NoError(t, err)
+	assert.Equal(t, "resources/rds-postgresql-2.tf", rdsFile)
+	util.FileContainsString(t, rdsFile, `module "rds_postgresql_2"`)
+	util.FileContainsString(t, rdsFile, `resource "kubernetes_secret" "rds_postgresql_2"`)
+	util.FileContainsString(t, rdsFile, `"rds-postgresql-2-instance-output"`)
+	util.FileContainsString(t, rdsFile, "module.rds_postgresql_2.database_password")
+	util.FileContainsString(t, filename, `module "rds_postgresql"`)
+
+	_, err = createRdsTfFile(RdsOptions{Engine: "mysql", ModuleName: "rds_postgresql"})
+	assert.ErrorContains(t, err, "module rds_postgresql already exists in rds-postgresql.tf")
+	assert.ErrorContains(t, err, "a secret named rds-postgresql-instance-output already exists in rds-postgresql.tf")
+	assert.ErrorContains(t, err, "resources/rds-postgresql.tf already exists")
+}
+
+func TestCreateRdsTfFileWithOptions(t *testing.T) {
+	_ = os.Mkdir("resources", 0o755)
+	defer os.RemoveAll("resources")
+
+	rdsFile, err := createRdsTfFile(RdsOptions{
+		Engine:        "mysql",
+		ModuleName:    "orders_db",
+		EngineVersion: "8.4.3",
+		InstanceClass: "db.t4g.small",
+		Storage:       "50",
+		DBName:        "orders",
+		ReadReplica:   true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "resources/orders-db.tf", rdsFile)
+
+	for _, s := range []string{
+		`module "orders_db"`,
+		`db_engine_version    = "8.4.3"`,
+		`rds_family           = "mysql8.4"`,
+		`db_instance_class    = "db.t4g.small"`,
+		`db_allocated_storage = "50"`,
+		`db_name = "orders"`,
+		`module "orders_db_read_replica"`,
+		"replicate_source_db        = module.orders_db.db_identifier",
+		`"orders-db-read-replica-output"`,
+		"module.orders_db_read_replica.rds_instance_endpoint",
+	} {
+		util.FileContainsString(t, rdsFile, s)
 	}
+}
+
+func TestCreateRdsTfFileInvalid(t *testing.T) {
+	_ = os.Mkdir("resources", 0o755)
+	defer os.RemoveAll("resources")
+
+	_, err := createRdsTfFile(RdsOptions{Engine: "mssql", ModuleName: "Orders", EngineVersion: "latest", InstanceClass: "t3.small", Storage: "5", DBName: "orders", ReadReplica: true})
+	assert.ErrorContains(t, err, `module name "Orders" must match`)
+	assert.ErrorContains(t, err, `engine version "latest" must match`)
+	assert.ErrorContains(t, err, `instance class "t3.small" must match`)
+	assert.ErrorContains(t, err, `storage "5" must be a whole number of GiB from 10 to 65536`)
+	assert.ErrorContains(t, err, "database name can't be set for mssql")
+	assert.ErrorContains(t, err, "read replicas aren't supported for mssql")
+
+	_, err = createRdsTfFile(RdsOptions{Engine: "oracle"})
+	assert.EqualError(t, err, "engine must be in the list: postgresql, mysql, mssql")
+
+	entries, err := os.ReadDir("resources")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
 
-	os.RemoveAll("resources")
+func TestRdsFamily(t *testing.T) {
+	assert.Equal(t, "postgres16", rdsFamily("postgres", "16.4"))
+	assert.Equal(t, "mysql8.0", rdsFamily("mysql", "8.0.39"))
+	assert.Equal(t, "sqlserver-ex-15.0", rdsFamily("sqlserver-ex", "15.00"))
 }
 
 func TestTfFileExists(t *testing.T) {
@@ -14,7 +14,7 @@ func TestCreatesS3TfFile(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = createS3TfFile()
+	err = addDefaultResource("s3")
 	if err != nil {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -0,0 +1,153 @@
+package environment
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useTemplates(t *testing.T, opt TemplateOptions) {
+	t.Helper()
+	assert.NoError(t, UseTemplates(opt))
+	t.Cleanup(func() { templates = embeddedTemplates{} })
+}
+
+func TestEmbeddedTemplatesAreValid(t *testing.T) {
+	ns := Namespace{Namespace: "foo", GithubTeam: "webops", Application: "My App", ReviewAfter: "2026-01-01"}
+
+	err := fs.WalkDir(templateBundle, templateBundleDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Base(p) == templateBundleManifest {
+			return err
+		}
+		name := strings.TrimPrefix(p, templateBundleDir+"/")
+
+		// only the namespace templates are executed, everything else is copied as is
+		var values any
+		if strings.HasPrefix(name, namespaceTemplates) && !strings.HasPrefix(name, prototypeTemplates) {
+			values = ns
+		}
+		output := strings.TrimSuffix(name, ".tmpl")
+		if strings.HasSuffix(name, ".tmpl") {
+			output += ".tf"
+		}
+
+		return renderTemplates([]*templateFile{{template: name, outputPath: output}}, values)
+	})
+	assert.NoError(t, err)
+}
+
+func TestEmbeddedTemplatesVersion(t *testing.T) {
+	assert.Equal(t, "cloud-platform-terraform-rds-instance@8.0.0 (embedded)", templates.version(rdsTemplateFilePrefix))
+	assert.Equal(t, "cloud-platform-environments@my-branch", githubTemplates("my-branch").version(namespaceTemplates))
+}
+
+func TestCreateNamespaceFromTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	err := fs.WalkDir(templateBundle, templateBundleDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := templateBundle.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, strings.TrimPrefix(p, templateBundleDir))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o644)
+	})
+	assert.NoError(t, err)
+
+	// a broken template means no files are written at all
+	rbac := filepath.Join(dir, namespaceTemplates, "01-rbac.yaml")
+	assert.NoError(t, os.WriteFile(rbac, []byte("name: {{ .Namespace"), 0o644))
+	useTemplates(t, TemplateOptions{Dir: dir})
+
+	defer func(base string) { namespaceBaseFolder = base }(namespaceBaseFolder)
+	namespaceBaseFolder = filepath.Join(t.TempDir(), "namespaces")
+
+	err = createNamespaceFiles(&Namespace{Namespace: "foo"})
+	assert.ErrorContains(t, err, "error parsing template "+namespaceTemplates+"/01-rbac.yaml")
+	assert.NoDirExists(t, namespaceBaseFolder)
+
+	assert.NoError(t, os.WriteFile(rbac, []byte("name: \"github:{{ .GithubTeam }}\"\n  bad: indent"), 0o644))
+	err = createNamespaceFiles(&Namespace{Namespace: "foo"})
+	assert.ErrorContains(t, err, "01-rbac.yaml is not valid yaml")
+	assert.NoDirExists(t, namespaceBaseFolder)
+
+	assert.NoError(t, os.WriteFile(rbac, []byte("name: \"github:{{ .GithubTeam }}\"\n"), 0o644))
+	assert.NoError(t, createNamespaceFiles(&Namespace{Namespace: "foo", GithubTeam: "webops"}))
+	assert.FileExists(t, filepath.Join(namespaceBaseFolder, "foo", "resources", "main.tf"))
+	data, err := os.ReadFile(filepath.Join(namespaceBaseFolder, "foo", "01-rbac.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name: \"github:webops\"\n", string(data))
+}
+
+func TestUseTemplates(t *testing.T) {
+	t.Cleanup(func() { templates = embeddedTemplates{} })
+
+	assert.Error(t, UseTemplates(TemplateOptions{Dir: "templates", Ref: "main"}))
+	assert.Error(t, UseTemplates(TemplateOptions{Dir: "no-such-dir"}))
+	assert.Error(t, UseTemplates(TemplateOptions{Dir: "templates.go"}))
+
+	assert.NoError(t, UseTemplates(TemplateOptions{Ref: "main"}))
+	assert.Equal(t, githubTemplates("main"), templates)
+	assert.NoError(t, UseTemplates(TemplateOptions{}))
+	assert.Equal(t, embeddedTemplates{}, templates)
+}
+
+func TestDownloadTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ecr.tf" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("module \"ecr\" {}\n"))
+	}))
+	defer server.Close()
+
+	data, err := downloadTemplate(server.URL + "/ecr.tf")
+	assert.NoError(t, err)
+	assert.Equal(t, "module \"ecr\" {}\n", string(data))
+
+	_, err = downloadTemplate(server.URL + "/missing.tf")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestGithubTemplatesOfflineFallback(t *testing.T) {
+	defer func(u string) { rawGithubUrl = u }(rawGithubUrl)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	rawGithubUrl = server.URL
+	_, err := githubTemplates("my-branch").read(rdsTemplateFilePrefix + "rds-postgresql.tf")
+	assert.ErrorContains(t, err, "404 Not Found", "a template missing at the ref isn't replaced")
+
+	// github can't be reached
+	server.Close()
+	content, err := githubTemplates("my-branch").read(rdsTemplateFilePrefix + "rds-postgresql.tf")
+	assert.NoError(t, err)
+	embedded, err := embeddedTemplates{}.read(rdsTemplateFilePrefix + "rds-postgresql.tf")
+	assert.NoError(t, err)
+	assert.Equal(t, embedded, content)
+}
+
+func TestCopyTemplateToFileRejectsInvalidOutput(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "repo"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "repo", "page.tf"), []byte("<html>Not Found</html>"), 0o644))
+	useTemplates(t, TemplateOptions{Dir: dir})
+
+	target := filepath.Join(dir, "resources", "page.tf")
+	assert.ErrorContains(t, CopyTemplateToFile("repo/page.tf", target), "is not valid terraform")
+	assert.NoFileExists(t, target)
+
+	assert.ErrorContains(t, CopyTemplateToFile("repo/missing.tf", target), "error reading template repo/missing.tf")
+}
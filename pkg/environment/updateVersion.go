@@ -1,107 +1,302 @@
 package environment
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
-	"os/exec"
-	"regexp"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/zclconf/go-cty/cty"
 )
 
-func updateVersion(moduleName, actualDbVersion, terraformDbVersion, tfDir string) ([]string, error) {
-	log.Printf("Inputs - moduleName: %s, actualDbVersion: '%s', terraformDbVersion: '%s', tfDir: %s", moduleName, actualDbVersion, terraformDbVersion, tfDir)
+// maxReferenceDepth stops a chain of locals referring to each other from looping forever.
+const maxReferenceDepth = 10
 
-	grepCmd := fmt.Sprintf("grep -l 'module \"%s\"' *.tf", moduleName)
-	cmd := exec.Command("/bin/sh", "-c", grepCmd)
-	cmd.Dir = tfDir
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to find module file: %w", err)
-	}
-	fileName := strings.TrimSpace(string(output))
-	log.Printf("Found module file: %s", fileName)
+// versionChange describes an attribute rewritten when correcting a version drift.
+type versionChange struct {
+	// File is the name of the changed file, relative to the terraform directory.
+	File string
+	// Address is where the value lives e.g. module.rds.db_engine_version or variable.db_version.default
+	Address  string
+	Old, New string
+}
+
+func (c versionChange) String() string {
+	return fmt.Sprintf("%s: %s %q -> %q", c.File, c.Address, c.Old, c.New)
+}
+
+// tfFiles holds the parsed terraform (.tf) and variable (.tfvars) files of a directory.
+// Changes are made to the parsed files in memory and only written out by writeChanged.
+type tfFiles struct {
+	dir      string
+	names    []string
+	parsed   map[string]*hclwrite.File
+	original map[string][]byte
+}
 
-	scanCmd := fmt.Sprintf("grep -A 40 'module \"%s\"' %s", moduleName, fileName)
-	log.Printf("Scanning module block: %s", scanCmd)
-	cmd = exec.Command("/bin/sh", "-c", scanCmd)
-	cmd.Dir = tfDir
-	blockBytes, err := cmd.Output()
+// loadTfFiles parses every .tf, terraform.tfvars and *.auto.tfvars file in dir.
+func loadTfFiles(dir string) (*tfFiles, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
-	moduleBlock := string(blockBytes)
 
-	lineRegex := regexp.MustCompile(`(?i)db_engine_version\s*=\s*(.+)`)
-	lineMatches := lineRegex.FindStringSubmatch(moduleBlock)
+	files := &tfFiles{dir: dir, parsed: make(map[string]*hclwrite.File), original: make(map[string][]byte)}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(filepath.Ext(name) == ".tf" || isAutoLoadedTfvars(name)) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", name, err)
+		}
 
-	dbValue := strings.TrimSpace(lineMatches[1])
-	log.Printf("Found db_engine_version value: %s", dbValue)
+		f, diags := hclwrite.ParseConfig(data, name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing %s: %s", name, diags)
+		}
 
-	var changedFiles []string
+		files.names = append(files.names, name)
+		files.parsed[name] = f
+		files.original[name] = data
+	}
+	sort.Strings(files.names)
 
-	if strings.Contains(dbValue, "var.") {
-		varName := strings.TrimSpace(strings.TrimPrefix(dbValue, "var."))
-		updated, varFile, err := updateVersionVariable(actualDbVersion, terraformDbVersion, tfDir, varName)
-		if err != nil {
-			log.Printf("[ERROR] Failed to update variable version: %v", err)
-			return nil, err
+	return files, nil
+}
+
+func isAutoLoadedTfvars(name string) bool {
+	return name == "terraform.tfvars" || strings.HasSuffix(name, ".auto.tfvars")
+}
+
+// findBlocks returns the file name and block of every top-level block of the given type and labels.
+func (t *tfFiles) findBlocks(blockType string, labels ...string) ([]string, []*hclwrite.Block) {
+	var names []string
+	var blocks []*hclwrite.Block
+	for _, name := range t.names {
+		if filepath.Ext(name) != ".tf" {
+			continue
 		}
-		if updated && varFile != "" {
-			log.Printf("Updated variable in file: %s", varFile)
-			changedFiles = append(changedFiles, varFile)
+		for _, b := range t.parsed[name].Body().Blocks() {
+			if b.Type() != blockType || !equalLabels(b.Labels(), labels) {
+				continue
+			}
+			names = append(names, name)
+			blocks = append(blocks, b)
 		}
-	} else {
-		updated, err := updateVersionHardcode(moduleName, fileName, actualDbVersion, terraformDbVersion, tfDir)
-		if err != nil {
-			log.Printf("[ERROR] Failed to update hardcoded version: %v", err)
-			return nil, err
+	}
+
+	return names, blocks
+}
+
+func equalLabels(got, want []string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
 		}
-		if updated {
-			log.Printf("Updated hardcoded version in file: %s", fileName)
-			changedFiles = append(changedFiles, fileName)
+	}
+	return true
+}
+
+// changedFiles returns the names of the files whose content has been changed in memory.
+// hclwrite formats a file when writing it out, so the original is formatted before comparing,
+// otherwise a file which isn't terraform fmt'ed would look changed even if it wasn't touched.
+func (t *tfFiles) changedFiles() []string {
+	var changed []string
+	for _, name := range t.names {
+		if !bytes.Equal(hclwrite.Format(t.original[name]), t.parsed[name].Bytes()) {
+			changed = append(changed, name)
 		}
 	}
+	return changed
+}
 
-	return changedFiles, nil
+// writeChanged writes the files changed in memory back to disk.
+func (t *tfFiles) writeChanged() error {
+	for _, name := range t.changedFiles() {
+		if err := os.WriteFile(filepath.Join(t.dir, name), t.parsed[name].Bytes(), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		t.original[name] = t.parsed[name].Bytes()
+	}
+	return nil
 }
 
-func updateVersionHardcode(moduleName, fileName, actualDbVersion, terraformDbVersion, tfDir string) (bool, error) {
-	sedCmd := fmt.Sprintf(
-		`sed -i -E '/module "%s"/,/^}/ s/"%s"/"%s"/g' %s`,
-		moduleName, terraformDbVersion, actualDbVersion, fileName,
-	)
-	log.Printf("Sed command: %s", sedCmd)
+// diff returns a unified diff of the changes made in memory, with file paths
+// relative to pathPrefix so it can be applied with git apply.
+func (t *tfFiles) diff(pathPrefix string) (string, error) {
+	var out strings.Builder
+	for _, name := range t.changedFiles() {
+		if err := writeUnifiedDiff(&out, filepath.Join(pathPrefix, name), t.original[name], t.parsed[name].Bytes()); err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
 
-	execCmd := exec.Command("/bin/sh", "-c", sedCmd)
-	execCmd.Dir = tfDir
-	if err := execCmd.Run(); err != nil {
-		log.Printf("[ERROR] Failed to update hardcoded version with sed: %v", err)
-		return false, err
+// writeUnifiedDiff writes a git style diff of the change to the file at path from before to after.
+func writeUnifiedDiff(w io.Writer, path string, before, after []byte) error {
+	path = filepath.ToSlash(path)
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        splitLines(before),
+		B:        splitLines(after),
+		FromFile: "a/" + path,
+		ToFile:   "b/" + path,
+		Context:  3,
+	})
+}
+
+// splitLines splits data after each newline. Unlike difflib.SplitLines it doesn't add an
+// empty line after the final newline, which would make the patch fail to apply.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
 	}
-	return true, nil
+	return lines
+}
+
+// attributeTarget is the attribute holding the string literal a reference resolves to.
+type attributeTarget struct {
+	file    string
+	address string
+	body    *hclwrite.Body
+	name    string
+	value   string
 }
 
-func updateVersionVariable(actualDbVersion, terraformDbVersion, tfDir, varName string) (bool, string, error) {
-	grepVarCmd := fmt.Sprintf("grep -l 'variable \"%s\"' *.tf", varName)
-	cmd := exec.Command("/bin/sh", "-c", grepVarCmd)
-	cmd.Dir = tfDir
-	varOutput, err := cmd.Output()
+// resolveAttribute follows an attribute through var. and local. references until it finds
+// the string literal that sets its value. Values in auto-loaded tfvars files take precedence
+// over variable defaults, the same as they do in terraform.
+func (t *tfFiles) resolveAttribute(file, address string, body *hclwrite.Body, name string, depth int) (*attributeTarget, error) {
+	if depth > maxReferenceDepth {
+		return nil, fmt.Errorf("too many references followed resolving %s", address)
+	}
+
+	attr := body.GetAttribute(name)
+	if attr == nil {
+		return nil, fmt.Errorf("%s is not set in %s", address, file)
+	}
+
+	src := attr.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, file, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("error parsing %s in %s: %s", address, file, diags)
+	}
+
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if !e.IsStringLiteral() {
+			return nil, fmt.Errorf("%s in %s is an interpolated string %s, it can't be updated automatically", address, file, strings.TrimSpace(string(src)))
+		}
+		val, _ := e.Value(nil)
+		return &attributeTarget{file: file, address: address, body: body, name: name, value: val.AsString()}, nil
+
+	case *hclsyntax.ScopeTraversalExpr:
+		if len(e.Traversal) != 2 {
+			break
+		}
+		step, ok := e.Traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			break
+		}
+
+		switch e.Traversal.RootName() {
+		case "var":
+			return t.resolveVariable(step.Name, depth+1)
+		case "local":
+			return t.resolveLocal(step.Name, depth+1)
+		}
+	}
+
+	return nil, fmt.Errorf("%s in %s is set to %s, only string literals, var. and local. references are supported", address, file, strings.TrimSpace(string(src)))
+}
+
+func (t *tfFiles) resolveVariable(varName string, depth int) (*attributeTarget, error) {
+	// the last tfvars file to set a variable wins, as auto.tfvars are loaded in lexical order
+	var tfvarsFile string
+	for _, name := range t.names {
+		if isAutoLoadedTfvars(name) && t.parsed[name].Body().GetAttribute(varName) != nil {
+			tfvarsFile = name
+		}
+	}
+	if tfvarsFile != "" {
+		return t.resolveAttribute(tfvarsFile, varName, t.parsed[tfvarsFile].Body(), varName, depth)
+	}
+
+	files, blocks := t.findBlocks("variable", varName)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("variable %q is not declared in %s", varName, t.dir)
+	}
+	if len(blocks) > 1 {
+		return nil, fmt.Errorf("variable %q is declared more than once in %s: %s", varName, t.dir, strings.Join(files, ", "))
+	}
+
+	return t.resolveAttribute(files[0], "variable."+varName+".default", blocks[0].Body(), "default", depth)
+}
+
+func (t *tfFiles) resolveLocal(localName string, depth int) (*attributeTarget, error) {
+	files, blocks := t.findBlocks("locals")
+	for i, b := range blocks {
+		if b.Body().GetAttribute(localName) != nil {
+			return t.resolveAttribute(files[i], "local."+localName, b.Body(), localName, depth)
+		}
+	}
+
+	return nil, fmt.Errorf("local %q is not defined in %s", localName, t.dir)
+}
+
+// updateVersion finds the version attribute of the module moduleName, e.g. db_engine_version,
+// follows it through variables and locals to where the version is set, and rewrites it in
+// memory from terraformDbVersion to actualDbVersion. It returns the change made, so the caller
+// can report it and knows which file to commit.
+func (t *tfFiles) updateVersion(moduleName, attribute, actualDbVersion, terraformDbVersion string) ([]versionChange, error) {
+	log.Printf("Inputs - moduleName: %s, attribute: %s, actualDbVersion: '%s', terraformDbVersion: '%s', tfDir: %s", moduleName, attribute, actualDbVersion, terraformDbVersion, t.dir)
+
+	names, blocks := t.findBlocks("module", moduleName)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("module %q not found in %s", moduleName, t.dir)
+	}
+	if len(blocks) > 1 {
+		return nil, fmt.Errorf("module %q is declared more than once in %s: %s", moduleName, t.dir, strings.Join(names, ", "))
+	}
+	log.Printf("Found module %s in file: %s", moduleName, names[0])
+
+	target, err := t.resolveAttribute(names[0], "module."+moduleName+"."+attribute, blocks[0].Body(), attribute, 0)
 	if err != nil {
-		return false, "", fmt.Errorf("failed to find variable definition for %s: %w", varName, err)
+		return nil, err
 	}
-	varFile := strings.TrimSpace(string(varOutput))
 
-	varSedCmd := fmt.Sprintf(
-		"sed -i -E 's/default[[:space:]]*=[[:space:]]*\"%s\"/default = \"%s\"/' %s",
-		terraformDbVersion, actualDbVersion, varFile)
-	log.Printf("Sed command for variable update: %s", varSedCmd)
+	// several modules can share a variable, so it may already have been updated for another module
+	if target.value == actualDbVersion {
+		log.Printf("%s in %s is already %q", target.address, target.file, actualDbVersion)
+		return nil, nil
+	}
 
-	cmd = exec.Command("/bin/sh", "-c", varSedCmd)
-	cmd.Dir = tfDir
-	if err := cmd.Run(); err != nil {
-		log.Printf("[ERROR] Failed to update default value in variable file: %v", err)
-		return false, "", fmt.Errorf("failed to update variable default: %w", err)
+	if target.value != terraformDbVersion {
+		return nil, fmt.Errorf("%s in %s is %q, expected %q", target.address, target.file, target.value, terraformDbVersion)
 	}
 
-	return true, varFile, nil
+	target.body.SetAttributeValue(target.name, cty.StringVal(actualDbVersion))
+
+	change := versionChange{File: target.file, Address: target.address, Old: terraformDbVersion, New: actualDbVersion}
+	log.Printf("Updated %s", change)
+
+	return []versionChange{change}, nil
 }
@@ -0,0 +1,203 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTfFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestUpdateVersion(t *testing.T) {
+	longModule := "module \"rds\" {\n  source = \"github.com/ministryofjustice/cloud-platform-terraform-rds-instance?ref=8.0.0\"\n" +
+		strings.Repeat("  # padding\n", 50) +
+		"  db_engine_version = \"14.7\"\n}\n"
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantChange []versionChange
+		wantFile   string
+		wantText   string
+		wantErr    string
+	}{
+		{
+			name: "hardcoded version in a long module block",
+			files: map[string]string{
+				"rds.tf": longModule,
+			},
+			wantChange: []versionChange{{File: "rds.tf", Address: "module.rds.db_engine_version", Old: "14.7", New: "14.13"}},
+			wantFile:   "rds.tf",
+			wantText:   `db_engine_version = "14.13"`,
+		},
+		{
+			name: "version set by a variable default",
+			files: map[string]string{
+				"rds.tf":       "module \"rds\" {\n  db_engine_version = var.db_version\n}\n",
+				"variables.tf": "variable \"db_version\" {\n  type    = string\n  default = \"14.7\"\n}\n",
+			},
+			wantChange: []versionChange{{File: "variables.tf", Address: "variable.db_version.default", Old: "14.7", New: "14.13"}},
+			wantFile:   "variables.tf",
+			wantText:   `default = "14.13"`,
+		},
+		{
+			name: "version set in tfvars overrides the variable default",
+			files: map[string]string{
+				"rds.tf":           "module \"rds\" {\n  db_engine_version = var.db_version\n}\n",
+				"variables.tf":     "variable \"db_version\" {\n  default = \"13.1\"\n}\n",
+				"terraform.tfvars": "db_version = \"14.7\"\n",
+			},
+			wantChange: []versionChange{{File: "terraform.tfvars", Address: "db_version", Old: "14.7", New: "14.13"}},
+			wantFile:   "terraform.tfvars",
+			wantText:   `db_version = "14.13"`,
+		},
+		{
+			name: "version set through a local referring to a variable",
+			files: map[string]string{
+				"rds.tf":    "module \"rds\" {\n  db_engine_version = local.db_version\n}\n",
+				"locals.tf": "locals {\n  db_version = var.db_version\n}\n\nvariable \"db_version\" {\n  default = \"14.7\"\n}\n",
+			},
+			wantChange: []versionChange{{File: "locals.tf", Address: "variable.db_version.default", Old: "14.7", New: "14.13"}},
+			wantFile:   "locals.tf",
+			wantText:   `default = "14.13"`,
+		},
+		{
+			name: "version already updated through a shared variable",
+			files: map[string]string{
+				"rds.tf": "module \"rds\" {\n  db_engine_version = \"14.13\"\n}\n",
+			},
+		},
+		{
+			name: "module not found",
+			files: map[string]string{
+				"rds.tf": "module \"rds_2\" {\n  db_engine_version = \"14.7\"\n}\n",
+			},
+			wantErr: `module "rds" not found`,
+		},
+		{
+			name: "module declared in two files",
+			files: map[string]string{
+				"a.tf": "module \"rds\" {\n  db_engine_version = \"14.7\"\n}\n",
+				"b.tf": "module \"rds\" {\n  db_engine_version = \"14.7\"\n}\n",
+			},
+			wantErr: "declared more than once",
+		},
+		{
+			name: "module without db_engine_version",
+			files: map[string]string{
+				"rds.tf": "module \"rds\" {\n  source = \"foo\"\n}\n",
+			},
+			wantErr: "module.rds.db_engine_version is not set in rds.tf",
+		},
+		{
+			name: "unexpected current version",
+			files: map[string]string{
+				"rds.tf": "module \"rds\" {\n  db_engine_version = \"12.1\"\n}\n",
+			},
+			wantErr: `is "12.1", expected "14.7"`,
+		},
+		{
+			name: "unsupported expression",
+			files: map[string]string{
+				"rds.tf": "module \"rds\" {\n  db_engine_version = lookup(var.versions, \"rds\")\n}\n",
+			},
+			wantErr: "only string literals",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTfFiles(t, tt.files)
+
+			files, err := loadTfFiles(dir)
+			assert.NoError(t, err)
+
+			changes, err := files.updateVersion("rds", "db_engine_version", "14.13", "14.7")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantChange, changes)
+			assert.NoError(t, files.writeChanged())
+
+			if tt.wantFile != "" {
+				data, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+				assert.NoError(t, err)
+				assert.Contains(t, string(data), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestTfFilesDiff(t *testing.T) {
+	dir := writeTfFiles(t, map[string]string{
+		"rds.tf":       "module \"rds\" {\n  db_engine_version = var.db_version\n}\n",
+		"variables.tf": "variable \"db_version\" {\n  default = \"14.7\"\n}\n",
+	})
+
+	files, err := loadTfFiles(dir)
+	assert.NoError(t, err)
+	_, err = files.updateVersion("rds", "db_engine_version", "14.13", "14.7")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"variables.tf"}, files.changedFiles())
+
+	patch, err := files.diff("namespaces/live/foo/resources")
+	assert.NoError(t, err)
+	assert.Equal(t, `--- a/namespaces/live/foo/resources/variables.tf
++++ b/namespaces/live/foo/resources/variables.tf
+@@ -1,3 +1,3 @@
+ variable "db_version" {
+-  default = "14.7"
++  default = "14.13"
+ }
+`, patch)
+
+	// nothing is written to disk until writeChanged is called
+	data, err := os.ReadFile(filepath.Join(dir, "variables.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `default = "14.7"`)
+
+	assert.NoError(t, files.writeChanged())
+	assert.Empty(t, files.changedFiles())
+	data, err = os.ReadFile(filepath.Join(dir, "variables.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `default = "14.13"`)
+}
+
+func TestWriteNamespacePatch(t *testing.T) {
+	dir := writeTfFiles(t, map[string]string{
+		"rds.tf": "module \"rds\" {\n  db_engine_version = \"14.7\"\n}\n",
+	})
+
+	files, err := loadTfFiles(dir)
+	assert.NoError(t, err)
+	_, err = files.updateVersion("rds", "db_engine_version", "14.13", "14.7")
+	assert.NoError(t, err)
+
+	patchDir := filepath.Join(t.TempDir(), "patches")
+	patchFile, err := writeNamespacePatch(files, "foo", patchDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(patchDir, "foo.patch"), patchFile)
+
+	patch, err := os.ReadFile(patchFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(patch), `+  db_engine_version = "14.13"`)
+
+	// the terraform itself is left untouched
+	data, err := os.ReadFile(filepath.Join(dir, "rds.tf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `db_engine_version = "14.7"`)
+}
@@ -12,22 +12,36 @@ type userQuestion struct {
 	prompt      string
 	value       string
 	validator   questionValidator
+	// defaultValue is the answer when nothing is entered.
+	defaultValue string
+	// optional questions are asked even though an empty answer is valid.
+	optional bool
 }
 
 func (q *userQuestion) getAnswer() error {
 	fmt.Println("")
 	fmt.Println(q.description)
 
+	// questions with a default, or which are optional, are always asked
+	answered := q.defaultValue == "" && !q.optional
 	for {
-		if q.validator.isValid(q.value) {
+		if (answered || q.value != "") && q.validator.isValid(q.value) {
 			break
 		}
 
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Printf("%s: ", q.prompt)
+		if q.defaultValue != "" {
+			fmt.Printf("%s [%s]: ", q.prompt, q.defaultValue)
+		} else {
+			fmt.Printf("%s: ", q.prompt)
+		}
 		input, _ := reader.ReadString('\n')
 
 		q.value = strings.TrimSpace(input)
+		if q.value == "" {
+			q.value = q.defaultValue
+		}
+		answered = true
 	}
 	return nil
 }
@@ -0,0 +1,308 @@
+package environment
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// yamlEditor changes the values of a yaml file by splicing them into its text, at the positions
+// yaml.v3 parsed them from, so the rest of the file, including any other documents, comments
+// and blank lines, is left byte for byte as it was.
+type yamlEditor struct {
+	data []byte
+	// lines are the offsets of the start of each line of data.
+	lines []int
+	edits []yamlEdit
+	added map[*yamlv3.Node]*yamlAdditions
+	order []*yamlv3.Node
+}
+
+// yamlEdit replaces data[start:end] with text.
+type yamlEdit struct {
+	start, end int
+	text       string
+}
+
+// yamlAdditions are the entries added to a mapping of the file, which are written after its
+// last entry.
+type yamlAdditions struct {
+	offset int
+	indent int
+	pairs  []*yamlv3.Node
+}
+
+func newYamlEditor(data []byte) *yamlEditor {
+	e := &yamlEditor{data: data, lines: []int{0}, added: map[*yamlv3.Node]*yamlAdditions{}}
+	for i, c := range data {
+		if c == '\n' {
+			e.lines = append(e.lines, i+1)
+		}
+	}
+	return e
+}
+
+// mapping returns the value of key in a block mapping, adding an empty mapping if it isn't
+// there. Empty mappings which are added aren't written.
+func (e *yamlEditor) mapping(m *yamlv3.Node, key string) (*yamlv3.Node, error) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != key {
+			continue
+		}
+		value := m.Content[i+1]
+		if value.Kind != yamlv3.MappingNode || value.Style&yamlv3.FlowStyle != 0 {
+			return nil, fmt.Errorf("%s on line %d isn't a block mapping", key, m.Content[i].Line)
+		}
+		return value, nil
+	}
+
+	value := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	if err := e.add(m, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// set sets key in a block mapping to a string, removing it if the string is empty. Changed
+// values keep their quotes, and new or unquoted values are double quoted, like the rest of
+// 00-namespace.yaml.
+func (e *yamlEditor) set(m *yamlv3.Node, key, value string) error {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if k.Value != key {
+			continue
+		}
+		if v.Kind == yamlv3.ScalarNode && v.Value == value {
+			return nil
+		}
+		if v.Line == 0 && value != "" {
+			// added by the editor, so it isn't in the text yet
+			v.Value = value
+			return nil
+		}
+
+		if value == "" {
+			last, err := e.lastLine(v)
+			if err != nil {
+				return err
+			}
+			e.edits = append(e.edits, yamlEdit{start: e.lines[k.Line-1], end: e.lineAfter(last)})
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return nil
+		}
+
+		start, end, err := e.scalarSpan(v)
+		if err != nil {
+			return err
+		}
+		style := v.Style &^ yamlv3.TaggedStyle
+		if style == 0 {
+			style = yamlv3.DoubleQuotedStyle
+		}
+		text, err := yamlScalar(value, style)
+		if err != nil {
+			return err
+		}
+		e.edits = append(e.edits, yamlEdit{start: start, end: end, text: text})
+		v.Value = value
+		return nil
+	}
+
+	if value == "" {
+		return nil
+	}
+	return e.add(m,
+		&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key},
+		&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value, Style: yamlv3.DoubleQuotedStyle})
+}
+
+// add adds an entry to a mapping. Entries of mappings which were parsed from the file are
+// written after their last entry, and mappings added by the editor are written with them.
+func (e *yamlEditor) add(m *yamlv3.Node, key, value *yamlv3.Node) error {
+	if m.Line > 0 {
+		a, ok := e.added[m]
+		if !ok {
+			if len(m.Content) == 0 {
+				return fmt.Errorf("can't add %s to the empty mapping on line %d", key.Value, m.Line)
+			}
+			last, err := e.lastLine(m)
+			if err != nil {
+				return err
+			}
+			a = &yamlAdditions{offset: e.lineAfter(last), indent: m.Content[0].Column - 1}
+			e.added[m] = a
+			e.order = append(e.order, m)
+		}
+		a.pairs = append(a.pairs, key, value)
+	}
+	m.Content = append(m.Content, key, value)
+	return nil
+}
+
+// output returns the text of the file with the edits made.
+func (e *yamlEditor) output() ([]byte, error) {
+	edits := e.edits
+	// entries added to nested mappings go before those added to their parents
+	order := append([]*yamlv3.Node{}, e.order...)
+	sort.SliceStable(order, func(i, j int) bool { return e.added[order[i]].indent > e.added[order[j]].indent })
+	for _, m := range order {
+		a := e.added[m]
+		text, err := yamlEntries(a.pairs, a.indent)
+		if err != nil {
+			return nil, err
+		}
+		if text == "" {
+			continue
+		}
+		if a.offset == len(e.data) && len(e.data) > 0 && e.data[len(e.data)-1] != '\n' {
+			text = "\n" + text
+		}
+		edits = append(edits, yamlEdit{start: a.offset, end: a.offset, text: text})
+	}
+	// an insertion at the start of a removed line goes before the removal
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end < edits[j].end
+	})
+
+	var b bytes.Buffer
+	pos := 0
+	for _, edit := range edits {
+		b.Write(e.data[pos:edit.start])
+		b.WriteString(edit.text)
+		pos = edit.end
+	}
+	b.Write(e.data[pos:])
+	return b.Bytes(), nil
+}
+
+// offset returns the offset in the text of a node parsed from it.
+func (e *yamlEditor) offset(n *yamlv3.Node) int {
+	i := e.lines[n.Line-1]
+	// yaml.v3 counts columns in characters
+	for col := 1; col < n.Column && i < len(e.data); col++ {
+		_, size := utf8.DecodeRune(e.data[i:])
+		i += size
+	}
+	return i
+}
+
+// lineAfter returns the offset of the start of the line after line, which is the end of the
+// text for the last line.
+func (e *yamlEditor) lineAfter(line int) int {
+	if line < len(e.lines) {
+		return e.lines[line]
+	}
+	return len(e.data)
+}
+
+// scalarSpan returns where a scalar which is on a single line starts and ends in the text.
+func (e *yamlEditor) scalarSpan(n *yamlv3.Node) (int, int, error) {
+	start := e.offset(n)
+	line := e.data[start:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	end := -1
+	switch {
+	case n.Kind != yamlv3.ScalarNode:
+	case n.Style&yamlv3.DoubleQuotedStyle != 0 && bytes.HasPrefix(line, []byte(`"`)):
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	case n.Style&yamlv3.SingleQuotedStyle != 0 && bytes.HasPrefix(line, []byte(`'`)):
+		for i := 1; i < len(line); i++ {
+			if line[i] != '\'' {
+				continue
+			}
+			if i+1 < len(line) && line[i+1] == '\'' {
+				i++
+				continue
+			}
+			end = i + 1
+			break
+		}
+	case n.Style == 0 && n.Value != "" && bytes.HasPrefix(line, []byte(n.Value)):
+		end = len(n.Value)
+	}
+	if end < 0 {
+		return 0, 0, fmt.Errorf("the value on line %d can't be changed in place, it isn't a string on a single line", n.Line)
+	}
+	return start, start + end, nil
+}
+
+// lastLine returns the last line of the text a node was parsed from.
+func (e *yamlEditor) lastLine(n *yamlv3.Node) (int, error) {
+	switch {
+	case n.Kind == yamlv3.AliasNode, n.Kind == yamlv3.ScalarNode && n.Tag == "!!null":
+		return n.Line, nil
+	case n.Kind == yamlv3.ScalarNode:
+		if _, _, err := e.scalarSpan(n); err != nil {
+			return 0, err
+		}
+		return n.Line, nil
+	case n.Style&yamlv3.FlowStyle != 0:
+		return 0, fmt.Errorf("the value on line %d can't be changed in place, it's written inline", n.Line)
+	case len(n.Content) == 0:
+		return n.Line, nil
+	}
+	return e.lastLine(n.Content[len(n.Content)-1])
+}
+
+// yamlScalar returns how a string is written in a given style.
+func yamlScalar(value string, style yamlv3.Style) (string, error) {
+	data, err := yamlv3.Marshal(&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value, Style: style})
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if strings.Contains(text, "\n") {
+		return "", fmt.Errorf("%q can't be written on a single line", value)
+	}
+	return text, nil
+}
+
+// yamlEntries returns the lines of the entries of a mapping, indented by indent spaces. Empty
+// mappings are left out.
+func yamlEntries(pairs []*yamlv3.Node, indent int) (string, error) {
+	m := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1].Kind == yamlv3.MappingNode && len(pairs[i+1].Content) == 0 {
+			continue
+		}
+		m.Content = append(m.Content, pairs[i], pairs[i+1])
+	}
+	if len(m.Content) == 0 {
+		return "", nil
+	}
+
+	var b bytes.Buffer
+	enc := yamlv3.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(m); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, line := range strings.SplitAfter(b.String(), "\n") {
+		if line != "" {
+			text.WriteString(strings.Repeat(" ", indent) + line)
+		}
+	}
+	return text.String(), nil
+}
@@ -3,6 +3,8 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -18,6 +20,7 @@ type GithubPullRequestsService interface {
 	IsMerged(ctx context.Context, owner string, repo string, number int) (bool, *github.Response, error)
 	Create(ctx context.Context, owner string, repo string, pr *github.NewPullRequest) (*github.PullRequest, *github.Response, error)
 	List(ctx context.Context, owner string, repo string, opts *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error)
+	RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error)
 }
 
 // GithubClient for handling requests to the Github V3 and V4 APIs.
@@ -39,8 +42,10 @@ type GithubClientConfig struct {
 // https://developer.github.com/v4/object/pullrequest/
 type Nodes struct {
 	PullRequest struct {
-		Title githubv4.String
-		Url   githubv4.String
+		Number   githubv4.Int
+		Title    githubv4.String
+		Url      githubv4.String
+		MergedAt githubv4.DateTime
 	} `graphql:"... on PullRequest"`
 }
 
@@ -70,7 +75,7 @@ func (gh *GithubClient) ListMergedPRs(date util.Date, count int) ([]Nodes, error
 			Nodes []Nodes
 		} `graphql:"search(first: $count, query: $searchQuery, type: ISSUE)"`
 	}
-	fmt.Printf("Searching Merged PRs from %s to %s\n", date.Last, date.First)
+	fmt.Fprintf(os.Stderr, "Searching Merged PRs from %s to %s\n", date.Last, date.First)
 	variables := map[string]interface{}{
 		"searchQuery": githubv4.String(
 			fmt.Sprintf(`repo:%s/%s is:pr is:closed merged:%s..%s`,
@@ -86,18 +91,28 @@ func (gh *GithubClient) ListMergedPRs(date util.Date, count int) ([]Nodes, error
 	return query.Search.Nodes, nil
 }
 
+// GetChangedFiles returns every file changed in a PR, following the pages of the files api so
+// PRs touching more than a hundred files are reported in full.
 func (gh *GithubClient) GetChangedFiles(prNumber int) ([]*github.CommitFile, error) {
-	repos, _, err := gh.PullRequests.ListFiles(
-		context.Background(),
-		gh.Owner,
-		gh.Repository,
-		prNumber,
-		&github.ListOptions{PerPage: 100})
-	if err != nil {
-		return nil, err
-	}
+	opts := &github.ListOptions{PerPage: 100}
+	var files []*github.CommitFile
+	for {
+		page, resp, err := gh.PullRequests.ListFiles(
+			context.Background(),
+			gh.Owner,
+			gh.Repository,
+			prNumber,
+			opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
 
-	return repos, nil
+		if resp == nil || resp.NextPage == 0 {
+			return files, nil
+		}
+		opts.Page = resp.NextPage
+	}
 }
 
 func (gh *GithubClient) IsMerged(prNumber int) (bool, error) {
@@ -109,9 +124,11 @@ func (gh *GithubClient) IsMerged(prNumber int) (bool, error) {
 	return merged, nil
 }
 
-func (gh *GithubClient) CreatePR(branchName, namespace, description string) (string, error) {
+// CreatePR raises a PR from branchName into main of the environments repository, and asks the
+// given Github teams to review it.
+func (gh *GithubClient) CreatePR(branchName, title, description string, teamReviewers []string) (string, error) {
 	newPR := &github.NewPullRequest{
-		Title:               github.String("Fix: rds version mismatch in " + namespace),
+		Title:               github.String(title),
 		Head:                github.String("ministryofjustice:" + branchName),
 		Base:                github.String("main"),
 		Body:                github.String(description),
@@ -124,10 +141,21 @@ func (gh *GithubClient) CreatePR(branchName, namespace, description string) (str
 	}
 
 	fmt.Printf("PR created: %s\n", pr.GetHTMLURL())
+
+	if len(teamReviewers) > 0 {
+		// the PR is still useful without reviewers, so don't fail because of them
+		_, _, err := gh.PullRequests.RequestReviewers(context.TODO(), "ministryofjustice", "cloud-platform-environments", pr.GetNumber(), github.ReviewersRequest{TeamReviewers: teamReviewers})
+		if err != nil {
+			fmt.Printf("Warning: failed to request reviews from %s on %s: %v\n", strings.Join(teamReviewers, ", "), pr.GetHTMLURL(), err)
+		}
+	}
+
 	return pr.GetHTMLURL(), nil
 }
 
-func (gh *GithubClient) ListOpenPRs(namespace string) ([]*github.PullRequest, error) {
+// ListOpenPRs returns the open PRs in the environments repository whose title contains title,
+// ignoring case.
+func (gh *GithubClient) ListOpenPRs(title string) ([]*github.PullRequest, error) {
 	listOpts := &github.ListOptions{PerPage: 100, Page: 0}
 	opts := &github.PullRequestListOptions{
 		State:       "open",
@@ -159,7 +187,7 @@ func (gh *GithubClient) ListOpenPRs(namespace string) ([]*github.PullRequest, er
 	}
 
 	for _, pr := range allOpenPrs {
-		if strings.Contains(*pr.Title, "Fix: rds version mismatch in "+namespace) {
+		if strings.Contains(strings.ToLower(pr.GetTitle()), strings.ToLower(title)) {
 			matchedOpenPRs = append(matchedOpenPRs, pr)
 		}
 	}
@@ -182,3 +210,80 @@ func (gh *GithubClient) CreateComment(prNumber int, body string) error {
 
 	return err
 }
+
+// GetLatestRelease returns the tag of the latest published release of a repository.
+func (gh *GithubClient) GetLatestRelease(owner, repo string) (string, error) {
+	release, _, err := gh.V3.Repositories.GetLatestRelease(context.TODO(), owner, repo)
+	if err != nil {
+		return "", err
+	}
+
+	return release.GetTagName(), nil
+}
+
+// ListReleases returns every release of a repository, newest first.
+func (gh *GithubClient) ListReleases(owner, repo string) ([]*github.RepositoryRelease, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var releases []*github.RepositoryRelease
+	for {
+		page, resp, err := gh.V3.Repositories.ListReleases(context.TODO(), owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, page...)
+
+		if resp.NextPage == 0 {
+			return releases, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// ListTeams returns the slug of every team in an organisation.
+func (gh *GithubClient) ListTeams(org string) ([]string, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var teams []string
+	for {
+		page, resp, err := gh.V3.Teams.ListTeams(context.TODO(), org, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			teams = append(teams, t.GetSlug())
+		}
+
+		if resp.NextPage == 0 {
+			return teams, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// RepositoryExists returns whether a repository exists, a private repository the token can't
+// see is reported as not existing.
+func (gh *GithubClient) RepositoryExists(owner, repo string) (bool, error) {
+	_, resp, err := gh.V3.Repositories.Get(context.TODO(), owner, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SearchRepositories returns the full names of the first page of repositories matching a
+// search query, e.g. "myapp in:name org:ministryofjustice".
+func (gh *GithubClient) SearchRepositories(query string) ([]string, error) {
+	result, _, err := gh.V3.Search.Repositories(context.TODO(), query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result.Repositories))
+	for _, r := range result.Repositories {
+		names = append(names, r.GetFullName())
+	}
+	return names, nil
+}
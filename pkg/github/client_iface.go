@@ -13,7 +13,12 @@ type GithubIface interface {
 	ListMergedPRs(date util.Date, count int) ([]Nodes, error)
 	GetChangedFiles(int) ([]*github.CommitFile, error)
 	IsMerged(prNumber int) (bool, error)
-	CreatePR(branchName, namespace, description string) (string, error)
-	ListOpenPRs(namespace string) ([]*github.PullRequest, error)
+	CreatePR(branchName, title, description string, teamReviewers []string) (string, error)
+	ListOpenPRs(title string) ([]*github.PullRequest, error)
 	CreateComment(prNumber int, body string) error
+	GetLatestRelease(owner, repo string) (string, error)
+	ListReleases(owner, repo string) ([]*github.RepositoryRelease, error)
+	ListTeams(org string) ([]string, error)
+	RepositoryExists(owner, repo string) (bool, error)
+	SearchRepositories(query string) ([]string, error)
 }
@@ -2,6 +2,10 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 
@@ -11,11 +15,24 @@ import (
 
 type mockGithub struct {
 	resp   []*github.CommitFile
+	pages  [][]*github.CommitFile
 	merged bool
 }
 
 func (m *mockGithub) ListFiles(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
-	return m.resp, nil, nil
+	if m.pages == nil {
+		return m.resp, nil, nil
+	}
+
+	page := opt.Page
+	if page == 0 {
+		page = 1
+	}
+	resp := &github.Response{}
+	if page < len(m.pages) {
+		resp.NextPage = page + 1
+	}
+	return m.pages[page-1], resp, nil
 }
 
 func (m *mockGithub) IsMerged(ctx context.Context, owner string, repo string, number int) (bool, *github.Response, error) {
@@ -30,6 +47,10 @@ func (m *mockGithub) List(ctx context.Context, owner, repo string, opts *github.
 	return nil, nil, nil
 }
 
+func (m *mockGithub) RequestReviewers(ctx context.Context, owner, repo string, number int, reviewers github.ReviewersRequest) (*github.PullRequest, *github.Response, error) {
+	return nil, nil, nil
+}
+
 func TestNewGithubClient(t *testing.T) {
 	type args struct {
 		config *GithubClientConfig
@@ -94,6 +115,28 @@ func TestGithubClient_GetChangedFiles(t *testing.T) {
 	}
 }
 
+func TestGithubClient_GetChangedFilesPaged(t *testing.T) {
+	var first, second []*github.CommitFile
+	for i := 0; i < 100; i++ {
+		first = append(first, &github.CommitFile{Filename: github.String(fmt.Sprintf("namespaces/live.cloud-platform.service.justice.gov.uk/ns%d/main.tf", i))})
+	}
+	second = append(second, &github.CommitFile{Filename: github.String("namespaces/live.cloud-platform.service.justice.gov.uk/last/main.tf")})
+
+	gh := &GithubClient{
+		PullRequests: &mockGithub{pages: [][]*github.CommitFile{first, second}},
+	}
+	got, err := gh.GetChangedFiles(8344)
+	if err != nil {
+		t.Fatalf("GithubClient.GetChangedFiles() error = %v", err)
+	}
+	if len(got) != 101 {
+		t.Errorf("GithubClient.GetChangedFiles() returned %d files, want 101", len(got))
+	}
+	if got[100].GetFilename() != "namespaces/live.cloud-platform.service.justice.gov.uk/last/main.tf" {
+		t.Errorf("GithubClient.GetChangedFiles() last file = %s", got[100].GetFilename())
+	}
+}
+
 func TestGithubClient_IsMerged(t *testing.T) {
 	mc := &mockGithub{
 		merged: true,
@@ -110,3 +153,53 @@ func TestGithubClient_IsMerged(t *testing.T) {
 		t.Errorf("GithubClient.IsMerged() = %v, want %v", got, true)
 	}
 }
+
+func testV3Client(t *testing.T, handler http.HandlerFunc) *GithubClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	v3 := github.NewClient(server.Client())
+	v3.BaseURL, _ = url.Parse(server.URL + "/")
+	return &GithubClient{V3: v3}
+}
+
+func TestGithubClient_ListTeams(t *testing.T) {
+	gh := testV3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/ministryofjustice/teams", r.URL.Path)
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"slug": "webops"}]`)
+			return
+		}
+		w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+		fmt.Fprint(w, `[{"slug": "laa-crime"}]`)
+	})
+
+	teams, err := gh.ListTeams("ministryofjustice")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"laa-crime", "webops"}, teams)
+}
+
+func TestGithubClient_RepositoryExists(t *testing.T) {
+	gh := testV3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/ministryofjustice/myapp":
+			fmt.Fprint(w, `{"full_name": "ministryofjustice/myapp"}`)
+		case "/repos/ministryofjustice/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	exists, err := gh.RepositoryExists("ministryofjustice", "myapp")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = gh.RepositoryExists("ministryofjustice", "missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = gh.RepositoryExists("ministryofjustice", "broken")
+	assert.Error(t, err)
+}
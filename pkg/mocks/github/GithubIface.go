@@ -16,6 +16,41 @@ type GithubIface struct {
 	mock.Mock
 }
 
+// CreateComment provides a mock function with given fields: prNumber, body
+func (_m *GithubIface) CreateComment(prNumber int, body string) error {
+	ret := _m.Called(prNumber, body)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string) error); ok {
+		r0 = rf(prNumber, body)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreatePR provides a mock function with given fields: branchName, title, description, teamReviewers
+func (_m *GithubIface) CreatePR(branchName string, title string, description string, teamReviewers []string) (string, error) {
+	ret := _m.Called(branchName, title, description, teamReviewers)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, string, []string) string); ok {
+		r0 = rf(branchName, title, description, teamReviewers)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string, []string) error); ok {
+		r1 = rf(branchName, title, description, teamReviewers)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetChangedFiles provides a mock function with given fields: _a0
 func (_m *GithubIface) GetChangedFiles(_a0 int) ([]*github.CommitFile, error) {
 	ret := _m.Called(_a0)
@@ -39,6 +74,27 @@ func (_m *GithubIface) GetChangedFiles(_a0 int) ([]*github.CommitFile, error) {
 	return r0, r1
 }
 
+// GetLatestRelease provides a mock function with given fields: owner, repo
+func (_m *GithubIface) GetLatestRelease(owner string, repo string) (string, error) {
+	ret := _m.Called(owner, repo)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(owner, repo)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(owner, repo)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // IsMerged provides a mock function with given fields: prNumber
 func (_m *GithubIface) IsMerged(prNumber int) (bool, error) {
 	ret := _m.Called(prNumber)
@@ -83,6 +139,119 @@ func (_m *GithubIface) ListMergedPRs(date util.Date, count int) ([]pkggithub.Nod
 	return r0, r1
 }
 
+// ListOpenPRs provides a mock function with given fields: title
+func (_m *GithubIface) ListOpenPRs(title string) ([]*github.PullRequest, error) {
+	ret := _m.Called(title)
+
+	var r0 []*github.PullRequest
+	if rf, ok := ret.Get(0).(func(string) []*github.PullRequest); ok {
+		r0 = rf(title)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.PullRequest)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(title)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListReleases provides a mock function with given fields: owner, repo
+func (_m *GithubIface) ListReleases(owner string, repo string) ([]*github.RepositoryRelease, error) {
+	ret := _m.Called(owner, repo)
+
+	var r0 []*github.RepositoryRelease
+	if rf, ok := ret.Get(0).(func(string, string) []*github.RepositoryRelease); ok {
+		r0 = rf(owner, repo)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*github.RepositoryRelease)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(owner, repo)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTeams provides a mock function with given fields: org
+func (_m *GithubIface) ListTeams(org string) ([]string, error) {
+	ret := _m.Called(org)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(org)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(org)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RepositoryExists provides a mock function with given fields: owner, repo
+func (_m *GithubIface) RepositoryExists(owner string, repo string) (bool, error) {
+	ret := _m.Called(owner, repo)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(owner, repo)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(owner, repo)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchRepositories provides a mock function with given fields: query
+func (_m *GithubIface) SearchRepositories(query string) ([]string, error) {
+	ret := _m.Called(query)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewGithubIface interface {
 	mock.TestingT
 	Cleanup(func())
@@ -10,7 +10,7 @@ import (
 )
 
 const (
-	prototypeResourcesUrl = "https://raw.githubusercontent.com/ministryofjustice/cloud-platform-environments/main/namespace-resources-cli-template/resources/prototype"
+	prototypeTemplates = "cloud-platform-environments/namespace-resources-cli-template/resources/prototype"
 )
 
 func CreateDeploymentPrototype(skipDockerFiles bool) error {
@@ -66,15 +66,15 @@ on slack.
 
 func createPrototypeDeploymentFiles(branch string, skipDockerFiles bool) error {
 	if !skipDockerFiles {
-		err := environment.CopyUrlToFile(prototypeResourcesUrl+"/build"+"/Dockerfile", "Dockerfile")
+		err := environment.CopyTemplateToFile(prototypeTemplates+"/build"+"/Dockerfile", "Dockerfile")
 		if err != nil {
 			return err
 		}
-		err = environment.CopyUrlToFile(prototypeResourcesUrl+"/build"+"/.dockerignore", ".dockerignore")
+		err = environment.CopyTemplateToFile(prototypeTemplates+"/build"+"/.dockerignore", ".dockerignore")
 		if err != nil {
 			return err
 		}
-		err = environment.CopyUrlToFile(prototypeResourcesUrl+"/build"+"/start.sh", "start.sh")
+		err = environment.CopyTemplateToFile(prototypeTemplates+"/build"+"/start.sh", "start.sh")
 		if err != nil {
 			return err
 		}
@@ -87,7 +87,7 @@ func createPrototypeDeploymentFiles(branch string, skipDockerFiles bool) error {
 	}
 	ghActionFile := ghDir + "cd-" + branch + ".yaml"
 
-	err = environment.CopyUrlToFile(prototypeResourcesUrl+"/templates"+"/cd.yaml", ghActionFile)
+	err = environment.CopyTemplateToFile(prototypeTemplates+"/templates"+"/cd.yaml", ghActionFile)
 	if err != nil {
 		return err
 	}
@@ -103,7 +103,7 @@ func createPrototypeDeploymentFiles(branch string, skipDockerFiles bool) error {
 		return err
 	}
 
-	err = environment.CopyUrlToFile(prototypeResourcesUrl+"/templates"+"/kubernetes-deploy.tpl", "kubernetes-deploy-"+branch+".tpl")
+	err = environment.CopyTemplateToFile(prototypeTemplates+"/templates"+"/kubernetes-deploy.tpl", "kubernetes-deploy-"+branch+".tpl")
 	if err != nil {
 		return err
 	}
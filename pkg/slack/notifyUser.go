@@ -6,7 +6,9 @@ import (
 	"github.com/slack-go/slack"
 )
 
-func Notify(prNumber, token, webhookUrl, buildUrl string) error {
+// Notify replies to the slack message asking for a review of the PR, telling the author their
+// build failed. hint is added to the message when the cause of the failure is known.
+func Notify(prNumber, token, webhookUrl, buildUrl, hint string) error {
 	slackClient := initSlack(token)
 
 	defaultSearchParams := slack.NewSearchParameters()
@@ -29,13 +31,25 @@ func Notify(prNumber, token, webhookUrl, buildUrl string) error {
 	user := results.Matches[0].User
 	ts := results.Matches[0].Timestamp
 
-	return post(user, ts, webhookUrl, buildUrl)
+	return post(user, ts, webhookUrl, buildUrl, hint)
 }
 
-func PostToAsk(prUrl, webhookUrl string) error {
+// PostToAsk asks #ask-cloud-platform to review a PR fixing the version drift of resources, e.g.
+// "RDS and ElastiCache".
+func PostToAsk(prUrl, resources, webhookUrl string) error {
 	webhookMsg := slack.WebhookMessage{
 		Channel: "ask-cloud-platform",
-		Text:    "RDS Minor version mismatch. PR for review please: " + prUrl,
+		Text:    resources + " version mismatch. PR for review please: " + prUrl,
+	}
+
+	return slack.PostWebhook(webhookUrl, &webhookMsg)
+}
+
+// PostToChannel posts a message to a team's channel, e.g. about a PR for their namespace.
+func PostToChannel(channel, text, webhookUrl string) error {
+	webhookMsg := slack.WebhookMessage{
+		Channel: channel,
+		Text:    text,
 	}
 
 	return slack.PostWebhook(webhookUrl, &webhookMsg)
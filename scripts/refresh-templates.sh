@@ -0,0 +1,42 @@
+#!/bin/sh
+# scripts/refresh-templates.sh
+# Refreshes the templates embedded in the cli from the repository refs pinned in
+# pkg/environment/templates/bundle.yaml. Only the files already in the bundle are copied, as they
+# are at the pinned ref.
+#
+# With --check the bundle is left as it is, and the script fails if it doesn't match the pinned
+# refs.
+set -e
+
+bundle=pkg/environment/templates
+
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+sed -n 's/^  \([a-z0-9-]*\): *"\{0,1\}\([^"]*\)"\{0,1\}$/\1 \2/p' "$bundle/bundle.yaml" | while read -r repo ref; do
+	echo "Fetching $repo@$ref"
+	git init -q "$work/clone/$repo"
+	git -C "$work/clone/$repo" fetch -q --depth 1 "https://github.com/ministryofjustice/$repo" "$ref"
+	git -C "$work/clone/$repo" checkout -q FETCH_HEAD
+
+	(cd "$bundle/$repo" && find . -type f) | while read -r f; do
+		mkdir -p "$(dirname "$work/bundle/$repo/$f")"
+		cp "$work/clone/$repo/$f" "$work/bundle/$repo/$f"
+	done
+done
+
+if [ "$1" = "--check" ]; then
+	if ! diff -r -x bundle.yaml "$work/bundle" "$bundle"; then
+		echo "The embedded templates don't match the refs in $bundle/bundle.yaml, run $0 to refresh them" >&2
+		exit 1
+	fi
+	echo "The embedded templates match the refs in $bundle/bundle.yaml"
+	exit 0
+fi
+
+for dir in "$work"/bundle/*; do
+	repo=$(basename "$dir")
+	rm -rf "${bundle:?}/$repo"
+	cp -R "$dir" "$bundle/$repo"
+done
+echo "Refreshed the embedded templates, check the diff before committing it"